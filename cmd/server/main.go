@@ -5,12 +5,18 @@ import (
 	"github.com/injoyai/frame"
 	"github.com/injoyai/logs"
 	"github.com/injoyai/trategy/internal/api"
+	"github.com/injoyai/trategy/internal/calendar"
 	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
 )
 
 func main() {
 	logs.PanicErr(common.Init())
-	common.Data.Start()
+	logs.PrintErr(common.Calendar.Start(calendar.DefaultSpec))
+	common.WarmCache()
+	if u, ok := common.Data.(data.Updater); ok {
+		u.Start()
+	}
 	port := cfg.GetInt("port", frame.DefaultPort)
 	logs.Err(api.Run(port))
 }
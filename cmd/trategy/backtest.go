@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/injoyai/trategy/internal/backtest"
+	"github.com/injoyai/trategy/internal/fundamental"
+	"github.com/injoyai/trategy/internal/screener"
+	"github.com/injoyai/trategy/internal/sector"
+	"github.com/injoyai/trategy/internal/strategy"
+	"github.com/injoyai/trategy/internal/universe"
+)
+
+// backtestItem 单只股票的回测结果,输出用
+type backtestItem struct {
+	Code   string           `json:"code"`
+	Result *backtest.Result `json:"result,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+// backtestCmd 回测一只或多只股票,code为all时回测全市场
+func backtestCmd(args []string) error {
+	fs := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	req := new(backtest.Request)
+	codes := fs.String("code", "", "股票代码,多个用逗号分隔,all表示全市场")
+	fs.StringVar(&req.Strategy, "strategy", "", "策略名称")
+	fs.StringVar(&req.Type, "type", "", "全市场回测的品种: stock, index, etf, bond, fund")
+	fs.StringVar(&req.Universe, "universe", "", "全市场回测的股票池名称,设置后忽略type")
+	fs.StringVar(&req.Interval, "interval", "", "K线周期: day, min,默认day")
+	fs.StringVar(&req.Benchmark, "benchmark", "", "基准,指数代码例sh000300,或板块指数例sector:银行")
+	fs.StringVar(&req.Start, "start", "", "开始日期,例2020-01-01")
+	fs.StringVar(&req.End, "end", "", "结束日期,例2024-12-31")
+	fs.Float64Var(&req.Cash, "cash", 0, "初始资金,默认100000")
+	fs.IntVar(&req.Size, "size", 0, "每次交易的股数,0为一手,向下取整到整手,不足一手按一手")
+	fs.Float64Var(&req.FeeRate, "fee-rate", 0, "手续费率,默认0.0005")
+	fs.Float64Var(&req.MinFee, "min-fee", 0, "最低手续费,默认5")
+	fs.Float64Var(&req.Slippage, "slippage", 0, "滑点")
+	fs.Float64Var(&req.StopLoss, "stop-loss", 0, "止损比例")
+	fs.Float64Var(&req.TakeProfit, "take-profit", 0, "止盈比例")
+	fs.IntVar(&req.Goroutines, "goroutines", 0, "全市场回测的并发数量")
+	format := fs.String("format", "text", "输出格式: text, json, csv")
+	output := fs.String("o", "", "输出文件,默认标准输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if req.Strategy == "" {
+		return errors.New("缺少策略名称")
+	}
+	if *codes == "" {
+		return errors.New("缺少股票代码")
+	}
+	if err := load(); err != nil {
+		return err
+	}
+
+	w, closer, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	if *codes == "all" {
+		return backtestAll(w, req, *format)
+	}
+
+	items := []backtestItem(nil)
+	failed := 0
+	for _, code := range strings.Split(*codes, ",") {
+		r := *req
+		r.Code = strings.TrimSpace(code)
+		res, err := backtest.Run(&r)
+		item := backtestItem{Code: r.Code, Result: res}
+		if err != nil {
+			item.Error = err.Error()
+			failed++
+		}
+		items = append(items, item)
+	}
+
+	switch *format {
+	case "json":
+		err = writeJSON(w, items)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"code", "id", "return", "max_drawdown", "sharpe", "trades", "error"})
+		for _, v := range items {
+			if v.Result == nil {
+				cw.Write([]string{v.Code, "", "", "", "", "", v.Error})
+				continue
+			}
+			cw.Write([]string{
+				v.Code,
+				strconv.FormatInt(v.Result.ID, 10),
+				strconv.FormatFloat(v.Result.Return, 'f', 6, 64),
+				strconv.FormatFloat(v.Result.MaxDD, 'f', 6, 64),
+				strconv.FormatFloat(v.Result.Sharpe, 'f', 4, 64),
+				strconv.Itoa(len(v.Result.Trades)),
+				"",
+			})
+		}
+		cw.Flush()
+		err = cw.Error()
+	default:
+		for _, v := range items {
+			if v.Result == nil {
+				fmt.Fprintf(w, "%-10s 失败: %s\n", v.Code, v.Error)
+				continue
+			}
+			fmt.Fprintf(w, "%-10s #%-6d 收益 %8.2f%%  回撤 %7.2f%%  Sharpe %6.2f  交易 %d\n",
+				v.Code, v.Result.ID, v.Result.Return*100, v.Result.MaxDD*100, v.Result.Sharpe, len(v.Result.Trades))
+			if req.Benchmark != "" {
+				fmt.Fprintf(w, "%-10s 基准收益 %8.2f%%  超额 %8.2f%%\n", "", v.Result.BenchmarkReturn*100, v.Result.Excess*100)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d只股票回测失败", failed)
+	}
+	return nil
+}
+
+func backtestAll(w io.Writer, req *backtest.Request, format string) error {
+	res, err := backtest.RunAll(context.Background(), req, nil, func(p backtest.Progress) {
+		fmt.Fprintf(os.Stderr, "\r回测进度 %d/%d", p.Done, p.Total)
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		return writeJSON(w, res)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"code", "name", "return", "max_drawdown", "sharpe", "error"})
+		for _, v := range append(res.Items, res.Failed...) {
+			cw.Write([]string{
+				v.Code, v.Name,
+				strconv.FormatFloat(v.Return, 'f', 6, 64),
+				strconv.FormatFloat(v.MaxDrawdown, 'f', 6, 64),
+				strconv.FormatFloat(v.Sharpe, 'f', 4, 64),
+				v.Error,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		fmt.Fprintf(w, "回测记录 #%d, 成功 %d/%d\n", res.ID, res.Count, res.Total)
+		fmt.Fprintf(w, "平均收益 %.2f%%  中位收益 %.2f%%  胜率 %.2f%%\n", res.AvgReturn*100, res.MedianReturn*100, res.WinRate*100)
+		fmt.Fprintf(w, "平均回撤 %.2f%%  平均Sharpe %.2f\n", res.AvgMaxDrawdown*100, res.AvgSharpe)
+		fmt.Fprintf(w, "收益分位 P5 %.2f%%  P25 %.2f%%  P75 %.2f%%  P95 %.2f%%\n",
+			res.P5Return*100, res.P25Return*100, res.P75Return*100, res.P95Return*100)
+		if req.Benchmark != "" {
+			fmt.Fprintf(w, "基准收益 %.2f%%\n", res.Benchmark*100)
+		}
+		return nil
+	}
+}
+
+// load 同步数据表并注册保存的策略,回测和选股前调用
+func load() error {
+	if err := strategy.Sync(); err != nil {
+		return err
+	}
+	if err := backtest.Sync(); err != nil {
+		return err
+	}
+	if err := sector.Sync(); err != nil {
+		return err
+	}
+	if err := fundamental.Sync(); err != nil {
+		return err
+	}
+	if err := screener.Sync(); err != nil {
+		return err
+	}
+	if err := universe.Sync(); err != nil {
+		return err
+	}
+	return strategy.Load()
+}
+
+// openOutput 打开输出文件,未指定时使用标准输出
+func openOutput(filename string) (io.Writer, func(), error) {
+	if filename == "" {
+		return os.Stdout, func() {}, nil
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
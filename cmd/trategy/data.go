@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/injoyai/tdx/extend"
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/fundamental"
+	"github.com/injoyai/trategy/internal/sector"
+)
+
+func dataCmd(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少子命令: export, import, audit, migrate, bench, sector, fundamental, tick")
+	}
+	switch args[0] {
+	case "migrate":
+		return dataMigrate(args[1:])
+	case "bench":
+		return dataBench(args[1:])
+	case "audit":
+		return dataAudit(args[1:])
+	case "export":
+		return dataExport(args[1:])
+	case "import":
+		return dataImport(args[1:])
+	case "sector":
+		return dataSector(args[1:])
+	case "fundamental":
+		return dataFundamental(args[1:])
+	case "tick":
+		return dataTick(args[1:])
+	default:
+		return fmt.Errorf("未知的子命令: %s", args[0])
+	}
+}
+
+// dataExport 导出K线,默认每只股票一个文件,-long时导出到一个长表文件
+func dataExport(args []string) error {
+	fs := flag.NewFlagSet("data export", flag.ContinueOnError)
+	req := new(data.ExportReq)
+	codes := fs.String("code", "", "股票代码,多个用逗号分隔,all表示全部股票")
+	fs.StringVar(&req.Type, "type", "day", "K线类型: day, min")
+	fs.StringVar(&req.Start, "start", "", "开始日期,默认1990-01-01")
+	fs.StringVar(&req.End, "end", "", "结束日期,默认今天")
+	fs.StringVar(&req.Adjust, "adjust", "", "复权方式: qfq, hfq,默认不复权")
+	fs.StringVar(&req.Format, "format", data.ExportCSV, "导出格式: csv, jsonl, parquet")
+	long := fs.Bool("long", false, "导出到一个文件,-o为文件名")
+	output := fs.String("o", ".", "输出目录,-long时为输出文件")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *codes == "all" {
+		req.Codes = common.Data.GetStockCodes()
+	} else {
+		req.Codes = data.ParseCodes(*codes)
+	}
+	if err := req.Check(); err != nil {
+		return err
+	}
+
+	if *long {
+		filename := *output
+		if filename == "." {
+			filename = req.Filename()
+		}
+		f, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		res, err := data.Export(common.Data, req, f)
+		if err != nil {
+			return err
+		}
+		for _, v := range res.Skipped {
+			fmt.Println("跳过:", v)
+		}
+		fmt.Printf("导出%d只股票,%d根K线到%s\n", res.Codes, res.Klines, filename)
+		return nil
+	}
+
+	if err := os.MkdirAll(*output, 0o755); err != nil {
+		return err
+	}
+	start, end, _ := req.Range()
+	for _, code := range req.Codes {
+		ks, err := data.LoadKlines(common.Data, code, req.Type, req.Adjust, start, end)
+		if err != nil {
+			//没有数据的股票跳过,不影响其他股票
+			fmt.Printf("%s 跳过: %v\n", code, err)
+			continue
+		}
+		filename := filepath.Join(*output, code+"."+req.Format)
+		if err = exportFile(filename, req.Format, code, ks); err != nil {
+			return err
+		}
+		fmt.Printf("%s 导出%d条到%s\n", code, len(ks), filename)
+	}
+	return nil
+}
+
+func exportFile(filename, format, code string, ks protocol.Klines) error {
+	name := common.Data.GetName(code)
+	if format == data.ExportCSV {
+		return extend.KlinesToCsv(filename, code, name, ks)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	e, err := data.NewExporter(format, f)
+	if err != nil {
+		return err
+	}
+	if err = e.Write(code, name, ks); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+// dataImport 导入csv和通达信数据文件,参数是目录时导入目录下所有支持的文件
+func dataImport(args []string) error {
+	fs := flag.NewFlagSet("data import", flag.ContinueOnError)
+	dir := fs.String("dir", "", "数据目录,默认当前数据源的目录")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("缺少导入文件或目录")
+	}
+	if *dir == "" {
+		var err error
+		if *dir, err = data.StoreDir(common.Data); err != nil {
+			return err
+		}
+	}
+
+	files := []string(nil)
+	for _, v := range fs.Args() {
+		err := filepath.WalkDir(v, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".csv", ".day", ".lc1", ".lc5":
+				if !d.IsDir() {
+					files = append(files, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, filename := range files {
+		results, err := data.ImportFile(*dir, filename)
+		if err != nil {
+			failed++
+			fmt.Printf("%s 失败: %v\n", filename, err)
+			continue
+		}
+		for _, r := range results {
+			fmt.Printf("%s %s 共%d条,新增%d条,重复%d条,无效%d条\n", r.Code, r.Type, r.Total, r.Inserted, r.Duplicate, r.Invalid)
+			for _, e := range r.Errors {
+				fmt.Printf("      %s\n", e)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d个文件导入失败", failed)
+	}
+	return nil
+}
+
+// dataAudit 检查数据,发现问题时返回错误
+func dataAudit(args []string) error {
+	fs := flag.NewFlagSet("data audit", flag.ContinueOnError)
+	req := new(data.AuditReq)
+	codes := fs.String("code", "", "股票代码,多个用逗号分隔,默认全部股票")
+	fs.StringVar(&req.Start, "start", "", "只检查这天之后的数据")
+	fs.IntVar(&req.StaleDays, "stale-days", 1, "最后一根K线落后超过n个交易日认为过期")
+	fs.BoolVar(&req.Repair, "repair", false, "重新拉取有问题的区间")
+	format := fs.String("format", "text", "输出格式: text, json")
+	output := fs.String("o", "", "输出文件,默认标准输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	req.Codes = data.ParseCodes(*codes)
+	report, err := data.Audit(context.Background(), common.Data, common.Calendar, req, func(done, total int) {
+		fmt.Fprintf(os.Stderr, "\r检查进度 %d/%d", done, total)
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	w, closer, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	if *format == "json" {
+		err = writeJSON(w, report)
+	} else {
+		for _, item := range report.Items {
+			fmt.Fprintf(w, "%s %s K线%d根\n", item.Code, item.Name, item.Bars)
+			for _, v := range item.Issues {
+				fmt.Fprintf(w, "  %-10s %s ~ %s  %s\n", v.Kind, v.Start.Format(time.DateOnly), v.End.Format(time.DateOnly), v.Message)
+			}
+			if item.Repaired {
+				fmt.Fprintln(w, "  已修复")
+			} else if item.Error != "" {
+				fmt.Fprintln(w, "  修复失败:", item.Error)
+			}
+		}
+		fmt.Fprintf(w, "共检查%d只,有问题%d只 %v\n", report.Total, report.Problem, report.Counts)
+	}
+	if err != nil {
+		return err
+	}
+	if report.Problem > 0 && !req.Repair {
+		return fmt.Errorf("%d只股票数据有问题", report.Problem)
+	}
+	return nil
+}
+
+// storeDir 命令行指定的数据目录,默认当前数据源的目录
+func storeDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	return data.StoreDir(common.Data)
+}
+
+// dataMigrate 把每个股票一个文件的日线迁移到合并数据库
+func dataMigrate(args []string) error {
+	fs := flag.NewFlagSet("data migrate", flag.ContinueOnError)
+	dir := fs.String("dir", "", "数据目录,默认当前数据源的目录")
+	remove := fs.Bool("remove", false, "迁移成功后删除原来的文件")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	d, err := storeDir(*dir)
+	if err != nil {
+		return err
+	}
+	res, err := data.Migrate(d, *remove, func(done, total int) {
+		fmt.Fprintf(os.Stderr, "\r迁移进度 %d/%d", done, total)
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+	for _, v := range res.Failed {
+		fmt.Println("失败:", v)
+	}
+	fmt.Printf("迁移%d只股票,%d根K线,耗时%s\n", res.Codes, res.Klines, res.Spend)
+	if len(res.Failed) > 0 {
+		return fmt.Errorf("%d只股票迁移失败", len(res.Failed))
+	}
+	return nil
+}
+
+// dataBench 对比两种存储方式读取全市场日线的耗时
+func dataBench(args []string) error {
+	fs := flag.NewFlagSet("data bench", flag.ContinueOnError)
+	dir := fs.String("dir", "", "数据目录,默认当前数据源的目录")
+	start := fs.String("start", time.Now().AddDate(-1, 0, 0).Format(time.DateOnly), "开始日期,默认一年前")
+	end := fs.String("end", "", "结束日期,默认今天")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	d, err := storeDir(*dir)
+	if err != nil {
+		return err
+	}
+	s, err := time.ParseInLocation(time.DateOnly, *start, time.Local)
+	if err != nil {
+		return err
+	}
+	e := time.Now()
+	if *end != "" {
+		if e, err = time.ParseInLocation(time.DateOnly, *end, time.Local); err != nil {
+			return err
+		}
+	}
+	results, err := data.Bench(d, s, e)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		fmt.Printf("%-10s %6d只 %9d根 %s\n", r.Name, r.Codes, r.Klines, r.Spend)
+	}
+	return nil
+}
+
+// dataSector 导入板块文件,通达信的block_*.dat,tdxhy.cfg和incon.dat,或csv
+func dataSector(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少板块文件")
+	}
+	if err := sector.Sync(); err != nil {
+		return err
+	}
+	files := map[string]io.Reader{}
+	for _, filename := range args {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		files[filename] = f
+	}
+	res, err := sector.Import(files)
+	if err != nil {
+		return err
+	}
+	for _, v := range res {
+		fmt.Printf("%s: 板块 %d 成分股 %d\n", v.File, v.Sectors, v.Members)
+	}
+	return nil
+}
+
+// dataFundamental 导入财报文件,通达信的gpcw*.zip/gpcw*.dat或csv,-download按报告期从通达信下载
+func dataFundamental(args []string) error {
+	fs := flag.NewFlagSet("data fundamental", flag.ContinueOnError)
+	download := fs.String("download", "", "下载的报告期,多个用逗号分隔,例20231231,20240331")
+	shares := fs.Bool("shares", false, "同步全部股票的股本变迁")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 && *download == "" && !*shares {
+		return errors.New("缺少财务文件")
+	}
+	if err := fundamental.Sync(); err != nil {
+		return err
+	}
+
+	results := []*fundamental.ImportResult(nil)
+	for _, s := range data.ParseCodes(*download) {
+		period, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("报告期格式错误: %s", s)
+		}
+		res, err := fundamental.Download(period)
+		if err != nil {
+			return err
+		}
+		results = append(results, res)
+	}
+	if fs.NArg() > 0 {
+		files := map[string]io.Reader{}
+		for _, filename := range fs.Args() {
+			f, err := os.Open(filename)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			files[filename] = f
+		}
+		res, err := fundamental.Import(files)
+		if err != nil {
+			return err
+		}
+		results = append(results, res...)
+	}
+	for _, v := range results {
+		fmt.Printf("%s: 报告期 %d 财报 %d\n", v.File, v.Period, v.Reports)
+	}
+
+	if *shares {
+		n, err := fundamental.SyncSharesAll(context.Background(), common.Data, func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\r同步股本 %d/%d", done, total)
+		})
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("同步股本 %d只\n", n)
+	}
+	return nil
+}
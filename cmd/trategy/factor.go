@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/injoyai/trategy/internal/screener"
+)
+
+// factorCmd 管理选股因子
+func factorCmd(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少子命令: list, save, del")
+	}
+	if err := screener.Sync(); err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		ls, err := screener.Factors()
+		if err != nil {
+			return err
+		}
+		for _, v := range ls {
+			fmt.Printf("%-16s %-10s 权重 %6.2f  %s\n", v.Name, v.Type, v.Weight, factorDesc(v))
+		}
+		return nil
+	case "save":
+		return factorSave(args[1:])
+	case "del":
+		if len(args) < 2 {
+			return errors.New("缺少因子名称")
+		}
+		return screener.DelFactor(args[1:]...)
+	default:
+		return fmt.Errorf("未知的子命令: %s", args[0])
+	}
+}
+
+func factorSave(args []string) error {
+	fs := flag.NewFlagSet("factor save", flag.ContinueOnError)
+	f := new(screener.Factor)
+	fs.StringVar(&f.Name, "name", "", "因子名称")
+	fs.StringVar(&f.Type, "type", "", "因子类型: momentum, volatility, liquidity, value, expr, script")
+	fs.IntVar(&f.Period, "period", 0, "计算周期,默认20")
+	fs.StringVar(&f.Key, "key", "", "基本面字段,类型为value时使用: pe, pb, ps, roe, eps, cap, float_cap")
+	fs.StringVar(&f.Expr, "expr", "", "表达式,类型为expr时使用")
+	script := fs.String("script", "", "脚本文件,类型为script时使用,不含package声明,声明func Value(ks protocol.Klines) []float64")
+	fs.StringVar(&f.Standard, "standard", "", "标准化方式: zscore, rank,默认zscore")
+	fs.Float64Var(&f.Winsorize, "winsorize", 0, "去极值的分位数,例0.05")
+	fs.Float64Var(&f.Weight, "weight", 1, "权重,负数表示越小越好")
+	fs.StringVar(&f.Memo, "memo", "", "备注")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *script != "" {
+		bs, err := os.ReadFile(*script)
+		if err != nil {
+			return err
+		}
+		f.Script = string(bs)
+	}
+	return screener.SaveFactor(f)
+}
+
+// factorDesc 因子的参数说明
+func factorDesc(f *screener.Factor) string {
+	s := ""
+	switch f.Type {
+	case screener.FactorValue:
+		s = f.Key
+	case screener.FactorExpr:
+		s = f.Expr
+	case screener.FactorScript:
+		s = "脚本"
+		if f.Period > 0 {
+			s += fmt.Sprintf(" 周期 %d", f.Period)
+		}
+	default:
+		s = "默认周期"
+		if f.Period > 0 {
+			s = fmt.Sprintf("周期 %d", f.Period)
+		}
+	}
+	if f.Standard != "" {
+		s += " " + f.Standard
+	}
+	if f.Winsorize > 0 {
+		s += fmt.Sprintf(" 去极值 %g", f.Winsorize)
+	}
+	return s
+}
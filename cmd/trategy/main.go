@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/injoyai/logs"
+	"github.com/injoyai/trategy/internal/common"
+)
+
+// command 子命令,args为去掉子命令名后的参数
+type command struct {
+	Usage string
+	Run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"backtest": {Usage: "backtest -strategy <name> -code <codes|all> [-universe name] [-start date] [-end date] [-format text|json|csv] [-o file] ...", Run: backtestCmd},
+	"universe": {Usage: "universe list | save -name <name> [-types types] [-boards main,gem,star,bj] [-sector names] [-exclude-sector names] [-exclude-st] [-exclude-suspended] [-min-list-days n] [-min-amount x] [-amount-days n] [-memo s] | codes [-date date] <name> | del <names...>", Run: universeCmd},
+	"update":   {Usage: "update [-force]", Run: updateCmd},
+	"screen":   {Usage: "screen [-strategy name] [-universe name] [-lookback n] [-min-score x] [-signal n] [-sector names] [-sector-min-return x] [-min-cap x] [-max-cap x] [-min-pe x] [-max-pe x] [-max-pb x] [-min-roe x] [-expr expr] [-partial] [-factor names] [-limit n] [-save name [-schedule spec]] [-run name] [-format text|json|csv] [-o file]", Run: screenCmd},
+	"data":     {Usage: "data export -code <codes|all> [-type day|min] [-start date] [-end date] [-adjust qfq|hfq] [-format csv|jsonl|parquet] [-long] [-o path] | import [-dir dir] <files|dirs...> | audit [-code codes] [-start date] [-repair] [-format text|json] | migrate [-dir dir] [-remove] | bench [-dir dir] [-start date] [-end date] | sector <block_*.dat|tdxhy.cfg incon.dat|csv...> | fundamental [-download periods] [-shares] [gpcw*.zip|gpcw*.dat|csv...] | tick watch|fetch|replay [-code codes] [-start date] [-end date] [-del] [-save]", Run: dataCmd},
+	"factor":   {Usage: "factor list | save -name <name> -type momentum|volatility|liquidity|value|expr|script [-period n] [-key k] [-expr expr] [-script file] [-standard zscore|rank] [-winsorize x] [-weight x] [-memo s] | del <names...>", Run: factorCmd},
+	"report":   {Usage: "report [-format html|json|trades|equity] [-o file] <id>", Run: reportCmd},
+	"strategy": {Usage: "strategy list | validate <name|file.go> | test <name> | export [-o file] [names...] | import [-overwrite] <file>", Run: strategyCmd},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := common.Init(); err != nil {
+		logs.Err(err)
+		os.Exit(1)
+	}
+	if err := cmd.Run(os.Args[2:]); err != nil {
+		logs.Err(err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for k := range commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "用法: trategy <command> [arguments]")
+	for _, k := range names {
+		fmt.Fprintln(os.Stderr, "  "+commands[k].Usage)
+	}
+}
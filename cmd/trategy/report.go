@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/injoyai/trategy/internal/backtest"
+)
+
+// reportCmd 把回测记录导出为报告文件
+func reportCmd(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	format := fs.String("format", backtest.ReportHTML, "报告格式: html, json, trades, equity")
+	output := fs.String("o", "", "输出文件,默认使用报告文件名")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("缺少回测记录ID")
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("无效的回测记录ID: %s", fs.Arg(0))
+	}
+	if err := backtest.Sync(); err != nil {
+		return err
+	}
+	h, err := backtest.GetHistory(id)
+	if err != nil {
+		return err
+	}
+	name, bs, err := h.Report(*format)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		name = *output
+	}
+	if err := os.WriteFile(name, bs, 0644); err != nil {
+		return err
+	}
+	fmt.Println("报告已生成:", name)
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/screener"
+)
+
+// screenCmd 按策略选股
+func screenCmd(args []string) error {
+	fs := flag.NewFlagSet("screen", flag.ContinueOnError)
+	req := screener.Request{}
+	fs.StringVar(&req.Strategy, "strategy", "", "策略名称,默认SMA(5,20)")
+	fs.IntVar(&req.Lookback, "lookback", 0, "计算得分的K线数量,默认10")
+	fs.Float64Var(&req.MinScore, "min-score", 0, "最低得分")
+	fs.IntVar(&req.Signal, "signal", 0, "只保留最后信号为该值的股票,1买入,-1卖出")
+	fs.StringVar(&req.Universe, "universe", "", "股票池名称")
+	sectors := fs.String("sector", "", "只选这些板块的成分股,多个用逗号分隔")
+	fs.Float64Var(&req.SectorMinReturn, "sector-min-return", 0, "板块指数在lookback内的最低涨幅")
+	filter := new(screener.Filter)
+	fs.Float64Var(&filter.MinCap, "min-cap", 0, "最小总市值,亿")
+	fs.Float64Var(&filter.MaxCap, "max-cap", 0, "最大总市值,亿")
+	fs.Float64Var(&filter.MinPE, "min-pe", 0, "最小市盈率TTM")
+	fs.Float64Var(&filter.MaxPE, "max-pe", 0, "最大市盈率TTM")
+	fs.Float64Var(&filter.MaxPB, "max-pb", 0, "最大市净率")
+	fs.Float64Var(&filter.MinROE, "min-roe", 0, "最小净资产收益率,%")
+	fs.StringVar(&req.Expr, "expr", "", "条件表达式,例 \"close > ma(close,60) and rsi(14) < 30 and amount > 1e8\"")
+	fs.BoolVar(&req.Partial, "partial", false, "同时输出只满足部分条件的股票")
+	factors := fs.String("factor", "", "按保存的因子打分,多个用逗号分隔,可以用name:weight覆盖权重")
+	limit := fs.Int("limit", 0, "最多输出数量,保存时为保存结果的数量")
+	save := fs.String("save", "", "按名称保存选股条件,不执行")
+	schedule := fs.String("schedule", "", "保存时的定时,6位cron表达式,空为每个交易日")
+	run := fs.String("run", "", "执行保存的选股并记录结果,忽略其他条件")
+	format := fs.String("format", "text", "输出格式: text, json, csv")
+	output := fs.String("o", "", "输出文件,默认标准输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := load(); err != nil {
+		return err
+	}
+	req.Sectors = data.ParseCodes(*sectors)
+	for _, v := range data.ParseCodes(*factors) {
+		name, weight, _ := strings.Cut(v, ":")
+		f := &screener.Factor{Name: name}
+		if weight != "" {
+			w, err := strconv.ParseFloat(weight, 64)
+			if err != nil {
+				return fmt.Errorf("因子[%s]的权重无效: %v", name, err)
+			}
+			f.Weight = w
+		}
+		req.Factors = append(req.Factors, f)
+	}
+	if *filter != (screener.Filter{}) {
+		req.Fundamental = filter
+	}
+	if *save != "" {
+		return screener.SaveScreen(&screener.Screen{Name: *save, Request: req, Schedule: *schedule, Enable: true, Limit: *limit})
+	}
+	var items []screener.Item
+	var res *screener.ScreenRun
+	var err error
+	if *run != "" {
+		if res, err = screener.RunScreen(*run); err != nil {
+			return err
+		}
+		items = res.Items
+	} else if items, err = screener.Run(req); err != nil {
+		return err
+	}
+	if *limit > 0 && len(items) > *limit {
+		items = items[:*limit]
+	}
+
+	w, closer, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	switch *format {
+	case "json":
+		if res != nil {
+			return writeJSON(w, res)
+		}
+		return writeJSON(w, items)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"code", "name", "score", "price", "signal", "passed", "conditions", "factors"})
+		for _, v := range items {
+			cw.Write([]string{
+				v.Symbol,
+				common.Data.GetName(v.Symbol),
+				strconv.FormatFloat(v.Score, 'f', 6, 64),
+				strconv.FormatFloat(v.Price.Float64(), 'f', 3, 64),
+				strconv.Itoa(v.Signal),
+				strconv.Itoa(v.Passed),
+				conditions(v.Conditions),
+				factorScores(v.Factors),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		for _, v := range items {
+			fmt.Fprintf(w, "%-10s %-10s 得分 %8.4f  价格 %8.3f  信号 %d",
+				v.Symbol, common.Data.GetName(v.Symbol), v.Score, v.Price.Float64(), v.Signal)
+			if len(v.Conditions) > 0 {
+				fmt.Fprintf(w, "  条件 %d/%d %s", v.Passed, len(v.Conditions), conditions(v.Conditions))
+			}
+			if len(v.Factors) > 0 {
+				fmt.Fprintf(w, "  因子 %s", factorScores(v.Factors))
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "共%d只\n", len(items))
+		if res != nil {
+			fmt.Fprintf(w, "新进入 %d只: %s\n", len(res.Entered), strings.Join(res.Entered, ","))
+			fmt.Fprintf(w, "离开 %d只: %s\n", len(res.Left), strings.Join(res.Left, ","))
+		}
+		return nil
+	}
+}
+
+// conditions 条件结果,满足的前面加+,不满足的加-
+func conditions(cs []screener.Condition) string {
+	ls := make([]string, len(cs))
+	for i, c := range cs {
+		ls[i] = "-" + c.Expr
+		if c.Pass {
+			ls[i] = "+" + c.Expr
+		}
+	}
+	return strings.Join(ls, "; ")
+}
+
+// factorScores 每个因子的贡献,没有数据的显示为-
+func factorScores(ls []screener.FactorScore) string {
+	out := make([]string, len(ls))
+	for i, v := range ls {
+		out[i] = v.Name + "=-"
+		if !v.Missing {
+			out[i] = fmt.Sprintf("%s=%.4f", v.Name, v.Contribution)
+		}
+	}
+	return strings.Join(out, "; ")
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/strategy"
+)
+
+func strategyCmd(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少子命令: list, validate, test, export, import")
+	}
+	if err := strategy.Sync(); err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		return strategyList()
+	case "validate":
+		return strategyValidate(args[1:])
+	case "test":
+		return strategyTest(args[1:])
+	case "export":
+		return strategyExport(args[1:])
+	case "import":
+		return strategyImport(args[1:])
+	default:
+		return fmt.Errorf("未知的子命令: %s", args[0])
+	}
+}
+
+// strategyList 列出已注册的策略和未启用的脚本策略
+func strategyList() error {
+	if err := strategy.Load(); err != nil {
+		return err
+	}
+	scripts := []*strategy.Strategy(nil)
+	if err := common.DB.Find(&scripts); err != nil {
+		return err
+	}
+	kind := map[string]string{}
+	for _, v := range scripts {
+		kind[v.Name] = "脚本(未启用)"
+	}
+	for _, v := range scripts {
+		if v.Enable && strategy.Get(v.Name) != nil {
+			kind[v.Name] = "脚本"
+		}
+	}
+	for _, name := range strategy.Registry() {
+		if _, ok := kind[name]; ok {
+			continue
+		}
+		if _, ok := strategy.Get(name).(*strategy.Combine); ok {
+			kind[name] = "组合"
+		} else {
+			kind[name] = "内置"
+		}
+	}
+	names := make([]string, 0, len(kind))
+	for k := range kind {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-20s %s\n", name, kind[name])
+	}
+	return nil
+}
+
+// strategyValidate 编译策略并执行测试用例,参数是.go文件时从文件读取
+func strategyValidate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少策略名称或文件")
+	}
+	var s *strategy.Strategy
+	var err error
+	if strings.HasSuffix(args[0], ".go") {
+		name := strings.TrimSuffix(filepath.Base(args[0]), ".go")
+		s, err = strategy.ParseFile(name, args[0])
+	} else {
+		s, err = getStrategy(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = strategy.Compile(s); err != nil {
+		return fmt.Errorf("策略[%s]编译失败: %v", s.Name, err)
+	}
+	fmt.Printf("策略[%s]编译通过\n", s.Name)
+	return runCases(s)
+}
+
+// strategyTest 执行策略的测试用例,有失败的用例则返回错误
+func strategyTest(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少策略名称")
+	}
+	s, err := getStrategy(args[0])
+	if err != nil {
+		return err
+	}
+	return runCases(s)
+}
+
+func runCases(s *strategy.Strategy) error {
+	results, err := strategy.TestCases(s)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, v := range results {
+		if v.Pass {
+			fmt.Printf("PASS  %s\n", v.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL  %s\n", v.Name)
+		for _, e := range v.Errors {
+			fmt.Printf("      %s\n", e)
+		}
+	}
+	fmt.Printf("共%d个用例,失败%d个\n", len(results), failed)
+	if failed > 0 {
+		return fmt.Errorf("策略[%s]测试未通过", s.Name)
+	}
+	return nil
+}
+
+func getStrategy(name string) (*strategy.Strategy, error) {
+	s := new(strategy.Strategy)
+	has, err := common.DB.Where("Name=?", name).Get(s)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, fmt.Errorf("策略[%s]不存在", name)
+	}
+	return s, nil
+}
+
+// strategyExport 导出策略到文件,未指定名称时导出全部
+func strategyExport(args []string) error {
+	fs := flag.NewFlagSet("strategy export", flag.ContinueOnError)
+	output := fs.String("o", "strategy.json", "导出文件")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	b, err := strategy.Export(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	bs, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(*output, bs, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("导出%d个脚本策略,%d个组合策略到%s\n", len(b.Strategies), len(b.Composites), *output)
+	return nil
+}
+
+// strategyImport 从文件导入策略
+func strategyImport(args []string) error {
+	fs := flag.NewFlagSet("strategy import", flag.ContinueOnError)
+	overwrite := fs.Bool("overwrite", false, "覆盖同名策略")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("缺少导入文件")
+	}
+	bs, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b := new(strategy.Bundle)
+	if err = json.Unmarshal(bs, b); err != nil {
+		return err
+	}
+	if err = strategy.Import(b, *overwrite); err != nil {
+		return err
+	}
+	fmt.Printf("导入%d个脚本策略,%d个组合策略\n", len(b.Strategies), len(b.Composites))
+	return nil
+}
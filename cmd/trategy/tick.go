@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/tick"
+)
+
+// dataTick 管理分笔采集: watch查看或修改采集列表,fetch补采分笔成交,replay合成分钟线
+func dataTick(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少子命令: watch, fetch, replay")
+	}
+	if err := tick.Sync(); err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("data tick "+args[0], flag.ContinueOnError)
+	codes := fs.String("code", "", "代码,多个用逗号分隔,fetch默认采集列表")
+	start := fs.String("start", "", "开始日期,默认今天")
+	end := fs.String("end", "", "结束日期,默认今天")
+	del := fs.Bool("del", false, "watch时从采集列表删除")
+	save := fs.Bool("save", false, "replay时写入分钟线")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	s, e, err := tickRange(*start, *end)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "watch":
+		if ls := data.ParseCodes(*codes); len(ls) > 0 {
+			if *del {
+				err = tick.DelWatch(ls...)
+			} else {
+				err = tick.AddWatch(ls...)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		ls, err := tick.Watches()
+		if err != nil {
+			return err
+		}
+		for _, code := range ls {
+			fmt.Println(code, common.Data.GetName(code))
+		}
+		fmt.Printf("共%d只\n", len(ls))
+		return nil
+
+	case "fetch":
+		ls := data.ParseCodes(*codes)
+		if len(ls) == 0 {
+			if ls, err = tick.Watches(); err != nil {
+				return err
+			}
+		}
+		res, err := tick.FetchRange(context.Background(), common.Data, ls, s, e, func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\r采集进度 %d/%d", done, total)
+		})
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		for _, v := range res.Errors {
+			fmt.Println("失败:", v)
+		}
+		fmt.Printf("采集%d天, 分笔%d条\n", res.Days, res.Ticks)
+		return nil
+
+	case "replay":
+		ls := data.ParseCodes(*codes)
+		if len(ls) == 0 {
+			return errors.New("缺少代码")
+		}
+		for _, code := range ls {
+			if *save {
+				res, err := tick.ReplayImport(common.Data, code, s, e)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s 分钟线%d根, 新增%d, 已存在%d, 无效%d\n", code, res.Total, res.Inserted, res.Duplicate, res.Invalid)
+				continue
+			}
+			ks, err := tick.Replay(code, s, e)
+			if err != nil {
+				return err
+			}
+			for _, k := range ks {
+				fmt.Printf("%s %s %s %8.3f %8.3f %8.3f %8.3f %10d\n", code, k.Time.Format(time.DateOnly), k.Time.Format("15:04"),
+					k.Open.Float64(), k.High.Float64(), k.Low.Float64(), k.Close.Float64(), k.Volume)
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("未知的子命令: %s", args[0])
+	}
+}
+
+// tickRange 解析日期区间,默认今天,结束日期包含当天
+func tickRange(start, end string) (time.Time, time.Time, error) {
+	now := time.Now()
+	s := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	e := s
+	var err error
+	if start != "" {
+		if s, err = time.ParseInLocation(time.DateOnly, start, time.Local); err != nil {
+			return s, e, err
+		}
+	}
+	if end != "" {
+		if e, err = time.ParseInLocation(time.DateOnly, end, time.Local); err != nil {
+			return s, e, err
+		}
+	}
+	return s, e.AddDate(0, 0, 1).Add(-time.Second), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/universe"
+)
+
+// universeCmd 管理股票池
+func universeCmd(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少子命令: list, save, codes, del")
+	}
+	if err := universe.Sync(); err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		ls, err := universe.List()
+		if err != nil {
+			return err
+		}
+		for _, v := range ls {
+			fmt.Printf("%-16s %s\n", v.Name, universeDesc(v))
+		}
+		return nil
+	case "save":
+		return universeSave(args[1:])
+	case "codes":
+		return universeCodes(args[1:])
+	case "del":
+		if len(args) < 2 {
+			return errors.New("缺少股票池名称")
+		}
+		return universe.Del(args[1:]...)
+	default:
+		return fmt.Errorf("未知的子命令: %s", args[0])
+	}
+}
+
+func universeSave(args []string) error {
+	fs := flag.NewFlagSet("universe save", flag.ContinueOnError)
+	u := new(universe.Universe)
+	fs.StringVar(&u.Name, "name", "", "股票池名称")
+	types := fs.String("types", "", "品种,多个用逗号分隔,默认stock")
+	boards := fs.String("boards", "", "交易板块,多个用逗号分隔: main, gem, star, bj")
+	sectors := fs.String("sector", "", "只选这些板块或指数的成分股,多个用逗号分隔")
+	excludeSectors := fs.String("exclude-sector", "", "排除这些板块的成分股,多个用逗号分隔")
+	fs.BoolVar(&u.ExcludeST, "exclude-st", false, "排除ST,*ST和退市整理")
+	fs.BoolVar(&u.ExcludeSuspended, "exclude-suspended", false, "排除停牌")
+	fs.IntVar(&u.MinListDays, "min-list-days", 0, "最少上市交易日数量")
+	fs.Float64Var(&u.MinAmount, "min-amount", 0, "最低日均成交额,元")
+	fs.IntVar(&u.AmountDays, "amount-days", 0, "计算日均成交额的交易日数量,默认20")
+	fs.StringVar(&u.Memo, "memo", "", "备注")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	u.Types = data.ParseCodes(*types)
+	u.Boards = data.ParseCodes(*boards)
+	u.Sectors = data.ParseCodes(*sectors)
+	u.ExcludeSectors = data.ParseCodes(*excludeSectors)
+	return universe.Save(u)
+}
+
+// universeCodes 输出股票池在某一天的代码
+func universeCodes(args []string) error {
+	fs := flag.NewFlagSet("universe codes", flag.ContinueOnError)
+	date := fs.String("date", "", "日期,默认当前")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("缺少股票池名称")
+	}
+	if err := load(); err != nil {
+		return err
+	}
+	t := time.Now()
+	if *date != "" {
+		var err error
+		if t, err = time.ParseInLocation(time.DateOnly, *date, time.Local); err != nil {
+			return err
+		}
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	codes, err := universe.Codes(common.Data, fs.Arg(0), t)
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		fmt.Printf("%-10s %s\n", code, common.Data.GetName(code))
+	}
+	fmt.Printf("共%d只\n", len(codes))
+	return nil
+}
+
+// universeDesc 股票池的过滤条件说明
+func universeDesc(u *universe.Universe) string {
+	ls := []string(nil)
+	if len(u.Types) > 0 {
+		ls = append(ls, "品种 "+strings.Join(u.Types, ","))
+	}
+	if len(u.Boards) > 0 {
+		ls = append(ls, "板块 "+strings.Join(u.Boards, ","))
+	}
+	if len(u.Sectors) > 0 {
+		ls = append(ls, "成分 "+strings.Join(u.Sectors, ","))
+	}
+	if len(u.ExcludeSectors) > 0 {
+		ls = append(ls, "排除 "+strings.Join(u.ExcludeSectors, ","))
+	}
+	if u.ExcludeST {
+		ls = append(ls, "排除ST")
+	}
+	if u.ExcludeSuspended {
+		ls = append(ls, "排除停牌")
+	}
+	if u.MinListDays > 0 {
+		ls = append(ls, fmt.Sprintf("上市%d天以上", u.MinListDays))
+	}
+	if u.MinAmount > 0 {
+		ls = append(ls, fmt.Sprintf("日均成交额%g以上", u.MinAmount))
+	}
+	return strings.Join(ls, "; ")
+}
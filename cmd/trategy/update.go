@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+)
+
+// updateCmd 立即同步日线,以及已经有分钟线的股票的分钟线
+func updateCmd(args []string) error {
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	force := fs.Bool("force", false, "忽略今天是否已经更新过")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	u, ok := common.Data.(data.Updater)
+	if !ok {
+		return errors.New("当前数据源不支持更新")
+	}
+	if err := u.Update(*force); err != nil {
+		return err
+	}
+	fmt.Println("数据更新完成")
+	return nil
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/injoyai/goutil/oss/shell"
 	"github.com/injoyai/goutil/oss/tray"
 	"github.com/injoyai/trategy/internal/api"
+	"github.com/injoyai/trategy/internal/calendar"
 	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
 )
 
 func main() {
@@ -23,7 +25,14 @@ func main() {
 				s.SetHint(err.Error())
 				return
 			}
-			common.Data.Start()
+			if err = common.Calendar.Start(calendar.DefaultSpec); err != nil {
+				s.SetHint(err.Error())
+				return
+			}
+			common.WarmCache()
+			if u, ok := common.Data.(data.Updater); ok {
+				u.Start()
+			}
 			go func() {
 				err = api.Run(port)
 				if err != nil {
@@ -4,6 +4,7 @@ go 1.25.0
 
 require (
 	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/fsnotify/fsnotify v1.10.1
 	github.com/gofiber/fiber/v3 v3.0.0-beta.4
 	github.com/injoyai/bar v0.0.8
 	github.com/injoyai/base v1.2.18
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"time"
+
+	"github.com/injoyai/frame/fbr"
+	"github.com/injoyai/trategy/internal/calendar"
+	"github.com/injoyai/trategy/internal/common"
+)
+
+type calendarResp struct {
+	Days     []string           `json:"days"`
+	Next     string             `json:"next"`
+	Prev     string             `json:"prev"`
+	Sessions []calendar.Session `json:"sessions"` //今天的交易时段
+	PerYear  float64            `json:"per_year"`
+}
+
+// GetCalendar
+// @Summary 获取交易日历
+// @Description 返回区间内的交易日,以及今天的前后交易日和交易时段
+// @Tags 日历
+// @Param start query string false "开始日期,默认30天前"
+// @Param end query string false "结束日期,默认今天"
+// @Success 200 {object} calendarResp
+func GetCalendar(c fbr.Ctx) {
+	now := time.Now()
+	start, end := now.AddDate(0, 0, -30), now
+	var err error
+	if s := c.GetString("start"); s != "" {
+		start, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+		c.CheckErr(err)
+	}
+	if s := c.GetString("end"); s != "" {
+		end, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+		c.CheckErr(err)
+	}
+	resp := calendarResp{
+		Days:     []string{},
+		Next:     common.Calendar.Next(now).Format(time.DateOnly),
+		Prev:     common.Calendar.Prev(now).Format(time.DateOnly),
+		Sessions: common.Calendar.Sessions(now),
+		PerYear:  common.Calendar.PerYear(),
+	}
+	for _, d := range common.Calendar.Days(start, end) {
+		resp.Days = append(resp.Days, d.Format(time.DateOnly))
+	}
+	c.Succ(resp)
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/injoyai/frame/fbr"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/fundamental"
+)
+
+// GetFundamentalReports
+// @Summary 财报列表
+// @Description 股票已导入的各期财报,按报告期升序
+// @Tags 基本面
+// @Param code query string true "代码"
+// @Success 200 {array} fundamental.Report
+func GetFundamentalReports(c fbr.Ctx) {
+	code := c.GetString("code")
+	if code == "" {
+		c.CheckErr(errors.New("缺少代码"))
+	}
+	ls, err := fundamental.Reports(code)
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// GetFundamentalShares
+// @Summary 股本变迁
+// @Description 股票的总股本和流通股本变化,sync为true时重新从数据源获取
+// @Tags 基本面
+// @Param code query string true "代码"
+// @Param sync query bool false "是否重新获取"
+// @Success 200 {array} fundamental.Share
+func GetFundamentalShares(c fbr.Ctx) {
+	code := c.GetString("code")
+	if code == "" {
+		c.CheckErr(errors.New("缺少代码"))
+	}
+	var ls []*fundamental.Share
+	var err error
+	if c.GetBool("sync") {
+		ls, err = fundamental.SyncShares(common.Data, code)
+	} else {
+		ls, err = fundamental.Shares(common.Data, code)
+	}
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// GetFundamentalValue
+// @Summary 市值和估值
+// @Description 每个交易日的市值、PE(TTM)、PB、PS(TTM)和ROE,只使用当天之前已公告的财报
+// @Tags 基本面
+// @Param code query string true "代码"
+// @Param start query string false "开始日期,默认1年前"
+// @Param end query string false "结束日期,默认今天"
+// @Success 200 {array} fundamental.Value
+func GetFundamentalValue(c fbr.Ctx) {
+	code := c.GetString("code")
+	if code == "" {
+		c.CheckErr(errors.New("缺少代码"))
+	}
+	now := time.Now()
+	start, end := now.AddDate(-1, 0, 0), now
+	var err error
+	if s := c.GetString("start"); s != "" {
+		start, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+		c.CheckErr(err)
+	}
+	if s := c.GetString("end"); s != "" {
+		end, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+		c.CheckErr(err)
+	}
+	ks, err := common.Data.GetDayKlines(code, start, end)
+	c.CheckErr(err)
+	ls, err := fundamental.Values(common.Data, code, ks)
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// PostFundamentalImport
+// @Summary 导入财报
+// @Description 上传通达信的gpcw*.zip/gpcw*.dat,或csv(code,period,announced,eps,bps,roe,revenue,net_profit,assets,equity,total,float),字段名file,可以上传多个
+// @Tags 基本面
+// @Param file formData file true "财务文件"
+// @Success 200 {array} fundamental.ImportResult
+func PostFundamentalImport(c fbr.Ctx) {
+	form, err := c.MultipartForm()
+	c.CheckErr(err)
+	if len(form.File["file"]) == 0 {
+		c.CheckErr(errors.New("缺少上传文件"))
+	}
+	files := map[string]io.Reader{}
+	for _, fh := range form.File["file"] {
+		f, err := fh.Open()
+		c.CheckErr(err)
+		defer f.Close()
+		files[fh.Filename] = f
+	}
+	res, err := fundamental.Import(files)
+	c.CheckErr(err)
+	c.Succ(res)
+}
+
+// PostFundamentalDownload
+// @Summary 下载财报
+// @Description 从通达信下载一个报告期的财务数据并导入
+// @Tags 基本面
+// @Param period query int true "报告期,例20231231"
+// @Success 200 {object} fundamental.ImportResult
+func PostFundamentalDownload(c fbr.Ctx) {
+	period := c.GetInt("period")
+	if period <= 0 {
+		c.CheckErr(errors.New("缺少报告期"))
+	}
+	res, err := fundamental.Download(period)
+	c.CheckErr(err)
+	c.Succ(res)
+}
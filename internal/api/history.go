@@ -0,0 +1,96 @@
+package api
+
+import (
+	"github.com/injoyai/conv"
+	"github.com/injoyai/frame/fbr"
+	"github.com/injoyai/trategy/internal/backtest"
+)
+
+// GetBacktestHistory
+// @Summary 获取回测记录
+// @Description 按创建时间倒序,不包含权益和交易明细
+// @Tags 回测
+// @Param kind query string false "single或all"
+// @Param strategy query string false "策略名称"
+// @Param code query string false "股票代码"
+// @Param tag query string false "标签"
+// @Param limit query int false "数量"
+// @Param offset query int false "偏移"
+// @Success 200 {array} backtest.History
+func GetBacktestHistory(c fbr.Ctx) {
+	data, err := backtest.GetHistories(backtest.HistoryFilter{
+		Kind:     c.GetString("kind"),
+		Strategy: c.GetString("strategy"),
+		Code:     c.GetString("code"),
+		Tag:      c.GetString("tag"),
+		Limit:    c.GetInt("limit", 100),
+		Offset:   c.GetInt("offset", 0),
+	})
+	c.CheckErr(err)
+	c.Succ(data)
+}
+
+// GetBacktestHistoryDetail
+// @Summary 获取回测记录详情
+// @Description 包含权益、交易明细或全市场汇总
+// @Tags 回测
+// @Param id query int true "回测记录ID"
+// @Success 200 {object} backtest.History
+func GetBacktestHistoryDetail(c fbr.Ctx) {
+	h, err := backtest.GetHistory(c.GetInt64("id"))
+	c.CheckErr(err)
+	c.Succ(h)
+}
+
+// PutBacktestHistoryTags
+// @Summary 设置回测记录标签
+// @Description 覆盖原有标签
+// @Tags 回测
+// @Param data body backtest.TagReq true "body"
+// @Success 200
+func PutBacktestHistoryTags(c fbr.Ctx) {
+	var req backtest.TagReq
+	c.Parse(&req)
+	err := backtest.SetTags(req.ID, req.Tags)
+	c.CheckErr(err)
+	c.Succ(nil)
+}
+
+func DelBacktestHistory(c fbr.Ctx) {
+	err := backtest.DelHistory(c.GetInt64s("id")...)
+	c.CheckErr(err)
+	c.Succ(nil)
+}
+
+type compareReq struct {
+	IDs []int64 `json:"ids"`
+}
+
+// PostBacktestCompare
+// @Summary 对比回测记录
+// @Description 按日期对齐净值曲线,并返回指标表格
+// @Tags 回测
+// @Param data body compareReq true "body"
+// @Success 200 {object} backtest.Comparison
+func PostBacktestCompare(c fbr.Ctx) {
+	var req compareReq
+	c.Parse(&req)
+	res, err := backtest.Compare(req.IDs...)
+	c.CheckErr(err)
+	c.Succ(res)
+}
+
+// GetBacktestReport
+// @Summary 下载回测报告
+// @Description format: html(默认,自包含网页), json, trades(交易明细csv), equity(每日权益csv)
+// @Tags 回测
+// @Param id path int true "回测记录ID"
+// @Param format query string false "报告格式"
+// @Success 200
+func GetBacktestReport(c fbr.Ctx) {
+	h, err := backtest.GetHistory(conv.Int64(c.Params("id")))
+	c.CheckErr(err)
+	name, bs, err := h.Report(c.GetString("format", backtest.ReportHTML))
+	c.CheckErr(err)
+	c.FileBytes(name, bs)
+}
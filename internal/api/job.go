@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/injoyai/frame/fbr"
+	"github.com/injoyai/trategy/internal/backtest"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/fundamental"
+	"github.com/injoyai/trategy/internal/job"
+	"github.com/injoyai/trategy/internal/tick"
+)
+
+const (
+	JobBacktest    = "backtest"
+	JobBacktestAll = "backtest_all"
+	JobDataAudit   = "data_audit"
+	JobShares      = "fundamental_shares"
+	JobTickFetch   = "tick_fetch"
+)
+
+func init() {
+	job.Register(JobBacktest, func(ctx context.Context, bs []byte, progress func(float64)) (any, error) {
+		req := new(backtest.Request)
+		if err := json.Unmarshal(bs, req); err != nil {
+			return nil, err
+		}
+		return backtest.Run(req)
+	})
+	job.Register(JobBacktestAll, func(ctx context.Context, bs []byte, progress func(float64)) (any, error) {
+		req := new(backtest.Request)
+		if err := json.Unmarshal(bs, req); err != nil {
+			return nil, err
+		}
+		return backtest.RunAll(ctx, req, nil, func(p backtest.Progress) {
+			progress(p.Percent / 100)
+		})
+	})
+	job.Register(JobDataAudit, func(ctx context.Context, bs []byte, progress func(float64)) (any, error) {
+		req := new(data.AuditReq)
+		if err := json.Unmarshal(bs, req); err != nil {
+			return nil, err
+		}
+		return data.Audit(ctx, common.Data, common.Calendar, req, func(done, total int) {
+			progress(float64(done) / float64(total))
+		})
+	})
+	job.Register(JobTickFetch, func(ctx context.Context, bs []byte, progress func(float64)) (any, error) {
+		req := new(tickFetchReq)
+		if err := json.Unmarshal(bs, req); err != nil {
+			return nil, err
+		}
+		start, end, err := req.Range()
+		if err != nil {
+			return nil, err
+		}
+		codes := req.Codes
+		if len(codes) == 0 {
+			if codes, err = tick.Watches(); err != nil {
+				return nil, err
+			}
+		}
+		return tick.FetchRange(ctx, common.Data, codes, start, end, func(done, total int) {
+			progress(float64(done) / float64(total))
+		})
+	})
+	job.Register(JobShares, func(ctx context.Context, bs []byte, progress func(float64)) (any, error) {
+		return fundamental.SyncSharesAll(ctx, common.Data, func(done, total int) {
+			progress(float64(done) / float64(total))
+		})
+	})
+}
+
+// tickFetchReq 补采分笔成交,codes为空时采集采集列表
+type tickFetchReq struct {
+	Codes []string `json:"codes"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// Range 解析区间,结束日期默认今天
+func (this *tickFetchReq) Range() (start, end time.Time, err error) {
+	start, err = time.ParseInLocation(time.DateOnly, this.Start, time.Local)
+	if err != nil {
+		return
+	}
+	end = time.Now()
+	if this.End != "" {
+		end, err = time.ParseInLocation(time.DateOnly, this.End, time.Local)
+	}
+	return
+}
+
+type jobReq struct {
+	Type    string          `json:"type"`
+	Request json.RawMessage `json:"request"` //对应任务类型的请求,例backtest.Request
+}
+
+// PostJob
+// @Summary 提交任务
+// @Description type可选backtest,backtest_all,data_audit,fundamental_shares,tick_fetch
+// @Tags 任务
+// @Param data body jobReq true "body"
+// @Success 200 {object} job.Job
+func PostJob(c fbr.Ctx) {
+	var req jobReq
+	c.Parse(&req)
+	if len(req.Request) == 0 {
+		c.Err("request is required")
+	}
+	j, err := job.Submit(req.Type, req.Request)
+	c.CheckErr(err)
+	c.Succ(j)
+}
+
+// GetJob
+// @Summary 获取任务状态和进度
+// @Description 获取任务状态和进度
+// @Tags 任务
+// @Param id query int true "任务ID"
+// @Success 200 {object} job.Job
+func GetJob(c fbr.Ctx) {
+	j, err := job.Get(c.GetInt64("id"))
+	c.CheckErr(err)
+	c.Succ(j)
+}
+
+// GetJobList
+// @Summary 获取任务列表
+// @Description 按创建时间倒序
+// @Tags 任务
+// @Param type query string false "任务类型"
+// @Param status query string false "任务状态"
+// @Param limit query int false "数量"
+// @Success 200 {array} job.Job
+func GetJobList(c fbr.Ctx) {
+	data, err := job.List(c.GetString("type"), c.GetString("status"), c.GetInt("limit", 100))
+	c.CheckErr(err)
+	c.Succ(data)
+}
+
+// GetJobResult
+// @Summary 获取任务结果
+// @Description 任务完成后可获取
+// @Tags 任务
+// @Param id query int true "任务ID"
+// @Success 200
+func GetJobResult(c fbr.Ctx) {
+	res, err := job.Result(c.GetInt64("id"))
+	c.CheckErr(err)
+	c.Succ(res)
+}
+
+// PutJobCancel
+// @Summary 取消任务
+// @Description 取消排队中或运行中的任务
+// @Tags 任务
+// @Param id query int true "任务ID"
+// @Success 200
+func PutJobCancel(c fbr.Ctx) {
+	err := job.Cancel(c.GetInt64("id"))
+	c.CheckErr(err)
+	c.Succ(nil)
+}
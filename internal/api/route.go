@@ -1,18 +1,68 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"time"
 
+	"github.com/injoyai/conv/cfg"
 	"github.com/injoyai/frame/fbr"
 	"github.com/injoyai/trategy/internal/backtest"
 	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/fundamental"
+	"github.com/injoyai/trategy/internal/job"
 	"github.com/injoyai/trategy/internal/screener"
+	"github.com/injoyai/trategy/internal/sector"
 	"github.com/injoyai/trategy/internal/strategy"
+	"github.com/injoyai/trategy/internal/tick"
+	"github.com/injoyai/trategy/internal/universe"
 )
 
 func Run(port int) error {
 
-	common.DB.Sync2(new(strategy.Strategy))
+	if err := strategy.Sync(); err != nil {
+		return err
+	}
+	if err := backtest.Sync(); err != nil {
+		return err
+	}
+	if err := sector.Sync(); err != nil {
+		return err
+	}
+	if err := fundamental.Sync(); err != nil {
+		return err
+	}
+	if err := tick.Sync(); err != nil {
+		return err
+	}
+	if err := screener.Sync(); err != nil {
+		return err
+	}
+	if err := universe.Sync(); err != nil {
+		return err
+	}
+
+	if err := strategy.Load(); err != nil {
+		return err
+	}
+
+	if err := job.Start(cfg.GetInt("job.workers", 2)); err != nil {
+		return err
+	}
+
+	//每个交易日更新完成后执行到期的选股
+	screener.Start()
+
+	//可选的分笔和五档快照采集
+	if err := tick.Start(); err != nil {
+		return err
+	}
+
+	//可选的策略目录,文件保存后自动重新加载
+	if dir := cfg.GetString("strategy.dir"); dir != "" {
+		go strategy.WatchDir(dir, cfg.GetSecond("strategy.interval", 2))
+	}
 
 	s := fbr.Default()
 	s.SetPort(port)
@@ -25,17 +75,96 @@ func Run(port int) error {
 			g.PUT("/", PutStrategy)
 			g.PUT("/enable", PutStrategyEnable)
 			g.DELETE("/", DelStrategy)
+			g.GET("/case", GetStrategyCases)
+			g.POST("/case", PostStrategyCase)
+			g.DELETE("/case", DelStrategyCase)
+			g.POST("/test", PostStrategyTest)
+			g.GET("/composite", GetStrategyComposites)
+			g.POST("/composite", PostStrategyComposite)
+			g.DELETE("/composite", DelStrategyComposite)
+			g.GET("/versions", GetStrategyVersions)
+			g.GET("/export", GetStrategyExport)
+			g.POST("/import", PostStrategyImport)
+			g.GET("/files", GetStrategyFiles)
 		})
 
 		g.Group("/stock", func(g fbr.Grouper) {
 			g.GET("/codes", GetCodes)
+			g.GET("/rule", GetRule)
 			g.GET("/klines", GetKlines)
 			g.POST("/screener", GetScreener)
+			g.POST("/import", PostStockImport)
+			g.GET("/export", GetStockExport)
+			g.GET("/audit", GetStockAudit)
+			g.GET("/cache", GetStockCache)
+			g.DELETE("/cache", DelStockCache)
 		})
 
 		g.Group("/backtest", func(g fbr.Grouper) {
 			g.POST("/", Backtest)
 			g.GET("/all/ws", BacktestAllWS)
+			g.GET("/history", GetBacktestHistory)
+			g.GET("/history/detail", GetBacktestHistoryDetail)
+			g.PUT("/history/tags", PutBacktestHistoryTags)
+			g.DELETE("/history", DelBacktestHistory)
+			g.GET("/:id/report", GetBacktestReport)
+			g.POST("/compare", PostBacktestCompare)
+		})
+
+		g.Group("/sector", func(g fbr.Grouper) {
+			g.GET("/list", GetSectorList)
+			g.GET("/members", GetSectorMembers)
+			g.GET("/of", GetSectorOf)
+			g.GET("/index", GetSectorIndex)
+			g.POST("/import", PostSectorImport)
+			g.DELETE("/", DelSector)
+		})
+
+		g.Group("/fundamental", func(g fbr.Grouper) {
+			g.GET("/reports", GetFundamentalReports)
+			g.GET("/shares", GetFundamentalShares)
+			g.GET("/value", GetFundamentalValue)
+			g.POST("/import", PostFundamentalImport)
+			g.POST("/download", PostFundamentalDownload)
+		})
+
+		g.Group("/tick", func(g fbr.Grouper) {
+			g.GET("/watch", GetTickWatch)
+			g.POST("/watch", PostTickWatch)
+			g.DELETE("/watch", DelTickWatch)
+			g.GET("/list", GetTicks)
+			g.GET("/snapshot", GetTickSnapshots)
+			g.POST("/fetch", PostTickFetch)
+			g.GET("/replay", GetTickReplay)
+		})
+
+		g.Group("/screener", func(g fbr.Grouper) {
+			g.GET("/factor", GetScreenerFactors)
+			g.POST("/factor", PostScreenerFactor)
+			g.DELETE("/factor", DelScreenerFactor)
+			g.GET("/screen", GetScreens)
+			g.POST("/screen", PostScreen)
+			g.DELETE("/screen", DelScreen)
+			g.POST("/screen/run", PostScreenRun)
+			g.GET("/screen/runs", GetScreenRuns)
+			g.GET("/screen/run", GetScreenRun)
+		})
+
+		g.Group("/universe", func(g fbr.Grouper) {
+			g.GET("/", GetUniverses)
+			g.POST("/", PostUniverse)
+			g.DELETE("/", DelUniverse)
+			g.GET("/codes", GetUniverseCodes)
+		})
+
+		g.GET("/calendar", GetCalendar)
+
+		g.Group("/job", func(g fbr.Grouper) {
+			g.POST("/", PostJob)
+			g.GET("/", GetJob)
+			g.GET("/list", GetJobList)
+			g.GET("/result", GetJobResult)
+			g.PUT("/cancel", PutJobCancel)
 		})
 
 	})
@@ -45,21 +174,41 @@ func Run(port int) error {
 
 // GetCodes
 // @Summary 获取股票代码
-// @Description 获取股票代码
+// @Description 获取代码,type为品种,多个用逗号分隔,默认stock,all表示全部
 // @Tags 股票
+// @Param type query string false "stock,index,etf,bond,fund"
 // @Success 200 {array} CodesResp
 func GetCodes(c fbr.Ctx) {
-	codes := common.Data.GetStockCodes()
+	types := data.ParseCodes(c.GetString("type", data.TypeStock))
+	if len(types) == 1 && types[0] == "all" {
+		types = nil
+	}
+	codes := common.Data.GetCodes(types...)
 	ls := make([]*CodesResp, len(codes))
 	for i, code := range codes {
 		ls[i] = &CodesResp{
 			Code: code,
-			Name: common.Data.Codes.GetName(code),
+			Name: common.Data.GetName(code),
+			Type: data.TypeOf(code),
 		}
 	}
 	c.Succ(ls)
 }
 
+// GetRule
+// @Summary 交易规则
+// @Description 代码对应品种的最小价格变动、每手数量、是否T+0和涨跌幅限制
+// @Tags 股票
+// @Param code query string true "代码"
+// @Success 200 {object} data.Rule
+func GetRule(c fbr.Ctx) {
+	code := c.GetString("code")
+	if code == "" {
+		c.CheckErr(errors.New("缺少代码"))
+	}
+	c.Succ(data.RuleOf(code))
+}
+
 // GetKlines
 // @Summary 获取K线
 // @Description 获取K线
@@ -95,235 +244,89 @@ func GetScreener(c fbr.Ctx) {
 }
 
 func Backtest(c fbr.Ctx) {
-
-	var req backtestReq
+	var req backtest.Request
 	c.Parse(&req)
 
-	strat := strategy.Get(req.Strategy)
-	if strat == nil {
-		c.Err("strategy not found")
-	}
-
-	var start, end time.Time
-	var err error
-	if req.Start != "" {
-		start, err = time.Parse("2006-01-02", req.Start)
-		c.CheckErr(err)
-	}
-	if req.End != "" {
-		end, err = time.Parse("2006-01-02", req.End)
-		c.CheckErr(err)
-	}
-
-	ks, err := common.Data.GetDayKlines(req.Code, start, end)
+	res, err := backtest.Run(&req)
 	c.CheckErr(err)
-
-	cash := req.Cash
-	if cash <= 0 {
-		cash = 100000
-	}
-	size := req.Size
-	if size <= 0 {
-		size = 1
-	}
-	if req.FeeRate <= 0 {
-		req.FeeRate = 0.0005
-	}
-	if req.MinFee <= 0 {
-		req.MinFee = 5
-	}
-	res := backtest.RunBacktestAdvanced(ks, strat, backtest.Settings{
-		Cash:       cash,
-		Size:       size,
-		FeeRate:    req.FeeRate,
-		MinFee:     req.MinFee,
-		Slippage:   req.Slippage,
-		StopLoss:   req.StopLoss,
-		TakeProfit: req.TakeProfit,
-	})
-
 	c.Succ(res)
 }
 
 func BacktestAllWS(c fbr.Ctx) {
 
 	// 读取参数（query）
-	strategyName := c.GetString("strategy")
-	strat := strategy.Get(strategyName)
-	if strat == nil {
-		c.Err("strategy not found")
-	}
-
-	startStr := c.GetString("start")
-	endStr := c.GetString("end")
-	var start, end time.Time
-	var err2 error
-	if startStr != "" {
-		start, err2 = time.Parse("2006-01-02", startStr)
-		c.CheckErr(err2)
-	} else {
-		start = time.Date(1990, 1, 1, 0, 0, 0, 0, time.Local)
-	}
-	if endStr != "" {
-		end, err2 = time.Parse("2006-01-02", endStr)
-		c.CheckErr(err2)
-	} else {
-		end = time.Now()
-	}
-
-	settings := backtest.Settings{
+	req := &backtest.Request{
+		Strategy:   c.GetString("strategy"),
+		Start:      c.GetString("start"),
+		End:        c.GetString("end"),
 		Cash:       c.GetFloat64("cash", 100000),
-		Size:       c.GetInt("size", 1),
+		Size:       c.GetInt("size", 0), //0为一手
 		FeeRate:    c.GetFloat64("fee_rate", 0.0005),
 		MinFee:     c.GetFloat64("min_fee", 5),
 		Slippage:   c.GetFloat64("slippage", 0),
 		StopLoss:   c.GetFloat64("stop_loss", 0),
 		TakeProfit: c.GetFloat64("take_profit", 0),
+		Goroutines: c.GetInt("goroutines", 0),
+		Universe:   c.GetString("universe"),
+	}
+	if strategy.Get(req.Strategy) == nil {
+		c.Err("strategy not found")
 	}
+	_, _, err := req.Range()
+	c.CheckErr(err)
 
 	// WebSocket 接入（fasthttp）
 	c.Websocket(func(conn *fbr.Websocket) {
 
-		codes := common.Data.GetStockCodes()
-		var sumRet, sumSharpe, sumDD float64
-		var cnt int
+		// 连接断开后写入失败,停止回测
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
 
-		for _, code := range codes {
-			ks, err := common.Data.GetDayKlines(code, start, end)
-			if err != nil || len(ks) == 0 {
-				continue
+		res, err := backtest.RunAll(ctx, req, func(item backtest.Item, p backtest.Progress) {
+			// 按完成顺序流式发送单条结果,失败的股票也发送,包含失败原因
+			typ := "item"
+			if item.Error != "" {
+				typ = "fail"
 			}
-			res := backtest.RunBacktestAdvanced(ks, strat, settings)
-			item := BacktestItem{
-				Code:        code,
-				Name:        common.Data.Codes.GetName(code),
-				Return:      res.Return,
-				MaxDrawdown: res.MaxDD,
-				Sharpe:      res.Sharpe,
+			if err := conn.WriteJSON(map[string]any{"type": typ, "item": item, "progress": p}); err != nil {
+				cancel()
 			}
-			sumRet += res.Return
-			sumSharpe += res.Sharpe
-			sumDD += res.MaxDD
-			cnt++
-			// 流式发送单条结果
-			_ = conn.WriteJSON(map[string]any{"type": "item", "item": item})
+		}, nil)
+		if err != nil {
+			_ = conn.WriteJSON(map[string]any{"type": "error", "error": err.Error()})
+			return
 		}
 
-		var avgRet, avgSharpe, avgDD float64
-		if cnt > 0 {
-			avgRet = sumRet / float64(cnt)
-			avgSharpe = sumSharpe / float64(cnt)
-			avgDD = sumDD / float64(cnt)
-		}
 		// 发送汇总
 		_ = conn.WriteJSON(map[string]any{
 			"type":             "summary",
-			"avg_return":       avgRet,
-			"avg_sharpe":       avgSharpe,
-			"avg_max_drawdown": avgDD,
-			"count":            cnt,
+			"avg_return":       res.AvgReturn,
+			"avg_sharpe":       res.AvgSharpe,
+			"avg_max_drawdown": res.AvgMaxDrawdown,
+			"median_return":    res.MedianReturn,
+			"p5_return":        res.P5Return,
+			"p25_return":       res.P25Return,
+			"p75_return":       res.P75Return,
+			"p95_return":       res.P95Return,
+			"win_rate":         res.WinRate,
+			"histogram":        res.Histogram,
+			"total":            res.Total,
+			"count":            res.Count,
+			"failed":           res.Failed,
 		})
 	})
 
 }
+
 func BacktestAll(c fbr.Ctx) {
-	var req backtestReq
+	var req backtest.Request
 	c.Parse(&req)
 
-	strat := strategy.Get(req.Strategy)
-	if strat == nil {
-		c.Err("strategy not found")
-	}
-
-	var start, end time.Time
-	var err error
-	if req.Start != "" {
-		start, err = time.Parse("2006-01-02", req.Start)
-		c.CheckErr(err)
-	} else {
-		start = time.Date(1990, 1, 1, 0, 0, 0, 0, time.Local)
-	}
-	if req.End != "" {
-		end, err = time.Parse("2006-01-02", req.End)
-		c.CheckErr(err)
-	} else {
-		end = time.Now()
-	}
-
-	cash := req.Cash
-	if cash <= 0 {
-		cash = 100000
-	}
-	size := req.Size
-	if size <= 0 {
-		size = 1
-	}
-	if req.FeeRate <= 0 {
-		req.FeeRate = 0.0005
-	}
-	if req.MinFee <= 0 {
-		req.MinFee = 5
-	}
-
-	settings := backtest.Settings{
-		Cash:       cash,
-		Size:       size,
-		FeeRate:    req.FeeRate,
-		MinFee:     req.MinFee,
-		Slippage:   req.Slippage,
-		StopLoss:   req.StopLoss,
-		TakeProfit: req.TakeProfit,
-	}
-
-	codes := common.Data.GetStockCodes()
-	items := make([]BacktestItem, 0, len(codes))
-	var sumRet, sumSharpe, sumDD float64
-	var cnt int
-	for _, code := range codes {
-		ks, err := common.Data.GetDayKlines(code, start, end)
-		if err != nil || len(ks) == 0 {
-			continue
-		}
-		res := backtest.RunBacktestAdvanced(ks, strat, settings)
-		item := BacktestItem{
-			Code:        code,
-			Name:        common.Data.Codes.GetName(code),
-			Return:      res.Return,
-			MaxDrawdown: res.MaxDD,
-			Sharpe:      res.Sharpe,
-		}
-		items = append(items, item)
-		sumRet += res.Return
-		sumSharpe += res.Sharpe
-		sumDD += res.MaxDD
-		cnt++
-	}
-
-	// sort by return desc
-	for i := 0; i < len(items); i++ {
-		for j := i + 1; j < len(items); j++ {
-			if items[j].Return > items[i].Return {
-				items[i], items[j] = items[j], items[i]
-			}
-		}
-	}
-	if len(items) > 200 {
-		items = items[:200]
-	}
-
-	var avgRet, avgSharpe, avgDD float64
-	if cnt > 0 {
-		avgRet = sumRet / float64(cnt)
-		avgSharpe = sumSharpe / float64(cnt)
-		avgDD = sumDD / float64(cnt)
-	}
+	res, err := backtest.RunAll(c.Context(), &req, nil, nil)
+	c.CheckErr(err)
 
-	resp := BacktestAllResp{
-		AvgReturn:      avgRet,
-		AvgSharpe:      avgSharpe,
-		AvgMaxDrawdown: avgDD,
-		Count:          cnt,
-		Items:          items,
+	if len(res.Items) > 200 {
+		res.Items = res.Items[:200]
 	}
-	c.Succ(resp)
+	c.Succ(res)
 }
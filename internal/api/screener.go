@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/injoyai/frame/fbr"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/screener"
+)
+
+// GetScreenerFactors
+// @Summary 因子列表
+// @Description 保存的选股因子,选股时在factors里按名称引用
+// @Tags 选股
+// @Success 200 {array} screener.Factor
+func GetScreenerFactors(c fbr.Ctx) {
+	ls, err := screener.Factors()
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// PostScreenerFactor
+// @Summary 新增或修改因子
+// @Description Type可选momentum,volatility,liquidity,value,expr,script,script的Script声明func Value(ks protocol.Klines) []float64,Standard可选zscore,rank,权重为负数表示越小越好
+// @Tags 选股
+// @Param data body screener.Factor true "body"
+// @Success 200 {object} screener.Factor
+func PostScreenerFactor(c fbr.Ctx) {
+	var req screener.Factor
+	c.Parse(&req)
+	c.CheckErr(screener.SaveFactor(&req))
+	c.Succ(req)
+}
+
+// DelScreenerFactor
+// @Summary 删除因子
+// @Tags 选股
+// @Param names query string true "因子名称,多个用逗号分隔"
+// @Success 200
+func DelScreenerFactor(c fbr.Ctx) {
+	names := data.ParseCodes(c.GetString("names"))
+	if len(names) == 0 {
+		c.CheckErr(errors.New("缺少因子名称"))
+	}
+	c.CheckErr(screener.DelFactor(names...))
+	c.Succ(nil)
+}
+
+// GetScreens
+// @Summary 保存的选股
+// @Tags 选股
+// @Success 200 {array} screener.Screen
+func GetScreens(c fbr.Ctx) {
+	ls, err := screener.Screens()
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// PostScreen
+// @Summary 新增或修改选股
+// @Description Schedule为6位cron表达式,决定哪些天执行,到期后在当天的日线更新完成后执行,空为每个交易日
+// @Tags 选股
+// @Param data body screener.Screen true "body"
+// @Success 200 {object} screener.Screen
+func PostScreen(c fbr.Ctx) {
+	var req screener.Screen
+	c.Parse(&req)
+	c.CheckErr(screener.SaveScreen(&req))
+	c.Succ(req)
+}
+
+// DelScreen
+// @Summary 删除选股
+// @Description 同时删除执行记录
+// @Tags 选股
+// @Param names query string true "选股名称,多个用逗号分隔"
+// @Success 200
+func DelScreen(c fbr.Ctx) {
+	names := data.ParseCodes(c.GetString("names"))
+	if len(names) == 0 {
+		c.CheckErr(errors.New("缺少选股名称"))
+	}
+	c.CheckErr(screener.DelScreen(names...))
+	c.Succ(nil)
+}
+
+// PostScreenRun
+// @Summary 立即执行选股
+// @Description 执行并保存结果,返回和上一次相比新进入和离开的股票
+// @Tags 选股
+// @Param name query string true "选股名称"
+// @Success 200 {object} screener.ScreenRun
+func PostScreenRun(c fbr.Ctx) {
+	res, err := screener.RunScreen(c.GetString("name"))
+	c.CheckErr(err)
+	c.Succ(res)
+}
+
+// GetScreenRuns
+// @Summary 选股执行记录
+// @Description 按时间倒序,包含新进入和离开的股票,不包含结果列表
+// @Tags 选股
+// @Param name query string true "选股名称"
+// @Param limit query int false "最近的数量,默认全部"
+// @Success 200 {array} screener.ScreenRun
+func GetScreenRuns(c fbr.Ctx) {
+	ls, err := screener.Runs(c.GetString("name"), c.GetInt("limit"))
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// GetScreenRun
+// @Summary 选股执行结果
+// @Tags 选股
+// @Param id query int true "执行记录ID"
+// @Success 200 {object} screener.ScreenRun
+func GetScreenRun(c fbr.Ctx) {
+	res, err := screener.GetRun(c.GetInt64("id"))
+	c.CheckErr(err)
+	c.Succ(res)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/injoyai/frame/fbr"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/sector"
+)
+
+// GetSectorList
+// @Summary 板块列表
+// @Description 板块名称、类型和成分股数量
+// @Tags 板块
+// @Param type query string false "industry,concept,style,index,默认全部"
+// @Success 200 {array} sector.Sector
+func GetSectorList(c fbr.Ctx) {
+	ls, err := sector.List(c.GetString("type"))
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// GetSectorMembers
+// @Summary 板块成分股
+// @Description 板块成分股的代码和名称
+// @Tags 板块
+// @Param name query string true "板块名称"
+// @Success 200 {array} CodesResp
+func GetSectorMembers(c fbr.Ctx) {
+	codes, err := sector.Members(c.GetString("name"))
+	c.CheckErr(err)
+	ls := make([]*CodesResp, len(codes))
+	for i, code := range codes {
+		ls[i] = &CodesResp{Code: code, Name: common.Data.GetName(code)}
+	}
+	c.Succ(ls)
+}
+
+// GetSectorOf
+// @Summary 代码所属的板块
+// @Description 代码所属的行业和概念等板块
+// @Tags 板块
+// @Param code query string true "代码"
+// @Success 200 {array} sector.Member
+func GetSectorOf(c fbr.Ctx) {
+	code := c.GetString("code")
+	if code == "" {
+		c.CheckErr(errors.New("缺少代码"))
+	}
+	ls, err := sector.Of(code)
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// GetSectorIndex
+// @Summary 板块指数
+// @Description 用成分股的日线计算板块指数,weight为equal等权或cap流通市值加权
+// @Tags 板块
+// @Param name query string true "板块名称"
+// @Param weight query string false "equal,cap"
+// @Param start query string false "开始日期,默认1年前"
+// @Param end query string false "结束日期,默认今天"
+// @Success 200 {array} protocol.Kline
+func GetSectorIndex(c fbr.Ctx) {
+	now := time.Now()
+	start, end := now.AddDate(-1, 0, 0), now
+	var err error
+	if s := c.GetString("start"); s != "" {
+		start, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+		c.CheckErr(err)
+	}
+	if s := c.GetString("end"); s != "" {
+		end, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+		c.CheckErr(err)
+	}
+	ks, err := sector.Index(common.Data, c.GetString("name"), c.GetString("weight"), start, end)
+	c.CheckErr(err)
+	c.Succ(ks)
+}
+
+// PostSectorImport
+// @Summary 导入板块
+// @Description 上传通达信的block_*.dat,tdxhy.cfg和incon.dat,或csv(板块,类型,代码),字段名file,可以上传多个
+// @Tags 板块
+// @Param file formData file true "板块文件"
+// @Success 200 {array} sector.ImportResult
+func PostSectorImport(c fbr.Ctx) {
+	form, err := c.MultipartForm()
+	c.CheckErr(err)
+	if len(form.File["file"]) == 0 {
+		c.CheckErr(errors.New("缺少上传文件"))
+	}
+	files := map[string]io.Reader{}
+	for _, fh := range form.File["file"] {
+		f, err := fh.Open()
+		c.CheckErr(err)
+		defer f.Close()
+		files[fh.Filename] = f
+	}
+	res, err := sector.Import(files)
+	c.CheckErr(err)
+	c.Succ(res)
+}
+
+// DelSector
+// @Summary 删除板块
+// @Tags 板块
+// @Param name query string true "板块名称"
+// @Success 200
+func DelSector(c fbr.Ctx) {
+	c.CheckErr(sector.Del(c.GetString("name")))
+	c.Succ(nil)
+}
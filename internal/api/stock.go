@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+
+	"github.com/injoyai/frame/fbr"
+	"github.com/injoyai/logs"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+)
+
+// PostStockImport
+// @Summary 导入K线数据
+// @Description 上传csv或通达信的.day/.lc1/.lc5文件,字段名file,可以上传多个
+// @Tags 股票
+// @Param file formData file true "数据文件"
+// @Success 200 {array} data.ImportResult
+func PostStockImport(c fbr.Ctx) {
+	dir, err := data.StoreDir(common.Data)
+	c.CheckErr(err)
+	form, err := c.MultipartForm()
+	c.CheckErr(err)
+	files := form.File["file"]
+	if len(files) == 0 {
+		c.CheckErr(errors.New("缺少上传文件"))
+	}
+	out := []*data.ImportResult(nil)
+	for _, fh := range files {
+		f, err := fh.Open()
+		c.CheckErr(err)
+		results, err := data.Import(dir, fh.Filename, f)
+		f.Close()
+		c.CheckErr(err)
+		for _, v := range results {
+			data.Invalidate(common.Data, v.Code)
+		}
+		out = append(out, results...)
+	}
+	c.Succ(out)
+}
+
+// GetStockExport
+// @Summary 导出K线数据
+// @Description 按股票逐个读取并流式返回,split为true时每只股票一个文件,打包成zip
+// @Tags 股票
+// @Param codes query string true "股票代码,多个用逗号分隔"
+// @Param type query string false "day或min"
+// @Param start query string false "开始日期"
+// @Param end query string false "结束日期"
+// @Param adjust query string false "复权方式,qfq或hfq"
+// @Param format query string false "csv,jsonl,parquet"
+// @Param split query bool false "每只股票一个文件"
+// @Success 200
+func GetStockExport(c fbr.Ctx) {
+	req := &data.ExportReq{
+		Codes:  data.ParseCodes(c.GetString("codes")),
+		Type:   c.GetString("type"),
+		Start:  c.GetString("start"),
+		End:    c.GetString("end"),
+		Adjust: c.GetString("adjust"),
+		Format: c.GetString("format"),
+		Split:  c.GetBool("split"),
+	}
+	c.CheckErr(req.Check())
+	c.Attachment(req.Filename())
+	err := c.SendStreamWriter(func(w *bufio.Writer) {
+		res, err := data.Export(common.Data, req, w)
+		if err != nil {
+			logs.Err(err)
+		} else if len(res.Skipped) > 0 {
+			logs.Warnf("导出时跳过%d只股票: %v\n", len(res.Skipped), res.Skipped)
+		}
+		w.Flush()
+	})
+	c.CheckErr(err)
+}
+
+// GetStockAudit
+// @Summary 检查单只股票的数据
+// @Description 检查缺失的交易日、重复的K线、异常价格和过期数据,全市场检查请提交data_audit任务
+// @Tags 股票
+// @Param code query string true "股票代码"
+// @Param start query string false "开始日期"
+// @Param repair query bool false "重新拉取有问题的区间"
+// @Success 200 {object} data.AuditReport
+func GetStockAudit(c fbr.Ctx) {
+	code := c.GetString("code")
+	if code == "" {
+		c.CheckErr(errors.New("缺少股票代码"))
+	}
+	report, err := data.Audit(c.Context(), common.Data, common.Calendar, &data.AuditReq{
+		Codes:  []string{code},
+		Start:  c.GetString("start"),
+		Repair: c.GetBool("repair"),
+	}, nil)
+	c.CheckErr(err)
+	c.Succ(report)
+}
+
+// GetStockCache
+// @Summary 日线缓存统计
+// @Description 内存预算、占用、命中和未命中次数
+// @Tags 股票
+// @Success 200 {object} data.CacheStats
+func GetStockCache(c fbr.Ctx) {
+	cache, ok := common.Data.(*data.Cache)
+	if !ok {
+		c.CheckErr(errors.New("未启用缓存"))
+	}
+	c.Succ(cache.Stats())
+}
+
+// DelStockCache
+// @Summary 清除日线缓存
+// @Description code为空时清除全部
+// @Tags 股票
+// @Param code query string false "股票代码"
+// @Success 200
+func DelStockCache(c fbr.Ctx) {
+	if code := c.GetString("code"); code != "" {
+		data.Invalidate(common.Data, code)
+	} else {
+		data.Invalidate(common.Data)
+	}
+	c.Succ(nil)
+}
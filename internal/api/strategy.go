@@ -1,6 +1,8 @@
 package api
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/injoyai/conv"
@@ -43,6 +45,17 @@ func PostStrategy(c fbr.Ctx) {
 	if req.Name == "" {
 		c.Err("name is required")
 	}
+	if i := strategy.Get(req.Name); i != nil && !strategy.IsScript(i) {
+		c.Err("name conflicts with registered strategy")
+	}
+	if strategy.IsFile(req.Name) {
+		c.Err("name conflicts with strategy file")
+	}
+	has, err := common.DB.Where("Name=?", req.Name).Exist(&strategy.Composite{})
+	c.CheckErr(err)
+	if has {
+		c.Err("name conflicts with composite strategy")
+	}
 
 	s := &strategy.Strategy{
 		Name:    req.Name,
@@ -51,7 +64,9 @@ func PostStrategy(c fbr.Ctx) {
 		Package: req.Name + conv.String(time.Now().Unix()),
 	}
 
-	_, err := common.DB.Insert(s)
+	_, err = common.DB.Insert(s)
+	c.CheckErr(err)
+	err = strategy.AddVersion(s)
 	c.CheckErr(err)
 
 	if req.Enable {
@@ -67,6 +82,9 @@ func PostStrategy(c fbr.Ctx) {
 func PutStrategy(c fbr.Ctx) {
 	var req strategy.CreateReq
 	c.Parse(&req)
+	if strategy.IsFile(req.Name) {
+		c.Err("name conflicts with strategy file")
+	}
 
 	s := new(strategy.Strategy)
 	_, err := common.DB.Where("Name=?", req.Name).Get(s)
@@ -76,8 +94,14 @@ func PutStrategy(c fbr.Ctx) {
 	s.Enable = req.Enable
 	s.Package = req.Name + conv.String(time.Now().Unix())
 
+	if req.Enable {
+		c.CheckErr(strategy.CheckCases(s))
+	}
+
 	_, err = common.DB.Where("Name=?", req.Name).Cols("Script,Enable,Package").Update(s)
 	c.CheckErr(err)
+	err = strategy.AddVersion(s)
+	c.CheckErr(err)
 
 	if req.Enable {
 		err = strategy.RegisterScript(s)
@@ -101,6 +125,13 @@ func PutStrategyEnable(c fbr.Ctx) {
 		c.Succ(nil)
 	}
 
+	if req.Enable && strategy.IsFile(req.Name) {
+		c.Err("name conflicts with strategy file")
+	}
+	if req.Enable {
+		c.CheckErr(strategy.CheckCases(s))
+	}
+
 	_, err = common.DB.Where("Name=?", req.Name).Cols("Enable").Update(&strategy.Strategy{
 		Enable: req.Enable,
 	})
@@ -116,13 +147,208 @@ func PutStrategyEnable(c fbr.Ctx) {
 	c.Succ(nil)
 }
 
+// DelStrategy
+// @Summary 删除脚本策略
+// @Description 同时删除测试用例和历史版本
+// @Tags 策略
+// @Param Name query string true "策略名称"
+// @Success 200
 func DelStrategy(c fbr.Ctx) {
 	name := c.GetString("Name")
 	if len(name) == 0 {
 		c.Succ(nil)
 	}
-	_, err := common.DB.Where("Name=?", name).Delete(&strategy.Strategy{})
+	c.CheckErr(strategy.Delete(name))
+	c.Succ(nil)
+}
+
+// GetStrategyCases
+// @Summary 获取策略测试用例
+// @Description 获取策略测试用例
+// @Tags 策略
+// @Param name query string true "策略名称"
+// @Success 200 {array} strategy.Case
+func GetStrategyCases(c fbr.Ctx) {
+	data, err := strategy.GetCases(c.GetString("name"))
+	c.CheckErr(err)
+	c.Succ(data)
+}
+
+// PostStrategyCase
+// @Summary 新增或修改策略测试用例
+// @Description ID为0时新增
+// @Tags 策略
+// @Param data body strategy.Case true "body"
+// @Success 200
+func PostStrategyCase(c fbr.Ctx) {
+	var req strategy.Case
+	c.Parse(&req)
+	if req.Strategy == "" {
+		c.Err("strategy is required")
+	}
+	if len(req.Klines) == 0 && req.Code == "" {
+		c.Err("klines or code is required")
+	}
+
+	var err error
+	if req.ID == 0 {
+		_, err = common.DB.Insert(&req)
+	} else {
+		_, err = common.DB.ID(req.ID).AllCols().Update(&req)
+	}
+	c.CheckErr(err)
+	c.Succ(req)
+}
+
+// DelStrategyCase
+// @Summary 删除策略测试用例
+// @Tags 策略
+// @Param ID query int true "用例ID"
+// @Success 200
+func DelStrategyCase(c fbr.Ctx) {
+	id := c.GetInt64("ID")
+	_, err := common.DB.ID(id).Delete(&strategy.Case{})
+	c.CheckErr(err)
+	c.Succ(nil)
+}
+
+// PostStrategyTest
+// @Summary 执行策略测试用例
+// @Description 脚本为空时测试已保存的脚本
+// @Tags 策略
+// @Param data body strategy.CaseTestReq true "body"
+// @Success 200 {array} strategy.CaseResult
+func PostStrategyTest(c fbr.Ctx) {
+	var req strategy.CaseTestReq
+	c.Parse(&req)
+
+	s := new(strategy.Strategy)
+	has, err := common.DB.Where("Name=?", req.Name).Get(s)
+	c.CheckErr(err)
+	if !has {
+		c.Err("strategy not found")
+	}
+	if req.Script != "" {
+		s.Script = req.Script
+	}
+
+	results, err := strategy.TestCases(s)
+	c.CheckErr(err)
+	c.Succ(results)
+}
+
+// GetStrategyComposites
+// @Summary 获取组合策略
+// @Description 获取组合策略
+// @Tags 策略
+// @Success 200 {array} strategy.Composite
+func GetStrategyComposites(c fbr.Ctx) {
+	data := []*strategy.Composite(nil)
+	err := common.DB.Find(&data)
+	c.CheckErr(err)
+	c.Succ(data)
+}
+
+// PostStrategyComposite
+// @Summary 新增或修改组合策略
+// @Description Mode可选all,any,vote,entry,filter,entry和filter需要2个成员
+// @Tags 策略
+// @Param data body strategy.Composite true "body"
+// @Success 200
+func PostStrategyComposite(c fbr.Ctx) {
+	var req strategy.Composite
+	c.Parse(&req)
+	if req.Name == "" {
+		c.Err("name is required")
+	}
+
+	if i := strategy.Get(req.Name); i != nil {
+		if _, ok := i.(*strategy.Combine); !ok {
+			c.Err("name conflicts with registered strategy")
+		}
+	}
+	has, err := common.DB.Where("Name=?", req.Name).Exist(&strategy.Strategy{})
+	c.CheckErr(err)
+	if has {
+		c.Err("name conflicts with script strategy")
+	}
+
+	err = strategy.RegisterComposite(&req)
+	c.CheckErr(err)
+
+	has, err = common.DB.Where("Name=?", req.Name).Exist(&strategy.Composite{})
+	c.CheckErr(err)
+	if has {
+		_, err = common.DB.Where("Name=?", req.Name).AllCols().Update(&req)
+	} else {
+		_, err = common.DB.Insert(&req)
+	}
+	c.CheckErr(err)
+
+	c.Succ(req)
+}
+
+func DelStrategyComposite(c fbr.Ctx) {
+	name := c.GetString("Name")
+	if len(name) == 0 {
+		c.Succ(nil)
+	}
+	_, err := common.DB.Where("Name=?", name).Delete(&strategy.Composite{})
 	c.CheckErr(err)
 	strategy.Del(name)
 	c.Succ(nil)
 }
+
+// GetStrategyVersions
+// @Summary 获取策略历史版本
+// @Description 获取策略历史版本
+// @Tags 策略
+// @Param name query string true "策略名称"
+// @Success 200 {array} strategy.Version
+func GetStrategyVersions(c fbr.Ctx) {
+	data, err := strategy.GetVersions(c.GetString("name"))
+	c.CheckErr(err)
+	c.Succ(data)
+}
+
+// GetStrategyExport
+// @Summary 导出策略
+// @Description 导出脚本、历史版本、测试用例和组合策略,names为空时导出全部
+// @Tags 策略
+// @Param names query string false "策略名称,逗号分隔"
+// @Success 200 {object} strategy.Bundle
+func GetStrategyExport(c fbr.Ctx) {
+	var names []string
+	if s := c.GetString("names"); s != "" {
+		names = strings.Split(s, ",")
+	}
+	b, err := strategy.Export(names...)
+	c.CheckErr(err)
+	bs, err := json.MarshalIndent(b, "", "  ")
+	c.CheckErr(err)
+	c.FileBytes("strategy-"+time.Now().Format("20060102150405")+".json", bs)
+}
+
+// PostStrategyImport
+// @Summary 导入策略
+// @Description 名称冲突时返回错误,overwrite=true时覆盖
+// @Tags 策略
+// @Param overwrite query bool false "覆盖同名策略"
+// @Param data body strategy.Bundle true "body"
+// @Success 200
+func PostStrategyImport(c fbr.Ctx) {
+	var req strategy.Bundle
+	c.Parse(&req)
+	err := strategy.Import(&req, c.GetBool("overwrite"))
+	c.CheckErr(err)
+	c.Succ(nil)
+}
+
+// GetStrategyFiles
+// @Summary 获取策略目录下的文件
+// @Description 包含编译错误,配置strategy.dir后生效
+// @Tags 策略
+// @Success 200 {array} strategy.File
+func GetStrategyFiles(c fbr.Ctx) {
+	c.Succ(strategy.Files())
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/injoyai/frame/fbr"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/tick"
+)
+
+// tickRange 解析查询区间,默认当天
+func tickRange(c fbr.Ctx) (time.Time, time.Time) {
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, 1).Add(-time.Second)
+	var err error
+	if s := c.GetString("start"); s != "" {
+		start, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+		c.CheckErr(err)
+	}
+	if s := c.GetString("end"); s != "" {
+		end, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+		c.CheckErr(err)
+		end = end.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return start, end
+}
+
+// GetTickWatch
+// @Summary 采集列表
+// @Description 需要采集分笔成交和五档快照的代码
+// @Tags 分笔
+// @Success 200 {array} string
+func GetTickWatch(c fbr.Ctx) {
+	ls, err := tick.Watches()
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// PostTickWatch
+// @Summary 添加采集
+// @Tags 分笔
+// @Param codes query string true "代码,多个用逗号分隔"
+// @Success 200
+func PostTickWatch(c fbr.Ctx) {
+	codes := data.ParseCodes(c.GetString("codes"))
+	if len(codes) == 0 {
+		c.CheckErr(errors.New("缺少代码"))
+	}
+	c.CheckErr(tick.AddWatch(codes...))
+	c.Succ(nil)
+}
+
+// DelTickWatch
+// @Summary 删除采集
+// @Description 已采集的数据保留
+// @Tags 分笔
+// @Param codes query string true "代码,多个用逗号分隔"
+// @Success 200
+func DelTickWatch(c fbr.Ctx) {
+	codes := data.ParseCodes(c.GetString("codes"))
+	if len(codes) == 0 {
+		c.CheckErr(errors.New("缺少代码"))
+	}
+	c.CheckErr(tick.DelWatch(codes...))
+	c.Succ(nil)
+}
+
+// GetTicks
+// @Summary 分笔成交
+// @Description 已采集的分笔成交,按时间升序
+// @Tags 分笔
+// @Param code query string true "代码"
+// @Param start query string false "开始日期,默认今天"
+// @Param end query string false "结束日期,默认今天"
+// @Success 200 {array} tick.Tick
+func GetTicks(c fbr.Ctx) {
+	start, end := tickRange(c)
+	ls, err := tick.Ticks(c.GetString("code"), start, end)
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// GetTickSnapshots
+// @Summary 五档快照
+// @Description 已采集的五档行情快照,按时间升序
+// @Tags 分笔
+// @Param code query string true "代码"
+// @Param start query string false "开始日期,默认今天"
+// @Param end query string false "结束日期,默认今天"
+// @Param limit query int false "只返回最后的数量,默认全部"
+// @Success 200 {array} tick.Snapshot
+func GetTickSnapshots(c fbr.Ctx) {
+	start, end := tickRange(c)
+	ls, err := tick.Snapshots(c.GetString("code"), start, end, c.GetInt("limit"))
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// PostTickFetch
+// @Summary 采集分笔成交
+// @Description 立即采集区间内每个交易日的分笔成交,替换已有的数据,区间较长时使用任务tick_fetch
+// @Tags 分笔
+// @Param code query string true "代码"
+// @Param start query string false "开始日期,默认今天"
+// @Param end query string false "结束日期,默认今天"
+// @Success 200 {object} tick.FetchResult
+func PostTickFetch(c fbr.Ctx) {
+	code := c.GetString("code")
+	if code == "" {
+		c.CheckErr(errors.New("缺少代码"))
+	}
+	start, end := tickRange(c)
+	res, err := tick.FetchRange(c.Context(), common.Data, []string{code}, start, end, nil)
+	c.CheckErr(err)
+	c.Succ(res)
+}
+
+// GetTickReplay
+// @Summary 分笔合成分钟线
+// @Description 把已采集的分笔成交合成1分钟K线,save为true时写入分钟线,回测可以使用interval=min
+// @Tags 分笔
+// @Param code query string true "代码"
+// @Param start query string false "开始日期,默认今天"
+// @Param end query string false "结束日期,默认今天"
+// @Param save query bool false "是否写入分钟线"
+// @Success 200 {array} protocol.Kline
+func GetTickReplay(c fbr.Ctx) {
+	code := c.GetString("code")
+	if code == "" {
+		c.CheckErr(errors.New("缺少代码"))
+	}
+	start, end := tickRange(c)
+	if c.GetBool("save") {
+		res, err := tick.ReplayImport(common.Data, code, start, end)
+		c.CheckErr(err)
+		c.Succ(res)
+		return
+	}
+	ks, err := tick.Replay(code, start, end)
+	c.CheckErr(err)
+	c.Succ(ks)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/injoyai/frame/fbr"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/universe"
+)
+
+// GetUniverses
+// @Summary 股票池列表
+// @Description 保存的股票池,选股和全市场回测的universe参数按名称引用
+// @Tags 股票池
+// @Success 200 {array} universe.Universe
+func GetUniverses(c fbr.Ctx) {
+	ls, err := universe.List()
+	c.CheckErr(err)
+	c.Succ(ls)
+}
+
+// PostUniverse
+// @Summary 新增或修改股票池
+// @Description Boards可选main,gem,star,bj,Sectors为已导入的板块或指数名称
+// @Tags 股票池
+// @Param data body universe.Universe true "body"
+// @Success 200 {object} universe.Universe
+func PostUniverse(c fbr.Ctx) {
+	var req universe.Universe
+	c.Parse(&req)
+	c.CheckErr(universe.Save(&req))
+	c.Succ(req)
+}
+
+// DelUniverse
+// @Summary 删除股票池
+// @Tags 股票池
+// @Param names query string true "股票池名称,多个用逗号分隔"
+// @Success 200
+func DelUniverse(c fbr.Ctx) {
+	names := data.ParseCodes(c.GetString("names"))
+	if len(names) == 0 {
+		c.CheckErr(errors.New("缺少股票池名称"))
+	}
+	c.CheckErr(universe.Del(names...))
+	c.Succ(nil)
+}
+
+// GetUniverseCodes
+// @Summary 股票池的代码
+// @Description 按日期之前最后一个收盘日的数据过滤
+// @Tags 股票池
+// @Param name query string true "股票池名称"
+// @Param date query string false "日期,默认当前"
+// @Success 200 {array} CodesResp
+func GetUniverseCodes(c fbr.Ctx) {
+	t := time.Now()
+	if s := c.GetString("date"); s != "" {
+		var err error
+		t, err = time.ParseInLocation(time.DateOnly, s, time.Local)
+		c.CheckErr(err)
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	codes, err := universe.Codes(common.Data, c.GetString("name"), t)
+	c.CheckErr(err)
+	ls := make([]*CodesResp, len(codes))
+	for i, code := range codes {
+		ls[i] = &CodesResp{Code: code, Name: common.Data.GetName(code)}
+	}
+	c.Succ(ls)
+}
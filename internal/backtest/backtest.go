@@ -1,10 +1,14 @@
 package backtest
 
 import (
+	"fmt"
 	"math"
 	"time"
 
 	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/debug"
 	"github.com/injoyai/trategy/internal/strategy"
 )
 
@@ -17,6 +21,8 @@ type Trade struct {
 }
 
 type Result struct {
+	// ID 回测记录ID，保存后设置
+	ID int64 `json:"id,omitempty"`
 	// Equity 每根K线对应的总资产（现金 + 持仓市值）
 	// 计算方式：eq + pos*close，其中 eq 为现金余额，pos 为持仓数量，close 为该根K线的收盘价
 	Equity []float64 `json:"equity"`
@@ -30,18 +36,31 @@ type Result struct {
 	Return float64 `json:"return"`
 	// MaxDD 最大回撤比例（期间总资产相对峰值的最大下跌比例）
 	MaxDD float64 `json:"max_drawdown"`
-	// Sharpe 夏普比率（以日收益率序列计算：mean/StdDev * sqrt(252)）
+	// Sharpe 夏普比率（以日收益率序列计算：mean/StdDev * sqrt(每年交易日数量)，交易日数量来自交易日历）
 	Sharpe float64 `json:"sharpe"`
+	// Benchmark 基准按初始资金换算后的权益，和Equity对齐，设置Request.Benchmark时返回
+	Benchmark []float64 `json:"benchmark,omitempty"`
+	// BenchmarkReturn 基准在回测区间的收益率
+	BenchmarkReturn float64 `json:"benchmark_return,omitempty"`
+	// Excess 超额收益（Return - BenchmarkReturn）
+	Excess float64 `json:"excess,omitempty"`
+	// Debug 脚本策略的调试输出（日志和按K线对齐的调试序列），开启Settings.Debug时返回
+	Debug *debug.Debug `json:"debug,omitempty"`
 }
 
 type Settings struct {
 	Cash       float64
-	Size       int
+	Size       int //每次交易的股数,设置Rule时按Rule.Qty取整,0为一手
 	FeeRate    float64
 	MinFee     float64
 	Slippage   float64
 	StopLoss   float64
 	TakeProfit float64
+	Debug      bool
+	Rule       *data.Rule //交易规则,设置后价格按最小变动取整,数量按整手取整,非T+0品种当天买入不能卖出
+	PerDay     int        //每个交易日的K线数量,用于年化Sharpe,分钟线为240,0按日线计算
+	//Fundamentals 和K线对齐的基本面序列,策略需要基本面数据时设置
+	Fundamentals map[string][]float64 `json:"-"`
 }
 
 type Candle struct {
@@ -54,7 +73,8 @@ type Candle struct {
 	Symbol string
 }
 
-func RunBacktestAdvanced(ks protocol.Klines, strat strategy.Interface, cfg Settings) Result {
+// RunBacktestAdvanced 按策略信号回测,策略返回的信号数量和K线数量不一致时返回错误
+func RunBacktestAdvanced(ks protocol.Klines, strat strategy.Interface, cfg Settings) (Result, error) {
 
 	if len(ks) == 0 {
 		return Result{
@@ -65,10 +85,22 @@ func RunBacktestAdvanced(ks protocol.Klines, strat strategy.Interface, cfg Setti
 			Return:   0,
 			MaxDD:    0,
 			Sharpe:   0,
-		}
+		}, nil
 	}
 
-	sigs := strat.Signals(ks)
+	var dbg *debug.Debug
+	var sigs []int
+	if f, ok := strat.(strategy.Fundamentaler); ok && cfg.Fundamentals != nil {
+		sigs = f.SignalsFundamental(ks, cfg.Fundamentals)
+	} else if d, ok := strat.(strategy.Debugger); ok && cfg.Debug {
+		dbg = debug.New(len(ks))
+		sigs = d.SignalsDebug(ks, dbg)
+	} else {
+		sigs = strat.Signals(ks)
+	}
+	if len(sigs) != len(ks) {
+		return Result{}, fmt.Errorf("策略[%s]返回%d个信号,和K线数量%d不一致", strat.Name(), len(sigs), len(ks))
+	}
 	n := len(ks)
 	equity := make([]float64, n)
 	cashSeries := make([]float64, n)
@@ -79,24 +111,38 @@ func RunBacktestAdvanced(ks protocol.Klines, strat strategy.Interface, cfg Setti
 	var peak float64
 	rets := make([]float64, 0, n)
 	var entry float64
+	var entryTime time.Time
+	size := cfg.Size
+	if cfg.Rule != nil {
+		size = cfg.Rule.Qty(size)
+	} else if size <= 0 {
+		size = 1
+	}
 	for i := 0; i < n; i++ {
 		price := ks[i].Close.Float64()
 		buyPx := price * (1 + cfg.Slippage)
 		sellPx := price * (1 - cfg.Slippage)
+		if cfg.Rule != nil {
+			buyPx = cfg.Rule.BuyPrice(buyPx)
+			sellPx = cfg.Rule.SellPrice(sellPx)
+		}
 		s := sigs[i]
+		//T+1的品种当天买入的不能卖出
+		locked := cfg.Rule != nil && !cfg.Rule.T0 && sameDay(entryTime, ks[i].Time)
 		if s == 1 && pos == 0 {
-			cost := buyPx * float64(cfg.Size)
+			cost := buyPx * float64(size)
 			fee := cost * cfg.FeeRate
 			if fee < cfg.MinFee {
 				fee = cfg.MinFee
 			}
 			if eq >= cost+fee {
 				eq -= cost + fee
-				pos += cfg.Size
+				pos += size
 				entry = buyPx
-				trades = append(trades, Trade{Time: ks[i].Time.Unix(), Index: i, Price: buyPx, Side: "buy", Qty: cfg.Size})
+				entryTime = ks[i].Time
+				trades = append(trades, Trade{Time: ks[i].Time.Unix(), Index: i, Price: buyPx, Side: "buy", Qty: size})
 			}
-		} else if s == -1 && pos > 0 {
+		} else if s == -1 && pos > 0 && !locked {
 			proceeds := sellPx * float64(pos)
 			fee := proceeds * cfg.FeeRate
 			if fee < cfg.MinFee {
@@ -106,7 +152,7 @@ func RunBacktestAdvanced(ks protocol.Klines, strat strategy.Interface, cfg Setti
 			trades = append(trades, Trade{Time: ks[i].Time.Unix(), Index: i, Price: sellPx, Side: "sell", Qty: pos})
 			pos = 0
 			entry = 0
-		} else if pos > 0 {
+		} else if pos > 0 && !locked {
 			if cfg.StopLoss > 0 && entry > 0 {
 				r := (sellPx - entry) / entry
 				if r <= -cfg.StopLoss {
@@ -152,7 +198,7 @@ func RunBacktestAdvanced(ks protocol.Klines, strat strategy.Interface, cfg Setti
 		totalRet = (equity[n-1] - cfg.Cash) / cfg.Cash
 	}
 	maxDD := drawdown(equity)
-	sharpe := sharpeRatio(rets)
+	sharpe := sharpeRatio(rets, max(cfg.PerDay, 1))
 	return Result{
 		Equity:   equity,
 		Cash:     cashSeries,
@@ -161,7 +207,12 @@ func RunBacktestAdvanced(ks protocol.Klines, strat strategy.Interface, cfg Setti
 		Return:   totalRet,
 		MaxDD:    maxDD,
 		Sharpe:   sharpe,
-	}
+		Debug:    dbg,
+	}, nil
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
 }
 
 func drawdown(eq []float64) float64 {
@@ -181,7 +232,7 @@ func drawdown(eq []float64) float64 {
 	return maxdd
 }
 
-func sharpeRatio(xs []float64) float64 {
+func sharpeRatio(xs []float64, perDay int) float64 {
 	if len(xs) == 0 {
 		return 0
 	}
@@ -199,5 +250,13 @@ func sharpeRatio(xs []float64) float64 {
 	if sd == 0 {
 		return 0
 	}
-	return mean / sd * math.Sqrt(252)
+	return mean / sd * math.Sqrt(tradingDaysPerYear()*float64(perDay))
+}
+
+// tradingDaysPerYear 年化使用的交易日数量,按交易日历计算
+func tradingDaysPerYear() float64 {
+	if common.Calendar == nil {
+		return 252
+	}
+	return common.Calendar.PerYear()
 }
@@ -0,0 +1,255 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/injoyai/base/chans"
+	"github.com/injoyai/conv/cfg"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/sector"
+	"github.com/injoyai/trategy/internal/universe"
+)
+
+// Item 全市场回测中单只股票的结果,Error不为空表示该股票回测失败
+type Item struct {
+	Code        string  `json:"code"`
+	Name        string  `json:"name"`
+	Return      float64 `json:"return"`
+	MaxDrawdown float64 `json:"max_drawdown"`
+	Sharpe      float64 `json:"sharpe"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// Bucket 收益分布的区间,[Low,High)
+type Bucket struct {
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+	Count int     `json:"count"`
+}
+
+// Summary 全市场回测的汇总,统计值只包含成功的股票
+type Summary struct {
+	ID             int64    `json:"id,omitempty"` //回测记录ID,保存后设置
+	AvgReturn      float64  `json:"avg_return"`
+	AvgSharpe      float64  `json:"avg_sharpe"`
+	AvgMaxDrawdown float64  `json:"avg_max_drawdown"`
+	MedianReturn   float64  `json:"median_return"`
+	P5Return       float64  `json:"p5_return"`
+	P25Return      float64  `json:"p25_return"`
+	P75Return      float64  `json:"p75_return"`
+	P95Return      float64  `json:"p95_return"`
+	WinRate        float64  `json:"win_rate"`            //收益为正的比例
+	Benchmark      float64  `json:"benchmark,omitempty"` //基准在回测区间的收益率
+	Histogram      []Bucket `json:"histogram"`
+	Total          int      `json:"total"` //股票总数
+	Count          int      `json:"count"` //成功数量
+	Items          []Item   `json:"items"`
+	Failed         []Item   `json:"failed"`
+}
+
+// Progress 全市场回测的进度
+type Progress struct {
+	Done    int     `json:"done"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+}
+
+// RunAll 并发回测全部股票并保存回测记录,按完成顺序回调onItem,回调不会并发执行
+// ctx取消时停止分发并返回ctx的错误,progress可以为nil
+func RunAll(ctx context.Context, req *Request, onItem func(item Item, p Progress), progress func(p Progress)) (*Summary, error) {
+	strat, err := req.strategy()
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := req.Range()
+	if err != nil {
+		return nil, err
+	}
+	settings := req.Settings()
+	goroutines := req.Goroutines
+	if goroutines <= 0 {
+		goroutines = cfg.GetInt("backtest.goroutines", runtime.NumCPU())
+	}
+
+	//先计算基准,基准无效时不用等全市场回测完才报错
+	var benchmark float64
+	if req.Benchmark != "" {
+		bks, err := sector.Benchmark(common.Data, req.Benchmark, start, end)
+		if err != nil {
+			return nil, err
+		}
+		if len(bks) > 0 && bks[0].Close > 0 {
+			benchmark = bks[len(bks)-1].Close.Float64()/bks[0].Close.Float64() - 1
+		}
+	}
+
+	var codes []string
+	if req.Universe != "" {
+		if codes, err = universe.Codes(common.Data, req.Universe, start); err != nil {
+			return nil, err
+		}
+	} else {
+		typ := req.Type
+		if typ == "" {
+			typ = data.TypeStock
+		}
+		codes = common.Data.GetCodes(typ)
+	}
+	total := len(codes)
+	items := make([]Item, 0, total)
+	failed := []Item(nil)
+	var mu sync.Mutex
+	var done int
+
+	wg := chans.NewWaitLimit(goroutines)
+	for _, code := range codes {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add()
+		go func(code string) {
+			defer wg.Done()
+			if ctx.Err() != nil {
+				return
+			}
+			item := Item{Code: code, Name: common.Data.GetName(code)}
+			func() {
+				//脚本panic只记为这只股票失败,子协程的panic不能被任务的recover捕获
+				defer func() {
+					if r := recover(); r != nil {
+						item.Error = fmt.Sprint(r)
+					}
+				}()
+				ks, err := req.klines(code, start, end)
+				switch {
+				case err != nil:
+					item.Error = err.Error()
+				case len(ks) == 0:
+					item.Error = "区间内没有数据"
+				default:
+					s := settings
+					s.Rule = data.RuleOf(code)
+					if s.Fundamentals, err = fundamentals(strat, code, ks); err != nil {
+						item.Error = err.Error()
+						break
+					}
+					res, err := RunBacktestAdvanced(ks, strat, s)
+					if err != nil {
+						item.Error = err.Error()
+						break
+					}
+					item.Return = res.Return
+					item.MaxDrawdown = res.MaxDD
+					item.Sharpe = res.Sharpe
+				}
+			}()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if item.Error != "" {
+				failed = append(failed, item)
+			} else {
+				items = append(items, item)
+			}
+			done++
+			p := Progress{Done: done, Total: total, Percent: float64(done) / float64(total) * 100}
+			if onItem != nil {
+				onItem(item, p)
+			}
+			if progress != nil {
+				progress(p)
+			}
+		}(code)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Return > items[j].Return })
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Code < failed[j].Code })
+	s := &Summary{
+		Total:  total,
+		Count:  len(items),
+		Items:  items,
+		Failed: failed,
+	}
+	s.stat()
+	s.Benchmark = benchmark
+	if err = saveSummary(req, strat, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// stat 计算汇总统计,Items需要按收益倒序
+func (this *Summary) stat() {
+	n := len(this.Items)
+	if n == 0 {
+		return
+	}
+	rets := make([]float64, n)
+	var sumRet, sumSharpe, sumDD float64
+	var win int
+	for i, v := range this.Items {
+		//倒序转升序
+		rets[n-1-i] = v.Return
+		sumRet += v.Return
+		sumSharpe += v.Sharpe
+		sumDD += v.MaxDrawdown
+		if v.Return > 0 {
+			win++
+		}
+	}
+	this.AvgReturn = sumRet / float64(n)
+	this.AvgSharpe = sumSharpe / float64(n)
+	this.AvgMaxDrawdown = sumDD / float64(n)
+	this.WinRate = float64(win) / float64(n)
+	this.MedianReturn = percentile(rets, 0.5)
+	this.P5Return = percentile(rets, 0.05)
+	this.P25Return = percentile(rets, 0.25)
+	this.P75Return = percentile(rets, 0.75)
+	this.P95Return = percentile(rets, 0.95)
+	this.Histogram = histogram(rets, 20)
+}
+
+// percentile 线性插值计算分位数,xs需要升序
+func percentile(xs []float64, p float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	pos := p * float64(len(xs)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return xs[lo] + (xs[hi]-xs[lo])*(pos-float64(lo))
+}
+
+// histogram 把最小值到最大值等分成n个区间统计数量,xs需要升序
+func histogram(xs []float64, n int) []Bucket {
+	if len(xs) == 0 || n <= 0 {
+		return []Bucket{}
+	}
+	lo, hi := xs[0], xs[len(xs)-1]
+	if hi == lo {
+		return []Bucket{{Low: lo, High: hi, Count: len(xs)}}
+	}
+	width := (hi - lo) / float64(n)
+	out := make([]Bucket, n)
+	for i := range out {
+		out[i] = Bucket{Low: lo + width*float64(i), High: lo + width*float64(i+1)}
+	}
+	for _, v := range xs {
+		i := int((v - lo) / width)
+		if i >= n {
+			i = n - 1
+		}
+		out[i].Count++
+	}
+	return out
+}
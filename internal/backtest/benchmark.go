@@ -0,0 +1,51 @@
+package backtest
+
+import (
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/sector"
+)
+
+// applyBenchmark 读取基准并按K线的日期对齐,换算成和初始资金相同起点的权益
+func applyBenchmark(code string, ks protocol.Klines, res *Result, cash float64) error {
+	if code == "" || len(ks) == 0 {
+		return nil
+	}
+	//多取一段,保证第一根K线之前有基准数据
+	bks, err := sector.Benchmark(common.Data, code, ks[0].Time.AddDate(0, 0, -30), ks[len(ks)-1].Time.Add(time.Second))
+	if err != nil {
+		return err
+	}
+	values := make([]float64, len(ks))
+	j, last := 0, 0.
+	for i, k := range ks {
+		day := k.Time.Format(time.DateOnly)
+		for ; j < len(bks) && bks[j].Time.Format(time.DateOnly) <= day; j++ {
+			last = bks[j].Close.Float64()
+		}
+		values[i] = last
+	}
+	//基准开始的比回测晚时,之前按初始资金计算
+	base := 0.
+	for _, v := range values {
+		if v > 0 {
+			base = v
+			break
+		}
+	}
+	if base == 0 {
+		return nil
+	}
+	res.Benchmark = make([]float64, len(ks))
+	for i, v := range values {
+		if v == 0 {
+			v = base
+		}
+		res.Benchmark[i] = cash * v / base
+	}
+	res.BenchmarkReturn = values[len(values)-1]/base - 1
+	res.Excess = res.Return - res.BenchmarkReturn
+	return nil
+}
@@ -0,0 +1,75 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+)
+
+// benchSource 基准只有部分日期的日线
+type benchSource struct {
+	data.Source
+	closes map[int]float64
+}
+
+func (this *benchSource) GetDayKlines(code string, start, end time.Time) (protocol.Klines, error) {
+	ks := protocol.Klines{}
+	for day := 1; day <= 31; day++ {
+		c, ok := this.closes[day]
+		if t := testKlines(day)[0].Time; ok && t.After(start) && t.Before(end) {
+			ks = append(ks, &protocol.Kline{Time: t, Close: protocol.Yuan(c)})
+		}
+	}
+	return ks, nil
+}
+
+func TestApplyBenchmark(t *testing.T) {
+	old := common.Data
+	defer func() { common.Data = old }()
+
+	cases := []struct {
+		name   string
+		closes map[int]float64
+		want   []float64
+		ret    float64
+	}{
+		//缺少4号时沿用3号
+		{"对齐", map[int]float64{2: 100, 3: 110, 5: 120}, []float64{1000, 1100, 1100, 1200}, 0.2},
+		//回测开始前的数据作为起点
+		{"开始前", map[int]float64{1: 100, 4: 90}, []float64{1000, 1000, 900, 900}, -0.1},
+		//基准开始得晚,之前按初始资金
+		{"开始晚", map[int]float64{4: 50, 5: 55}, []float64{1000, 1000, 1000, 1100}, 0.1},
+	}
+	ks := testKlines(2, 3, 4, 5)
+	for _, v := range cases {
+		common.Data = &benchSource{closes: v.closes}
+		res := &Result{Return: 0.15}
+		if err := applyBenchmark("sh000300", ks, res, 1000); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Benchmark) != len(v.want) {
+			t.Fatalf("%s: 基准%v,期望%v", v.name, res.Benchmark, v.want)
+		}
+		for i := range v.want {
+			if !near(res.Benchmark[i], v.want[i]) {
+				t.Fatalf("%s: 基准%v,期望%v", v.name, res.Benchmark, v.want)
+			}
+		}
+		if !near(res.BenchmarkReturn, v.ret) || !near(res.Excess, 0.15-v.ret) {
+			t.Fatalf("%s: 基准收益%v,超额%v", v.name, res.BenchmarkReturn, res.Excess)
+		}
+	}
+
+	//没有基准数据或没有设置基准时不返回
+	common.Data = &benchSource{}
+	res := &Result{}
+	if err := applyBenchmark("sh000300", ks, res, 1000); err != nil || res.Benchmark != nil {
+		t.Fatalf("没有基准数据时%v, %v", res.Benchmark, err)
+	}
+	if err := applyBenchmark("", ks, res, 1000); err != nil || res.Benchmark != nil {
+		t.Fatalf("没有设置基准时%v, %v", res.Benchmark, err)
+	}
+}
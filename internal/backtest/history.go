@@ -0,0 +1,267 @@
+package backtest
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/strategy"
+)
+
+const (
+	KindSingle = "single" //单只股票回测
+	KindAll    = "all"    //全市场回测
+)
+
+// History 回测记录,每次回测都会保存
+type History struct {
+	ID        int64     `xorm:"pk autoincr" json:"id"`
+	Kind      string    `xorm:"index" json:"kind"`
+	Strategy  string    `xorm:"index" json:"strategy"`
+	Version   int64     `json:"version"` //脚本策略的版本ID,内置策略为0
+	Code      string    `xorm:"index" json:"code"`
+	Request   *Request  `xorm:"json" json:"request"`
+	Settings  Settings  `xorm:"json" json:"settings"`
+	DataStart time.Time `json:"data_start"` //实际数据的第一根K线时间
+	DataEnd   time.Time `json:"data_end"`   //实际数据的最后一根K线时间
+	Return    float64   `json:"return"`
+	MaxDD     float64   `json:"max_drawdown"`
+	Sharpe    float64   `json:"sharpe"`
+	Trades    int       `json:"trades"`
+	Tags      []string  `xorm:"json" json:"tags"`
+	Times     []int64   `xorm:"json" json:"times,omitempty"` //每根K线的时间,和Result.Equity对齐
+	Result    *Result   `xorm:"json" json:"result,omitempty"`
+	Summary   *Summary  `xorm:"json" json:"summary,omitempty"`
+	Created   time.Time `xorm:"created" json:"created"`
+}
+
+// HistoryFilter 回测记录的筛选条件,为空的字段不过滤
+type HistoryFilter struct {
+	Kind     string `json:"kind"`
+	Strategy string `json:"strategy"`
+	Code     string `json:"code"`
+	Tag      string `json:"tag"`
+	Limit    int    `json:"limit"`
+	Offset   int    `json:"offset"`
+}
+
+type TagReq struct {
+	ID   int64    `json:"id"`
+	Tags []string `json:"tags"`
+}
+
+// Sync 同步回测相关的数据表
+func Sync() error {
+	return common.DB.Sync2(new(History))
+}
+
+// newHistory 版本取回测时实际执行的脚本,不是最新保存的版本
+func newHistory(kind string, req *Request, strat strategy.Interface) *History {
+	return &History{
+		Kind:     kind,
+		Strategy: req.Strategy,
+		Version:  strategy.VersionOf(strat),
+		Code:     req.Code,
+		Request:  req,
+		Settings: req.Settings(),
+		Tags:     []string{},
+	}
+}
+
+// saveResult 保存单只股票的回测结果,并设置Result.ID
+func saveResult(req *Request, strat strategy.Interface, ks protocol.Klines, res *Result) error {
+	h := newHistory(KindSingle, req, strat)
+	h.Times = make([]int64, len(ks))
+	for i, k := range ks {
+		h.Times[i] = k.Time.Unix()
+	}
+	if len(ks) > 0 {
+		h.DataStart = ks[0].Time
+		h.DataEnd = ks[len(ks)-1].Time
+	}
+	h.Return = res.Return
+	h.MaxDD = res.MaxDD
+	h.Sharpe = res.Sharpe
+	h.Trades = len(res.Trades)
+	h.Result = res
+	if _, err := common.DB.Insert(h); err != nil {
+		return err
+	}
+	res.ID = h.ID
+	return nil
+}
+
+// saveSummary 保存全市场回测的汇总,并设置Summary.ID
+func saveSummary(req *Request, strat strategy.Interface, s *Summary) error {
+	h := newHistory(KindAll, req, strat)
+	h.Code = ""
+	var err error
+	h.DataStart, h.DataEnd, err = req.Range()
+	if err != nil {
+		return err
+	}
+	h.Return = s.AvgReturn
+	h.MaxDD = s.AvgMaxDrawdown
+	h.Sharpe = s.AvgSharpe
+	h.Summary = s
+	if _, err = common.DB.Insert(h); err != nil {
+		return err
+	}
+	s.ID = h.ID
+	return nil
+}
+
+// GetHistories 按创建时间倒序获取回测记录,不包含权益和交易明细
+func GetHistories(f HistoryFilter) ([]*History, error) {
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	session := common.DB.Desc("ID").Limit(f.Limit, f.Offset).Omit("Times", "Result", "Summary")
+	if f.Kind != "" {
+		session.And("Kind=?", f.Kind)
+	}
+	if f.Strategy != "" {
+		session.And("Strategy=?", f.Strategy)
+	}
+	if f.Code != "" {
+		session.And("Code=?", f.Code)
+	}
+	if f.Tag != "" {
+		//标签以json数组保存
+		session.And("Tags like ?", `%"`+f.Tag+`"%`)
+	}
+	data := []*History(nil)
+	err := session.Find(&data)
+	return data, err
+}
+
+// GetHistory 获取完整的回测记录
+func GetHistory(id int64) (*History, error) {
+	h := new(History)
+	has, err := common.DB.ID(id).Get(h)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, errors.New("回测记录不存在")
+	}
+	return h, nil
+}
+
+// SetTags 设置回测记录的标签
+func SetTags(id int64, tags []string) error {
+	out := make([]string, 0, len(tags))
+	for _, v := range tags {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	_, err := common.DB.ID(id).Cols("Tags").Update(&History{Tags: out})
+	return err
+}
+
+// DelHistory 删除回测记录
+func DelHistory(ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := common.DB.In("ID", ids).Delete(&History{})
+	return err
+}
+
+// Comparison 多个回测的对比,权益按日期对齐并归一化成净值
+type Comparison struct {
+	Dates   []string     `json:"dates"`
+	Runs    []*History   `json:"runs"`    //回测指标,不包含明细
+	Equity  [][]*float64 `json:"equity"`  //和Runs对齐,每个日期的净值,没有数据时为null
+	Metrics []Metric     `json:"metrics"` //指标表格,每行一个指标
+}
+
+// Metric 对比表格的一行,Values和Runs对齐
+type Metric struct {
+	Name   string    `json:"name"`
+	Values []float64 `json:"values"`
+}
+
+// Compare 对比多个单只股票的回测记录
+func Compare(ids ...int64) (*Comparison, error) {
+	if len(ids) < 2 {
+		return nil, errors.New("至少需要2个回测记录")
+	}
+	hs := make([]*History, len(ids))
+	dates := map[int64]bool{}
+	for i, id := range ids {
+		h, err := GetHistory(id)
+		if err != nil {
+			return nil, err
+		}
+		if h.Result == nil || len(h.Times) != len(h.Result.Equity) {
+			return nil, errors.New("全市场回测记录不支持对比")
+		}
+		hs[i] = h
+		for _, t := range h.Times {
+			dates[day(t)] = true
+		}
+	}
+
+	days := make([]int64, 0, len(dates))
+	for k := range dates {
+		days = append(days, k)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+	index := make(map[int64]int, len(days))
+	c := &Comparison{Dates: make([]string, len(days))}
+	for i, d := range days {
+		index[d] = i
+		c.Dates[i] = time.Unix(d, 0).Format(time.DateOnly)
+	}
+
+	for _, h := range hs {
+		ls := make([]*float64, len(days))
+		cash := h.Settings.Cash
+		if cash <= 0 {
+			cash = 1
+		}
+		for i, t := range h.Times {
+			v := h.Result.Equity[i] / cash
+			ls[index[day(t)]] = &v
+		}
+		//区间内缺失的日期沿用上一个净值
+		var last *float64
+		for i := range ls {
+			if ls[i] != nil {
+				last = ls[i]
+			} else if last != nil && i <= index[day(h.Times[len(h.Times)-1])] {
+				ls[i] = last
+			}
+		}
+		c.Equity = append(c.Equity, ls)
+
+		run := *h
+		run.Times, run.Result, run.Summary = nil, nil, nil
+		c.Runs = append(c.Runs, &run)
+	}
+
+	metric := func(name string, f func(h *History) float64) {
+		m := Metric{Name: name, Values: make([]float64, len(hs))}
+		for i, h := range hs {
+			m.Values[i] = f(h)
+		}
+		c.Metrics = append(c.Metrics, m)
+	}
+	metric("return", func(h *History) float64 { return h.Return })
+	metric("max_drawdown", func(h *History) float64 { return h.MaxDD })
+	metric("sharpe", func(h *History) float64 { return h.Sharpe })
+	metric("trades", func(h *History) float64 { return float64(h.Trades) })
+	metric("bars", func(h *History) float64 { return float64(len(h.Times)) })
+	return c, nil
+}
+
+// day 转成当天0点的时间戳
+func day(t int64) int64 {
+	tm := time.Unix(t, 0)
+	return time.Date(tm.Year(), tm.Month(), tm.Day(), 0, 0, 0, 0, time.Local).Unix()
+}
@@ -0,0 +1,191 @@
+package backtest
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/injoyai/goutil/database/sqlite"
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+)
+
+func testDB(t *testing.T) {
+	t.Helper()
+	db, err := sqlite.NewXorm(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	common.DB = db
+	if err = Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testKlines 按日期生成日线,收盘价任意
+func testKlines(days ...int) protocol.Klines {
+	ks := make(protocol.Klines, len(days))
+	for i, d := range days {
+		ks[i] = &protocol.Kline{Time: time.Date(2024, 1, d, 15, 0, 0, 0, time.Local), Close: protocol.Yuan(10)}
+	}
+	return ks
+}
+
+// saveTest 保存一条单只股票的回测记录,权益按天给出
+func saveTest(t *testing.T, strategy, code string, cash float64, days []int, equity []float64) int64 {
+	t.Helper()
+	req := &Request{Strategy: strategy, Code: code, Cash: cash}
+	res := &Result{Equity: equity, Return: equity[len(equity)-1]/cash - 1, Trades: make([]Trade, len(days)/2)}
+	if err := saveResult(req, nil, testKlines(days...), res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ID == 0 {
+		t.Fatal("保存后没有设置ID")
+	}
+	return res.ID
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestHistory(t *testing.T) {
+	testDB(t)
+	a := saveTest(t, "ma", "sz000001", 1000, []int{2, 3}, []float64{1000, 1100})
+	b := saveTest(t, "macd", "sz000001", 1000, []int{2, 3, 4}, []float64{1000, 900, 950})
+	s := &Summary{AvgReturn: 0.1, AvgSharpe: 1, AvgMaxDrawdown: 0.2}
+	if err := saveSummary(&Request{Strategy: "ma", Start: "2024-01-01", End: "2024-02-01"}, nil, s); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := GetHistory(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Kind != KindSingle || h.Trades != 1 || len(h.Times) != 2 || h.Result == nil ||
+		!h.DataStart.Equal(testKlines(2)[0].Time) || !h.DataEnd.Equal(testKlines(3)[0].Time) {
+		t.Fatalf("单只股票的回测记录有误: %+v", h)
+	}
+	if h, err = GetHistory(s.ID); err != nil || h.Kind != KindAll || h.Code != "" || h.Return != 0.1 || h.Summary == nil {
+		t.Fatalf("全市场的回测记录有误: %+v, %v", h, err)
+	}
+	if _, err = GetHistory(999); err == nil {
+		t.Fatal("不存在的记录应该返回错误")
+	}
+
+	//列表倒序且不包含明细
+	ls, err := GetHistories(HistoryFilter{})
+	if err != nil || len(ls) != 3 || ls[0].ID != s.ID || ls[2].Result != nil || ls[2].Times != nil {
+		t.Fatalf("回测列表有误: %v, %v", ls, err)
+	}
+	if err = SetTags(b, []string{" 好 ", "", "macd"}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		f    HistoryFilter
+		want []int64
+	}{
+		{HistoryFilter{Kind: KindAll}, []int64{s.ID}},
+		{HistoryFilter{Strategy: "ma"}, []int64{s.ID, a}},
+		{HistoryFilter{Code: "sz000001"}, []int64{b, a}},
+		{HistoryFilter{Tag: "好"}, []int64{b}},
+		{HistoryFilter{Tag: "ma"}, nil}, //标签按完整匹配
+		{HistoryFilter{Limit: 1, Offset: 1}, []int64{b}},
+	}
+	for _, v := range cases {
+		ls, err := GetHistories(v.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int64(nil)
+		for _, h := range ls {
+			ids = append(ids, h.ID)
+		}
+		if len(ids) != len(v.want) || (len(ids) > 0 && ids[0] != v.want[0]) {
+			t.Errorf("%+v: 得到%v,期望%v", v.f, ids, v.want)
+		}
+	}
+	if h, _ = GetHistory(b); len(h.Tags) != 2 || h.Tags[0] != "好" {
+		t.Fatalf("标签%v", h.Tags)
+	}
+
+	if err = DelHistory(a, b); err != nil {
+		t.Fatal(err)
+	}
+	if ls, _ = GetHistories(HistoryFilter{}); len(ls) != 1 {
+		t.Fatalf("删除后剩余%d条", len(ls))
+	}
+}
+
+func TestCompare(t *testing.T) {
+	testDB(t)
+	//a缺少4号,b从3号开始、5号结束,c的初始资金不同
+	a := saveTest(t, "ma", "sz000001", 1000, []int{2, 3, 5, 8}, []float64{1000, 1100, 1200, 1300})
+	b := saveTest(t, "macd", "sz000001", 1000, []int{3, 4, 5}, []float64{1000, 900, 950})
+	c := saveTest(t, "ma", "sh600000", 2000, []int{2, 8}, []float64{2000, 3000})
+	all := &Summary{}
+	if err := saveSummary(&Request{Strategy: "ma"}, nil, all); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Compare(a); err == nil {
+		t.Fatal("1个记录不能对比")
+	}
+	if _, err := Compare(a, all.ID); err == nil {
+		t.Fatal("全市场回测不能对比")
+	}
+	if _, err := Compare(a, 999); err == nil {
+		t.Fatal("不存在的记录不能对比")
+	}
+
+	cmp, err := Compare(a, b, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDates := []string{"2024-01-02", "2024-01-03", "2024-01-04", "2024-01-05", "2024-01-08"}
+	if len(cmp.Dates) != len(wantDates) {
+		t.Fatalf("日期%v,期望%v", cmp.Dates, wantDates)
+	}
+	for i := range wantDates {
+		if cmp.Dates[i] != wantDates[i] {
+			t.Fatalf("日期%v,期望%v", cmp.Dates, wantDates)
+		}
+	}
+
+	//-1表示null,缺失的日期沿用上一个净值,开始前和结束后为null
+	want := [][]float64{
+		{1, 1.1, 1.1, 1.2, 1.3},
+		{-1, 1, 0.9, 0.95, -1},
+		{1, 1, 1, 1, 1.5},
+	}
+	for i, ls := range cmp.Equity {
+		for j, v := range ls {
+			got := -1.
+			if v != nil {
+				got = *v
+			}
+			if !near(got, want[i][j]) {
+				t.Errorf("记录%d在%s的净值%v,期望%v", i, cmp.Dates[j], got, want[i][j])
+			}
+		}
+	}
+
+	if len(cmp.Runs) != 3 || cmp.Runs[1].ID != b || cmp.Runs[0].Result != nil || cmp.Runs[0].Times != nil {
+		t.Fatalf("对比的记录有误: %v", cmp.Runs)
+	}
+	metrics := map[string][]float64{}
+	for _, m := range cmp.Metrics {
+		metrics[m.Name] = m.Values
+	}
+	if r := metrics["return"]; len(r) != 3 || !near(r[0], 0.3) || !near(r[1], -0.05) || !near(r[2], 0.5) {
+		t.Fatalf("收益指标%v", r)
+	}
+	if r := metrics["bars"]; len(r) != 3 || r[0] != 4 || r[1] != 3 || r[2] != 2 {
+		t.Fatalf("K线数量指标%v", r)
+	}
+	if r := metrics["trades"]; len(r) != 3 || r[0] != 2 || r[2] != 1 {
+		t.Fatalf("交易次数指标%v", r)
+	}
+}
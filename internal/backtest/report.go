@@ -0,0 +1,260 @@
+package backtest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/injoyai/conv"
+)
+
+const (
+	ReportHTML   = "html"   //网页报告,包含权益曲线、回撤、月度收益和交易列表
+	ReportJSON   = "json"   //完整的回测记录
+	ReportTrades = "trades" //交易明细csv
+	ReportEquity = "equity" //每日权益、现金、持仓csv
+)
+
+// Report 生成回测报告,返回文件名和内容
+func (this *History) Report(format string) (string, []byte, error) {
+	name := fmt.Sprintf("backtest-%d", this.ID)
+	if format == ReportJSON {
+		bs, err := json.MarshalIndent(this, "", "  ")
+		return name + ".json", bs, err
+	}
+	if this.Result == nil || len(this.Times) != len(this.Result.Equity) {
+		return "", nil, errors.New("全市场回测仅支持json报告")
+	}
+	switch format {
+	case ReportHTML, "":
+		bs, err := this.html()
+		return name + ".html", bs, err
+	case ReportTrades:
+		bs, err := this.tradesCSV()
+		return name + "-trades.csv", bs, err
+	case ReportEquity:
+		bs, err := this.equityCSV()
+		return name + "-equity.csv", bs, err
+	default:
+		return "", nil, fmt.Errorf("不支持的报告格式: %s", format)
+	}
+}
+
+func (this *History) tradesCSV() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	w := csv.NewWriter(buf)
+	w.Write([]string{"time", "index", "side", "price", "qty", "amount"})
+	for _, t := range this.Result.Trades {
+		w.Write([]string{
+			time.Unix(t.Time, 0).Format(time.DateOnly),
+			strconv.Itoa(t.Index),
+			t.Side,
+			strconv.FormatFloat(t.Price, 'f', 4, 64),
+			strconv.Itoa(t.Qty),
+			strconv.FormatFloat(t.Price*float64(t.Qty), 'f', 2, 64),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func (this *History) equityCSV() ([]byte, error) {
+	res := this.Result
+	buf := bytes.NewBuffer(nil)
+	w := csv.NewWriter(buf)
+	w.Write([]string{"date", "equity", "cash", "position", "drawdown"})
+	dd := drawdownSeries(res.Equity)
+	for i, t := range this.Times {
+		row := []string{
+			time.Unix(t, 0).Format(time.DateOnly),
+			strconv.FormatFloat(res.Equity[i], 'f', 2, 64),
+			"", "",
+			strconv.FormatFloat(dd[i], 'f', 6, 64),
+		}
+		if i < len(res.Cash) {
+			row[2] = strconv.FormatFloat(res.Cash[i], 'f', 2, 64)
+		}
+		if i < len(res.Position) {
+			row[3] = strconv.Itoa(res.Position[i])
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// drawdownSeries 每根K线相对之前峰值的回撤比例
+func drawdownSeries(eq []float64) []float64 {
+	out := make([]float64, len(eq))
+	var peak float64
+	for i, v := range eq {
+		if v > peak {
+			peak = v
+		}
+		if peak > 0 {
+			out[i] = (peak - v) / peak
+		}
+	}
+	return out
+}
+
+// monthReturn 月度收益,按月末权益计算
+type monthReturn struct {
+	Year   int
+	Months [12]*float64
+	Total  float64
+}
+
+func (this *History) monthReturns() []*monthReturn {
+	out := []*monthReturn(nil)
+	eq := this.Result.Equity
+	prev := this.Settings.Cash
+	yearStart := prev
+	for i, t := range this.Times {
+		tm := time.Unix(t, 0)
+		last := i == len(this.Times)-1
+		if !last && time.Unix(this.Times[i+1], 0).Month() == tm.Month() {
+			continue
+		}
+		//月末
+		if len(out) == 0 || out[len(out)-1].Year != tm.Year() {
+			out = append(out, &monthReturn{Year: tm.Year()})
+			yearStart = prev
+		}
+		y := out[len(out)-1]
+		if prev > 0 {
+			r := eq[i]/prev - 1
+			y.Months[tm.Month()-1] = &r
+		}
+		if yearStart > 0 {
+			y.Total = eq[i]/yearStart - 1
+		}
+		prev = eq[i]
+	}
+	return out
+}
+
+// svgLine 把序列画成内联的svg折线
+func svgLine(values []float64, width, height int, color string, fill bool) template.HTML {
+	if len(values) == 0 {
+		return ""
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		lo = math.Min(lo, v)
+		hi = math.Max(hi, v)
+	}
+	if hi == lo {
+		hi = lo + 1
+	}
+	pts := make([]string, len(values))
+	for i, v := range values {
+		x := float64(width) * float64(i) / math.Max(1, float64(len(values)-1))
+		y := float64(height) * (hi - v) / (hi - lo)
+		pts[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	line := strings.Join(pts, " ")
+	s := fmt.Sprintf(`<svg viewBox="0 0 %d %d" width="100%%" height="%d" preserveAspectRatio="none">`, width, height, height)
+	if fill {
+		s += fmt.Sprintf(`<polygon points="0,0 %s %d,0" fill="%s" fill-opacity="0.2"/>`, line, width, color)
+	}
+	s += fmt.Sprintf(`<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5" vector-effect="non-scaling-stroke"/>`, line, color)
+	s += fmt.Sprintf(`<text x="4" y="12" font-size="11" fill="#888">%s</text>`, conv.String(hi))
+	s += fmt.Sprintf(`<text x="4" y="%d" font-size="11" fill="#888">%s</text></svg>`, height-4, conv.String(lo))
+	return template.HTML(s)
+}
+
+// heatColor 月度收益的颜色,红涨绿跌
+func heatColor(r *float64) template.CSS {
+	if r == nil {
+		return "background:#fafafa"
+	}
+	a := math.Min(math.Abs(*r)/0.1, 1)*0.8 + 0.1
+	if *r >= 0 {
+		return template.CSS(fmt.Sprintf("background:rgba(245,34,45,%.2f)", a))
+	}
+	return template.CSS(fmt.Sprintf("background:rgba(82,196,26,%.2f)", a))
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"pct": func(v float64) string { return fmt.Sprintf("%.2f%%", v*100) },
+	"pctp": func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprintf("%.2f%%", *v*100)
+	},
+	"heat":  heatColor,
+	"date":  func(t int64) string { return time.Unix(t, 0).Format(time.DateOnly) },
+	"price": func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="UTF-8">
+<title>回测报告 #{{.H.ID}} {{.H.Strategy}} {{.H.Code}}</title>
+<style>
+body{font-family:'Microsoft YaHei',Arial,sans-serif;margin:24px;color:#333}
+h1{font-size:20px}h2{font-size:16px;margin-top:28px}
+table{border-collapse:collapse;font-size:13px}
+td,th{border:1px solid #e8e8e8;padding:4px 8px;text-align:right}
+th{background:#fafafa}
+.metrics td{text-align:left}
+.chart{border:1px solid #e8e8e8;padding:4px}
+</style>
+</head>
+<body>
+<h1>回测报告 #{{.H.ID}}</h1>
+<table class="metrics">
+<tr><th>策略</th><td>{{.H.Strategy}}{{if .H.Version}} (版本{{.H.Version}}){{end}}</td><th>股票</th><td>{{.H.Code}}</td></tr>
+<tr><th>数据区间</th><td>{{.H.DataStart.Format "2006-01-02"}} ~ {{.H.DataEnd.Format "2006-01-02"}}</td><th>生成时间</th><td>{{.Now}}</td></tr>
+<tr><th>初始资金</th><td>{{.H.Settings.Cash}}</td><th>每次数量</th><td>{{if .H.Settings.Size}}{{.H.Settings.Size}}{{else}}一手{{end}}</td></tr>
+<tr><th>手续费率</th><td>{{.H.Settings.FeeRate}}</td><th>最低手续费</th><td>{{.H.Settings.MinFee}}</td></tr>
+<tr><th>滑点</th><td>{{.H.Settings.Slippage}}</td><th>止损/止盈</th><td>{{.H.Settings.StopLoss}} / {{.H.Settings.TakeProfit}}</td></tr>
+<tr><th>总收益</th><td>{{pct .H.Return}}</td><th>最大回撤</th><td>{{pct .H.MaxDD}}</td></tr>
+<tr><th>Sharpe</th><td>{{printf "%.2f" .H.Sharpe}}</td><th>交易次数</th><td>{{.H.Trades}}</td></tr>
+</table>
+<h2>权益曲线</h2>
+<div class="chart">{{.Equity}}</div>
+<h2>回撤</h2>
+<div class="chart">{{.Drawdown}}</div>
+<h2>月度收益</h2>
+<table>
+<tr><th>年份</th>{{range $m := .MonthNames}}<th>{{$m}}</th>{{end}}<th>全年</th></tr>
+{{range .Months}}<tr><th>{{.Year}}</th>{{range .Months}}<td style="{{heat .}}">{{pctp .}}</td>{{end}}<td>{{pct .Total}}</td></tr>
+{{end}}</table>
+<h2>交易列表</h2>
+<table>
+<tr><th>日期</th><th>K线</th><th>方向</th><th>价格</th><th>数量</th></tr>
+{{range .H.Result.Trades}}<tr><td>{{date .Time}}</td><td>{{.Index}}</td><td>{{if eq .Side "buy"}}买入{{else}}卖出{{end}}</td><td>{{price .Price}}</td><td>{{.Qty}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (this *History) html() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	err := reportTemplate.Execute(buf, map[string]any{
+		"H":          this,
+		"Now":        time.Now().Format(time.DateTime),
+		"Equity":     svgLine(this.Result.Equity, 1000, 260, "#1890ff", false),
+		"Drawdown":   svgLine(negative(drawdownSeries(this.Result.Equity)), 1000, 140, "#f5222d", true),
+		"Months":     this.monthReturns(),
+		"MonthNames": []string{"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+	})
+	return buf.Bytes(), err
+}
+
+func negative(xs []float64) []float64 {
+	out := make([]float64, len(xs))
+	for i, v := range xs {
+		out[i] = -v
+	}
+	return out
+}
@@ -0,0 +1,206 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func unix(year int, month time.Month, day int) int64 {
+	return time.Date(year, month, day, 15, 0, 0, 0, time.Local).Unix()
+}
+
+func testReport() *History {
+	return &History{
+		ID:        7,
+		Kind:      KindSingle,
+		Strategy:  "<ma>",
+		Code:      "sz000001",
+		Settings:  Settings{Cash: 1000},
+		DataStart: time.Unix(unix(2024, 1, 30), 0),
+		DataEnd:   time.Unix(unix(2025, 1, 2), 0),
+		Times: []int64{
+			unix(2024, 1, 30), unix(2024, 1, 31),
+			unix(2024, 2, 29),
+			unix(2024, 12, 31),
+			unix(2025, 1, 2),
+		},
+		Result: &Result{
+			Equity:   []float64{1000, 1100, 990, 1188, 1306.8},
+			Cash:     []float64{1000, 100, 100, 1188, 1188},
+			Position: []int{0, 100, 100, 0, 0},
+			Trades: []Trade{
+				{Time: unix(2024, 1, 31), Index: 1, Price: 10, Side: "buy", Qty: 100},
+				{Time: unix(2024, 12, 31), Index: 3, Price: 11.88, Side: "sell", Qty: 100},
+			},
+		},
+	}
+}
+
+func readCSV(t *testing.T, bs []byte) [][]string {
+	t.Helper()
+	rows, err := csv.NewReader(strings.NewReader(string(bs))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestReportFormat(t *testing.T) {
+	h := testReport()
+	cases := []struct {
+		format string
+		name   string
+	}{
+		{"", "backtest-7.html"},
+		{ReportHTML, "backtest-7.html"},
+		{ReportJSON, "backtest-7.json"},
+		{ReportTrades, "backtest-7-trades.csv"},
+		{ReportEquity, "backtest-7-equity.csv"},
+	}
+	for _, v := range cases {
+		name, bs, err := h.Report(v.format)
+		if err != nil || name != v.name || len(bs) == 0 {
+			t.Errorf("%q: 得到%s,%v,期望%s", v.format, name, err, v.name)
+		}
+	}
+	if _, _, err := h.Report("pdf"); err == nil {
+		t.Fatal("不支持的格式应该返回错误")
+	}
+
+	//全市场回测只有json报告
+	all := &History{ID: 8, Kind: KindAll, Summary: &Summary{Total: 3}}
+	if _, _, err := all.Report(ReportHTML); err == nil {
+		t.Fatal("全市场回测不支持网页报告")
+	}
+	_, bs, err := all.Report(ReportJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(History)
+	if err = json.Unmarshal(bs, got); err != nil || got.ID != 8 || got.Summary == nil || got.Summary.Total != 3 {
+		t.Fatalf("json报告有误: %s, %v", bs, err)
+	}
+}
+
+func TestReportCSV(t *testing.T) {
+	h := testReport()
+	_, bs, err := h.Report(ReportTrades)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := readCSV(t, bs)
+	want := [][]string{
+		{"time", "index", "side", "price", "qty", "amount"},
+		{"2024-01-31", "1", "buy", "10.0000", "100", "1000.00"},
+		{"2024-12-31", "3", "sell", "11.8800", "100", "1188.00"},
+	}
+	if strings.Join(flat(rows), ",") != strings.Join(flat(want), ",") {
+		t.Fatalf("交易明细\n%v\n期望\n%v", rows, want)
+	}
+
+	_, bs, err = h.Report(ReportEquity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows = readCSV(t, bs)
+	want = [][]string{
+		{"date", "equity", "cash", "position", "drawdown"},
+		{"2024-01-30", "1000.00", "1000.00", "0", "0.000000"},
+		{"2024-01-31", "1100.00", "100.00", "100", "0.000000"},
+		{"2024-02-29", "990.00", "100.00", "100", "0.100000"},
+		{"2024-12-31", "1188.00", "1188.00", "0", "0.000000"},
+		{"2025-01-02", "1306.80", "1188.00", "0", "0.000000"},
+	}
+	if strings.Join(flat(rows), ",") != strings.Join(flat(want), ",") {
+		t.Fatalf("每日权益\n%v\n期望\n%v", rows, want)
+	}
+
+	//没有现金和持仓序列时留空
+	h.Result.Cash, h.Result.Position = nil, nil
+	_, bs, _ = h.Report(ReportEquity)
+	if rows = readCSV(t, bs); rows[1][2] != "" || rows[1][3] != "" {
+		t.Fatalf("缺少现金和持仓时%v", rows[1])
+	}
+}
+
+func flat(rows [][]string) []string {
+	out := []string(nil)
+	for _, v := range rows {
+		out = append(out, strings.Join(v, "|"))
+	}
+	return out
+}
+
+func TestMonthReturns(t *testing.T) {
+	ms := testReport().monthReturns()
+	if len(ms) != 2 || ms[0].Year != 2024 || ms[1].Year != 2025 {
+		t.Fatalf("年份有误: %v", ms)
+	}
+	cases := []struct {
+		name string
+		got  *float64
+		want float64
+	}{
+		{"2024-01", ms[0].Months[0], 0.1},
+		{"2024-02", ms[0].Months[1], -0.1},
+		{"2024-12", ms[0].Months[11], 0.2},
+		{"2025-01", ms[1].Months[0], 0.1},
+	}
+	for _, v := range cases {
+		if v.got == nil || !near(*v.got, v.want) {
+			t.Errorf("%s: 得到%v,期望%v", v.name, v.got, v.want)
+		}
+	}
+	if ms[0].Months[2] != nil {
+		t.Fatal("没有数据的月份应该为空")
+	}
+	if !near(ms[0].Total, 0.188) || !near(ms[1].Total, 0.1) {
+		t.Fatalf("全年收益%v,%v", ms[0].Total, ms[1].Total)
+	}
+}
+
+func TestReportHTML(t *testing.T) {
+	h := testReport()
+	_, bs, err := h.Report(ReportHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(bs)
+	for _, want := range []string{
+		"回测报告 #7",
+		"&lt;ma&gt;", //策略名称转义
+		"sz000001",
+		"2024-01-30 ~ 2025-01-02",
+		"一手",
+		"<svg",
+		"<th>2024</th>",
+		"10.00%", "-10.00%", "18.80%",
+		"<td>买入</td>", "<td>卖出</td>", "11.880",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("网页报告缺少%q", want)
+		}
+	}
+	if strings.Contains(s, "<ma>") {
+		t.Fatal("策略名称没有转义")
+	}
+
+	h.Settings.Size = 300
+	_, bs, _ = h.Report(ReportHTML)
+	if !strings.Contains(string(bs), "<td>300</td>") {
+		t.Fatal("每次数量没有显示")
+	}
+}
+
+func TestDrawdownSeries(t *testing.T) {
+	got := drawdownSeries([]float64{100, 120, 90, 130, 65})
+	want := []float64{0, 0, 0.25, 0, 0.5}
+	for i := range want {
+		if !near(got[i], want[i]) {
+			t.Fatalf("回撤%v,期望%v", got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/fundamental"
+	"github.com/injoyai/trategy/internal/strategy"
+)
+
+// Request 回测请求,单只股票回测时需要Code,全市场回测时忽略Code,按Universe或Type选择品种
+type Request struct {
+	Strategy   string  `json:"strategy"`
+	Code       string  `json:"code"`
+	Type       string  `json:"type"`      //全市场回测的品种,默认stock
+	Universe   string  `json:"universe"`  //全市场回测的股票池名称,按开始日期前的数据过滤,设置后忽略Type
+	Interval   string  `json:"interval"`  //K线周期,day日线,min分钟线,默认day
+	Benchmark  string  `json:"benchmark"` //基准,指数代码例sh000300,或板块指数例sector:银行,sector:银行:cap
+	Start      string  `json:"start"`
+	End        string  `json:"end"`
+	Cash       float64 `json:"cash"`
+	Size       int     `json:"size"` //每次交易的股数,0为一手(科创板200股),见data.Rule.Qty;旧版本默认1股且不取整,现在1股按一手成交
+	FeeRate    float64 `json:"fee_rate"`
+	MinFee     float64 `json:"min_fee"`
+	Slippage   float64 `json:"slippage"`
+	StopLoss   float64 `json:"stop_loss"`
+	TakeProfit float64 `json:"take_profit"`
+	Debug      bool    `json:"debug"`
+	Goroutines int     `json:"goroutines"` //全市场回测的并发数量,默认CPU数量
+}
+
+// Settings 转成回测配置,未设置的参数使用默认值
+func (this *Request) Settings() Settings {
+	cash := this.Cash
+	if cash <= 0 {
+		cash = 100000
+	}
+	size := max(this.Size, 0)
+	feeRate := this.FeeRate
+	if feeRate <= 0 {
+		feeRate = 0.0005
+	}
+	minFee := this.MinFee
+	if minFee <= 0 {
+		minFee = 5
+	}
+	perDay := 1
+	if this.Interval == IntervalMin {
+		perDay = 240
+	}
+	return Settings{
+		Cash:       cash,
+		Size:       size,
+		FeeRate:    feeRate,
+		MinFee:     minFee,
+		Slippage:   this.Slippage,
+		StopLoss:   this.StopLoss,
+		TakeProfit: this.TakeProfit,
+		Debug:      this.Debug,
+		Rule:       data.RuleOf(this.Code),
+		PerDay:     perDay,
+	}
+}
+
+// K线周期
+const (
+	IntervalDay = "day"
+	IntervalMin = "min"
+)
+
+// klines 按周期读取回测的K线
+func (this *Request) klines(code string, start, end time.Time) (protocol.Klines, error) {
+	switch this.Interval {
+	case "", IntervalDay:
+		return common.Data.GetDayKlines(code, start, end)
+	case IntervalMin:
+		return common.Data.GetMinKlines(code, start, end)
+	default:
+		return nil, fmt.Errorf("不支持的K线周期: %s", this.Interval)
+	}
+}
+
+// Range 解析回测区间,开始默认1990-01-01,结束默认当前时间
+func (this *Request) Range() (start, end time.Time, err error) {
+	start = time.Date(1990, 1, 1, 0, 0, 0, 0, time.Local)
+	end = time.Now()
+	if this.Start != "" {
+		start, err = time.Parse(time.DateOnly, this.Start)
+		if err != nil {
+			return
+		}
+	}
+	if this.End != "" {
+		end, err = time.Parse(time.DateOnly, this.End)
+	}
+	return
+}
+
+func (this *Request) strategy() (strategy.Interface, error) {
+	strat := strategy.Get(this.Strategy)
+	if strat == nil {
+		return nil, errors.New("strategy not found")
+	}
+	return strat, nil
+}
+
+// fundamentals 策略需要基本面数据时按K线生成基本面序列,否则返回nil
+func fundamentals(strat strategy.Interface, code string, ks protocol.Klines) (map[string][]float64, error) {
+	if !strategy.NeedFundamental(strat) {
+		return nil, nil
+	}
+	return fundamental.Series(common.Data, code, ks)
+}
+
+// Run 回测单只股票,并保存回测记录
+func Run(req *Request) (*Result, error) {
+	strat, err := req.strategy()
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := req.Range()
+	if err != nil {
+		return nil, err
+	}
+	ks, err := req.klines(req.Code, start, end)
+	if err != nil {
+		return nil, err
+	}
+	settings := req.Settings()
+	if settings.Fundamentals, err = fundamentals(strat, req.Code, ks); err != nil {
+		return nil, err
+	}
+	res, err := RunBacktestAdvanced(ks, strat, settings)
+	if err != nil {
+		return nil, err
+	}
+	if err = applyBenchmark(req.Benchmark, ks, &res, req.Settings().Cash); err != nil {
+		return nil, err
+	}
+	if err = saveResult(req, strat, ks, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
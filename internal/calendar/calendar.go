@@ -0,0 +1,270 @@
+package calendar
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/injoyai/goutil/database/xorms"
+	"github.com/injoyai/logs"
+	"github.com/robfig/cron/v3"
+	"xorm.io/xorm"
+)
+
+// DefaultSpec 每天开盘前刷新
+const DefaultSpec = "0 0 9 * * *"
+
+// sessions 交易时段,距离零点的时间,中间是午休
+var sessions = [][2]time.Duration{
+	{9*time.Hour + 30*time.Minute, 11*time.Hour + 30*time.Minute},
+	{13 * time.Hour, 15 * time.Hour},
+}
+
+// TradingDay 保存的交易日,例20240102
+type TradingDay struct {
+	Date int `json:"date" xorm:"pk"`
+}
+
+// Fetcher 获取全部交易日
+type Fetcher func() ([]time.Time, error)
+
+// Session 交易时段
+type Session struct {
+	Open  time.Time `json:"open"`
+	Close time.Time `json:"close"`
+}
+
+/*
+New 交易日历,交易日保存在数据库,启动时读取,为空时从fetch拉取
+超出已知范围的日期(例如未来)按周一到周五计算
+*/
+func New(db *xorms.Engine, fetch Fetcher) (*Calendar, error) {
+	if err := db.Sync2(new(TradingDay)); err != nil {
+		return nil, err
+	}
+	c := &Calendar{db: db, fetch: fetch}
+	days := []*TradingDay(nil)
+	if err := db.Asc("Date").Find(&days); err != nil {
+		return nil, err
+	}
+	if len(days) == 0 {
+		//拉取失败不影响启动,按工作日计算
+		logs.PrintErr(c.Refresh())
+		return c, nil
+	}
+	ls := make([]int, len(days))
+	for i, v := range days {
+		ls[i] = v.Date
+	}
+	c.set(ls)
+	return c, nil
+}
+
+type Calendar struct {
+	db    *xorms.Engine
+	fetch Fetcher
+	mu    sync.RWMutex
+	days  []int //升序
+	index map[int]bool
+}
+
+func (this *Calendar) set(days []int) {
+	index := make(map[int]bool, len(days))
+	for _, v := range days {
+		index[v] = true
+	}
+	this.mu.Lock()
+	this.days = days
+	this.index = index
+	this.mu.Unlock()
+}
+
+// Refresh 重新拉取并保存交易日
+func (this *Calendar) Refresh() error {
+	if this.fetch == nil {
+		return nil
+	}
+	ts, err := this.fetch()
+	if err != nil {
+		return err
+	}
+	if len(ts) == 0 {
+		return nil
+	}
+	days := make([]int, 0, len(ts))
+	for _, t := range ts {
+		days = append(days, key(t))
+	}
+	sort.Ints(days)
+	err = this.db.SessionFunc(func(session *xorm.Session) error {
+		if _, err := session.Where("1=1").Delete(new(TradingDay)); err != nil {
+			return err
+		}
+		for _, v := range days {
+			if _, err := session.Insert(&TradingDay{Date: v}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	this.set(days)
+	return nil
+}
+
+// Start 定时刷新
+func (this *Calendar) Start(spec string) error {
+	cr := cron.New(cron.WithSeconds())
+	_, err := cr.AddFunc(spec, func() { logs.PrintErr(this.Refresh()) })
+	if err != nil {
+		return err
+	}
+	cr.Start()
+	return nil
+}
+
+func key(t time.Time) int {
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
+}
+
+func date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// IsTradingDay 是否是交易日
+func (this *Calendar) IsTradingDay(t time.Time) bool {
+	k := key(t)
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	if len(this.days) == 0 || k < this.days[0] || k > this.days[len(this.days)-1] {
+		return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday
+	}
+	return this.index[k]
+}
+
+// Next 下一个交易日,不包含t当天
+func (this *Calendar) Next(t time.Time) time.Time {
+	d := date(t)
+	for {
+		d = d.AddDate(0, 0, 1)
+		if this.IsTradingDay(d) {
+			return d
+		}
+	}
+}
+
+// Prev 上一个交易日,不包含t当天
+func (this *Calendar) Prev(t time.Time) time.Time {
+	d := date(t)
+	for i := 0; i < 366*5; i++ {
+		d = d.AddDate(0, 0, -1)
+		if this.IsTradingDay(d) {
+			return d
+		}
+	}
+	return d
+}
+
+// Days [start,end]之间的交易日
+func (this *Calendar) Days(start, end time.Time) []time.Time {
+	out := []time.Time(nil)
+	for d := date(start); !d.After(end); d = d.AddDate(0, 0, 1) {
+		if this.IsTradingDay(d) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Count [start,end]之间的交易日数量
+func (this *Calendar) Count(start, end time.Time) int {
+	return len(this.Days(start, end))
+}
+
+// Sessions t当天的交易时段,非交易日返回空
+func (this *Calendar) Sessions(t time.Time) []Session {
+	if !this.IsTradingDay(t) {
+		return nil
+	}
+	d := date(t)
+	out := make([]Session, len(sessions))
+	for i, v := range sessions {
+		out[i] = Session{Open: d.Add(v[0]), Close: d.Add(v[1])}
+	}
+	return out
+}
+
+// IsOpen t是否在交易时段内
+func (this *Calendar) IsOpen(t time.Time) bool {
+	for _, s := range this.Sessions(t) {
+		if !t.Before(s.Open) && t.Before(s.Close) {
+			return true
+		}
+	}
+	return false
+}
+
+// LastClose t之前(包含t)最近一次收盘的时间
+func (this *Calendar) LastClose(t time.Time) time.Time {
+	if ss := this.Sessions(t); len(ss) > 0 {
+		if c := ss[len(ss)-1].Close; !t.Before(c) {
+			return c
+		}
+	}
+	return this.Prev(t).Add(sessions[len(sessions)-1][1])
+}
+
+/*
+BarsBetween [start,end)之间的K线数量,按交易时段计算
+period大于等于一天时按交易日计算,例如5分钟线一个交易日48根
+*/
+func (this *Calendar) BarsBetween(start, end time.Time, period time.Duration) int {
+	if !end.After(start) || period <= 0 {
+		return 0
+	}
+	if period >= 24*time.Hour {
+		return this.Count(start, end.Add(-time.Nanosecond)) / int(period/(24*time.Hour))
+	}
+	var total time.Duration
+	for d := date(start); d.Before(end); d = d.AddDate(0, 0, 1) {
+		for _, s := range this.Sessions(d) {
+			open, close := s.Open, s.Close
+			if open.Before(start) {
+				open = start
+			}
+			if close.After(end) {
+				close = end
+			}
+			if close.After(open) {
+				total += close.Sub(open)
+			}
+		}
+	}
+	return int(total / period)
+}
+
+// PerYear 每年的交易日数量,取最近3个完整年份的平均值,没有数据时返回252
+func (this *Calendar) PerYear() float64 {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	if len(this.days) == 0 {
+		return 252
+	}
+	counts := map[int]int{}
+	for _, v := range this.days {
+		counts[v/10000]++
+	}
+	first, last := this.days[0]/10000, this.days[len(this.days)-1]/10000
+	sum, n := 0, 0
+	//去掉首尾不完整的年份
+	for y := last - 1; y > first && n < 3; y-- {
+		sum += counts[y]
+		n++
+	}
+	if n == 0 {
+		return 252
+	}
+	return float64(sum) / float64(n)
+}
@@ -0,0 +1,213 @@
+package calendar
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/injoyai/goutil/database/sqlite"
+)
+
+func at(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2024, month, day, hour, minute, 0, 0, time.Local)
+}
+
+// testCalendar 2024年2月,9日到18日是春节假期,范围外按周一到周五计算
+func testCalendar() *Calendar {
+	c := new(Calendar)
+	c.set([]int{20240201, 20240202, 20240205, 20240206, 20240207, 20240208, 20240219, 20240220, 20240221, 20240222, 20240223})
+	return c
+}
+
+func TestIsTradingDay(t *testing.T) {
+	c := testCalendar()
+	for d, want := range map[time.Time]bool{
+		at(2, 8, 0, 0):  true,
+		at(2, 9, 0, 0):  false, //周五,假期
+		at(2, 10, 0, 0): false,
+		at(2, 19, 0, 0): true,
+		at(1, 31, 0, 0): true, //范围外的周三
+		at(3, 1, 0, 0):  true, //范围外的周五
+		at(3, 2, 0, 0):  false,
+	} {
+		if got := c.IsTradingDay(d); got != want {
+			t.Errorf("%s: 得到%v,期望%v", d.Format(time.DateOnly), got, want)
+		}
+	}
+}
+
+func TestNextPrev(t *testing.T) {
+	c := testCalendar()
+	cases := []struct {
+		name string
+		got  time.Time
+		want time.Time
+	}{
+		{"假期前的下一个", c.Next(at(2, 8, 10, 0)), at(2, 19, 0, 0)},
+		{"假期中的下一个", c.Next(at(2, 12, 0, 0)), at(2, 19, 0, 0)},
+		{"超出范围的下一个", c.Next(at(2, 23, 0, 0)), at(2, 26, 0, 0)},
+		{"假期后的上一个", c.Prev(at(2, 19, 16, 0)), at(2, 8, 0, 0)},
+		{"超出范围的上一个", c.Prev(at(2, 1, 0, 0)), at(1, 31, 0, 0)},
+	}
+	for _, v := range cases {
+		if !v.got.Equal(v.want) {
+			t.Errorf("%s: 得到%v,期望%v", v.name, v.got, v.want)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	c := testCalendar()
+	cases := []struct {
+		start, end time.Time
+		want       int
+	}{
+		{at(2, 1, 0, 0), at(2, 23, 0, 0), 11},
+		{at(2, 9, 0, 0), at(2, 18, 0, 0), 0},
+		{at(2, 8, 0, 0), at(2, 19, 0, 0), 2}, //包含首尾
+		{at(2, 8, 15, 0), at(2, 19, 0, 0), 2},
+		{at(2, 26, 0, 0), at(3, 3, 0, 0), 5}, //范围外按工作日
+	}
+	for _, v := range cases {
+		if got := c.Count(v.start, v.end); got != v.want {
+			t.Errorf("%s到%s: 得到%d,期望%d", v.start.Format(time.DateOnly), v.end.Format(time.DateOnly), got, v.want)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	c := testCalendar()
+	ss := c.Sessions(at(2, 8, 12, 0))
+	if len(ss) != 2 || !ss[0].Open.Equal(at(2, 8, 9, 30)) || !ss[0].Close.Equal(at(2, 8, 11, 30)) ||
+		!ss[1].Open.Equal(at(2, 8, 13, 0)) || !ss[1].Close.Equal(at(2, 8, 15, 0)) {
+		t.Fatalf("交易时段有误: %v", ss)
+	}
+	if ss = c.Sessions(at(2, 9, 10, 0)); ss != nil {
+		t.Fatalf("假期不应该有交易时段: %v", ss)
+	}
+	for tm, want := range map[time.Time]bool{
+		at(2, 8, 9, 29):  false,
+		at(2, 8, 9, 30):  true,
+		at(2, 8, 11, 29): true,
+		at(2, 8, 11, 30): false, //午休
+		at(2, 8, 12, 0):  false,
+		at(2, 8, 13, 0):  true,
+		at(2, 8, 15, 0):  false,
+		at(2, 9, 10, 0):  false,
+	} {
+		if got := c.IsOpen(tm); got != want {
+			t.Errorf("%s: 得到%v,期望%v", tm.Format(time.DateTime), got, want)
+		}
+	}
+}
+
+func TestLastClose(t *testing.T) {
+	c := testCalendar()
+	cases := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"收盘前", at(2, 19, 14, 59), at(2, 8, 15, 0)},
+		{"收盘时", at(2, 19, 15, 0), at(2, 19, 15, 0)},
+		{"收盘后", at(2, 19, 20, 0), at(2, 19, 15, 0)},
+		{"开盘前", at(2, 20, 9, 0), at(2, 19, 15, 0)},
+		{"假期中", at(2, 12, 16, 0), at(2, 8, 15, 0)},
+		{"周末", at(2, 4, 10, 0), at(2, 2, 15, 0)},
+	}
+	for _, v := range cases {
+		if got := c.LastClose(v.t); !got.Equal(v.want) {
+			t.Errorf("%s: 得到%v,期望%v", v.name, got, v.want)
+		}
+	}
+}
+
+func TestBarsBetween(t *testing.T) {
+	c := testCalendar()
+	cases := []struct {
+		name       string
+		start, end time.Time
+		period     time.Duration
+		want       int
+	}{
+		{"1分钟线一天", at(2, 8, 0, 0), at(2, 9, 0, 0), time.Minute, 240},
+		{"5分钟线一天", at(2, 8, 0, 0), at(2, 9, 0, 0), 5 * time.Minute, 48},
+		{"跨午休", at(2, 8, 11, 0), at(2, 8, 13, 30), time.Minute, 60},
+		{"跨假期", at(2, 8, 14, 0), at(2, 19, 10, 30), time.Minute, 120},
+		{"假期", at(2, 9, 0, 0), at(2, 19, 0, 0), time.Minute, 0},
+		{"日线不包含结束", at(2, 1, 0, 0), at(2, 19, 0, 0), 24 * time.Hour, 6},
+		{"周线", at(2, 1, 0, 0), at(2, 24, 0, 0), 2 * 24 * time.Hour, 5},
+		{"结束早于开始", at(2, 19, 0, 0), at(2, 8, 0, 0), time.Minute, 0},
+		{"周期为0", at(2, 8, 0, 0), at(2, 9, 0, 0), 0, 0},
+	}
+	for _, v := range cases {
+		if got := c.BarsBetween(v.start, v.end, v.period); got != v.want {
+			t.Errorf("%s: 得到%d,期望%d", v.name, got, v.want)
+		}
+	}
+}
+
+func TestWeekdays(t *testing.T) {
+	c := new(Calendar)
+	if c.IsTradingDay(at(2, 10, 0, 0)) || !c.IsTradingDay(at(2, 9, 0, 0)) {
+		t.Fatal("没有交易日时按周一到周五计算")
+	}
+	if n := c.Count(at(2, 5, 0, 0), at(2, 11, 0, 0)); n != 5 {
+		t.Fatalf("一周的交易日%d,期望5", n)
+	}
+	if got := c.LastClose(at(2, 12, 10, 0)); !got.Equal(at(2, 9, 15, 0)) {
+		t.Fatalf("周一收盘前最近的收盘%v,期望上周五", got)
+	}
+	if c.PerYear() != 252 {
+		t.Fatalf("没有交易日时每年%v,期望252", c.PerYear())
+	}
+}
+
+func TestPerYear(t *testing.T) {
+	days := []int(nil)
+	counts := map[int]int{}
+	for d := time.Date(2019, 6, 1, 0, 0, 0, 0, time.Local); d.Year() < 2025 || d.Month() < 3; d = d.AddDate(0, 0, 1) {
+		if d.Weekday() != time.Saturday && d.Weekday() != time.Sunday {
+			days = append(days, key(d))
+			counts[d.Year()]++
+		}
+	}
+	c := new(Calendar)
+	c.set(days)
+	//去掉首尾不完整的年份,取最近3年
+	want := float64(counts[2022]+counts[2023]+counts[2024]) / 3
+	if got := c.PerYear(); got != want {
+		t.Fatalf("每年交易日%v,期望%v", got, want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	db, err := sqlite.NewXorm(filepath.Join(t.TempDir(), "calendar.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fetched := []time.Time{at(2, 8, 0, 0), at(2, 19, 0, 0), at(2, 20, 0, 0)}
+	c, err := New(db, func() ([]time.Time, error) { return fetched, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.IsTradingDay(at(2, 9, 0, 0)) || !c.IsTradingDay(at(2, 19, 0, 0)) {
+		t.Fatal("拉取的交易日没有生效")
+	}
+
+	//保存到数据库,再次启动时不拉取
+	c, err = New(db, func() ([]time.Time, error) { return nil, errors.New("不应该拉取") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Count(at(2, 8, 0, 0), at(2, 20, 0, 0)); n != 3 {
+		t.Fatalf("从数据库读取的交易日%d,期望3", n)
+	}
+
+	//拉取失败时保留原来的交易日
+	if err = c.Refresh(); err == nil || !c.IsTradingDay(at(2, 19, 0, 0)) {
+		t.Fatalf("拉取失败应该返回错误并保留原来的交易日: %v", err)
+	}
+}
@@ -1,11 +1,14 @@
 package common
 
 import (
+	"path/filepath"
+
 	"github.com/injoyai/conv/cfg"
 	"github.com/injoyai/goutil/database/sqlite"
 	"github.com/injoyai/goutil/database/xorms"
 	"github.com/injoyai/logs"
 	"github.com/injoyai/tdx"
+	"github.com/injoyai/trategy/internal/calendar"
 	"github.com/injoyai/trategy/internal/data"
 	"github.com/injoyai/trategy/internal/lib"
 	"github.com/traefik/yaegi/interp"
@@ -13,37 +16,87 @@ import (
 )
 
 var (
-	Data *data.Data
+	Data data.Source
 
 	DB *xorms.Engine
 
+	//Tick 分笔成交和盘口快照,数据量大,单独一个数据库
+	Tick *xorms.Engine
+
+	Calendar *calendar.Calendar
+
 	Script *interp.Interpreter
 )
 
 func Init() error {
-	m, err := tdx.NewManage(tdx.WithClients(3))
+	src, err := newSource()
 	if err != nil {
 		return err
 	}
-	Data, err = data.NewManage(m)
+
+	DB, err = sqlite.NewXorm(cfg.GetString("database.filename"))
 	if err != nil {
 		return err
 	}
 
-	DB, err = sqlite.NewXorm(cfg.GetString("database.filename"))
+	Tick, err = sqlite.NewXorm(cfg.GetString("tick.filename", filepath.Join(tdx.DefaultDatabaseDir, "tick.db")))
 	if err != nil {
 		return err
 	}
 
-	Script = interp.New(interp.Options{})
-	err = Script.Use(stdlib.Symbols)
+	Calendar, err = calendar.New(DB, src.TradingDays)
+	if err != nil {
+		return err
+	}
+	if d, ok := src.(*data.Data); ok {
+		d.SetCalendar(Calendar)
+	}
+
+	//日线缓存,单位MB,0表示不缓存
+	Data = data.NewCache(src, cfg.GetInt64("data.cache.size", 512)<<20)
+
+	Script = NewScript()
+
+	return nil
+}
+
+// NewScript 新建脚本解释器,加载标准库和项目的符号
+func NewScript() *interp.Interpreter {
+	i := interp.New(interp.Options{})
+	err := i.Use(stdlib.Symbols)
 	if err != nil {
 		logs.Err(err)
 	}
-	err = Script.Use(lib.Symbols)
+	err = i.Use(lib.Symbols)
 	if err != nil {
 		logs.Err(err)
 	}
+	return i
+}
 
-	return nil
+// WarmCache 配置了data.cache.warm时在后台预热全市场日线
+func WarmCache() {
+	if c, ok := Data.(*data.Cache); ok && cfg.GetBool("data.cache.warm") {
+		go c.Warm(nil)
+	}
+}
+
+// newSource 按配置选择数据源,data.source为offline时读取data.dir,不连接服务器
+func newSource() (data.Source, error) {
+	switch cfg.GetString("data.source", "tdx") {
+	case "offline":
+		return data.NewOffline(cfg.GetString("data.dir", tdx.DefaultDatabaseDir), cfg.GetString("data.format"))
+	default:
+		m, err := tdx.NewManage(tdx.WithClients(3))
+		if err != nil {
+			return nil, err
+		}
+		d, err := data.NewManage(m)
+		if err != nil {
+			return nil, err
+		}
+		//需要更新的品种,默认全部
+		d.Types = cfg.GetStrings("data.types", data.Types)
+		return d, nil
+	}
 }
@@ -0,0 +1,306 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/injoyai/goutil/database/sqlite"
+	"github.com/injoyai/goutil/g"
+	"github.com/injoyai/tdx"
+	"github.com/injoyai/tdx/protocol"
+	"xorm.io/xorm"
+)
+
+const (
+	IssueMissing   = "missing"   //没有数据
+	IssueGap       = "gap"       //缺少交易日,也可能是停牌
+	IssueDuplicate = "duplicate" //重复的时间
+	IssueBadPrice  = "bad_price" //价格小于等于0
+	IssueHighLow   = "high_low"  //最高价低于最低价,或开收不在高低之间
+	IssueJump      = "jump"      //涨跌幅超过限制,且当天没有除权除息
+	IssueStale     = "stale"     //最后一根K线不是最近的交易日
+)
+
+// AuditReq 数据检查参数
+type AuditReq struct {
+	Codes     []string `json:"codes"`      //为空时检查全部股票
+	Start     string   `json:"start"`      //只检查这天之后的数据
+	StaleDays int      `json:"stale_days"` //最后一根K线落后超过n个交易日认为过期,默认1
+	Repair    bool     `json:"repair"`     //重新拉取有问题的区间
+}
+
+// Issue 一个问题,Start和End是受影响的区间
+type Issue struct {
+	Kind    string    `json:"kind"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Count   int       `json:"count"`
+	Message string    `json:"message"`
+}
+
+// AuditItem 单只股票的检查结果
+type AuditItem struct {
+	Code     string    `json:"code"`
+	Name     string    `json:"name"`
+	Bars     int       `json:"bars"`
+	First    time.Time `json:"first"`
+	Last     time.Time `json:"last"`
+	Issues   []Issue   `json:"issues"`
+	Repaired bool      `json:"repaired"`
+	Error    string    `json:"error,omitempty"` //修复失败的原因
+}
+
+// AuditReport 检查报告,只包含有问题的股票
+type AuditReport struct {
+	Total   int            `json:"total"`   //检查的股票数量
+	Problem int            `json:"problem"` //有问题的股票数量
+	Counts  map[string]int `json:"counts"`  //每种问题的数量
+	Items   []*AuditItem   `json:"items"`
+	Created time.Time      `json:"created"`
+}
+
+// Repairer 支持重新拉取数据的数据源
+type Repairer interface {
+	Repair(code string, start, end time.Time) error
+}
+
+// Audit 检查数据,cal为nil时按周一到周五计算交易日,progress可以为nil
+func Audit(ctx context.Context, s Source, cal Calendar, req *AuditReq, progress func(done, total int)) (*AuditReport, error) {
+	codes := req.Codes
+	if len(codes) == 0 {
+		codes = s.GetStockCodes()
+	}
+	start := time.Time{}
+	if req.Start != "" {
+		var err error
+		if start, err = time.ParseInLocation(time.DateOnly, req.Start, time.Local); err != nil {
+			return nil, err
+		}
+	}
+	staleDays := req.StaleDays
+	if staleDays <= 0 {
+		staleDays = 1
+	}
+	if cal == nil {
+		cal = weekdays{}
+	}
+	last := cal.LastClose(time.Now())
+	latest := time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.Local)
+
+	report := &AuditReport{Total: len(codes), Counts: map[string]int{}, Items: []*AuditItem{}, Created: time.Now()}
+	for i, code := range codes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		item := auditCode(s, cal, code, start, latest, staleDays)
+		if len(item.Issues) > 0 {
+			if req.Repair {
+				repair(s, item)
+			}
+			report.Problem++
+			for _, v := range item.Issues {
+				report.Counts[v.Kind]++
+			}
+			report.Items = append(report.Items, item)
+		}
+		if progress != nil {
+			progress(i+1, len(codes))
+		}
+	}
+	return report, nil
+}
+
+func auditCode(s Source, cal Calendar, code string, start, latest time.Time, staleDays int) *AuditItem {
+	item := &AuditItem{Code: code, Name: s.GetName(code), Issues: []Issue{}}
+	ks, err := s.GetDayKlines(code, start, time.Now().AddDate(0, 0, 1))
+	if err != nil || len(ks) == 0 {
+		msg := "没有数据"
+		if err != nil {
+			msg = err.Error()
+		}
+		item.Issues = append(item.Issues, Issue{Kind: IssueMissing, Start: start, End: latest, Message: msg})
+		return item
+	}
+	sort.SliceStable(ks, func(i, j int) bool { return ks[i].Time.Before(ks[j].Time) })
+	item.Bars = len(ks)
+	item.First = ks[0].Time
+	item.Last = ks[len(ks)-1].Time
+
+	//重复的时间,按股票分文件的数据库没有唯一索引,导入也可能写入重复的K线
+	for i := 1; i < len(ks); i++ {
+		if ks[i].Time.Equal(ks[i-1].Time) {
+			item.addIssue(IssueDuplicate, ks[i].Time, "重复的K线")
+		}
+	}
+
+	//价格
+	for _, k := range ks {
+		switch {
+		case k.Open <= 0 || k.High <= 0 || k.Low <= 0 || k.Close <= 0:
+			item.addIssue(IssueBadPrice, k.Time, fmt.Sprintf("开%s 高%s 低%s 收%s", k.Open, k.High, k.Low, k.Close))
+		case k.High < k.Low || k.High < k.Open || k.High < k.Close || k.Low > k.Open || k.Low > k.Close:
+			item.addIssue(IssueHighLow, k.Time, fmt.Sprintf("开%s 高%s 低%s 收%s", k.Open, k.High, k.Low, k.Close))
+		}
+	}
+
+	//缺少的交易日
+	days := map[string]bool{}
+	for _, k := range ks {
+		days[k.Time.Format(time.DateOnly)] = true
+	}
+	first := time.Date(item.First.Year(), item.First.Month(), item.First.Day(), 0, 0, 0, 0, time.Local)
+	for t := first; !t.After(item.Last); t = t.AddDate(0, 0, 1) {
+		if cal.IsTradingDay(t) && !days[t.Format(time.DateOnly)] {
+			item.addIssue(IssueGap, t, "缺少交易日,可能是停牌")
+		}
+	}
+
+	//涨跌幅,上市前5天没有涨跌幅限制
+	limit := priceLimit(code, item.Name)
+	var xrxds map[string]bool
+	for i := 5; limit > 0 && i < len(ks); i++ {
+		prev := ks[i-1].Close
+		if prev <= 0 || ks[i].Close <= 0 {
+			continue
+		}
+		change := ks[i].Close.Float64()/prev.Float64() - 1
+		if math.Abs(change) <= limit {
+			continue
+		}
+		if xrxds == nil {
+			xrxds = map[string]bool{}
+			if xs, err := s.GetXRXDs(code); err == nil {
+				for _, x := range xs {
+					xrxds[x.Time.Format(time.DateOnly)] = true
+				}
+			}
+		}
+		if !xrxds[ks[i].Time.Format(time.DateOnly)] {
+			item.addIssue(IssueJump, ks[i].Time, fmt.Sprintf("涨跌幅%.2f%%", change*100))
+		}
+	}
+
+	//最后一根K线是否过期
+	behind := 0
+	last := time.Date(item.Last.Year(), item.Last.Month(), item.Last.Day(), 0, 0, 0, 0, time.Local)
+	for t := last.AddDate(0, 0, 1); !t.After(latest); t = t.AddDate(0, 0, 1) {
+		if cal.IsTradingDay(t) {
+			behind++
+		}
+	}
+	if behind >= staleDays {
+		item.Issues = append(item.Issues, Issue{
+			Kind:    IssueStale,
+			Start:   last.AddDate(0, 0, 1),
+			End:     latest,
+			Count:   behind,
+			Message: fmt.Sprintf("落后%d个交易日", behind),
+		})
+	}
+	return item
+}
+
+// addIssue 相邻交易日的同类问题合并成一个区间
+func (this *AuditItem) addIssue(kind string, t time.Time, msg string) {
+	if n := len(this.Issues); n > 0 {
+		last := &this.Issues[n-1]
+		if last.Kind == kind && t.Sub(last.End) <= 5*24*time.Hour && kind != IssueJump {
+			last.End = t
+			last.Count++
+			return
+		}
+	}
+	this.Issues = append(this.Issues, Issue{Kind: kind, Start: t, End: t, Count: 1, Message: msg})
+}
+
+/*
+priceLimit 涨跌幅限制,加上1%的误差,没有涨跌幅限制的品种返回0
+主板的ST股票限制5%,按当前名称判断,没有历史名称
+*/
+func priceLimit(code, name string) float64 {
+	r := RuleOf(code)
+	if r.Limit <= 0 {
+		return 0
+	}
+	if BoardOf(code) == BoardMain && IsST(name) {
+		return 0.05 + 0.01
+	}
+	return r.Limit + 0.01
+}
+
+// repair 重新拉取有问题的区间,停牌造成的缺口重新拉取后仍然会存在
+func repair(s Source, item *AuditItem) {
+	r, ok := s.(Repairer)
+	if !ok {
+		item.Error = "当前数据源不支持修复"
+		return
+	}
+	start, end := time.Time{}, time.Time{}
+	for _, v := range item.Issues {
+		if start.IsZero() || v.Start.Before(start) {
+			start = v.Start
+		}
+		if v.End.After(end) {
+			end = v.End
+		}
+	}
+	if err := r.Repair(item.Code, start, end.AddDate(0, 0, 1)); err != nil {
+		item.Error = err.Error()
+		return
+	}
+	item.Repaired = true
+}
+
+// Repair 重新拉取[start,end)的日线,替换数据库里这个区间的数据
+func (this *Data) Repair(code string, start, end time.Time) error {
+	code = protocol.AddPrefix(code)
+	defer this.changed(code)
+	var resp *protocol.KlineResp
+	err := g.Retry(func() error {
+		return this.Do(func(c *tdx.Client) (err error) {
+			resp, err = getKlineDayUntil(c, code, func(k *protocol.Kline) bool {
+				return k.Time.Before(start)
+			})
+			return
+		})
+	}, this.Retry)
+	if err != nil {
+		return err
+	}
+
+	ks := protocol.Klines{}
+	for _, k := range resp.List {
+		if !k.Time.Before(start) && k.Time.Before(end) {
+			ks = append(ks, k)
+		}
+	}
+	s, err := OpenStore(this.DatabaseDir, false)
+	if err != nil {
+		return err
+	} else if s != nil {
+		return s.Replace(code, start, end, ks)
+	}
+
+	db, err := sqlite.NewXorm(this.dayKlineFilename(code))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err = db.Sync2(new(protocol.Kline)); err != nil {
+		return err
+	}
+	return db.SessionFunc(func(session *xorm.Session) error {
+		if _, err := session.Where("Time>=? and Time<?", start, end).Delete(new(protocol.Kline)); err != nil {
+			return err
+		}
+		for _, k := range ks {
+			if _, err := session.Insert(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/injoyai/goutil/database/sqlite"
+	"github.com/injoyai/tdx/protocol"
+)
+
+// auditSource 每只股票10根日线,最后一根涨change
+type auditSource struct {
+	Source
+	names  map[string]string
+	change float64
+}
+
+func (this *auditSource) GetName(code string) string { return this.names[code] }
+
+func (this *auditSource) GetXRXDs(code string) (protocol.XRXDs, error) { return nil, nil }
+
+func (this *auditSource) GetDayKlines(code string, start, end time.Time) (protocol.Klines, error) {
+	ks := protocol.Klines{}
+	t := time.Date(2024, 1, 1, 15, 0, 0, 0, time.Local) //周一
+	for i := 0; i < 10; i++ {
+		p := protocol.Yuan(10)
+		if i == 9 {
+			p = protocol.Yuan(10 * (1 + this.change))
+		}
+		ks = append(ks, &protocol.Kline{Time: t.AddDate(0, 0, i/5*7+i%5), Open: p, High: p, Low: p, Close: p})
+	}
+	return ks, nil
+}
+
+func TestAuditJump(t *testing.T) {
+	s := &auditSource{names: map[string]string{"sz000001": "平安银行", "sz000002": "*ST万科", "sz300001": "ST特锐"}, change: 0.08}
+	report, err := Audit(context.Background(), s, nil, &AuditReq{Codes: []string{"sz000001", "sz000002", "sz300001"}, StaleDays: 1 << 20}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//只有主板的ST股票限制5%
+	if len(report.Items) != 1 || report.Items[0].Code != "sz000002" {
+		t.Fatalf("检查结果有误: %+v", report.Items)
+	}
+	if is := report.Items[0].Issues; len(is) != 1 || is[0].Kind != IssueJump {
+		t.Fatalf("问题有误: %+v", is)
+	}
+}
+
+func TestAuditDuplicate(t *testing.T) {
+	//按股票分文件的数据库没有唯一索引,可以写入相同时间的K线
+	dir := t.TempDir()
+	db, err := sqlite.NewXorm(filepath.Join(dir, DayKline, "sz000001.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Sync2(new(protocol.Kline)); err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2024, 1, 2, 15, 0, 0, 0, time.Local)
+	for _, v := range []time.Time{t0, t0.AddDate(0, 0, 1), t0.AddDate(0, 0, 1), t0.AddDate(0, 0, 2)} {
+		p := protocol.Yuan(10)
+		if _, err = db.Insert(&protocol.Kline{Time: v, Open: p, High: p, Low: p, Close: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	o, err := NewOffline(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Audit(context.Background(), o, nil, &AuditReq{Codes: []string{"sz000001"}, StaleDays: 1 << 20}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Items) != 1 || report.Counts[IssueDuplicate] != 1 {
+		t.Fatalf("检查结果有误: %+v", report)
+	}
+	is := report.Items[0].Issues
+	if len(is) != 1 || is[0].Kind != IssueDuplicate || !is[0].Start.Equal(t0.AddDate(0, 0, 1)) {
+		t.Fatalf("问题有误: %+v", is)
+	}
+}
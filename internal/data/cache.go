@@ -0,0 +1,253 @@
+package data
+
+import (
+	"container/list"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+// klineSize 每根K线在缓存里大约占用的字节数,用于计算内存预算
+const klineSize = int64(unsafe.Sizeof(protocol.Kline{}) + unsafe.Sizeof(uintptr(0)))
+
+/*
+NewCache 日线缓存,按股票缓存全部历史,读取时再按时间截取
+budget为内存预算(字节),超出后淘汰最久没有使用的股票,小于等于0时不缓存
+分钟线和其他数据直接读取数据源
+*/
+func NewCache(s Source, budget int64) *Cache {
+	c := &Cache{
+		Source:  s,
+		budget:  budget,
+		ls:      list.New(),
+		m:       map[string]*list.Element{},
+		loading: map[string]*cacheLoad{},
+	}
+	if d, ok := s.(*Data); ok {
+		d.OnChange = c.Invalidate
+	}
+	return c
+}
+
+type Cache struct {
+	Source
+	budget    int64
+	mu        sync.Mutex
+	ls        *list.List //最近使用的在前面
+	m         map[string]*list.Element
+	loading   map[string]*cacheLoad //正在读取的股票,相同股票只读取一次
+	size      int64
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type cacheItem struct {
+	code string
+	ks   protocol.Klines
+	size int64
+}
+
+type cacheLoad struct {
+	done    chan struct{}
+	ks      protocol.Klines
+	err     error
+	invalid bool //读取期间被清除
+}
+
+// CacheStats 缓存统计
+type CacheStats struct {
+	Budget    int64   `json:"budget"`    //内存预算,字节
+	Size      int64   `json:"size"`      //已使用,字节
+	Codes     int     `json:"codes"`     //缓存的股票数量
+	Hits      int64   `json:"hits"`      //命中次数
+	Misses    int64   `json:"misses"`    //未命中次数
+	Evictions int64   `json:"evictions"` //淘汰次数
+	HitRate   float64 `json:"hitRate"`   //命中率
+}
+
+// Unwrap 被缓存的数据源
+func (this *Cache) Unwrap() Source {
+	return this.Source
+}
+
+func (this *Cache) GetDayKlines(code string, start, end time.Time) (protocol.Klines, error) {
+	if this.budget <= 0 {
+		return this.Source.GetDayKlines(code, start, end)
+	}
+	ks, err := this.get(code)
+	if err != nil {
+		return nil, err
+	}
+	//和数据源一样是开区间,返回副本,防止调用方修改缓存
+	i := sort.Search(len(ks), func(i int) bool { return ks[i].Time.After(start) })
+	j := sort.Search(len(ks), func(i int) bool { return !ks[i].Time.Before(end) })
+	out := make(protocol.Klines, 0, max(j-i, 0))
+	for _, k := range ks[i:max(i, j)] {
+		c := *k
+		out = append(out, &c)
+	}
+	return out, nil
+}
+
+func (this *Cache) get(code string) (protocol.Klines, error) {
+	key := protocol.AddPrefix(code)
+	this.mu.Lock()
+	if e, ok := this.m[key]; ok {
+		this.hits++
+		this.ls.MoveToFront(e)
+		this.mu.Unlock()
+		return e.Value.(*cacheItem).ks, nil
+	}
+	this.misses++
+	if l, ok := this.loading[key]; ok {
+		this.mu.Unlock()
+		<-l.done
+		return l.ks, l.err
+	}
+	l := &cacheLoad{done: make(chan struct{})}
+	this.loading[key] = l
+	this.mu.Unlock()
+
+	l.ks, l.err = this.Source.GetDayKlines(code, time.Time{}, time.Now().AddDate(1, 0, 0))
+
+	this.mu.Lock()
+	delete(this.loading, key)
+	//读取期间被清除的数据不缓存,下次重新读取
+	if l.err == nil && !l.invalid {
+		this.add(key, l.ks)
+	}
+	this.mu.Unlock()
+	close(l.done)
+	return l.ks, l.err
+}
+
+// add 加入缓存并淘汰超出预算的股票,需要持有锁
+func (this *Cache) add(code string, ks protocol.Klines) {
+	item := &cacheItem{code: code, ks: ks, size: int64(len(ks))*klineSize + int64(len(code))}
+	if item.size > this.budget {
+		return
+	}
+	this.m[code] = this.ls.PushFront(item)
+	this.size += item.size
+	for this.size > this.budget {
+		e := this.ls.Back()
+		this.remove(e)
+		this.evictions++
+	}
+}
+
+func (this *Cache) remove(e *list.Element) {
+	item := e.Value.(*cacheItem)
+	this.ls.Remove(e)
+	delete(this.m, item.code)
+	this.size -= item.size
+}
+
+// Invalidate 清除股票的缓存,不传参数时清除全部,数据更新、导入或修复后调用
+func (this *Cache) Invalidate(codes ...string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if len(codes) == 0 {
+		this.ls.Init()
+		this.m = map[string]*list.Element{}
+		this.size = 0
+		for _, l := range this.loading {
+			l.invalid = true
+		}
+		return
+	}
+	for _, code := range codes {
+		code = protocol.AddPrefix(code)
+		if e, ok := this.m[code]; ok {
+			this.remove(e)
+		}
+		if l, ok := this.loading[code]; ok {
+			l.invalid = true
+		}
+	}
+}
+
+// Warm 预热全市场的日线,超出预算后停止
+func (this *Cache) Warm(progress func(done, total int)) {
+	if this.budget <= 0 {
+		return
+	}
+	codes := this.GetStockCodes()
+	for i, code := range codes {
+		if _, err := this.get(code); err == nil {
+			this.mu.Lock()
+			evicted := this.evictions > 0
+			this.mu.Unlock()
+			if evicted {
+				return
+			}
+		}
+		if progress != nil {
+			progress(i+1, len(codes))
+		}
+	}
+}
+
+// Stats 命中率等统计
+func (this *Cache) Stats() *CacheStats {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	s := &CacheStats{
+		Budget:    this.budget,
+		Size:      this.size,
+		Codes:     len(this.m),
+		Hits:      this.hits,
+		Misses:    this.misses,
+		Evictions: this.evictions,
+	}
+	if total := this.hits + this.misses; total > 0 {
+		s.HitRate = float64(this.hits) / float64(total)
+	}
+	return s
+}
+
+// Start 数据源支持更新时启动定时更新,不支持时直接执行更新完成后的函数
+func (this *Cache) Start() {
+	if u, ok := this.Source.(Updater); ok {
+		u.Start()
+		return
+	}
+	//数据源不会更新,例如离线数据,启动时直接执行更新完成后的函数
+	updated()
+}
+
+// Update 更新数据,数据源不会通知变化的股票时清除全部缓存
+func (this *Cache) Update(force bool) error {
+	u, ok := this.Source.(Updater)
+	if !ok {
+		return errors.New("当前数据源不支持更新")
+	}
+	err := u.Update(force)
+	if _, ok := this.Source.(*Data); !ok {
+		this.Invalidate()
+	}
+	return err
+}
+
+// Repair 修复数据后清除这只股票的缓存
+func (this *Cache) Repair(code string, start, end time.Time) error {
+	r, ok := this.Source.(Repairer)
+	if !ok {
+		return errors.New("当前数据源不支持修复")
+	}
+	err := r.Repair(code, start, end)
+	this.Invalidate(code)
+	return err
+}
+
+// Invalidate 数据源带缓存时清除股票的缓存
+func Invalidate(s Source, codes ...string) {
+	if c, ok := s.(*Cache); ok {
+		c.Invalidate(codes...)
+	}
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+// countSource 记录每只股票读取日线的次数,block不为nil时读取会等待它关闭
+type countSource struct {
+	Source
+	n       int
+	calls   sync.Map
+	started chan string
+	block   chan struct{}
+}
+
+func (this *countSource) count(code string) int64 {
+	v, _ := this.calls.LoadOrStore(protocol.AddPrefix(code), new(int64))
+	return atomic.LoadInt64(v.(*int64))
+}
+
+func (this *countSource) GetDayKlines(code string, start, end time.Time) (protocol.Klines, error) {
+	v, _ := this.calls.LoadOrStore(protocol.AddPrefix(code), new(int64))
+	atomic.AddInt64(v.(*int64), 1)
+	if this.started != nil {
+		this.started <- code
+	}
+	if this.block != nil {
+		<-this.block
+	}
+	out := protocol.Klines{}
+	t := time.Date(2024, 1, 1, 15, 0, 0, 0, time.Local)
+	for i := 0; i < this.n; i++ {
+		if k := t.AddDate(0, 0, i); k.After(start) && k.Before(end) {
+			out = append(out, &protocol.Kline{Time: k, Close: protocol.Yuan(10)})
+		}
+	}
+	return out, nil
+}
+
+// budget 刚好能缓存codes只股票
+func budget(n, codes int) int64 {
+	return (int64(n)*klineSize + int64(len("sz000001"))) * int64(codes)
+}
+
+func TestCacheEvict(t *testing.T) {
+	s := &countSource{n: 10}
+	c := NewCache(s, budget(s.n, 2))
+	get := func(code string) {
+		if _, err := c.GetDayKlines(code, time.Time{}, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get("sz000001")
+	get("sz000002")
+	get("sz000001") //sz000001变成最近使用的
+	get("sz000003") //淘汰sz000002
+
+	st := c.Stats()
+	if st.Codes != 2 || st.Evictions != 1 || st.Hits != 1 || st.Misses != 3 {
+		t.Fatalf("缓存统计有误: %+v", st)
+	}
+	if st.Size > st.Budget {
+		t.Fatalf("超出预算: %+v", st)
+	}
+	get("sz000001")
+	get("sz000002")
+	if n := s.count("sz000001"); n != 1 {
+		t.Errorf("sz000001应该命中缓存,读取了%d次", n)
+	}
+	if n := s.count("sz000002"); n != 2 {
+		t.Errorf("sz000002应该被淘汰后重新读取,读取了%d次", n)
+	}
+}
+
+func TestCacheRange(t *testing.T) {
+	s := &countSource{n: 10}
+	c := NewCache(s, budget(s.n, 1))
+	start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.Local)
+	end := time.Date(2024, 1, 5, 15, 0, 0, 0, time.Local)
+	ks, err := c.GetDayKlines("sz000001", start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//和数据源一样不包含开始和结束时间
+	if len(ks) != 2 || ks[0].Time.Day() != 3 || ks[1].Time.Day() != 4 {
+		t.Fatalf("区间有误: %v", ks)
+	}
+	//返回的是副本
+	ks[0].Close = 0
+	if ks, _ = c.GetDayKlines("sz000001", start, end); ks[0].Close == 0 {
+		t.Fatal("修改返回值影响了缓存")
+	}
+}
+
+func TestCacheInvalidateDuringLoad(t *testing.T) {
+	s := &countSource{n: 10, started: make(chan string, 1), block: make(chan struct{})}
+	c := NewCache(s, budget(s.n, 2))
+
+	var wg sync.WaitGroup
+	results := make([]int, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ks, err := c.GetDayKlines("sz000001", time.Time{}, time.Now())
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = len(ks)
+		}(i)
+		if i == 0 {
+			<-s.started
+		}
+	}
+	//第二个请求在等待第一个读取完成,不会重复读取
+	for {
+		c.mu.Lock()
+		waiting := c.misses == 2
+		c.mu.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Invalidate("sz000001")
+	close(s.block)
+	wg.Wait()
+
+	if n := s.count("sz000001"); n != 1 {
+		t.Fatalf("相同股票同时读取应该只读取一次,读取了%d次", n)
+	}
+	if results[0] != s.n || results[1] != s.n {
+		t.Fatalf("读取结果有误: %v", results)
+	}
+	if st := c.Stats(); st.Codes != 0 {
+		t.Fatalf("读取期间被清除的数据不应该缓存: %+v", st)
+	}
+
+	s.started, s.block = nil, nil
+	if _, err := c.GetDayKlines("sz000001", time.Time{}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.count("sz000001"); n != 2 {
+		t.Fatalf("清除后应该重新读取,读取了%d次", n)
+	}
+	if st := c.Stats(); st.Codes != 1 {
+		t.Fatalf("重新读取后应该缓存: %+v", st)
+	}
+}
+
+func TestCacheInvalidateAll(t *testing.T) {
+	s := &countSource{n: 10}
+	c := NewCache(s, budget(s.n, 2))
+	c.GetDayKlines("sz000001", time.Time{}, time.Now())
+	c.GetDayKlines("sz000002", time.Time{}, time.Now())
+	c.Invalidate()
+	if st := c.Stats(); st.Codes != 0 || st.Size != 0 {
+		t.Fatalf("清除全部后缓存不为空: %+v", st)
+	}
+}
@@ -0,0 +1,360 @@
+package data
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+const (
+	ExportCSV     = "csv"
+	ExportJSONL   = "jsonl"
+	ExportParquet = "parquet"
+
+	AdjustNone = ""
+	AdjustQFQ  = "qfq" //前复权
+	AdjustHFQ  = "hfq" //后复权
+)
+
+// ExportReq 导出K线的参数
+type ExportReq struct {
+	Codes  []string `json:"codes"`
+	Type   string   `json:"type"`   //day或min,默认day
+	Start  string   `json:"start"`  //开始日期,默认1990-01-01
+	End    string   `json:"end"`    //结束日期,默认今天
+	Adjust string   `json:"adjust"` //复权方式,qfq或hfq,默认不复权
+	Format string   `json:"format"` //csv,jsonl,parquet,默认csv
+	Split  bool     `json:"split"`  //每只股票一个文件,打包成zip
+}
+
+// Check 校验参数并设置默认值
+func (this *ExportReq) Check() error {
+	if len(this.Codes) == 0 {
+		return errors.New("缺少股票代码")
+	}
+	if this.Type == "" {
+		this.Type = "day"
+	}
+	if this.Type != "day" && this.Type != "min" {
+		return fmt.Errorf("不支持的K线类型: %s", this.Type)
+	}
+	if this.Format == "" {
+		this.Format = ExportCSV
+	}
+	switch this.Format {
+	case ExportCSV, ExportJSONL, ExportParquet:
+	default:
+		return fmt.Errorf("不支持的导出格式: %s", this.Format)
+	}
+	switch this.Adjust {
+	case AdjustNone, AdjustQFQ, AdjustHFQ:
+	default:
+		return fmt.Errorf("不支持的复权方式: %s", this.Adjust)
+	}
+	_, _, err := this.Range()
+	return err
+}
+
+// Range 导出区间,结束日期包含当天
+func (this *ExportReq) Range() (start, end time.Time, err error) {
+	start = time.Date(1990, 1, 1, 0, 0, 0, 0, time.Local)
+	end = time.Now()
+	if this.Start != "" {
+		if start, err = time.ParseInLocation(time.DateOnly, this.Start, time.Local); err != nil {
+			return
+		}
+	}
+	if this.End != "" {
+		if end, err = time.ParseInLocation(time.DateOnly, this.End, time.Local); err != nil {
+			return
+		}
+		end = end.AddDate(0, 0, 1)
+	}
+	return
+}
+
+// Filename 导出文件名
+func (this *ExportReq) Filename() string {
+	name := "klines-" + this.Type
+	if this.Adjust != "" {
+		name += "-" + this.Adjust
+	}
+	if this.Split {
+		return name + ".zip"
+	}
+	return name + "." + this.Format
+}
+
+// ExportResult 导出结果,读取失败的股票跳过,不影响其他股票
+type ExportResult struct {
+	Codes   int      `json:"codes"`
+	Klines  int      `json:"klines"`
+	Skipped []string `json:"skipped"` //跳过的股票和原因
+}
+
+// Export 按股票逐个读取并写出,不会把全部数据放在内存里
+// 没有数据的股票跳过并记录在结果里,写出失败时返回错误
+func Export(s Source, req *ExportReq, w io.Writer) (*ExportResult, error) {
+	if err := req.Check(); err != nil {
+		return nil, err
+	}
+	start, end, err := req.Range()
+	if err != nil {
+		return nil, err
+	}
+
+	var zw *zip.Writer
+	var e Exporter
+	if req.Split {
+		zw = zip.NewWriter(w)
+		defer zw.Close()
+	} else {
+		if e, err = NewExporter(req.Format, w); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &ExportResult{Skipped: []string{}}
+	for _, code := range req.Codes {
+		ks, err := LoadKlines(s, code, req.Type, req.Adjust, start, end)
+		if err != nil {
+			res.Skipped = append(res.Skipped, fmt.Sprintf("%s: %v", code, err))
+			continue
+		}
+		if zw != nil {
+			f, err := zw.Create(code + "." + req.Format)
+			if err != nil {
+				return nil, err
+			}
+			if e, err = NewExporter(req.Format, f); err != nil {
+				return nil, err
+			}
+		}
+		if err = e.Write(code, s.GetName(code), ks); err != nil {
+			return nil, err
+		}
+		if zw != nil {
+			if err = e.Close(); err != nil {
+				return nil, err
+			}
+		}
+		res.Codes++
+		res.Klines += len(ks)
+	}
+	if zw == nil {
+		if err = e.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// LoadKlines 读取K线,typ为day或min,adjust为复权方式
+func LoadKlines(s Source, code, typ, adjust string, start, end time.Time) (protocol.Klines, error) {
+	var ks protocol.Klines
+	var err error
+	if typ == "min" {
+		ks, err = s.GetMinKlines(code, start, end)
+	} else {
+		ks, err = s.GetDayKlines(code, start, end)
+	}
+	if err != nil || adjust == AdjustNone || len(ks) == 0 {
+		return ks, err
+	}
+	xs, err := s.GetXRXDs(code)
+	if err != nil {
+		return nil, err
+	}
+	return Adjust(ks, xs, adjust), nil
+}
+
+// Adjust 复权,返回新的K线,不修改原数据
+func Adjust(ks protocol.Klines, xs protocol.XRXDs, adjust string) protocol.Klines {
+	if len(ks) == 0 || len(xs) == 0 || adjust == AdjustNone {
+		return ks
+	}
+	//数据库里没有保存昨收价,按上一根K线的收盘价计算
+	out := make(protocol.Klines, len(ks))
+	for i, k := range ks {
+		c := *k
+		if i > 0 {
+			c.Last = ks[i-1].Close
+		}
+		out[i] = &c
+	}
+	factors := xs.Pre(out).Factors()
+	for i, k := range out {
+		f := factors[i].QFQ
+		if adjust == AdjustHFQ {
+			f = factors[i].HFQ
+		}
+		k.Open = protocol.Price(float64(k.Open) * f)
+		k.High = protocol.Price(float64(k.High) * f)
+		k.Low = protocol.Price(float64(k.Low) * f)
+		k.Close = protocol.Price(float64(k.Close) * f)
+		k.Last = protocol.Price(float64(k.Last) * f)
+	}
+	return out
+}
+
+// Exporter 流式写出K线,每只股票调用一次Write
+type Exporter interface {
+	Write(code, name string, ks protocol.Klines) error
+	// Close 写入结尾的数据,不关闭底层的writer
+	Close() error
+}
+
+func NewExporter(format string, w io.Writer) (Exporter, error) {
+	switch format {
+	case ExportCSV:
+		return newCsvExporter(w), nil
+	case ExportJSONL:
+		return &jsonlExporter{w: bufio.NewWriter(w)}, nil
+	case ExportParquet:
+		p, err := newParquetWriter(w, klineColumns)
+		if err != nil {
+			return nil, err
+		}
+		return &parquetExporter{p: p}, nil
+	default:
+		return nil, fmt.Errorf("不支持的导出格式: %s", format)
+	}
+}
+
+// csvExporter 列和extend.KlinesToCsv一致,导出的文件可以直接导入
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func newCsvExporter(w io.Writer) *csvExporter {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"日期", "时间", "代码", "名称", "开盘", "最高", "最低", "收盘", "总手", "金额"})
+	return &csvExporter{w: cw}
+}
+
+func (this *csvExporter) Write(code, name string, ks protocol.Klines) error {
+	for _, k := range ks {
+		this.w.Write([]string{
+			k.Time.Format("20060102"),
+			k.Time.Format("15:04"),
+			code,
+			name,
+			formatPrice(k.Open),
+			formatPrice(k.High),
+			formatPrice(k.Low),
+			formatPrice(k.Close),
+			strconv.FormatInt(k.Volume, 10),
+			formatPrice(k.Amount),
+		})
+	}
+	this.w.Flush()
+	return this.w.Error()
+}
+
+func (this *csvExporter) Close() error {
+	this.w.Flush()
+	return this.w.Error()
+}
+
+func formatPrice(p protocol.Price) string {
+	return strconv.FormatFloat(p.Float64(), 'f', -1, 64)
+}
+
+type jsonlExporter struct {
+	w *bufio.Writer
+}
+
+// klineRow JSON Lines和parquet的一行
+type klineRow struct {
+	Code   string  `json:"code"`
+	Name   string  `json:"name"`
+	Time   string  `json:"time"`
+	Open   float64 `json:"open"`
+	High   float64 `json:"high"`
+	Low    float64 `json:"low"`
+	Close  float64 `json:"close"`
+	Volume int64   `json:"volume"`
+	Amount float64 `json:"amount"`
+}
+
+func (this *jsonlExporter) Write(code, name string, ks protocol.Klines) error {
+	e := json.NewEncoder(this.w)
+	for _, k := range ks {
+		err := e.Encode(klineRow{
+			Code:   code,
+			Name:   name,
+			Time:   k.Time.Format(time.DateTime),
+			Open:   k.Open.Float64(),
+			High:   k.High.Float64(),
+			Low:    k.Low.Float64(),
+			Close:  k.Close.Float64(),
+			Volume: k.Volume,
+			Amount: k.Amount.Float64(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return this.w.Flush()
+}
+
+func (this *jsonlExporter) Close() error {
+	return this.w.Flush()
+}
+
+var klineColumns = []parquetColumn{
+	{Name: "code", Type: parquetByteArray, Converted: parquetUTF8},
+	{Name: "name", Type: parquetByteArray, Converted: parquetUTF8},
+	{Name: "time", Type: parquetInt64, Converted: parquetTimestampMillis},
+	{Name: "open", Type: parquetDouble, Converted: -1},
+	{Name: "high", Type: parquetDouble, Converted: -1},
+	{Name: "low", Type: parquetDouble, Converted: -1},
+	{Name: "close", Type: parquetDouble, Converted: -1},
+	{Name: "volume", Type: parquetInt64, Converted: -1},
+	{Name: "amount", Type: parquetDouble, Converted: -1},
+}
+
+// parquetExporter 每只股票一个RowGroup
+type parquetExporter struct {
+	p *parquetWriter
+}
+
+func (this *parquetExporter) Write(code, name string, ks protocol.Klines) error {
+	vs := make([]parquetValues, len(klineColumns))
+	for _, k := range ks {
+		vs[0].Strings = append(vs[0].Strings, code)
+		vs[1].Strings = append(vs[1].Strings, name)
+		vs[2].Int64s = append(vs[2].Int64s, k.Time.UnixMilli())
+		vs[3].Doubles = append(vs[3].Doubles, k.Open.Float64())
+		vs[4].Doubles = append(vs[4].Doubles, k.High.Float64())
+		vs[5].Doubles = append(vs[5].Doubles, k.Low.Float64())
+		vs[6].Doubles = append(vs[6].Doubles, k.Close.Float64())
+		vs[7].Int64s = append(vs[7].Int64s, k.Volume)
+		vs[8].Doubles = append(vs[8].Doubles, k.Amount.Float64())
+	}
+	return this.p.WriteGroup(len(ks), vs)
+}
+
+func (this *parquetExporter) Close() error {
+	return this.p.Close()
+}
+
+// ParseCodes 解析逗号分隔的股票代码
+func ParseCodes(s string) []string {
+	out := []string(nil)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,255 @@
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+/*
+thriftReader 按thrift compact协议解析成通用结构,用来检查写出的parquet元数据
+结构体为map[int16]any,列表为[]any,整数为int64,二进制为string
+*/
+type thriftReader struct {
+	*bytes.Reader
+}
+
+func (this *thriftReader) varint() int64 {
+	v, err := binary.ReadUvarint(this)
+	if err != nil {
+		panic(err)
+	}
+	return int64(v)
+}
+
+func (this *thriftReader) zigzag() int64 {
+	v := uint64(this.varint())
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (this *thriftReader) value(typ byte) any {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		b, _ := this.ReadByte()
+		return int64(b)
+	case 4, thriftI32, thriftI64:
+		return this.zigzag()
+	case 7:
+		var f float64
+		binary.Read(this, binary.LittleEndian, &f)
+		return f
+	case thriftBinary:
+		bs := make([]byte, this.varint())
+		this.Read(bs)
+		return string(bs)
+	case thriftList:
+		b, _ := this.ReadByte()
+		size, elem := int64(b>>4), b&0x0f
+		if size == 15 {
+			size = this.varint()
+		}
+		out := make([]any, size)
+		for i := range out {
+			out[i] = this.value(elem)
+		}
+		return out
+	case thriftStruct:
+		return this.structure()
+	}
+	panic("未知的thrift类型")
+}
+
+func (this *thriftReader) structure() map[int16]any {
+	out := map[int16]any{}
+	var last int16
+	for {
+		b, err := this.ReadByte()
+		if err != nil {
+			panic(err)
+		}
+		if b == 0 {
+			return out
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			id = int16(this.zigzag())
+		}
+		last = id
+		out[id] = this.value(b & 0x0f)
+	}
+}
+
+// readParquet 读取parquetWriter写出的文件,返回每列的值
+func readParquet(bs []byte) (names []string, rows int64, columns [][]any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("解析失败: %v", r)
+		}
+	}()
+	if len(bs) < 12 || string(bs[:4]) != "PAR1" || string(bs[len(bs)-4:]) != "PAR1" {
+		return nil, 0, nil, errors.New("不是parquet文件")
+	}
+	size := int(binary.LittleEndian.Uint32(bs[len(bs)-8:]))
+	meta := (&thriftReader{bytes.NewReader(bs[len(bs)-8-size : len(bs)-8])}).structure()
+
+	schema := meta[2].([]any)
+	for _, v := range schema[1:] {
+		names = append(names, v.(map[int16]any)[4].(string))
+	}
+	columns = make([][]any, len(names))
+	rows = meta[3].(int64)
+	for _, g := range meta[4].([]any) {
+		for i, c := range g.(map[int16]any)[1].([]any) {
+			cm := c.(map[int16]any)[3].(map[int16]any)
+			r := &thriftReader{bytes.NewReader(bs[cm[9].(int64):])}
+			header := r.structure()
+			n := header[5].(map[int16]any)[1].(int64)
+			data := make([]byte, header[3].(int64))
+			r.Read(data)
+			dr := bytes.NewReader(data)
+			for j := int64(0); j < n; j++ {
+				switch cm[1].(int64) {
+				case parquetInt64:
+					var v int64
+					binary.Read(dr, binary.LittleEndian, &v)
+					columns[i] = append(columns[i], v)
+				case parquetDouble:
+					var v float64
+					binary.Read(dr, binary.LittleEndian, &v)
+					columns[i] = append(columns[i], v)
+				case parquetByteArray:
+					var l uint32
+					binary.Read(dr, binary.LittleEndian, &l)
+					s := make([]byte, l)
+					dr.Read(s)
+					columns[i] = append(columns[i], string(s))
+				}
+			}
+		}
+	}
+	return
+}
+
+func TestThrift(t *testing.T) {
+	w := newThrift()
+	w.i32(1, -5)
+	w.i64(20, 1<<40) //间隔超过15
+	w.listBegin(21, thriftBinary, 16)
+	for i := 0; i < 16; i++ {
+		w.str(strings.Repeat("a", i))
+	}
+	w.structBegin(22)
+	w.binary(1, "x")
+	w.structEnd()
+	w.i32(23, 7)
+	w.stop()
+
+	m := (&thriftReader{bytes.NewReader(w.Bytes())}).structure()
+	if m[1] != int64(-5) || m[20] != int64(1<<40) || m[23] != int64(7) {
+		t.Fatalf("整数有误: %v", m)
+	}
+	if ls := m[21].([]any); len(ls) != 16 || ls[15] != strings.Repeat("a", 15) {
+		t.Fatalf("列表有误: %v", ls)
+	}
+	if s := m[22].(map[int16]any); s[1] != "x" {
+		t.Fatalf("结构体有误: %v", s)
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	t0 := time.Date(2024, 1, 2, 15, 0, 0, 0, time.Local)
+	groups := map[string]protocol.Klines{
+		"sz000001": {
+			{Time: t0, Open: protocol.Yuan(10), High: protocol.Yuan(10.5), Low: protocol.Yuan(9.9), Close: protocol.Yuan(10.2), Volume: 100, Amount: protocol.Yuan(102000)},
+			{Time: t0.AddDate(0, 0, 1), Open: protocol.Yuan(10.2), High: protocol.Yuan(10.3), Low: protocol.Yuan(10), Close: protocol.Yuan(10.1), Volume: 200, Amount: protocol.Yuan(202000)},
+		},
+		"sh600000": {
+			{Time: t0, Open: protocol.Yuan(8), High: protocol.Yuan(8), Low: protocol.Yuan(8), Close: protocol.Yuan(8), Volume: 300, Amount: protocol.Yuan(240000)},
+		},
+	}
+	buf := bytes.NewBuffer(nil)
+	e, err := NewExporter(ExportParquet, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := []string{"sz000001", "sh600000"}
+	for _, code := range order {
+		if err = e.Write(code, "名称"+code, groups[code]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = e.Write("sz000002", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, rows, cols, err := readParquet(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "code,name,time,open,high,low,close,volume,amount" {
+		t.Fatalf("列名有误: %v", names)
+	}
+	if rows != 3 {
+		t.Fatalf("行数%d,期望3", rows)
+	}
+	i := 0
+	for _, code := range order {
+		for _, k := range groups[code] {
+			want := []any{code, "名称" + code, k.Time.UnixMilli(), k.Open.Float64(), k.High.Float64(), k.Low.Float64(), k.Close.Float64(), k.Volume, k.Amount.Float64()}
+			for j, w := range want {
+				got := cols[j][i]
+				if f, ok := w.(float64); ok {
+					if math.Abs(got.(float64)-f) > 1e-9 {
+						t.Fatalf("第%d行%s: 得到%v,期望%v", i, names[j], got, w)
+					}
+				} else if got != w {
+					t.Fatalf("第%d行%s: 得到%v,期望%v", i, names[j], got, w)
+				}
+			}
+			i++
+		}
+	}
+}
+
+// emptySource 只有sz000001有数据
+type emptySource struct {
+	Source
+}
+
+func (this *emptySource) GetName(code string) string { return "" }
+
+func (this *emptySource) GetDayKlines(code string, start, end time.Time) (protocol.Klines, error) {
+	if code != "sz000001" {
+		return nil, errors.New("股票[" + code + "]数据不存在")
+	}
+	return protocol.Klines{{Time: time.Date(2024, 1, 2, 15, 0, 0, 0, time.Local), Close: protocol.Yuan(10)}}, nil
+}
+
+func TestExportSkip(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	req := &ExportReq{Codes: []string{"sz000002", "sz000001", "sz000003"}, Type: "day", Format: ExportJSONL}
+	res, err := Export(&emptySource{}, req, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Codes != 1 || res.Klines != 1 || len(res.Skipped) != 2 || !strings.HasPrefix(res.Skipped[0], "sz000002") {
+		t.Fatalf("导出结果有误: %+v", res)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Fatalf("导出%d行,期望1行", n)
+	}
+}
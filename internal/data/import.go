@@ -0,0 +1,341 @@
+package data
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/injoyai/goutil/database/sqlite"
+	"github.com/injoyai/tdx/protocol"
+	"xorm.io/xorm"
+)
+
+// MaxImportErrors 导入结果里最多保留的错误数量
+const MaxImportErrors = 20
+
+// ImportResult 单只股票的导入结果
+type ImportResult struct {
+	Code      string   `json:"code"`
+	Type      string   `json:"type"`      //day-kline或min-kline
+	Total     int      `json:"total"`     //文件里的K线数量
+	Inserted  int      `json:"inserted"`  //新增数量
+	Duplicate int      `json:"duplicate"` //已存在的数量
+	Invalid   int      `json:"invalid"`   //未通过校验的数量
+	Errors    []string `json:"errors"`
+}
+
+func (this *ImportResult) addError(format string, a ...any) {
+	this.Invalid++
+	if len(this.Errors) < MaxImportErrors {
+		this.Errors = append(this.Errors, fmt.Sprintf(format, a...))
+	}
+}
+
+// StoreDir 数据源对应的sqlite目录,导入的数据写到这里
+func StoreDir(s Source) (string, error) {
+	if c, ok := s.(*Cache); ok {
+		s = c.Unwrap()
+	}
+	switch v := s.(type) {
+	case *Data:
+		return v.DatabaseDir, nil
+	case *Offline:
+		if v.Format == OfflineSqlite {
+			return v.Dir, nil
+		}
+	}
+	return "", errors.New("当前数据源不支持导入")
+}
+
+// ImportFile 按扩展名导入文件,支持.csv和通达信的.day/.lc1/.lc5
+func ImportFile(dir, filename string) ([]*ImportResult, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Import(dir, filepath.Base(filename), f)
+}
+
+// Import 导入数据到dir,name为文件名,用于识别格式和股票代码
+func Import(dir, name string, r io.Reader) ([]*ImportResult, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	code := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+	switch ext {
+	case ".day":
+		ks, err := decodeTdx(r, code, decodeTdxDay)
+		if err != nil {
+			return nil, err
+		}
+		res, err := importKlines(dir, DayKline, code, ks)
+		return []*ImportResult{res}, err
+	case ".lc1", ".lc5":
+		ks, err := decodeTdx(r, code, decodeTdxMinute)
+		if err != nil {
+			return nil, err
+		}
+		res, err := importKlines(dir, MinKline, code, ks)
+		return []*ImportResult{res}, err
+	case ".csv":
+		return importCsv(dir, code, r)
+	default:
+		return nil, fmt.Errorf("不支持的文件格式: %s", ext)
+	}
+}
+
+/*
+通达信vipdoc文件,每条记录32字节,小端
+
+.day: 日期uint32(20060102), 开高低收uint32(分), 成交额float32, 成交量uint32(股), 保留
+.lc1/.lc5: 日期uint16((年-2004)*2048+月*100+日), 分钟uint16, 开高低收float32(元), 成交额float32, 成交量uint32(股), 保留
+*/
+const tdxRecordSize = 32
+
+func decodeTdx(r io.Reader, code string, decode func(bs []byte, scale float64) (*protocol.Kline, error)) (protocol.Klines, error) {
+	scale := tdxPriceScale(code)
+	br := bufio.NewReader(r)
+	out := protocol.Klines{}
+	buf := make([]byte, tdxRecordSize)
+	for {
+		_, err := io.ReadFull(br, buf)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("第%d条记录: %v", len(out)+1, err)
+		}
+		k, err := decode(buf, scale)
+		if err != nil {
+			return nil, fmt.Errorf("第%d条记录: %v", len(out)+1, err)
+		}
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+// tdxPriceScale .day文件的价格单位,股票是分,基金和ETF是厘
+func tdxPriceScale(code string) float64 {
+	switch {
+	case strings.HasPrefix(code, "sh5"), strings.HasPrefix(code, "sz15"),
+		strings.HasPrefix(code, "sz16"), strings.HasPrefix(code, "sz18"):
+		return 1000
+	default:
+		return 100
+	}
+}
+
+func decodeTdxDay(bs []byte, scale float64) (*protocol.Kline, error) {
+	date := binary.LittleEndian.Uint32(bs[0:4])
+	t, err := time.ParseInLocation("20060102", fmt.Sprint(date), time.Local)
+	if err != nil {
+		return nil, err
+	}
+	price := func(b []byte) protocol.Price {
+		return protocol.Yuan(float64(binary.LittleEndian.Uint32(b)) / scale)
+	}
+	return &protocol.Kline{
+		Time:   t.Add(15 * time.Hour),
+		Open:   price(bs[4:8]),
+		High:   price(bs[8:12]),
+		Low:    price(bs[12:16]),
+		Close:  price(bs[16:20]),
+		Amount: protocol.Yuan(float64(math.Float32frombits(binary.LittleEndian.Uint32(bs[20:24])))),
+		Volume: int64(binary.LittleEndian.Uint32(bs[24:28])) / 100,
+	}, nil
+}
+
+func decodeTdxMinute(bs []byte, _ float64) (*protocol.Kline, error) {
+	date := int(binary.LittleEndian.Uint16(bs[0:2]))
+	minute := int(binary.LittleEndian.Uint16(bs[2:4]))
+	year, month, day := date/2048+2004, date%2048/100, date%2048%100
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return nil, fmt.Errorf("无效的日期: %d", date)
+	}
+	price := func(b []byte) protocol.Price {
+		return protocol.Yuan(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+	}
+	return &protocol.Kline{
+		Time:   time.Date(year, time.Month(month), day, minute/60, minute%60, 0, 0, time.Local),
+		Open:   price(bs[4:8]),
+		High:   price(bs[8:12]),
+		Low:    price(bs[12:16]),
+		Close:  price(bs[16:20]),
+		Amount: price(bs[20:24]),
+		Volume: int64(binary.LittleEndian.Uint32(bs[24:28])) / 100,
+	}, nil
+}
+
+// importCsv 导入csv,有代码列时按代码分组(长表),否则使用文件名作为代码
+func importCsv(dir, code string, r io.Reader) ([]*ImportResult, error) {
+	groups, err := decodeCsvKlines(r, code)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, len(groups))
+	for k := range groups {
+		codes = append(codes, k)
+	}
+	sort.Strings(codes)
+	out := []*ImportResult(nil)
+	for _, c := range codes {
+		typ := DayKline
+		if isMinute(groups[c]) {
+			typ = MinKline
+		}
+		res, err := importKlines(dir, typ, c, groups[c])
+		if err != nil {
+			return out, err
+		}
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+// isMinute 同一天有多根不同时间的K线时认为是分钟线,相同时间的是重复的日线
+func isMinute(ks protocol.Klines) bool {
+	for i := 1; i < len(ks); i++ {
+		if ks[i].Time.Format(time.DateOnly) == ks[i-1].Time.Format(time.DateOnly) && !ks[i].Time.Equal(ks[i-1].Time) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKline 校验开高低收
+func checkKline(k *protocol.Kline) error {
+	switch {
+	case k.Open <= 0 || k.High <= 0 || k.Low <= 0 || k.Close <= 0:
+		return errors.New("价格必须大于0")
+	case k.High < k.Low:
+		return errors.New("最高价小于最低价")
+	case k.High < k.Open || k.High < k.Close:
+		return errors.New("最高价小于开盘价或收盘价")
+	case k.Low > k.Open || k.Low > k.Close:
+		return errors.New("最低价大于开盘价或收盘价")
+	case k.Volume < 0 || k.Amount < 0:
+		return errors.New("成交量或成交额小于0")
+	}
+	return nil
+}
+
+// ImportKlines 校验并写入数据源的sqlite目录,typ为DayKline或MinKline,已存在相同时间的K线跳过
+func ImportKlines(s Source, typ, code string, ks protocol.Klines) (*ImportResult, error) {
+	dir, err := StoreDir(s)
+	if err != nil {
+		return nil, err
+	}
+	res, err := importKlines(dir, typ, code, ks)
+	if err == nil && typ == DayKline {
+		Invalidate(s, res.Code)
+	}
+	return res, err
+}
+
+// importKlines 校验并写入sqlite,已存在相同时间的K线跳过
+func importKlines(dir, typ, code string, ks protocol.Klines) (*ImportResult, error) {
+	code = protocol.AddPrefix(code)
+	res := &ImportResult{Code: code, Type: typ, Total: len(ks), Errors: []string{}}
+
+	valid := protocol.Klines{}
+	seen := map[int64]bool{}
+	for _, k := range ks {
+		if err := checkKline(k); err != nil {
+			res.addError("%s %s", k.Time.Format(time.DateTime), err)
+			continue
+		}
+		if typ == DayKline {
+			//日线统一到15点,和同步、.day导入的一致,csv只有日期时是0点,不统一会按时间重复写入
+			v := *k
+			v.Time = dayClose(k.Time)
+			k = &v
+		}
+		if seen[k.Time.Unix()] {
+			res.Duplicate++
+			continue
+		}
+		seen[k.Time.Unix()] = true
+		valid = append(valid, k)
+	}
+
+	//迁移到合并数据库后日线写入合并数据库
+	if typ == DayKline {
+		s, err := OpenStore(dir, false)
+		if err != nil {
+			return res, err
+		} else if s != nil {
+			n, err := s.Insert(code, valid)
+			res.Inserted = n
+			res.Duplicate += len(valid) - n
+			return res, err
+		}
+	}
+
+	//分钟线按年分文件
+	files := map[string]protocol.Klines{}
+	for _, k := range valid {
+		filename := filepath.Join(dir, DayKline, code+".db")
+		if typ == MinKline {
+			filename = filepath.Join(dir, MinKline, fmt.Sprintf("%s-%d.db", code, k.Time.Year()))
+		}
+		files[filename] = append(files[filename], k)
+	}
+	for filename, ls := range files {
+		n, err := insertKlines(filename, ls)
+		if err != nil {
+			return res, err
+		}
+		res.Inserted += n
+		res.Duplicate += len(ls) - n
+	}
+	return res, nil
+}
+
+// dayClose t当天的15点,日线的时间
+func dayClose(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 15, 0, 0, 0, t.Location())
+}
+
+func insertKlines(filename string, ks protocol.Klines) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return 0, err
+	}
+	db, err := sqlite.NewXorm(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	if err = db.Sync2(new(protocol.Kline)); err != nil {
+		return 0, err
+	}
+
+	exist := protocol.Klines{}
+	if err = db.Cols("Time").Find(&exist); err != nil {
+		return 0, err
+	}
+	has := make(map[int64]bool, len(exist))
+	for _, v := range exist {
+		has[v.Time.Unix()] = true
+	}
+
+	n := 0
+	err = db.SessionFunc(func(session *xorm.Session) error {
+		for _, k := range ks {
+			if has[k.Time.Unix()] {
+				continue
+			}
+			if _, err := session.Insert(k); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
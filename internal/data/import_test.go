@@ -0,0 +1,167 @@
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+// tdxDay 生成.day记录,价格单位是分或厘,成交量单位是股
+func tdxDay(date, open, high, low, close uint32, amount float32, volume uint32) []byte {
+	bs := make([]byte, tdxRecordSize)
+	for i, v := range []uint32{date, open, high, low, close, math.Float32bits(amount), volume} {
+		binary.LittleEndian.PutUint32(bs[i*4:], v)
+	}
+	return bs
+}
+
+// tdxMinute 生成.lc1/.lc5记录,价格单位是元
+func tdxMinute(t time.Time, open, high, low, close, amount float32, volume uint32) []byte {
+	bs := make([]byte, tdxRecordSize)
+	binary.LittleEndian.PutUint16(bs[0:], uint16((t.Year()-2004)*2048+int(t.Month())*100+t.Day()))
+	binary.LittleEndian.PutUint16(bs[2:], uint16(t.Hour()*60+t.Minute()))
+	for i, v := range []float32{open, high, low, close, amount} {
+		binary.LittleEndian.PutUint32(bs[4+i*4:], math.Float32bits(v))
+	}
+	binary.LittleEndian.PutUint32(bs[24:], volume)
+	return bs
+}
+
+func TestDecodeTdxDay(t *testing.T) {
+	ks, err := decodeTdx(bytes.NewReader(tdxDay(20240102, 1020, 1050, 990, 1030, 1.5e6, 150000)), "sz000001", decodeTdxDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := ks[0]
+	if !k.Time.Equal(time.Date(2024, 1, 2, 15, 0, 0, 0, time.Local)) {
+		t.Fatalf("日线时间%v,期望15点", k.Time)
+	}
+	if k.Open != protocol.Yuan(10.2) || k.High != protocol.Yuan(10.5) || k.Low != protocol.Yuan(9.9) || k.Close != protocol.Yuan(10.3) {
+		t.Fatalf("价格有误: %+v", k)
+	}
+	if k.Volume != 1500 || k.Amount != protocol.Yuan(1.5e6) {
+		t.Fatalf("成交量或成交额有误: %+v", k)
+	}
+
+	//ETF的价格单位是厘
+	if ks, err = decodeTdx(bytes.NewReader(tdxDay(20240102, 3520, 3520, 3520, 3520, 0, 0)), "sh510300", decodeTdxDay); err != nil || ks[0].Close != protocol.Yuan(3.52) {
+		t.Fatalf("ETF价格有误: %v %v", ks, err)
+	}
+
+	//不完整的记录
+	bs := append(tdxDay(20240102, 1, 1, 1, 1, 0, 0), 1, 2, 3)
+	if _, err = decodeTdx(bytes.NewReader(bs), "sz000001", decodeTdxDay); err == nil || !strings.Contains(err.Error(), "第2条记录") {
+		t.Fatalf("期望第2条记录错误,得到%v", err)
+	}
+	if _, err = decodeTdx(bytes.NewReader(tdxDay(20241345, 1, 1, 1, 1, 0, 0)), "sz000001", decodeTdxDay); err == nil {
+		t.Fatal("无效的日期期望返回错误")
+	}
+}
+
+func TestDecodeTdxMinute(t *testing.T) {
+	t0 := time.Date(2024, 3, 15, 9, 31, 0, 0, time.Local)
+	ks, err := decodeTdx(bytes.NewReader(append(tdxMinute(t0, 10, 10.5, 9.5, 10.25, 2e5, 20000), tdxMinute(t0.Add(4*time.Hour), 11, 11, 11, 11, 0, 100)...)), "sz000001", decodeTdxMinute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks) != 2 || !ks[0].Time.Equal(t0) || !ks[1].Time.Equal(t0.Add(4*time.Hour)) {
+		t.Fatalf("分钟线时间有误: %v", ks)
+	}
+	if k := ks[0]; k.Open != protocol.Yuan(10) || k.High != protocol.Yuan(10.5) || k.Close != protocol.Yuan(10.25) || k.Volume != 200 || k.Amount != protocol.Yuan(2e5) {
+		t.Fatalf("分钟线有误: %+v", k)
+	}
+
+	bs := tdxMinute(t0, 1, 1, 1, 1, 0, 0)
+	binary.LittleEndian.PutUint16(bs[0:], uint16(20*2048+1350))
+	if _, err = decodeTdx(bytes.NewReader(bs), "sz000001", decodeTdxMinute); err == nil || !strings.Contains(err.Error(), "无效的日期") {
+		t.Fatalf("期望无效的日期错误,得到%v", err)
+	}
+}
+
+func TestDecodeCsvKlines(t *testing.T) {
+	//长表,按代码分组,每组按时间排序
+	groups, err := decodeCsvKlines(strings.NewReader("代码,日期,时间,开盘,最高,最低,收盘,成交量\n"+
+		"SZ000001,20240102,09:32,10.1,10.2,10,10.1,200\n"+
+		"SZ000001,20240102,09:31,10,10.1,10,10.1,100\n"+
+		"sh600000,20240102,09:31,8,8,8,8,\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := groups["sz000001"]
+	if len(groups) != 2 || len(ks) != 2 {
+		t.Fatalf("分组有误: %v", groups)
+	}
+	if !ks[0].Time.Equal(time.Date(2024, 1, 2, 9, 31, 0, 0, time.Local)) || ks[1].Last != ks[0].Close || ks[1].Volume != 200 {
+		t.Fatalf("K线有误: %+v %+v", ks[0], ks[1])
+	}
+	if !isMinute(ks) {
+		t.Fatal("同一天多根K线应该是分钟线")
+	}
+
+	//没有代码列时使用文件名
+	if groups, err = decodeCsvKlines(strings.NewReader("date,open,high,low,close\n2024-01-02,1,1,1,1\n2024-01-03,1,1,1,1\n"), "sz000002"); err != nil || len(groups["sz000002"]) != 2 {
+		t.Fatalf("宽表有误: %v %v", groups, err)
+	}
+	if isMinute(groups["sz000002"]) {
+		t.Fatal("每天一根K线应该是日线")
+	}
+}
+
+func TestImportDedupe(t *testing.T) {
+	dir := t.TempDir()
+	day := append(tdxDay(20240102, 1000, 1000, 1000, 1000, 0, 0), tdxDay(20240103, 1010, 1010, 1010, 1010, 0, 0)...)
+	res, err := Import(dir, "sz000001.day", bytes.NewReader(day))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Type != DayKline || res[0].Inserted != 2 {
+		t.Fatalf("导入结果有误: %+v", res[0])
+	}
+
+	//csv只有日期,和.day导入的是同一天,不重复写入
+	csv := "date,open,high,low,close\n2024-01-02,10,10,10,10\n2024-01-03,10.1,10.1,10.1,10.1\n2024-01-04,10.2,10.2,10.2,10.2\n2024-01-04,10.2,10.2,10.2,10.2\n"
+	if res, err = Import(dir, "sz000001.csv", strings.NewReader(csv)); err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Type != DayKline || res[0].Inserted != 1 || res[0].Duplicate != 3 || res[0].Invalid != 0 {
+		t.Fatalf("重复导入结果有误: %+v", res[0])
+	}
+	ks, err := readKlines(filepath.Join(dir, DayKline, "sz000001.db"), "sz000001", time.Time{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks) != 3 || !ks[2].Time.Equal(time.Date(2024, 1, 4, 15, 0, 0, 0, time.Local)) {
+		t.Fatalf("日线有误: %v", ks)
+	}
+
+	//分钟线按年分文件,再次导入全部跳过
+	t0 := time.Date(2023, 12, 29, 14, 59, 0, 0, time.Local)
+	minute := append(tdxMinute(t0, 1, 1, 1, 1, 0, 0), tdxMinute(time.Date(2024, 1, 2, 9, 31, 0, 0, time.Local), 1, 1, 1, 1, 0, 0)...)
+	for n, want := range []int{2, 0} {
+		if res, err = Import(dir, "sz000001.lc1", bytes.NewReader(minute)); err != nil {
+			t.Fatal(err)
+		}
+		if res[0].Type != MinKline || res[0].Inserted != want || res[0].Duplicate != 2-want {
+			t.Fatalf("第%d次导入分钟线结果有误: %+v", n+1, res[0])
+		}
+	}
+	for _, year := range []string{"2023", "2024"} {
+		if ks, err = readKlines(filepath.Join(dir, MinKline, "sz000001-"+year+".db"), "sz000001", time.Time{}, time.Now()); err != nil || len(ks) != 1 {
+			t.Fatalf("%s年的分钟线有误: %v %v", year, ks, err)
+		}
+	}
+
+	//价格有误的K线不写入
+	if res, err = Import(dir, "sz000003.csv", strings.NewReader("date,open,high,low,close\n2024-01-02,10,9,10,10\n")); err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Invalid != 1 || res[0].Inserted != 0 || len(res[0].Errors) != 1 {
+		t.Fatalf("校验结果有误: %+v", res[0])
+	}
+}
@@ -0,0 +1,184 @@
+package data
+
+import (
+	"math"
+	"strings"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+// 品种类型
+const (
+	TypeStock = "stock" //股票
+	TypeIndex = "index" //指数
+	TypeETF   = "etf"   //场内ETF
+	TypeBond  = "bond"  //可转债
+	TypeFund  = "fund"  //LOF等其他场内基金
+)
+
+// Types 全部品种
+var Types = []string{TypeStock, TypeIndex, TypeETF, TypeBond, TypeFund}
+
+// T0Prefix 可以当天买卖的ETF,按代码前缀匹配,货币、债券、黄金和跨境ETF
+var T0Prefix = []string{
+	"sh511", "sh513", "sh518",
+	"sz1590", "sz159920", "sz159934", "sz159937", "sz159941", "sz159812", "sz159866",
+}
+
+// TypeOf 根据代码判断品种,例sh510300,未知的返回空
+func TypeOf(code string) string {
+	code = strings.ToLower(code)
+	if len(code) != 8 {
+		return ""
+	}
+	switch {
+	case protocol.IsStock(code):
+		return TypeStock
+	case protocol.IsIndex(code):
+		return TypeIndex
+	case protocol.IsETF(code):
+		return TypeETF
+	}
+	ex, n := code[:2], code[2:]
+	switch ex {
+	case protocol.ExchangeSH.String():
+		switch n[:3] {
+		case "110", "111", "113", "118":
+			return TypeBond
+		case "501", "502", "506":
+			return TypeFund
+		}
+	case protocol.ExchangeSZ.String():
+		switch n[:3] {
+		case "123", "127", "128":
+			return TypeBond
+		case "160", "161", "162", "163", "164", "165", "166", "167", "168", "169":
+			return TypeFund
+		}
+	}
+	return ""
+}
+
+// 股票的交易板块
+const (
+	BoardMain = "main" //主板
+	BoardGEM  = "gem"  //创业板
+	BoardSTAR = "star" //科创板
+	BoardBJ   = "bj"   //北交所
+)
+
+// Boards 全部交易板块
+var Boards = []string{BoardMain, BoardGEM, BoardSTAR, BoardBJ}
+
+// BoardOf 股票代码所属的交易板块,不是股票的返回空
+func BoardOf(code string) string {
+	code = strings.ToLower(code)
+	if TypeOf(code) != TypeStock {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(code, "bj"):
+		return BoardBJ
+	case strings.HasPrefix(code, "sz30"):
+		return BoardGEM
+	case strings.HasPrefix(code, "sh68"):
+		return BoardSTAR
+	}
+	return BoardMain
+}
+
+// IsST 按名称判断是否是ST,*ST或者退市整理的股票
+func IsST(name string) bool {
+	name = strings.ToUpper(name)
+	return strings.Contains(name, "ST") || strings.HasPrefix(name, "退") || strings.HasSuffix(name, "退")
+}
+
+// IsType 代码是否属于types中的一种,types为空时表示全部已知品种
+func IsType(code string, types ...string) bool {
+	return matchType(TypeOf(code), types)
+}
+
+func matchType(t string, types []string) bool {
+	if t == "" {
+		return false
+	}
+	if len(types) == 0 {
+		return true
+	}
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule 品种的交易规则,回测时按这个规则取整价格和数量
+type Rule struct {
+	Type  string  `json:"type"`
+	Tick  float64 `json:"tick"`  //最小价格变动,元
+	Lot   int     `json:"lot"`   //每手数量,买入数量取整到它的倍数
+	Min   int     `json:"min"`   //最少买入数量,0表示一手
+	T0    bool    `json:"t0"`    //当天买入当天可以卖出
+	Limit float64 `json:"limit"` //涨跌幅限制,0表示没有限制
+}
+
+// RuleOf 代码对应的交易规则,未知品种按股票处理
+func RuleOf(code string) *Rule {
+	code = strings.ToLower(code)
+	switch t := TypeOf(code); t {
+	case TypeIndex:
+		return &Rule{Type: t, Tick: 0.01, Lot: 1, T0: true}
+	case TypeETF:
+		r := &Rule{Type: t, Tick: 0.001, Lot: 100, Limit: 0.1}
+		for _, v := range T0Prefix {
+			if strings.HasPrefix(code, v) {
+				r.T0 = true
+				break
+			}
+		}
+		return r
+	case TypeBond:
+		return &Rule{Type: t, Tick: 0.001, Lot: 10, T0: true, Limit: 0.2}
+	case TypeFund:
+		return &Rule{Type: t, Tick: 0.001, Lot: 100, Limit: 0.1}
+	default:
+		r := &Rule{Type: TypeStock, Tick: 0.01, Lot: 100, Limit: 0.1}
+		switch {
+		case strings.HasPrefix(code, "bj"):
+			r.Limit = 0.3
+		case strings.HasPrefix(code, "sz30"), strings.HasPrefix(code, "sh68"):
+			r.Limit = 0.2
+		}
+		if strings.HasPrefix(code, "sh68") {
+			r.Lot, r.Min = 1, 200 //科创板最少买200股,超出部分按1股递增
+		}
+		return r
+	}
+}
+
+/*
+Qty 每次买入的数量,n向下取整到整手
+n小于最少买入数量(默认一手,科创板200股)时按最少买入数量,0表示最少买入数量
+*/
+func (this *Rule) Qty(n int) int {
+	lot := max(this.Lot, 1)
+	least := (max(this.Min, lot) + lot - 1) / lot * lot
+	return max(n/lot*lot, least)
+}
+
+// BuyPrice 买入价向上取整到最小价格变动
+func (this *Rule) BuyPrice(p float64) float64 {
+	if this.Tick <= 0 {
+		return p
+	}
+	return math.Ceil(p/this.Tick-1e-9) * this.Tick
+}
+
+// SellPrice 卖出价向下取整到最小价格变动
+func (this *Rule) SellPrice(p float64) float64 {
+	if this.Tick <= 0 {
+		return p
+	}
+	return math.Floor(p/this.Tick+1e-9) * this.Tick
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRuleQty(t *testing.T) {
+	cases := []struct {
+		code string
+		n    int
+		want int
+	}{
+		{"sz000001", 0, 100}, //默认一手
+		{"sz000001", 1, 100}, //不足一手按一手
+		{"sz000001", 100, 100},
+		{"sz000001", 150, 100},
+		{"sz000001", 250, 200},
+		{"sh688001", 0, 200}, //科创板最少200股
+		{"sh688001", 150, 200},
+		{"sh688001", 201, 201},
+		{"sh510300", 0, 100},
+		{"sh510300", 1234, 1200},
+		{"sz123001", 0, 10},
+		{"sz123001", 15, 10},
+		{"sh000001", 0, 1},
+		{"sh000001", 3, 3},
+	}
+	for _, c := range cases {
+		if got := RuleOf(c.code).Qty(c.n); got != c.want {
+			t.Errorf("%s买入%d: 得到%d,期望%d", c.code, c.n, got, c.want)
+		}
+	}
+}
+
+func TestRulePrice(t *testing.T) {
+	cases := []struct {
+		code      string
+		typ       string
+		price     float64
+		buy, sell float64
+	}{
+		{"sz000001", TypeStock, 10.123, 10.13, 10.12},
+		{"sz000001", TypeStock, 10.12, 10.12, 10.12}, //已经是最小变动的整数倍不变
+		{"sh510300", TypeETF, 3.5214, 3.522, 3.521},
+		{"sz123001", TypeBond, 120.0005, 120.001, 120},
+		{"sz160105", TypeFund, 1.0001, 1.001, 1},
+		{"sh000001", TypeIndex, 3000.123, 3000.13, 3000.12},
+	}
+	for _, c := range cases {
+		r := RuleOf(c.code)
+		if r.Type != c.typ {
+			t.Errorf("%s: 类型%s,期望%s", c.code, r.Type, c.typ)
+		}
+		if got := r.BuyPrice(c.price); math.Abs(got-c.buy) > 1e-9 {
+			t.Errorf("%s买入价%v: 得到%v,期望%v", c.code, c.price, got, c.buy)
+		}
+		if got := r.SellPrice(c.price); math.Abs(got-c.sell) > 1e-9 {
+			t.Errorf("%s卖出价%v: 得到%v,期望%v", c.code, c.price, got, c.sell)
+		}
+	}
+	if r := (&Rule{}); r.BuyPrice(1.2345) != 1.2345 || r.SellPrice(1.2345) != 1.2345 {
+		t.Error("没有最小价格变动时不取整")
+	}
+}
+
+func TestRuleT0(t *testing.T) {
+	for code, want := range map[string]bool{"sz000001": false, "sh510300": false, "sh511880": true, "sz159001": true, "sz123001": true} {
+		if got := RuleOf(code).T0; got != want {
+			t.Errorf("%s: T0得到%v,期望%v", code, got, want)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package data
 import (
 	"fmt"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/injoyai/conv"
 	"github.com/injoyai/goutil/database/sqlite"
+	"github.com/injoyai/goutil/g"
 	"github.com/injoyai/goutil/oss"
 	"github.com/injoyai/tdx"
 	"github.com/injoyai/tdx/protocol"
@@ -26,6 +28,7 @@ func NewManage(m *tdx.Manage) (*Data, error) {
 		Retry:       tdx.DefaultRetry,
 		Goroutines:  50,
 		DatabaseDir: tdx.DefaultDatabaseDir,
+		Types:       Types,
 		Manage:      m,
 		Updated:     updated,
 	}, nil
@@ -35,24 +38,143 @@ type Data struct {
 	Retry       int
 	Goroutines  int
 	DatabaseDir string
+	Types       []string             //需要更新数据的品种
+	Calendar    Calendar             //为nil时按周一到周五计算
+	OnChange    func(code ...string) //股票的日线写入数据库后调用,用于清除缓存
 	*tdx.Manage
 	*Updated
+
+	gbbqMu sync.Mutex
+	gbbq   map[string]*gbbqCache //股本变迁按股票缓存当天的结果
 }
 
-func (this *Data) dayKlineFilename(code string) string {
-	return filepath.Join(this.DatabaseDir, DayKline, code+".db")
+type gbbqCache struct {
+	day  string
+	resp *protocol.GbbqResp
+}
+
+// SetCalendar 设置交易日历,更新数据时跳过非交易日
+func (this *Data) SetCalendar(c Calendar) {
+	this.Calendar = c
+	this.Updated.Calendar = c
+}
+
+func (this *Data) changed(code string) {
+	if this.OnChange != nil {
+		this.OnChange(code)
+	}
+}
+
+func (this *Data) calendar() Calendar {
+	if this.Calendar == nil {
+		return weekdays{}
+	}
+	return this.Calendar
+}
+
+// TradingDays 通达信的交易日
+func (this *Data) TradingDays() ([]time.Time, error) {
+	out := []time.Time(nil)
+	for t := range this.Workday.Iter(time.Date(1990, 1, 1, 0, 0, 0, 0, time.Local), time.Now()) {
+		out = append(out, t)
+	}
+	return out, nil
 }
 
-func (this *Data) minKlineFilename(code string, year int) string {
-	return filepath.Join(this.DatabaseDir, MinKline, code+"-"+conv.String(year)+".db")
+func (this *Data) dayKlineFilename(code string) string {
+	return filepath.Join(this.DatabaseDir, DayKline, code+".db")
 }
 
 func (this *Data) GetStockCodes() []string {
 	return this.Codes.GetStockCodes()
 }
 
+func (this *Data) GetCodes(types ...string) []string {
+	out := []string(nil)
+	for code := range this.Codes.Iter() {
+		if IsType(code, types...) {
+			out = append(out, code)
+		}
+	}
+	return out
+}
+
+func (this *Data) GetName(code string) string {
+	return this.Codes.GetName(code)
+}
+
+// getGbbq 获取股本变迁,同一天内相同股票只请求一次服务器
+func (this *Data) getGbbq(code string) (*protocol.GbbqResp, error) {
+	day := time.Now().Format(time.DateOnly)
+	this.gbbqMu.Lock()
+	if c, ok := this.gbbq[code]; ok && c.day == day {
+		this.gbbqMu.Unlock()
+		return c.resp, nil
+	}
+	this.gbbqMu.Unlock()
+
+	var resp *protocol.GbbqResp
+	err := g.Retry(func() error {
+		return this.Do(func(c *tdx.Client) (err error) {
+			resp, err = c.GetGbbq(code)
+			return
+		})
+	}, this.Retry)
+	if err != nil {
+		return nil, err
+	}
+
+	this.gbbqMu.Lock()
+	defer this.gbbqMu.Unlock()
+	if this.gbbq == nil {
+		this.gbbq = map[string]*gbbqCache{}
+	}
+	this.gbbq[code] = &gbbqCache{day: day, resp: resp}
+	return resp, nil
+}
+
+// GetXRXDs 从服务器获取股本变迁,只保留除权除息
+func (this *Data) GetXRXDs(code string) (protocol.XRXDs, error) {
+	resp, err := this.getGbbq(code)
+	if err != nil {
+		return nil, err
+	}
+	out := protocol.XRXDs{}
+	for _, v := range resp.List {
+		if v.IsXRXD() {
+			out = append(out, v.XRXD())
+		}
+	}
+	return out, nil
+}
+
+// GetEquities 从服务器获取股本变迁,只保留股本变化
+func (this *Data) GetEquities(code string) ([]*protocol.Equity, error) {
+	resp, err := this.getGbbq(code)
+	if err != nil {
+		return nil, err
+	}
+	out := []*protocol.Equity{}
+	for _, v := range resp.List {
+		if v.IsEquity() {
+			out = append(out, v.Equity())
+		}
+	}
+	return out, nil
+}
+
 func (this *Data) GetDayKlines(code string, start, end time.Time) (protocol.Klines, error) {
-	filename := this.dayKlineFilename(code)
+	s, err := OpenStore(this.DatabaseDir, false)
+	if err != nil {
+		return nil, err
+	} else if s != nil {
+		return s.Get(protocol.AddPrefix(code), start, end)
+	}
+	return readKlines(this.dayKlineFilename(code), code, start, end)
+}
+
+// readKlines 读取sqlite文件里的K线
+func readKlines(filename, code string, start, end time.Time) (protocol.Klines, error) {
 	if !oss.Exists(filename) {
 		return nil, fmt.Errorf("股票[%s]数据不存在", code)
 	}
@@ -67,9 +189,22 @@ func (this *Data) GetDayKlines(code string, start, end time.Time) (protocol.Klin
 }
 
 func (this *Data) GetMinKlines(code string, start, end time.Time) (protocol.Klines, error) {
-	filename := this.minKlineFilename(code, 2025)
-	if !oss.Exists(filename) {
-		return nil, fmt.Errorf("股票[%s]数据不存在", code)
+	return readMinKlines(this.DatabaseDir, protocol.AddPrefix(code), start, end)
+}
+
+// readMinKlines 读取按年分文件的分钟线,没有文件的年份跳过
+func readMinKlines(dir, code string, start, end time.Time) (protocol.Klines, error) {
+	out := protocol.Klines{}
+	for year := max(start.Year(), 1990); year <= end.Year(); year++ {
+		filename := filepath.Join(dir, MinKline, code+"-"+conv.String(year)+".db")
+		if !oss.Exists(filename) {
+			continue
+		}
+		ks, err := readKlines(filename, code, start, end)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ks...)
 	}
-	return nil, nil
+	return out, nil
 }
@@ -0,0 +1,382 @@
+package data
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/injoyai/goutil/oss"
+	"github.com/injoyai/tdx/protocol"
+)
+
+const (
+	OfflineCSV    = "csv"
+	OfflineSqlite = "sqlite"
+)
+
+/*
+NewOffline 离线数据源,不需要连接服务器
+
+sqlite: 和Data相同的目录结构,kline.db或day-kline/<code>.db, min-kline/<code>-<year>.db
+csv: day/<code>.csv, min/<code>.csv, xrxd/<code>.csv, equity/<code>.csv
+
+两种格式都可以在目录下放codes.csv(代码,名称)提供股票名称
+format为空时,存在day-kline目录则使用sqlite,否则使用csv
+*/
+func NewOffline(dir, format string) (*Offline, error) {
+	if !oss.Exists(dir) {
+		return nil, fmt.Errorf("数据目录[%s]不存在", dir)
+	}
+	if format == "" {
+		format = OfflineCSV
+		if oss.Exists(filepath.Join(dir, DayKline)) || oss.Exists(filepath.Join(dir, StoreFilename)) {
+			format = OfflineSqlite
+		}
+	}
+	if format != OfflineCSV && format != OfflineSqlite {
+		return nil, fmt.Errorf("不支持的离线数据格式: %s", format)
+	}
+	o := &Offline{
+		Dir:    dir,
+		Format: format,
+		names:  map[string]string{},
+	}
+	return o, o.loadNames()
+}
+
+type Offline struct {
+	Dir    string
+	Format string
+	names  map[string]string
+}
+
+func (this *Offline) loadNames() error {
+	filename := filepath.Join(this.Dir, "codes.csv")
+	if !oss.Exists(filename) {
+		return nil
+	}
+	rows, err := readCsv(filename)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if len(row) >= 2 {
+			this.names[row[0]] = row[1]
+		}
+	}
+	return nil
+}
+
+func (this *Offline) GetStockCodes() []string {
+	return this.GetCodes(TypeStock)
+}
+
+func (this *Offline) GetCodes(types ...string) []string {
+	if s := this.store(); s != nil {
+		codes, _ := s.Codes()
+		out := []string(nil)
+		for _, code := range codes {
+			if this.isType(code, types) {
+				out = append(out, code)
+			}
+		}
+		return out
+	}
+	dir, ext := filepath.Join(this.Dir, "day"), ".csv"
+	if this.Format == OfflineSqlite {
+		dir, ext = filepath.Join(this.Dir, DayKline), ".db"
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	out := []string(nil)
+	for _, v := range entries {
+		code := strings.TrimSuffix(v.Name(), ext)
+		if !v.IsDir() && strings.HasSuffix(v.Name(), ext) && this.isType(code, types) {
+			out = append(out, code)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// isType 离线数据里识别不了的代码按股票处理
+func (this *Offline) isType(code string, types []string) bool {
+	t := TypeOf(code)
+	if t == "" {
+		t = TypeStock
+	}
+	return matchType(t, types)
+}
+
+func (this *Offline) GetName(code string) string {
+	return this.names[code]
+}
+
+// store 合并数据库,csv格式或者没有迁移时返回nil
+func (this *Offline) store() *Store {
+	if this.Format != OfflineSqlite {
+		return nil
+	}
+	s, _ := OpenStore(this.Dir, false)
+	return s
+}
+
+func (this *Offline) GetDayKlines(code string, start, end time.Time) (protocol.Klines, error) {
+	if s := this.store(); s != nil {
+		return s.Get(code, start, end)
+	}
+	if this.Format == OfflineSqlite {
+		return readKlines(filepath.Join(this.Dir, DayKline, code+".db"), code, start, end)
+	}
+	return readCsvKlines(filepath.Join(this.Dir, "day", code+".csv"), code, start, end)
+}
+
+func (this *Offline) GetMinKlines(code string, start, end time.Time) (protocol.Klines, error) {
+	if this.Format == OfflineSqlite {
+		return readMinKlines(this.Dir, code, start, end)
+	}
+	return readCsvKlines(filepath.Join(this.Dir, "min", code+".csv"), code, start, end)
+}
+
+// TradingDays 以上证指数sh000001的日线作为交易日
+func (this *Offline) TradingDays() ([]time.Time, error) {
+	ks, err := this.GetDayKlines("sh000001", time.Time{}, time.Now().AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]time.Time, len(ks))
+	for i, k := range ks {
+		out[i] = k.Time
+	}
+	return out, nil
+}
+
+// GetXRXDs 读取xrxd/<code>.csv,列为日期,分红,配股价,送转股,配股,文件不存在时返回空
+func (this *Offline) GetXRXDs(code string) (protocol.XRXDs, error) {
+	filename := filepath.Join(this.Dir, "xrxd", code+".csv")
+	if !oss.Exists(filename) {
+		return protocol.XRXDs{}, nil
+	}
+	rows, err := readCsv(filename)
+	if err != nil {
+		return nil, err
+	}
+	out := protocol.XRXDs{}
+	for i, row := range rows {
+		if len(row) < 5 {
+			continue
+		}
+		t, err := parseDate(row[0], "")
+		if err != nil {
+			if i == 0 {
+				continue //表头
+			}
+			return nil, err
+		}
+		x := &protocol.XRXD{Code: code, Time: t}
+		x.Fenhong, _ = strconv.ParseFloat(row[1], 64)
+		x.Peigujia, _ = strconv.ParseFloat(row[2], 64)
+		x.Songzhuangu, _ = strconv.ParseFloat(row[3], 64)
+		x.Peigu, _ = strconv.ParseFloat(row[4], 64)
+		out = append(out, x)
+	}
+	return out, nil
+}
+
+// GetEquities 读取equity/<code>.csv,列为日期,流通股本,总股本,单位股,文件不存在时返回空
+func (this *Offline) GetEquities(code string) ([]*protocol.Equity, error) {
+	filename := filepath.Join(this.Dir, "equity", code+".csv")
+	if !oss.Exists(filename) {
+		return []*protocol.Equity{}, nil
+	}
+	rows, err := readCsv(filename)
+	if err != nil {
+		return nil, err
+	}
+	out := []*protocol.Equity{}
+	for i, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		t, err := parseDate(row[0], "")
+		if err != nil {
+			if i == 0 {
+				continue //表头
+			}
+			return nil, err
+		}
+		e := &protocol.Equity{Code: code, Time: t}
+		e.Float, _ = strconv.ParseFloat(row[1], 64)
+		e.Total, _ = strconv.ParseFloat(row[2], 64)
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func readCsv(filename string) ([][]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+// csvColumns 表头别名,兼容英文表头和extend.KlinesToCsv导出的中文表头
+var csvColumns = map[string][]string{
+	"code":   {"code", "代码", "symbol"},
+	"date":   {"date", "日期", "datetime", "time"},
+	"time":   {"时间"},
+	"open":   {"open", "开盘"},
+	"high":   {"high", "最高"},
+	"low":    {"low", "最低"},
+	"close":  {"close", "收盘"},
+	"volume": {"volume", "vol", "总手", "成交量"},
+	"amount": {"amount", "金额", "成交额"},
+}
+
+// readCsvKlines 读取csv文件的K线,按表头识别列,必须包含日期和开高低收
+func readCsvKlines(filename, code string, start, end time.Time) (protocol.Klines, error) {
+	if !oss.Exists(filename) {
+		return nil, fmt.Errorf("股票[%s]数据不存在", code)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	groups, err := decodeCsvKlines(f, code)
+	if err != nil {
+		return nil, fmt.Errorf("文件[%s]%v", filename, err)
+	}
+	//文件里只有一只股票,代码列可能不带前缀
+	out := protocol.Klines{}
+	for _, ks := range groups {
+		for _, k := range ks {
+			if k.Time.After(start) && k.Time.Before(end) {
+				out = append(out, k)
+			}
+		}
+	}
+	return out, nil
+}
+
+// decodeCsvKlines 按代码分组解析K线,没有代码列时都归到code,每组按时间升序
+func decodeCsvKlines(r io.Reader, code string) (map[string]protocol.Klines, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return map[string]protocol.Klines{}, nil
+	}
+
+	index := map[string]int{}
+	for i, v := range rows[0] {
+		v = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(v, "\ufeff")))
+		for col, alias := range csvColumns {
+			for _, a := range alias {
+				if v == a {
+					if _, ok := index[col]; !ok {
+						index[col] = i
+					}
+				}
+			}
+		}
+	}
+	for _, col := range []string{"date", "open", "high", "low", "close"} {
+		if _, ok := index[col]; !ok {
+			return nil, fmt.Errorf("缺少列: %s", col)
+		}
+	}
+
+	get := func(row []string, col string) string {
+		i, ok := index[col]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+	price := func(row []string, col string) (protocol.Price, error) {
+		f, err := strconv.ParseFloat(get(row, col), 64)
+		return protocol.Yuan(f), err
+	}
+
+	out := map[string]protocol.Klines{}
+	for n, row := range rows[1:] {
+		t, err := parseDate(get(row, "date"), get(row, "time"))
+		if err != nil {
+			return nil, fmt.Errorf("第%d行: %v", n+2, err)
+		}
+		k := &protocol.Kline{Time: t}
+		for col, p := range map[string]*protocol.Price{"open": &k.Open, "high": &k.High, "low": &k.Low, "close": &k.Close} {
+			if *p, err = price(row, col); err != nil {
+				return nil, fmt.Errorf("第%d行: %v", n+2, err)
+			}
+		}
+		//成交量和成交额可以没有,有的话需要是数字
+		if v := get(row, "volume"); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行: 无效的成交量: %s", n+2, v)
+			}
+			k.Volume = int64(f)
+		}
+		if v := get(row, "amount"); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行: 无效的成交额: %s", n+2, v)
+			}
+			k.Amount = protocol.Yuan(f)
+		}
+		c := code
+		if v := get(row, "code"); v != "" {
+			c = strings.ToLower(v)
+		}
+		out[c] = append(out[c], k)
+	}
+	for _, ks := range out {
+		sort.Slice(ks, func(i, j int) bool { return ks[i].Time.Before(ks[j].Time) })
+		for i := 1; i < len(ks); i++ {
+			ks[i].Last = ks[i-1].Close
+		}
+	}
+	return out, nil
+}
+
+var dateLayouts = []string{
+	time.DateTime,
+	"2006-01-02 15:04",
+	time.DateOnly,
+	"2006/01/02",
+	"20060102",
+}
+
+// parseDate 解析日期,clock是单独的时间列,例15:04
+func parseDate(date, clock string) (time.Time, error) {
+	if clock != "" {
+		date += " " + clock
+		if len(date) == len("20060102 15:04") {
+			return time.ParseInLocation("20060102 15:04", date, time.Local)
+		}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, date, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("无效的日期: " + date)
+}
@@ -0,0 +1,167 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+func writeFile(t *testing.T, filename, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func date(s string) time.Time {
+	t, _ := time.ParseInLocation(time.DateOnly, s, time.Local)
+	return t
+}
+
+func TestOfflineCSV(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "codes.csv"), "sz000001,平安银行\nsh000001,上证指数\n")
+	//中文表头带BOM,行的顺序是乱的
+	writeFile(t, filepath.Join(dir, "day", "sz000001.csv"), "\ufeff日期,开盘,最高,最低,收盘,成交量,成交额\n"+
+		"2024-01-03,10.2,10.5,10.1,10.4,1000,1040000\n"+
+		"2024-01-02,10,10.3,9.9,10.2,2000,2040000\n"+
+		"2024/01/04,10.4,10.6,10.3,10.5,,\n")
+	writeFile(t, filepath.Join(dir, "day", "sh000001.csv"), "date,open,high,low,close\n20240102,1,1,1,1\n20240103,1,1,1,1\n")
+	writeFile(t, filepath.Join(dir, "xrxd", "sz000001.csv"), "日期,分红,配股价,送转股,配股\n2024-01-03,1.5,0,0,0\n")
+	writeFile(t, filepath.Join(dir, "equity", "sz000001.csv"), "日期,流通股本,总股本\n2024-01-02,100,200\n")
+
+	o, err := NewOffline(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Format != OfflineCSV {
+		t.Fatalf("格式%s,期望csv", o.Format)
+	}
+	if codes := o.GetStockCodes(); len(codes) != 1 || codes[0] != "sz000001" {
+		t.Fatalf("股票代码有误: %v", codes)
+	}
+	if codes := o.GetCodes(); len(codes) != 2 {
+		t.Fatalf("全部代码有误: %v", codes)
+	}
+	if name := o.GetName("sz000001"); name != "平安银行" {
+		t.Fatalf("名称有误: %s", name)
+	}
+
+	ks, err := o.GetDayKlines("sz000001", time.Time{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks) != 3 || !ks[0].Time.Equal(date("2024-01-02")) || !ks[2].Time.Equal(date("2024-01-04")) {
+		t.Fatalf("日线有误: %v", ks)
+	}
+	if ks[0].Close != protocol.Yuan(10.2) || ks[0].Volume != 2000 || ks[0].Amount != protocol.Yuan(2040000) {
+		t.Fatalf("第一根有误: %+v", ks[0])
+	}
+	if ks[1].Last != ks[0].Close || ks[2].Volume != 0 {
+		t.Fatalf("昨收或空成交量有误: %+v %+v", ks[1], ks[2])
+	}
+	//区间不包含开始和结束
+	if ks, err = o.GetDayKlines("sz000001", date("2024-01-02"), date("2024-01-04")); err != nil || len(ks) != 1 {
+		t.Fatalf("区间读取有误: %v %v", ks, err)
+	}
+	if _, err = o.GetDayKlines("sz000002", time.Time{}, time.Now()); err == nil {
+		t.Fatal("没有数据的股票期望返回错误")
+	}
+
+	days, err := o.TradingDays()
+	if err != nil || len(days) != 2 {
+		t.Fatalf("交易日有误: %v %v", days, err)
+	}
+	xs, err := o.GetXRXDs("sz000001")
+	if err != nil || len(xs) != 1 || xs[0].Fenhong != 1.5 {
+		t.Fatalf("除权除息有误: %v %v", xs, err)
+	}
+	if xs, err = o.GetXRXDs("sz000002"); err != nil || len(xs) != 0 {
+		t.Fatalf("没有除权除息文件期望返回空: %v %v", xs, err)
+	}
+	eqs, err := o.GetEquities("sz000001")
+	if err != nil || len(eqs) != 1 || eqs[0].Float != 100 || eqs[0].Total != 200 {
+		t.Fatalf("股本有误: %v %v", eqs, err)
+	}
+}
+
+func TestOfflineCSVError(t *testing.T) {
+	cases := map[string]string{
+		"缺少列: close":  "date,open,high,low\n2024-01-02,1,1,1\n",
+		"第3行: 无效的日期":  "date,open,high,low,close\n2024-01-02,1,1,1,1\n2024-13-45,1,1,1,1\n",
+		"第2行":         "date,open,high,low,close\n2024-01-02,1,x,1,1\n",
+		"第2行: 无效的成交量": "date,open,high,low,close,volume\n2024-01-02,1,1,1,1,1O0\n",
+		"第3行: 无效的成交额": "date,open,high,low,close,amount\n2024-01-02,1,1,1,1,100\n2024-01-03,1,1,1,1,-\n",
+	}
+	for want, content := range cases {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "day", "sz000001.csv"), content)
+		o, err := NewOffline(dir, OfflineCSV)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = o.GetDayKlines("sz000001", time.Time{}, time.Now())
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("期望错误包含%q,得到%v", want, err)
+		}
+	}
+}
+
+func TestOfflineSqlite(t *testing.T) {
+	ks := protocol.Klines{
+		{Time: date("2024-01-02").Add(15 * time.Hour), Close: protocol.Yuan(10), Volume: 100},
+		{Time: date("2024-01-03").Add(15 * time.Hour), Close: protocol.Yuan(11), Volume: 200},
+	}
+
+	//按股票分文件
+	dir := t.TempDir()
+	if _, err := insertKlines(filepath.Join(dir, DayKline, "sz000001.db"), ks); err != nil {
+		t.Fatal(err)
+	}
+	o, err := NewOffline(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Format != OfflineSqlite {
+		t.Fatalf("格式%s,期望sqlite", o.Format)
+	}
+	if codes := o.GetStockCodes(); len(codes) != 1 || codes[0] != "sz000001" {
+		t.Fatalf("股票代码有误: %v", codes)
+	}
+	got, err := o.GetDayKlines("sz000001", time.Time{}, time.Now())
+	if err != nil || len(got) != 2 || got[1].Close != protocol.Yuan(11) {
+		t.Fatalf("日线有误: %v %v", got, err)
+	}
+
+	//合并数据库
+	dir = t.TempDir()
+	s, err := OpenStore(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Insert("sz000002", ks); err != nil {
+		t.Fatal(err)
+	}
+	if o, err = NewOffline(dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	if codes := o.GetStockCodes(); len(codes) != 1 || codes[0] != "sz000002" {
+		t.Fatalf("股票代码有误: %v", codes)
+	}
+	//结束时间是第二根的时间,不包含
+	got, err = o.GetDayKlines("sz000002", time.Time{}, ks[1].Time)
+	if err != nil || len(got) != 1 || !got[0].Time.Equal(ks[0].Time) {
+		t.Fatalf("日线有误: %v %v", got, err)
+	}
+
+	if _, err = NewOffline(dir, "parquet"); err == nil {
+		t.Fatal("不支持的格式期望返回错误")
+	}
+}
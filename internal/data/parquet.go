@@ -0,0 +1,275 @@
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+/*
+parquetWriter 最简单的parquet写入,只支持扁平的必填列,不压缩,PLAIN编码
+每次WriteGroup写一个RowGroup,不需要把全部数据放在内存里
+元数据使用thrift compact协议编码,格式参考
+https://github.com/apache/parquet-format/blob/master/src/main/thrift/parquet.thrift
+*/
+
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+)
+
+type parquetColumn struct {
+	Name      string
+	Type      int32
+	Converted int32 //-1表示没有
+}
+
+// parquetValues 一列的数据,按类型使用对应的字段
+type parquetValues struct {
+	Int64s  []int64
+	Doubles []float64
+	Strings []string
+}
+
+type parquetChunk struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+type parquetGroup struct {
+	rows   int64
+	size   int64
+	chunks []parquetChunk
+}
+
+type parquetWriter struct {
+	w       io.Writer
+	offset  int64
+	columns []parquetColumn
+	groups  []parquetGroup
+}
+
+func newParquetWriter(w io.Writer, columns []parquetColumn) (*parquetWriter, error) {
+	p := &parquetWriter{w: w, columns: columns}
+	return p, p.write([]byte("PAR1"))
+}
+
+func (this *parquetWriter) write(bs []byte) error {
+	n, err := this.w.Write(bs)
+	this.offset += int64(n)
+	return err
+}
+
+// WriteGroup 写一个RowGroup,values和columns一一对应
+func (this *parquetWriter) WriteGroup(rows int, values []parquetValues) error {
+	if rows == 0 {
+		return nil
+	}
+	g := parquetGroup{rows: int64(rows)}
+	for i, col := range this.columns {
+		data := bytes.NewBuffer(nil)
+		v := values[i]
+		switch col.Type {
+		case parquetInt64:
+			binary.Write(data, binary.LittleEndian, v.Int64s)
+		case parquetDouble:
+			for _, f := range v.Doubles {
+				binary.Write(data, binary.LittleEndian, math.Float64bits(f))
+			}
+		case parquetByteArray:
+			for _, s := range v.Strings {
+				binary.Write(data, binary.LittleEndian, uint32(len(s)))
+				data.WriteString(s)
+			}
+		}
+
+		header := newThrift()
+		header.i32(1, 0) //DATA_PAGE
+		header.i32(2, int32(data.Len()))
+		header.i32(3, int32(data.Len()))
+		header.structBegin(5)
+		header.i32(1, int32(rows))
+		header.i32(2, 0) //PLAIN
+		header.i32(3, 3) //RLE
+		header.i32(4, 3) //RLE
+		header.structEnd()
+		header.stop()
+
+		chunk := parquetChunk{offset: this.offset, values: int64(rows)}
+		if err := this.write(header.Bytes()); err != nil {
+			return err
+		}
+		if err := this.write(data.Bytes()); err != nil {
+			return err
+		}
+		chunk.size = this.offset - chunk.offset
+		g.size += chunk.size
+		g.chunks = append(g.chunks, chunk)
+	}
+	this.groups = append(this.groups, g)
+	return nil
+}
+
+// Close 写入文件元数据,不关闭底层的writer
+func (this *parquetWriter) Close() error {
+	var rows int64
+	for _, g := range this.groups {
+		rows += g.rows
+	}
+
+	t := newThrift()
+	t.i32(1, 1)
+
+	t.listBegin(2, thriftStruct, len(this.columns)+1)
+	t.elemBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(this.columns)))
+	t.structEnd()
+	for _, col := range this.columns {
+		t.elemBegin()
+		t.i32(1, col.Type)
+		t.i32(3, 0) //REQUIRED
+		t.binary(4, col.Name)
+		if col.Converted >= 0 {
+			t.i32(6, col.Converted)
+		}
+		t.structEnd()
+	}
+
+	t.i64(3, rows)
+
+	t.listBegin(4, thriftStruct, len(this.groups))
+	for _, g := range this.groups {
+		t.elemBegin()
+		t.listBegin(1, thriftStruct, len(g.chunks))
+		for i, c := range g.chunks {
+			t.elemBegin()
+			t.i64(2, c.offset)
+			t.structBegin(3)
+			t.i32(1, this.columns[i].Type)
+			t.listBegin(2, thriftI32, 1)
+			t.varint(0) //PLAIN
+			t.listBegin(3, thriftBinary, 1)
+			t.str(this.columns[i].Name)
+			t.i32(4, 0) //UNCOMPRESSED
+			t.i64(5, c.values)
+			t.i64(6, c.size)
+			t.i64(7, c.size)
+			t.i64(9, c.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, g.size)
+		t.i64(3, g.rows)
+		t.structEnd()
+	}
+	t.binary(6, "trategy")
+	t.stop()
+
+	meta := t.Bytes()
+	if err := this.write(meta); err != nil {
+		return err
+	}
+	if err := this.write(binary.LittleEndian.AppendUint32(nil, uint32(len(meta)))); err != nil {
+		return err
+	}
+	return this.write([]byte("PAR1"))
+}
+
+/*
+thrift compact协议,只实现parquet元数据用到的部分
+*/
+
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+type thrift struct {
+	bytes.Buffer
+	last  int16
+	stack []int16
+}
+
+func newThrift() *thrift {
+	return &thrift{}
+}
+
+func (this *thrift) varint(v uint64) {
+	this.Write(binary.AppendUvarint(nil, v))
+}
+
+func (this *thrift) zigzag(v int64) {
+	this.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (this *thrift) field(id int16, typ byte) {
+	if delta := id - this.last; delta > 0 && delta <= 15 {
+		this.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		this.WriteByte(typ)
+		this.zigzag(int64(id))
+	}
+	this.last = id
+}
+
+func (this *thrift) i32(id int16, v int32) {
+	this.field(id, thriftI32)
+	this.zigzag(int64(v))
+}
+
+func (this *thrift) i64(id int16, v int64) {
+	this.field(id, thriftI64)
+	this.zigzag(v)
+}
+
+func (this *thrift) binary(id int16, s string) {
+	this.field(id, thriftBinary)
+	this.str(s)
+}
+
+func (this *thrift) str(s string) {
+	this.varint(uint64(len(s)))
+	this.WriteString(s)
+}
+
+func (this *thrift) listBegin(id int16, elem byte, size int) {
+	this.field(id, thriftList)
+	if size < 15 {
+		this.WriteByte(byte(size)<<4 | elem)
+	} else {
+		this.WriteByte(0xF0 | elem)
+		this.varint(uint64(size))
+	}
+}
+
+// structBegin 结构体字段
+func (this *thrift) structBegin(id int16) {
+	this.field(id, thriftStruct)
+	this.elemBegin()
+}
+
+// elemBegin 列表里的结构体
+func (this *thrift) elemBegin() {
+	this.stack = append(this.stack, this.last)
+	this.last = 0
+}
+
+func (this *thrift) structEnd() {
+	this.stop()
+	this.last = this.stack[len(this.stack)-1]
+	this.stack = this.stack[:len(this.stack)-1]
+}
+
+func (this *thrift) stop() {
+	this.WriteByte(0)
+}
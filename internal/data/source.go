@@ -0,0 +1,60 @@
+package data
+
+import (
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+// Source 行情数据源,选股、回测等只依赖这个接口
+type Source interface {
+	// GetStockCodes 股票代码,例sh600000
+	GetStockCodes() []string
+	// GetCodes 指定品种的代码,types为空时返回全部已知品种
+	GetCodes(types ...string) []string
+	// GetName 股票名称,未知时返回空
+	GetName(code string) string
+	// GetDayKlines 日线,按时间升序
+	GetDayKlines(code string, start, end time.Time) (protocol.Klines, error)
+	// GetMinKlines 分钟线,按时间升序
+	GetMinKlines(code string, start, end time.Time) (protocol.Klines, error)
+	// GetXRXDs 除权除息记录
+	GetXRXDs(code string) (protocol.XRXDs, error)
+	// GetEquities 股本变迁记录,按时间升序
+	GetEquities(code string) ([]*protocol.Equity, error)
+	// TradingDays 已知的全部交易日,用于生成交易日历
+	TradingDays() ([]time.Time, error)
+}
+
+// Calendar 交易日历,由calendar包实现
+type Calendar interface {
+	IsTradingDay(t time.Time) bool
+	// LastClose t之前(包含t)最近一次收盘的时间
+	LastClose(t time.Time) time.Time
+}
+
+// weekdays 没有交易日历时按周一到周五15点收盘计算
+type weekdays struct{}
+
+func (weekdays) IsTradingDay(t time.Time) bool {
+	return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday
+}
+
+func (this weekdays) LastClose(t time.Time) time.Time {
+	d := time.Date(t.Year(), t.Month(), t.Day(), 15, 0, 0, 0, time.Local)
+	if t.Before(d) {
+		d = d.AddDate(0, 0, -1)
+	}
+	for !this.IsTradingDay(d) {
+		d = d.AddDate(0, 0, -1)
+	}
+	return d
+}
+
+// Updater 支持从远端同步数据的数据源
+type Updater interface {
+	// Start 立即更新一次,并在每个交易日收盘后定时更新
+	Start()
+	// Update 立即更新日线和分钟线,force为true时忽略今天是否已经更新过
+	Update(force bool) error
+}
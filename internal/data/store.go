@@ -0,0 +1,318 @@
+package data
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/injoyai/goutil/database/sqlite"
+	"github.com/injoyai/goutil/database/xorms"
+	"github.com/injoyai/goutil/oss"
+	"github.com/injoyai/tdx/protocol"
+	"xorm.io/xorm"
+)
+
+// StoreFilename 合并后的日线数据库,在数据目录下
+const StoreFilename = "kline.db"
+
+// StoreKline 合并数据库里的日线,价格单位厘,时间为unix秒
+type StoreKline struct {
+	Code   string `xorm:"pk varchar(16)"`
+	Time   int64  `xorm:"pk index"`
+	Open   int64
+	High   int64
+	Low    int64
+	Close  int64
+	Volume int64
+	Amount int64
+}
+
+/*
+Store 所有股票的日线保存在一个sqlite文件里,主键(Code,Time)
+不需要每次读取都打开一个文件,全市场读取时只需要一次查询
+*/
+type Store struct {
+	db *xorms.Engine
+}
+
+var (
+	stores   = map[string]*Store{}
+	storesMu sync.Mutex
+)
+
+// OpenStore 打开dir下的合并数据库,create为false且文件不存在时返回nil
+func OpenStore(dir string, create bool) (*Store, error) {
+	filename := filepath.Join(dir, StoreFilename)
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if s, ok := stores[filename]; ok {
+		return s, nil
+	}
+	if !create && !oss.Exists(filename) {
+		return nil, nil
+	}
+	db, err := sqlite.NewXorm(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Sync2(new(StoreKline)); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &Store{db: db}
+	stores[filename] = s
+	return s, nil
+}
+
+// Codes 有数据的股票代码
+func (this *Store) Codes() ([]string, error) {
+	rows, err := this.db.DB().Query("SELECT DISTINCT Code FROM StoreKline ORDER BY Code")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []string(nil)
+	for rows.Next() {
+		var code string
+		if err = rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		out = append(out, code)
+	}
+	return out, rows.Err()
+}
+
+func scanKline(scan func(dest ...any) error) (string, *protocol.Kline, error) {
+	var code string
+	var t, open, high, low, close, volume, amount int64
+	if err := scan(&code, &t, &open, &high, &low, &close, &volume, &amount); err != nil {
+		return "", nil, err
+	}
+	return code, &protocol.Kline{
+		Time:   time.Unix(t, 0),
+		Open:   protocol.Price(open),
+		High:   protocol.Price(high),
+		Low:    protocol.Price(low),
+		Close:  protocol.Price(close),
+		Volume: volume,
+		Amount: protocol.Price(amount),
+	}, nil
+}
+
+const storeColumns = "Code,Time,Open,High,Low,Close,Volume,Amount"
+
+// Get 读取(start,end)之间的日线,按时间升序
+func (this *Store) Get(code string, start, end time.Time) (protocol.Klines, error) {
+	rows, err := this.db.DB().Query(
+		"SELECT "+storeColumns+" FROM StoreKline WHERE Code=? AND Time>? AND Time<? ORDER BY Time",
+		code, start.Unix(), end.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := protocol.Klines{}
+	for rows.Next() {
+		_, k, err := scanKline(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// GetAll 一次查询读取全部股票(start,end)之间的日线
+func (this *Store) GetAll(start, end time.Time) (map[string]protocol.Klines, error) {
+	rows, err := this.db.DB().Query(
+		"SELECT "+storeColumns+" FROM StoreKline WHERE Time>? AND Time<? ORDER BY Code,Time",
+		start.Unix(), end.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]protocol.Klines{}
+	for rows.Next() {
+		code, k, err := scanKline(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out[code] = append(out[code], k)
+	}
+	return out, rows.Err()
+}
+
+// Last 最后一根日线,没有数据时返回nil
+func (this *Store) Last(code string) (*protocol.Kline, error) {
+	row := this.db.DB().QueryRow("SELECT "+storeColumns+" FROM StoreKline WHERE Code=? ORDER BY Time DESC LIMIT 1", code)
+	_, k, err := scanKline(row.Scan)
+	if err != nil && strings.Contains(err.Error(), "no rows") {
+		return nil, nil
+	}
+	return k, err
+}
+
+// Replace 删除[start,end)之间的数据后写入ks,end为零值时表示不限制
+func (this *Store) Replace(code string, start, end time.Time, ks protocol.Klines) error {
+	return this.db.SessionFunc(func(session *xorm.Session) error {
+		var err error
+		if end.IsZero() {
+			_, err = session.Exec("DELETE FROM StoreKline WHERE Code=? AND Time>=?", code, start.Unix())
+		} else {
+			_, err = session.Exec("DELETE FROM StoreKline WHERE Code=? AND Time>=? AND Time<?", code, start.Unix(), end.Unix())
+		}
+		if err != nil {
+			return err
+		}
+		return insertStore(session, "INSERT OR REPLACE", code, ks)
+	})
+}
+
+// Insert 写入ks,已存在相同时间的K线跳过,返回新增的数量
+func (this *Store) Insert(code string, ks protocol.Klines) (int, error) {
+	n := 0
+	err := this.db.SessionFunc(func(session *xorm.Session) error {
+		before, err := session.Table(new(StoreKline)).Where("Code=?", code).Count()
+		if err != nil {
+			return err
+		}
+		if err = insertStore(session, "INSERT OR IGNORE", code, ks); err != nil {
+			return err
+		}
+		after, err := session.Table(new(StoreKline)).Where("Code=?", code).Count()
+		n = int(after - before)
+		return err
+	})
+	return n, err
+}
+
+func insertStore(session *xorm.Session, verb, code string, ks protocol.Klines) error {
+	for _, k := range ks {
+		_, err := session.Exec(verb+" INTO StoreKline ("+storeColumns+") VALUES (?,?,?,?,?,?,?,?)",
+			code, k.Time.Unix(), int64(k.Open), int64(k.High), int64(k.Low), int64(k.Close), k.Volume, int64(k.Amount))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateResult 迁移结果
+type MigrateResult struct {
+	Codes   int           `json:"codes"`
+	Klines  int           `json:"klines"`
+	Failed  []string      `json:"failed"`
+	Spend   time.Duration `json:"spend"`
+	Removed bool          `json:"removed"`
+}
+
+// Migrate 把day-kline/*.db迁移到合并数据库,remove为true时迁移成功后删除原来的文件
+func Migrate(dir string, remove bool, progress func(done, total int)) (*MigrateResult, error) {
+	start := time.Now()
+	entries, err := os.ReadDir(filepath.Join(dir, DayKline))
+	if err != nil {
+		return nil, err
+	}
+	s, err := OpenStore(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	res := &MigrateResult{Failed: []string{}}
+	for i, v := range entries {
+		if !v.IsDir() && strings.HasSuffix(v.Name(), ".db") {
+			code := strings.TrimSuffix(v.Name(), ".db")
+			filename := filepath.Join(dir, DayKline, v.Name())
+			ks, err := readKlines(filename, code, time.Time{}, time.Now().AddDate(1, 0, 0))
+			if err == nil {
+				_, err = s.Insert(code, ks)
+			}
+			if err != nil {
+				res.Failed = append(res.Failed, fmt.Sprintf("%s: %v", code, err))
+			} else {
+				res.Codes++
+				res.Klines += len(ks)
+			}
+		}
+		if progress != nil {
+			progress(i+1, len(entries))
+		}
+	}
+	if remove && len(res.Failed) == 0 {
+		if err = os.RemoveAll(filepath.Join(dir, DayKline)); err != nil {
+			return res, err
+		}
+		res.Removed = true
+	}
+	res.Spend = time.Since(start)
+	return res, nil
+}
+
+// BenchResult 全市场读取耗时
+type BenchResult struct {
+	Name   string        `json:"name"`
+	Codes  int           `json:"codes"`
+	Klines int           `json:"klines"`
+	Spend  time.Duration `json:"spend"`
+}
+
+// Bench 分别用每个股票一个文件和合并数据库读取全市场(start,end)的日线,对应的数据不存在时跳过
+func Bench(dir string, start, end time.Time) ([]BenchResult, error) {
+	out := []BenchResult(nil)
+
+	if entries, err := os.ReadDir(filepath.Join(dir, DayKline)); err == nil {
+		r := BenchResult{Name: "file"}
+		now := time.Now()
+		for _, v := range entries {
+			if v.IsDir() || !strings.HasSuffix(v.Name(), ".db") {
+				continue
+			}
+			code := strings.TrimSuffix(v.Name(), ".db")
+			ks, err := readKlines(filepath.Join(dir, DayKline, v.Name()), code, start, end)
+			if err != nil {
+				return nil, err
+			}
+			r.Codes++
+			r.Klines += len(ks)
+		}
+		r.Spend = time.Since(now)
+		out = append(out, r)
+	}
+
+	s, err := OpenStore(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	if s != nil {
+		now := time.Now()
+		codes, err := s.Codes()
+		if err != nil {
+			return nil, err
+		}
+		r := BenchResult{Name: "store"}
+		for _, code := range codes {
+			ks, err := s.Get(code, start, end)
+			if err != nil {
+				return nil, err
+			}
+			r.Codes++
+			r.Klines += len(ks)
+		}
+		r.Spend = time.Since(now)
+		out = append(out, r)
+
+		now = time.Now()
+		all, err := s.GetAll(start, end)
+		if err != nil {
+			return nil, err
+		}
+		r = BenchResult{Name: "store-all", Codes: len(all)}
+		for _, ks := range all {
+			r.Klines += len(ks)
+		}
+		r.Spend = time.Since(now)
+		out = append(out, r)
+	}
+	return out, nil
+}
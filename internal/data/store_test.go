@@ -0,0 +1,164 @@
+package data
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+const (
+	benchCodes  = 50   //股票数量
+	benchKlines = 1000 //每只股票的日线数量
+)
+
+var (
+	benchOnce sync.Once
+	benchDir  string
+	benchErr  error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if benchDir != "" {
+		os.RemoveAll(benchDir)
+	}
+	os.Exit(code)
+}
+
+func benchCode(i int) string {
+	return fmt.Sprintf("sz%06d", i+1)
+}
+
+// storeFixture 同时生成按股票分文件和合并数据库两种格式的日线,只生成一次
+func storeFixture(tb testing.TB) (string, *Store) {
+	benchOnce.Do(func() {
+		if benchDir, benchErr = os.MkdirTemp("", "trategy-store"); benchErr != nil {
+			return
+		}
+		s, err := OpenStore(benchDir, true)
+		if err != nil {
+			benchErr = err
+			return
+		}
+		t := time.Date(2020, 1, 1, 15, 0, 0, 0, time.Local)
+		for i := 0; i < benchCodes; i++ {
+			ks := make(protocol.Klines, benchKlines)
+			for j := range ks {
+				p := protocol.Yuan(10 + float64(j%100)/10)
+				ks[j] = &protocol.Kline{Time: t.AddDate(0, 0, j), Open: p, High: p, Low: p, Close: p, Volume: 100, Amount: p * 10000}
+			}
+			code := benchCode(i)
+			if _, err = insertKlines(filepath.Join(benchDir, DayKline, code+".db"), ks); err != nil {
+				benchErr = err
+				return
+			}
+			if _, err = s.Insert(code, ks); err != nil {
+				benchErr = err
+				return
+			}
+		}
+	})
+	if benchErr != nil {
+		tb.Fatal(benchErr)
+	}
+	s, err := OpenStore(benchDir, false)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return benchDir, s
+}
+
+func TestStore(t *testing.T) {
+	dir, s := storeFixture(t)
+	start := time.Date(2020, 3, 1, 0, 0, 0, 0, time.Local)
+	end := time.Date(2021, 3, 1, 0, 0, 0, 0, time.Local)
+	code := benchCode(0)
+
+	file, err := readKlines(filepath.Join(dir, DayKline, code+".db"), code, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := s.Get(code, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks) == 0 || len(ks) != len(file) {
+		t.Fatalf("合并数据库读取%d根,分文件读取%d根", len(ks), len(file))
+	}
+	for i := range ks {
+		if !ks[i].Time.Equal(file[i].Time) || ks[i].Close != file[i].Close || ks[i].Amount != file[i].Amount {
+			t.Fatalf("第%d根不一致: %+v %+v", i, ks[i], file[i])
+		}
+	}
+
+	all, err := s.GetAll(start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != benchCodes || len(all[code]) != len(ks) {
+		t.Fatalf("全部读取有误: %d只,%s有%d根", len(all), code, len(all[code]))
+	}
+
+	last, err := s.Last(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2020, 1, 1, 15, 0, 0, 0, time.Local).AddDate(0, 0, benchKlines-1); !last.Time.Equal(want) {
+		t.Fatalf("最后一根时间%v,期望%v", last.Time, want)
+	}
+}
+
+// BenchmarkStore 对比按股票分文件和合并数据库的读取速度,读取最近一年的日线
+func BenchmarkStore(b *testing.B) {
+	dir, s := storeFixture(b)
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local)
+	end := time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local)
+
+	b.Run("file/one", func(b *testing.B) {
+		code := benchCode(0)
+		for i := 0; i < b.N; i++ {
+			if _, err := readKlines(filepath.Join(dir, DayKline, code+".db"), code, start, end); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("store/one", func(b *testing.B) {
+		code := benchCode(0)
+		for i := 0; i < b.N; i++ {
+			if _, err := s.Get(code, start, end); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("file/all", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < benchCodes; j++ {
+				code := benchCode(j)
+				if _, err := readKlines(filepath.Join(dir, DayKline, code+".db"), code, start, end); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("store/each", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < benchCodes; j++ {
+				if _, err := s.Get(benchCode(j), start, end); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("store/all", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := s.GetAll(start, end); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -1,11 +1,17 @@
 package data
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/injoyai/goutil/database/sqlite"
 	"github.com/injoyai/goutil/database/xorms"
 	"github.com/injoyai/goutil/g"
+	"github.com/injoyai/goutil/oss"
 	"github.com/injoyai/goutil/str/bar/v2"
 	"github.com/injoyai/logs"
 	"github.com/injoyai/tdx"
@@ -20,26 +26,76 @@ import (
 
  */
 
+var (
+	afterUpdateMu sync.Mutex
+	afterUpdate   []func()
+	hasUpdated    bool
+)
+
+/*
+OnUpdated 注册日线更新完成后执行的函数,例如定时选股,更新失败时不执行
+启动时补更新完成和每个交易日定时更新完成后都会执行,注册时已经更新过则立即异步执行一次
+*/
+func OnUpdated(f func()) {
+	afterUpdateMu.Lock()
+	defer afterUpdateMu.Unlock()
+	afterUpdate = append(afterUpdate, f)
+	if hasUpdated {
+		go f()
+	}
+}
+
+// updated 日线更新完成,执行注册的函数
+func updated() {
+	afterUpdateMu.Lock()
+	hasUpdated = true
+	fs := append([]func(){}, afterUpdate...)
+	afterUpdateMu.Unlock()
+	for _, f := range fs {
+		f()
+	}
+}
+
 // Start 更新数据
 func (this *Data) Start() {
 	cr := cron.New(cron.WithSeconds())
 	cr.AddFunc("0 20 15 * * *", func() {
-		logs.PrintErr(this.updateDayKlineAll())
+		if !this.calendar().IsTradingDay(time.Now()) {
+			return
+		}
+		if err := this.updateDayKlineAll(false); err != nil {
+			logs.Err(err)
+			return
+		}
+		updated()
+		logs.PrintErr(this.updateMinKlineAll(false))
 	})
-	logs.PrintErr(this.updateDayKlineAll())
+	if err := this.updateDayKlineAll(false); err != nil {
+		logs.Err(err)
+	} else {
+		updated()
+	}
 	cr.Start()
 }
 
+// Update 立即更新日线和已有分钟线的股票的分钟线,force为true时忽略今天是否已经更新过
+func (this *Data) Update(force bool) error {
+	if err := this.updateDayKlineAll(force); err != nil {
+		return err
+	}
+	return this.updateMinKlineAll(force)
+}
+
 // updateDayKline 更新日线数据
-func (this *Data) updateDayKlineAll() error {
+func (this *Data) updateDayKlineAll(force bool) error {
 	updated, err := this.Updated.Updated(DayKline)
 	if err != nil {
 		return err
 	}
-	if updated {
+	if updated && !force {
 		return nil
 	}
-	codes := this.Codes.GetStockCodes()
+	codes := this.GetCodes(this.Types...)
 	b := bar.NewCoroutine(len(codes), this.Goroutines)
 	defer b.Close()
 	for i := range codes {
@@ -58,6 +114,13 @@ func (this *Data) updateDayKlineAll() error {
 
 func (this *Data) updateDayKline(code string) error {
 	code = protocol.AddPrefix(code)
+	defer this.changed(code)
+	s, err := OpenStore(this.DatabaseDir, false)
+	if err != nil {
+		return err
+	} else if s != nil {
+		return this.updateDayKlineStore(s, code)
+	}
 	filename := this.dayKlineFilename(code)
 
 	db, err := sqlite.NewXorm(filename)
@@ -81,7 +144,7 @@ func (this *Data) updateDayKline(code string) error {
 	var resp *protocol.KlineResp
 	err = g.Retry(func() error {
 		return this.Do(func(c *tdx.Client) error {
-			resp, err = c.GetKlineDayUntil(code, func(k *protocol.Kline) bool {
+			resp, err = getKlineDayUntil(c, code, func(k *protocol.Kline) bool {
 				return k.Time.Unix() <= last.Time.Unix()
 			})
 			return err
@@ -114,9 +177,167 @@ func (this *Data) updateDayKline(code string) error {
 
 }
 
-// updateMinKline 更新分钟数据
-func updateMinKline() {
+// updateDayKlineStore 迁移到合并数据库后的更新,同样从最后一根K线开始替换
+func (this *Data) updateDayKlineStore(s *Store, code string) error {
+	last, err := s.Last(code)
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		last = &protocol.Kline{}
+	}
+	var resp *protocol.KlineResp
+	err = g.Retry(func() error {
+		return this.Do(func(c *tdx.Client) error {
+			resp, err = getKlineDayUntil(c, code, func(k *protocol.Kline) bool {
+				return k.Time.Unix() <= last.Time.Unix()
+			})
+			return err
+		})
+	}, this.Retry)
+	if err != nil {
+		return err
+	}
+	ks := protocol.Klines{}
+	for _, v := range resp.List {
+		if v.Time.Unix() >= last.Time.Unix() {
+			ks = append(ks, v)
+		}
+	}
+	return s.Replace(code, last.Time, time.Time{}, ks)
+}
 
+// getKlineDayUntil 指数和其他品种的日线是不同的接口
+func getKlineDayUntil(c *tdx.Client, code string, f func(k *protocol.Kline) bool) (*protocol.KlineResp, error) {
+	if TypeOf(code) == TypeIndex {
+		return c.GetIndexDayUntil(code, f)
+	}
+	return c.GetKlineDayUntil(code, f)
+}
+
+/*
+updateMinKlineAll 更新分钟线,只更新已经有分钟线的股票,例如导入过通达信.lc1文件的
+服务器只保留最近一段时间的1分钟线,间隔太久更新会有缺口
+*/
+func (this *Data) updateMinKlineAll(force bool) error {
+	updated, err := this.Updated.Updated(MinKline)
+	if err != nil {
+		return err
+	}
+	if updated && !force {
+		return nil
+	}
+	codes, err := minKlineCodes(this.DatabaseDir)
+	if err != nil {
+		return err
+	}
+	b := bar.NewCoroutine(len(codes), this.Goroutines)
+	defer b.Close()
+	for i := range codes {
+		code := codes[i]
+		b.Go(func() {
+			err := this.updateMinKline(code)
+			if err != nil {
+				b.Log("[ERR]", err)
+				b.Flush()
+			}
+		})
+	}
+	b.Wait()
+	return this.Updated.Update(MinKline)
+}
+
+func (this *Data) updateMinKline(code string) error {
+	last, err := lastMinKline(this.DatabaseDir, code)
+	if err != nil {
+		return err
+	}
+	var resp *protocol.KlineResp
+	err = g.Retry(func() error {
+		return this.Do(func(c *tdx.Client) error {
+			resp, err = getKlineMinuteUntil(c, code, func(k *protocol.Kline) bool {
+				return k.Time.Before(last)
+			})
+			return err
+		})
+	}, this.Retry)
+	if err != nil {
+		return err
+	}
+	return replaceMinKlines(this.DatabaseDir, code, last, resp.List)
+}
+
+// getKlineMinuteUntil 指数和其他品种的分钟线是不同的接口
+func getKlineMinuteUntil(c *tdx.Client, code string, f func(k *protocol.Kline) bool) (*protocol.KlineResp, error) {
+	if TypeOf(code) == TypeIndex {
+		return c.GetIndexUntil(protocol.TypeKlineMinute, code, f)
+	}
+	return c.GetKlineMinuteUntil(code, f)
+}
+
+// minKlineCodes 已经有分钟线的股票,按min-kline目录下的文件名<code>-<year>.db
+func minKlineCodes(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, MinKline))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	out := []string(nil)
+	seen := map[string]bool{}
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".db")
+		i := strings.LastIndex(name, "-")
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".db") || i <= 0 || seen[name[:i]] {
+			continue
+		}
+		seen[name[:i]] = true
+		out = append(out, name[:i])
+	}
+	return out, nil
+}
+
+// lastMinKline 最后一根分钟线的时间,从最近的年份文件往前找
+func lastMinKline(dir, code string) (time.Time, error) {
+	for year := time.Now().Year(); year >= 1990; year-- {
+		filename := filepath.Join(dir, MinKline, fmt.Sprintf("%s-%d.db", code, year))
+		if !oss.Exists(filename) {
+			continue
+		}
+		ks, err := readKlines(filename, code, time.Time{}, time.Now().AddDate(1, 0, 0))
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(ks) > 0 {
+			return ks[len(ks)-1].Time, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// replaceMinKlines 用ks替换from及之后的分钟线,更新时最后一根可能还没有走完
+func replaceMinKlines(dir, code string, from time.Time, ks protocol.Klines) error {
+	filename := filepath.Join(dir, MinKline, fmt.Sprintf("%s-%d.db", code, from.Year()))
+	if !from.IsZero() && oss.Exists(filename) {
+		db, err := sqlite.NewXorm(filename)
+		if err != nil {
+			return err
+		}
+		//按保存的文本格式比较,直接传时间会带时区,相等的比较不成立
+		_, err = db.Where("Time>=?", from.Format(time.DateTime)).Delete(new(protocol.Kline))
+		db.Close()
+		if err != nil {
+			return err
+		}
+	}
+	valid := protocol.Klines{}
+	for _, k := range ks {
+		if !k.Time.Before(from) {
+			valid = append(valid, k)
+		}
+	}
+	_, err := importKlines(dir, MinKline, code, valid)
+	return err
 }
 
 /*
@@ -135,9 +356,10 @@ func NewUpdated(filename string) (*Updated, error) {
 }
 
 type Updated struct {
-	db     *xorms.Engine
-	hour   int
-	minute int
+	db       *xorms.Engine
+	hour     int
+	minute   int
+	Calendar Calendar //设置后以最近一次收盘时间作为节点,非交易日不会重复更新
 }
 
 func (this *Updated) Update(key string) error {
@@ -159,6 +381,11 @@ func (this *Updated) Updated(key string) (bool, error) {
 			return false, nil
 		}
 	}
+	if this.Calendar != nil {
+		//最近一次收盘之后更新过,则不更新
+		node := this.Calendar.LastClose(time.Now())
+		return !time.Unix(update.Time, 0).Before(node), nil
+	}
 	{ //判断是否更新过,更新过则不更新
 		now := time.Now()
 		node := time.Date(now.Year(), now.Month(), now.Day(), this.hour, this.minute, 0, 0, time.Local)
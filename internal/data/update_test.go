@@ -0,0 +1,81 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+func TestOnUpdated(t *testing.T) {
+	afterUpdate, hasUpdated = nil, false
+	n := 0
+	OnUpdated(func() { n++ })
+	updated()
+	if n != 1 {
+		t.Fatalf("更新完成后执行了%d次,期望1次", n)
+	}
+
+	//更新完成后才注册的也会执行
+	late := make(chan struct{})
+	OnUpdated(func() { close(late) })
+	select {
+	case <-late:
+	case <-time.After(time.Second):
+		t.Fatal("更新完成后注册的函数没有执行")
+	}
+
+	//离线数据源启动时直接执行
+	afterUpdate, hasUpdated = nil, false
+	OnUpdated(func() { n++ })
+	NewCache(&countSource{}, 0).Start()
+	if n != 2 {
+		t.Fatalf("不支持更新的数据源启动后执行了%d次,期望1次", n-1)
+	}
+}
+
+func TestMinKlineSync(t *testing.T) {
+	dir := t.TempDir()
+	if codes, err := minKlineCodes(dir); err != nil || len(codes) != 0 {
+		t.Fatalf("没有分钟线目录时期望为空: %v %v", codes, err)
+	}
+	last, err := lastMinKline(dir, "sz000001")
+	if err != nil || !last.IsZero() {
+		t.Fatalf("没有分钟线时期望零值: %v %v", last, err)
+	}
+
+	t0 := time.Date(2023, 12, 29, 14, 59, 0, 0, time.Local)
+	bar := func(t time.Time, price float64) *protocol.Kline {
+		p := protocol.Yuan(price)
+		return &protocol.Kline{Time: t, Open: p, High: p, Low: p, Close: p, Volume: 1}
+	}
+	if _, err = importKlines(dir, MinKline, "sz000001", protocol.Klines{bar(t0.Add(-time.Minute), 10), bar(t0, 10)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = importKlines(dir, MinKline, "sh600000", protocol.Klines{bar(t0, 8)}); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := minKlineCodes(dir)
+	if err != nil || len(codes) != 2 {
+		t.Fatalf("有分钟线的股票有误: %v %v", codes, err)
+	}
+	if last, err = lastMinKline(dir, "sz000001"); err != nil || !last.Equal(t0) {
+		t.Fatalf("最后一根分钟线%v,期望%v", last, t0)
+	}
+
+	//最后一根被替换,新的数据跨年写到下一年的文件
+	t1 := time.Date(2024, 1, 2, 9, 31, 0, 0, time.Local)
+	if err = replaceMinKlines(dir, "sz000001", last, protocol.Klines{bar(t0.Add(-time.Minute), 99), bar(t0, 11), bar(t1, 12)}); err != nil {
+		t.Fatal(err)
+	}
+	ks, err := readMinKlines(dir, "sz000001", time.Time{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks) != 3 || ks[0].Close != protocol.Yuan(10) || ks[1].Close != protocol.Yuan(11) || !ks[2].Time.Equal(t1) {
+		t.Fatalf("更新后的分钟线有误: %v", ks)
+	}
+	if last, _ = lastMinKline(dir, "sz000001"); !last.Equal(t1) {
+		t.Fatalf("最后一根分钟线%v,期望%v", last, t1)
+	}
+}
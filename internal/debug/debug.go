@@ -0,0 +1,74 @@
+package debug
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MaxLogs 单次执行最多保留的日志条数
+const MaxLogs = 1000
+
+// Debug 脚本策略单次执行的调试输出,包含日志和按K线对齐的调试序列
+type Debug struct {
+	Logs   []string             `json:"logs"`
+	Series map[string][]float64 `json:"series"`
+	n      int
+	mu     sync.Mutex
+}
+
+// New 新建调试输出,n为K线数量
+func New(n int) *Debug {
+	return &Debug{
+		Logs:   []string{},
+		Series: map[string][]float64{},
+		n:      n,
+	}
+}
+
+// Log 记录一条日志
+func (this *Debug) Log(a ...any) {
+	this.log(fmt.Sprint(a...))
+}
+
+// Logf 按格式记录一条日志
+func (this *Debug) Logf(format string, a ...any) {
+	this.log(fmt.Sprintf(format, a...))
+}
+
+func (this *Debug) log(s string) {
+	if this == nil {
+		return
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if len(this.Logs) < MaxLogs {
+		this.Logs = append(this.Logs, s)
+	}
+}
+
+// Set 设置调试序列第i根K线的值,未设置的值为0,图表上不显示
+func (this *Debug) Set(name string, i int, v float64) {
+	if this == nil || i < 0 || i >= this.n {
+		return
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	ls, ok := this.Series[name]
+	if !ok {
+		ls = make([]float64, this.n)
+		this.Series[name] = ls
+	}
+	ls[i] = v
+}
+
+// Add 设置整条调试序列,长度和K线数量不一致时截断或补0
+func (this *Debug) Add(name string, vs []float64) {
+	if this == nil {
+		return
+	}
+	ls := make([]float64, this.n)
+	copy(ls, vs)
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.Series[name] = ls
+}
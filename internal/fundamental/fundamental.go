@@ -0,0 +1,146 @@
+package fundamental
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"xorm.io/xorm"
+)
+
+// Report 一期财报,按公告日期使用,避免用到当时还没公布的数据
+type Report struct {
+	ID        int64     `xorm:"pk autoincr" json:"id"`
+	Code      string    `xorm:"unique(code_period)" json:"code"`
+	Period    int       `xorm:"unique(code_period)" json:"period"` //报告期,例20231231
+	Announced int       `xorm:"index" json:"announced"`            //公告日期,例20240330,公告日之后的交易日才能使用
+	EPS       float64   `json:"eps"`                               //基本每股收益,元
+	BPS       float64   `json:"bps"`                               //每股净资产,元
+	ROE       float64   `json:"roe"`                               //净资产收益率,%
+	Revenue   float64   `json:"revenue"`                           //营业收入,元,年初至报告期累计
+	NetProfit float64   `json:"net_profit"`                        //归母净利润,元,年初至报告期累计
+	Assets    float64   `json:"assets"`                            //资产总计,元
+	Equity    float64   `json:"equity"`                            //股东权益,元
+	Total     float64   `json:"total"`                             //总股本,股
+	Float     float64   `json:"float"`                             //流通股本,股
+	Updated   time.Time `xorm:"updated" json:"updated"`
+}
+
+// Share 股本变迁,来自数据源的股本记录
+type Share struct {
+	ID    int64   `xorm:"pk autoincr" json:"id"`
+	Code  string  `xorm:"index" json:"code"`
+	Date  int     `xorm:"index" json:"date"` //变动日期,例20240102
+	Float float64 `json:"float"`             //流通股本,股
+	Total float64 `json:"total"`             //总股本,股
+}
+
+// Sync 同步基本面相关的数据表
+func Sync() error {
+	return common.DB.Sync2(new(Report), new(Share))
+}
+
+// Reports 股票的全部财报,按报告期升序
+func Reports(code string) ([]*Report, error) {
+	out := []*Report{}
+	err := common.DB.Where("Code=?", protocol.AddPrefix(code)).Asc("Period").Find(&out)
+	return out, err
+}
+
+// Save 按代码和报告期保存财报,已存在的覆盖
+func Save(ls []*Report) error {
+	return common.DB.SessionFunc(func(session *xorm.Session) error {
+		for _, v := range ls {
+			v.Code = protocol.AddPrefix(v.Code)
+			if v.Announced == 0 {
+				v.Announced = deadline(v.Period)
+			}
+			if _, err := session.Where("Code=? AND Period=?", v.Code, v.Period).Delete(new(Report)); err != nil {
+				return err
+			}
+			if _, err := session.Insert(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deadline 没有公告日期时,按披露截止日期计算,一季报4月30日,半年报8月31日,三季报10月31日,年报次年4月30日
+func deadline(period int) int {
+	year, md := period/10000, period%10000
+	switch {
+	case md <= 331:
+		return year*10000 + 430
+	case md <= 630:
+		return year*10000 + 831
+	case md <= 930:
+		return year*10000 + 1031
+	default:
+		return (year+1)*10000 + 430
+	}
+}
+
+// Shares 股票的股本变迁,按日期升序,数据库里没有时从数据源获取并保存
+func Shares(s data.Source, code string) ([]*Share, error) {
+	code = protocol.AddPrefix(code)
+	out := []*Share{}
+	if err := common.DB.Where("Code=?", code).Asc("Date").Find(&out); err != nil {
+		return nil, err
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	return SyncShares(s, code)
+}
+
+// SyncShares 从数据源获取股本变迁,替换数据库里的记录
+func SyncShares(s data.Source, code string) ([]*Share, error) {
+	code = protocol.AddPrefix(code)
+	eqs, err := s.GetEquities(code)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Share, 0, len(eqs))
+	for _, v := range eqs {
+		out = append(out, &Share{Code: code, Date: dateInt(v.Time), Float: v.Float, Total: v.Total})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	err = common.DB.SessionFunc(func(session *xorm.Session) error {
+		if _, err := session.Where("Code=?", code).Delete(new(Share)); err != nil {
+			return err
+		}
+		for _, v := range out {
+			if _, err := session.Insert(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// SyncSharesAll 同步全部股票的股本变迁,失败的股票跳过,返回成功数量
+func SyncSharesAll(ctx context.Context, s data.Source, progress func(done, total int)) (int, error) {
+	codes := s.GetStockCodes()
+	n := 0
+	for i, code := range codes {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		if _, err := SyncShares(s, code); err == nil {
+			n++
+		}
+		if progress != nil {
+			progress(i+1, len(codes))
+		}
+	}
+	return n, nil
+}
+
+func dateInt(t time.Time) int {
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
+}
@@ -0,0 +1,289 @@
+package fundamental
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/injoyai/conv/cfg"
+	"github.com/injoyai/tdx/protocol"
+)
+
+// ImportResult 导入结果
+type ImportResult struct {
+	File    string `json:"file"`
+	Period  int    `json:"period,omitempty"`
+	Reports int    `json:"reports"`
+}
+
+/*
+Import 按文件名导入财报,files为文件名对应的内容
+
+gpcw*.zip/gpcw*.dat: 通达信的专业财务数据,一个文件是一个报告期的全部股票
+.csv: 第一行是表头,列名见csvColumns,代码和报告期必填
+*/
+func Import(files map[string]io.Reader) ([]*ImportResult, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := []*ImportResult(nil)
+	for _, name := range names {
+		base := strings.ToLower(filepath.Base(name))
+		var ls []*Report
+		var err error
+		switch {
+		case strings.HasSuffix(base, ".zip"):
+			ls, err = DecodeZip(files[name])
+		case strings.HasSuffix(base, ".dat"):
+			ls, err = DecodeGpcw(files[name])
+		case strings.HasSuffix(base, ".csv"):
+			ls, err = DecodeCsv(files[name])
+		default:
+			return nil, fmt.Errorf("不支持的财务文件: %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if err = Save(ls); err != nil {
+			return nil, err
+		}
+		res := &ImportResult{File: name, Reports: len(ls)}
+		if len(ls) > 0 {
+			res.Period = ls[0].Period
+		}
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+// Download 从通达信下载一个报告期的财务数据并导入,地址可以通过fundamental.url配置
+func Download(period int) (*ImportResult, error) {
+	url := fmt.Sprintf(cfg.GetString("fundamental.url", "http://down.tdx.com.cn:8001/tdxfin/gpcw%d.zip"), period)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载财务数据失败: %s", resp.Status)
+	}
+	ls, err := DecodeZip(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err = Save(ls); err != nil {
+		return nil, err
+	}
+	return &ImportResult{File: filepath.Base(url), Period: period, Reports: len(ls)}, nil
+}
+
+// DecodeZip 解析通达信的gpcw*.zip,里面是同名的.dat
+func DecodeZip(r io.Reader) ([]*Report, error) {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(bs), int64(len(bs)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if !strings.HasSuffix(strings.ToLower(f.Name), ".dat") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return DecodeGpcw(rc)
+	}
+	return nil, errors.New("压缩包里没有.dat文件")
+}
+
+const (
+	gpcwHeader = 20 //文件头,保留2字节,报告期4字节,股票数量2字节,保留4字节,每条记录长度4字节,保留4字节
+	gpcwItem   = 11 //6位代码,保留1字节,记录偏移4字节
+)
+
+// gpcw里各字段的序号,从1开始,每个字段是4字节的float32
+const (
+	gpcwEPS       = 1
+	gpcwBPS       = 4
+	gpcwROE       = 6
+	gpcwAssets    = 40
+	gpcwEquity    = 72
+	gpcwRevenue   = 74
+	gpcwNetProfit = 96
+	gpcwTotal     = 238
+	gpcwFloat     = 239
+	gpcwAnnounced = 314 //公告日期,YYMMDD
+)
+
+// DecodeGpcw 解析通达信的gpcw*.dat
+func DecodeGpcw(r io.Reader) ([]*Report, error) {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) < gpcwHeader {
+		return nil, errors.New("财务文件长度错误")
+	}
+	period := int(binary.LittleEndian.Uint32(bs[2:]))
+	count := int(binary.LittleEndian.Uint16(bs[6:]))
+	size := int(binary.LittleEndian.Uint32(bs[12:]))
+	if len(bs) < gpcwHeader+count*gpcwItem {
+		return nil, errors.New("财务文件长度错误")
+	}
+	out := make([]*Report, 0, count)
+	for i := 0; i < count; i++ {
+		item := bs[gpcwHeader+i*gpcwItem:]
+		code := protocol.AddPrefix(string(item[:6]))
+		offset := int(binary.LittleEndian.Uint32(item[7:]))
+		if offset+size > len(bs) || len(code) != 8 {
+			continue
+		}
+		values := bs[offset : offset+size]
+		field := func(n int) float64 {
+			if n*4 > len(values) {
+				return 0
+			}
+			f := float64(math.Float32frombits(binary.LittleEndian.Uint32(values[(n-1)*4:])))
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				return 0
+			}
+			return f
+		}
+		announced := int(field(gpcwAnnounced))
+		if announced > 0 && announced < 1000000 {
+			announced += 20000000
+		}
+		out = append(out, &Report{
+			Code:      code,
+			Period:    period,
+			Announced: announced,
+			EPS:       field(gpcwEPS),
+			BPS:       field(gpcwBPS),
+			ROE:       field(gpcwROE),
+			Revenue:   field(gpcwRevenue),
+			NetProfit: field(gpcwNetProfit),
+			Assets:    field(gpcwAssets),
+			Equity:    field(gpcwEquity),
+			Total:     field(gpcwTotal),
+			Float:     field(gpcwFloat),
+		})
+	}
+	return out, nil
+}
+
+// csvColumns csv的列名和别名
+var csvColumns = map[string][]string{
+	"code":       {"code", "代码", "股票代码"},
+	"period":     {"period", "报告期"},
+	"announced":  {"announced", "公告日期"},
+	"eps":        {"eps", "每股收益"},
+	"bps":        {"bps", "每股净资产"},
+	"roe":        {"roe", "净资产收益率"},
+	"revenue":    {"revenue", "营业收入"},
+	"net_profit": {"net_profit", "净利润"},
+	"assets":     {"assets", "总资产"},
+	"equity":     {"equity", "净资产"},
+	"total":      {"total", "总股本"},
+	"float":      {"float", "流通股本"},
+}
+
+// DecodeCsv 解析csv,日期支持20240330和2024-03-30
+func DecodeCsv(r io.Reader) ([]*Report, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	index := map[string]int{}
+	for i, name := range rows[0] {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for key, alias := range csvColumns {
+			for _, a := range alias {
+				if name == a {
+					index[key] = i
+				}
+			}
+		}
+	}
+	if _, ok := index["code"]; !ok {
+		return nil, errors.New("缺少代码列")
+	}
+	if _, ok := index["period"]; !ok {
+		return nil, errors.New("缺少报告期列")
+	}
+
+	out := []*Report(nil)
+	for n, row := range rows[1:] {
+		get := func(key string) string {
+			if i, ok := index[key]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		num := func(key string) float64 {
+			f, _ := strconv.ParseFloat(get(key), 64)
+			return f
+		}
+		code := strings.ToLower(get("code"))
+		if code == "" {
+			continue
+		}
+		period, err := parseDate(get("period"))
+		if err != nil || period == 0 {
+			return nil, fmt.Errorf("第%d行报告期错误: %s", n+2, get("period"))
+		}
+		announced, err := parseDate(get("announced"))
+		if err != nil {
+			return nil, fmt.Errorf("第%d行公告日期错误: %s", n+2, get("announced"))
+		}
+		out = append(out, &Report{
+			Code:      protocol.AddPrefix(code),
+			Period:    period,
+			Announced: announced,
+			EPS:       num("eps"),
+			BPS:       num("bps"),
+			ROE:       num("roe"),
+			Revenue:   num("revenue"),
+			NetProfit: num("net_profit"),
+			Assets:    num("assets"),
+			Equity:    num("equity"),
+			Total:     num("total"),
+			Float:     num("float"),
+		})
+	}
+	return out, nil
+}
+
+// parseDate 解析20240330或2024-03-30,空字符串返回0
+func parseDate(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(strings.NewReplacer("-", "", "/", "").Replace(s))
+	if err != nil || n < 19000101 || n > 99991231 {
+		return 0, fmt.Errorf("日期格式错误: %s", s)
+	}
+	return n, nil
+}
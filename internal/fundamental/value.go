@@ -0,0 +1,157 @@
+package fundamental
+
+import (
+	"sort"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/data"
+)
+
+// Value 一个交易日的市值和估值,用当天之前已经公告的财报计算,没有数据的字段为0
+type Value struct {
+	Code      string  `json:"code"`
+	Date      int     `json:"date"`
+	Close     float64 `json:"close"`     //不复权收盘价
+	Cap       float64 `json:"cap"`       //总市值,元
+	FloatCap  float64 `json:"float_cap"` //流通市值,元
+	PE        float64 `json:"pe"`        //市盈率TTM,亏损时为0
+	PB        float64 `json:"pb"`        //市净率
+	PS        float64 `json:"ps"`        //市销率TTM
+	ROE       float64 `json:"roe"`       //最新一期的净资产收益率,%
+	EPS       float64 `json:"eps"`       //最新一期的每股收益
+	Period    int     `json:"period"`    //使用的报告期
+	Announced int     `json:"announced"` //使用的报告的公告日期
+}
+
+// 序列的名称,策略和选股按名称读取
+const (
+	KeyPE       = "pe"
+	KeyPB       = "pb"
+	KeyPS       = "ps"
+	KeyROE      = "roe"
+	KeyEPS      = "eps"
+	KeyCap      = "cap"
+	KeyFloatCap = "float_cap"
+)
+
+// Keys 全部序列的名称
+var Keys = []string{KeyPE, KeyPB, KeyPS, KeyROE, KeyEPS, KeyCap, KeyFloatCap}
+
+/*
+Values 按K线计算每天的市值和估值,ks需要是不复权的日线
+
+财报在公告日的下一个交易日才能使用,避免用到未来数据
+TTM = 最新一期累计值 + 上一年年报 - 上一年同期累计值,缺少上一年数据时按最新一期年化
+股本优先用数据源的股本变迁,没有时用财报里的股本
+*/
+func Values(s data.Source, code string, ks protocol.Klines) ([]*Value, error) {
+	code = protocol.AddPrefix(code)
+	reports, err := Reports(code)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := Shares(s, code)
+	if err != nil {
+		//股本只是补充数据,获取失败时用财报里的股本
+		shares = nil
+	}
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].Announced < reports[j].Announced })
+
+	out := make([]*Value, 0, len(ks))
+	known := map[int]*Report{}
+	var latest *Report
+	ri, si := 0, 0
+	var share *Share
+	for _, k := range ks {
+		date := dateInt(k.Time)
+		for ; ri < len(reports) && reports[ri].Announced < date; ri++ {
+			r := reports[ri]
+			known[r.Period] = r
+			if latest == nil || r.Period >= latest.Period {
+				latest = r
+			}
+		}
+		for ; si < len(shares) && shares[si].Date <= date; si++ {
+			share = shares[si]
+		}
+
+		v := &Value{Code: code, Date: date, Close: k.Close.Float64()}
+		total, float := 0., 0.
+		if share != nil {
+			total, float = share.Total, share.Float
+		}
+		if latest != nil {
+			v.Period, v.Announced, v.ROE, v.EPS = latest.Period, latest.Announced, latest.ROE, latest.EPS
+			if total <= 0 {
+				total = latest.Total
+			}
+			if float <= 0 {
+				float = latest.Float
+			}
+		}
+		if float <= 0 {
+			float = total
+		}
+		v.Cap, v.FloatCap = v.Close*total, v.Close*float
+		if latest != nil && v.Cap > 0 {
+			if profit := ttm(known, latest, func(r *Report) float64 { return r.NetProfit }); profit > 0 {
+				v.PE = v.Cap / profit
+			}
+			if revenue := ttm(known, latest, func(r *Report) float64 { return r.Revenue }); revenue > 0 {
+				v.PS = v.Cap / revenue
+			}
+			if latest.Equity > 0 {
+				v.PB = v.Cap / latest.Equity
+			} else if latest.BPS > 0 {
+				v.PB = v.Close / latest.BPS
+			}
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// ttm 滚动12个月的累计值
+func ttm(known map[int]*Report, r *Report, f func(r *Report) float64) float64 {
+	year, md := r.Period/10000, r.Period%10000
+	if md == 1231 {
+		return f(r)
+	}
+	annual, last := known[(year-1)*10000+1231], known[(year-1)*10000+md]
+	if annual != nil && last != nil {
+		return f(r) + f(annual) - f(last)
+	}
+	months := float64(md / 100)
+	if months <= 0 {
+		return 0
+	}
+	return f(r) * 12 / months
+}
+
+// Series 按K线生成基本面序列,key见Keys,和K线一一对应
+func Series(s data.Source, code string, ks protocol.Klines) (map[string][]float64, error) {
+	values, err := Values(s, code, ks)
+	if err != nil {
+		return nil, err
+	}
+	out := Empty(len(ks))
+	for i, v := range values {
+		out[KeyPE][i] = v.PE
+		out[KeyPB][i] = v.PB
+		out[KeyPS][i] = v.PS
+		out[KeyROE][i] = v.ROE
+		out[KeyEPS][i] = v.EPS
+		out[KeyCap][i] = v.Cap
+		out[KeyFloatCap][i] = v.FloatCap
+	}
+	return out, nil
+}
+
+// Empty 全为0的序列,没有基本面数据时使用
+func Empty(n int) map[string][]float64 {
+	out := make(map[string][]float64, len(Keys))
+	for _, k := range Keys {
+		out[k] = make([]float64, n)
+	}
+	return out
+}
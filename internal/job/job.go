@@ -0,0 +1,301 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/injoyai/logs"
+	"github.com/injoyai/trategy/internal/common"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusRunning  = "running"
+	StatusDone     = "done"
+	StatusFailed   = "failed"
+	StatusCanceled = "canceled"
+)
+
+// Job 异步任务,请求和结果以json保存
+type Job struct {
+	ID       int64     `xorm:"pk autoincr" json:"id"`
+	Type     string    `xorm:"index" json:"type"`
+	Status   string    `xorm:"index" json:"status"`
+	Progress float64   `json:"progress"` //进度0~1
+	Request  string    `json:"request"`
+	Result   string    `json:"-"`
+	Error    string    `json:"error"`
+	Created  time.Time `xorm:"created" json:"created"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// IsFinished 是否已经结束
+func (this *Job) IsFinished() bool {
+	return this.Status == StatusDone || this.Status == StatusFailed || this.Status == StatusCanceled
+}
+
+// Handler 任务处理函数,ctx取消时应尽快返回,progress上报0~1的进度
+type Handler func(ctx context.Context, req []byte, progress func(float64)) (any, error)
+
+var (
+	handlers = map[string]Handler{}
+
+	running   = map[int64]*task{}
+	runningMu sync.Mutex
+
+	claimMu sync.Mutex
+	notify  = make(chan struct{}, 1)
+)
+
+type task struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	progress float64
+	saved    time.Time
+}
+
+// Register 注册任务类型
+func Register(typ string, h Handler) {
+	handlers[typ] = h
+}
+
+// Start 同步数据表并启动workers个工作协程
+// 上次退出时未完成的任务会重新排队
+func Start(workers int) error {
+	if workers <= 0 {
+		workers = 1
+	}
+	if err := common.DB.Sync2(new(Job)); err != nil {
+		return err
+	}
+	if err := requeue(); err != nil {
+		return err
+	}
+	for i := 0; i < workers; i++ {
+		go work(nil)
+	}
+	wake()
+	return nil
+}
+
+// requeue 上次退出时运行中的任务重新排队
+func requeue() error {
+	_, err := common.DB.Where("Status=?", StatusRunning).Cols("Status,Progress").Update(&Job{Status: StatusPending})
+	return err
+}
+
+// Submit 提交任务,返回排队中的任务
+func Submit(typ string, req any) (*Job, error) {
+	if _, ok := handlers[typ]; !ok {
+		return nil, fmt.Errorf("未知的任务类型: %s", typ)
+	}
+	bs, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	j := &Job{
+		Type:    typ,
+		Status:  StatusPending,
+		Request: string(bs),
+	}
+	if _, err = common.DB.Insert(j); err != nil {
+		return nil, err
+	}
+	wake()
+	return j, nil
+}
+
+// Get 获取任务,运行中的任务返回实时进度
+func Get(id int64) (*Job, error) {
+	j := new(Job)
+	has, err := common.DB.ID(id).Get(j)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, fmt.Errorf("任务[%d]不存在", id)
+	}
+	runningMu.Lock()
+	if t, ok := running[id]; ok {
+		j.Progress = t.progress
+	}
+	runningMu.Unlock()
+	return j, nil
+}
+
+// List 按创建时间倒序获取任务,typ和status为空时不过滤
+func List(typ, status string, limit int) ([]*Job, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	session := common.DB.Desc("ID").Limit(limit).Omit("Result")
+	if typ != "" {
+		session.And("Type=?", typ)
+	}
+	if status != "" {
+		session.And("Status=?", status)
+	}
+	data := []*Job(nil)
+	err := session.Find(&data)
+	return data, err
+}
+
+// Result 获取已完成任务的结果json
+func Result(id int64) (json.RawMessage, error) {
+	j, err := Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if j.Status != StatusDone {
+		return nil, fmt.Errorf("任务[%d]未完成,状态: %s", id, j.Status)
+	}
+	return json.RawMessage(j.Result), nil
+}
+
+// Cancel 取消排队中或运行中的任务
+func Cancel(id int64) error {
+	claimMu.Lock()
+	n, err := common.DB.Where("ID=? and Status=?", id, StatusPending).Cols("Status,Finished").Update(&Job{
+		Status:   StatusCanceled,
+		Finished: time.Now(),
+	})
+	claimMu.Unlock()
+	if err != nil || n > 0 {
+		return err
+	}
+	runningMu.Lock()
+	t, ok := running[id]
+	runningMu.Unlock()
+	if !ok {
+		return errors.New("任务已结束或不存在")
+	}
+	t.cancel()
+	return nil
+}
+
+func wake() {
+	select {
+	case notify <- struct{}{}:
+	default:
+	}
+}
+
+// work 循环领取并执行任务,stop关闭时退出
+func work(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		j, t, err := claim()
+		if err != nil {
+			logs.Err(err)
+		}
+		if j == nil {
+			select {
+			case <-stop:
+				return
+			case <-notify:
+			case <-time.After(time.Second * 5):
+			}
+			continue
+		}
+		//可能还有排队的任务,唤醒其他协程
+		wake()
+		run(j, t)
+	}
+}
+
+// claim 领取一个排队中的任务
+// 在claimMu内登记到running,Cancel要么取消排队中的任务,要么能找到运行中的任务
+func claim() (*Job, *task, error) {
+	claimMu.Lock()
+	defer claimMu.Unlock()
+	j := new(Job)
+	has, err := common.DB.Where("Status=?", StatusPending).Asc("ID").Get(j)
+	if err != nil || !has {
+		return nil, nil, err
+	}
+	j.Status = StatusRunning
+	j.Started = time.Now()
+	_, err = common.DB.ID(j.ID).Cols("Status,Started").Update(j)
+	if err != nil {
+		return nil, nil, err
+	}
+	t := new(task)
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	runningMu.Lock()
+	running[j.ID] = t
+	runningMu.Unlock()
+	return j, t, nil
+}
+
+func run(j *Job, t *task) {
+	ctx := t.ctx
+	defer t.cancel()
+	defer func() {
+		runningMu.Lock()
+		delete(running, j.ID)
+		runningMu.Unlock()
+	}()
+
+	progress := func(p float64) {
+		runningMu.Lock()
+		t.progress = p
+		save := time.Since(t.saved) > time.Second
+		if save {
+			t.saved = time.Now()
+		}
+		runningMu.Unlock()
+		//每秒最多保存一次进度
+		if save {
+			_, _ = common.DB.ID(j.ID).Cols("Progress").Update(&Job{Progress: p})
+		}
+	}
+
+	//领取后、执行前已经被取消的任务不再执行
+	var res any
+	var err error
+	if ctx.Err() == nil {
+		res, err = handle(ctx, j, progress)
+	}
+	j.Finished = time.Now()
+	switch {
+	case ctx.Err() != nil:
+		j.Status = StatusCanceled
+	case err != nil:
+		j.Status = StatusFailed
+		j.Error = err.Error()
+	default:
+		j.Status = StatusDone
+		j.Progress = 1
+		bs, err := json.Marshal(res)
+		if err != nil {
+			j.Status = StatusFailed
+			j.Error = err.Error()
+		}
+		j.Result = string(bs)
+	}
+	if _, err := common.DB.ID(j.ID).Cols("Status,Progress,Result,Error,Finished").Update(j); err != nil {
+		logs.Err(err)
+	}
+}
+
+func handle(ctx context.Context, j *Job, progress func(float64)) (res any, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("任务执行异常: %v", e)
+		}
+	}()
+	h, ok := handlers[j.Type]
+	if !ok {
+		return nil, fmt.Errorf("未知的任务类型: %s", j.Type)
+	}
+	return h(ctx, []byte(j.Request), progress)
+}
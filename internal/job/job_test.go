@@ -0,0 +1,224 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/injoyai/goutil/database/sqlite"
+	"github.com/injoyai/trategy/internal/common"
+)
+
+func testDB(t *testing.T) {
+	t.Helper()
+	db, err := sqlite.NewXorm(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err = db.Sync2(new(Job)); err != nil {
+		t.Fatal(err)
+	}
+	common.DB = db
+}
+
+func init() {
+	Register("_test_echo", func(ctx context.Context, req []byte, progress func(float64)) (any, error) {
+		progress(0.5)
+		return json.RawMessage(req), nil
+	})
+	Register("_test_fail", func(ctx context.Context, req []byte, progress func(float64)) (any, error) {
+		return nil, errors.New("失败")
+	})
+	Register("_test_panic", func(ctx context.Context, req []byte, progress func(float64)) (any, error) {
+		panic("异常")
+	})
+	Register("_test_block", func(ctx context.Context, req []byte, progress func(float64)) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+}
+
+func mustGet(t *testing.T, id int64) *Job {
+	t.Helper()
+	j, err := Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+// runNext 领取并执行下一个任务,不启动工作协程
+func runNext(t *testing.T) *Job {
+	t.Helper()
+	j, task, err := claim()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil {
+		run(j, task)
+	}
+	return j
+}
+
+func TestQueue(t *testing.T) {
+	testDB(t)
+	if _, err := Submit("_test_unknown", nil); err == nil {
+		t.Fatal("未知的任务类型应该返回错误")
+	}
+	a, err := Submit("_test_echo", map[string]int{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := Submit("_test_fail", nil)
+	c, _ := Submit("_test_panic", nil)
+	if j := mustGet(t, a.ID); j.Status != StatusPending {
+		t.Fatalf("提交后状态%s,期望%s", j.Status, StatusPending)
+	}
+	if _, err = Result(a.ID); err == nil {
+		t.Fatal("未完成的任务不应该有结果")
+	}
+
+	//按提交顺序执行
+	for _, want := range []*Job{a, b, c} {
+		if j := runNext(t); j == nil || j.ID != want.ID {
+			t.Fatalf("执行的任务%v,期望%d", j, want.ID)
+		}
+	}
+	if j := runNext(t); j != nil {
+		t.Fatalf("队列应该为空,得到任务%d", j.ID)
+	}
+
+	if j := mustGet(t, a.ID); j.Status != StatusDone || j.Progress != 1 || j.Started.IsZero() || j.Finished.IsZero() {
+		t.Fatalf("任务状态有误: %+v", j)
+	}
+	res, err := Result(a.ID)
+	if err != nil || string(res) != `{"n":1}` {
+		t.Fatalf("任务结果%s,%v", res, err)
+	}
+	if j := mustGet(t, b.ID); j.Status != StatusFailed || j.Error != "失败" {
+		t.Fatalf("失败的任务状态有误: %+v", j)
+	}
+	if j := mustGet(t, c.ID); j.Status != StatusFailed || j.Error == "" {
+		t.Fatalf("异常的任务状态有误: %+v", j)
+	}
+
+	ls, err := List("_test_echo", StatusDone, 0)
+	if err != nil || len(ls) != 1 || ls[0].ID != a.ID || ls[0].Result != "" {
+		t.Fatalf("任务列表有误: %v, %v", ls, err)
+	}
+}
+
+func TestCancelPending(t *testing.T) {
+	testDB(t)
+	j, _ := Submit("_test_echo", nil)
+	if err := Cancel(j.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, j.ID); got.Status != StatusCanceled {
+		t.Fatalf("取消后状态%s", got.Status)
+	}
+	if got := runNext(t); got != nil {
+		t.Fatal("取消的任务不应该被领取")
+	}
+	if err := Cancel(j.ID); err == nil {
+		t.Fatal("已结束的任务不能取消")
+	}
+}
+
+func TestCancelClaimed(t *testing.T) {
+	testDB(t)
+	called := false
+	Register("_test_called", func(ctx context.Context, req []byte, progress func(float64)) (any, error) {
+		called = true
+		return nil, nil
+	})
+	j, _ := Submit("_test_called", nil)
+
+	//领取之后、执行之前取消
+	claimed, task, err := claim()
+	if err != nil || claimed == nil {
+		t.Fatal(err)
+	}
+	if err = Cancel(j.ID); err != nil {
+		t.Fatalf("领取后取消失败: %v", err)
+	}
+	run(claimed, task)
+	if called {
+		t.Fatal("已取消的任务不应该执行")
+	}
+	if got := mustGet(t, j.ID); got.Status != StatusCanceled {
+		t.Fatalf("取消后状态%s", got.Status)
+	}
+}
+
+func TestCancelRunning(t *testing.T) {
+	testDB(t)
+	j, _ := Submit("_test_block", nil)
+	claimed, task, _ := claim()
+	done := make(chan struct{})
+	go func() {
+		run(claimed, task)
+		close(done)
+	}()
+	if got := mustGet(t, j.ID); got.Status != StatusRunning {
+		t.Fatalf("运行中的状态%s", got.Status)
+	}
+	if err := Cancel(j.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("取消后任务没有结束")
+	}
+	if got := mustGet(t, j.ID); got.Status != StatusCanceled {
+		t.Fatalf("取消后状态%s", got.Status)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	testDB(t)
+	//模拟上次退出时运行中的任务
+	interrupted := &Job{Type: "_test_echo", Status: StatusRunning, Progress: 0.3, Request: `1`}
+	if _, err := common.DB.Insert(interrupted); err != nil {
+		t.Fatal(err)
+	}
+	//重启时重新排队,再由工作协程执行
+	if err := requeue(); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, interrupted.ID); got.Status != StatusPending {
+		t.Fatalf("重启后状态%s,期望%s", got.Status, StatusPending)
+	}
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	for i := 0; i < 2; i++ {
+		go work(stop)
+	}
+	wake()
+	j, err := Submit("_test_echo", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait := func(id int64) *Job {
+		for deadline := time.Now().Add(time.Second * 10); time.Now().Before(deadline); time.Sleep(time.Millisecond * 20) {
+			if got := mustGet(t, id); got.IsFinished() {
+				return got
+			}
+		}
+		t.Fatalf("任务[%d]没有完成", id)
+		return nil
+	}
+	for id, want := range map[int64]string{interrupted.ID: "1", j.ID: "2"} {
+		if got := wait(id); got.Status != StatusDone {
+			t.Fatalf("任务[%d]状态%s", id, got.Status)
+		}
+		if res, _ := Result(id); string(res) != want {
+			t.Fatalf("任务[%d]结果%s,期望%s", id, res, want)
+		}
+	}
+}
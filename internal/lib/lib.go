@@ -70,3 +70,5 @@ var Symbols = interp.Exports{}
 
 //go:generate yaegi extract github.com/injoyai/logs
 //go:generate yaegi extract github.com/injoyai/bar
+
+//go:generate yaegi extract github.com/injoyai/trategy/internal/debug
@@ -0,0 +1,842 @@
+package screener
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/fundamental"
+)
+
+/*
+Expr 选股条件表达式,按K线逐根计算,取最后一根的结果
+
+变量: open,high,low,close,volume(手),amount(元),以及基本面pe,pb,ps,roe,eps,cap,float_cap
+函数: ma,ema,ref,hhv,llv,sum,std,roc,rsi,count,cross,abs,max,min
+运算: + - * / > >= < <= == != and or not(也可以写成&& || !)
+例: close > ma(close,60) and rsi(14) < 30 and amount > 1e8
+
+最外层用and连接的每一项是一个条件,结果里会返回每个条件是否满足
+*/
+type Expr struct {
+	src        string
+	root       node
+	conditions []node
+}
+
+// Condition 一个条件的计算结果
+type Condition struct {
+	Expr  string  `json:"expr"`
+	Pass  bool    `json:"pass"`
+	Value float64 `json:"value"` //条件两边都是数值时为左边的值,方便查看差多少
+}
+
+// ParseError 表达式解析错误,Pos为出错的位置,从0开始
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (this *ParseError) Error() string {
+	return fmt.Sprintf("表达式第%d个字符: %s", this.Pos+1, this.Msg)
+}
+
+// variables 表达式可以使用的变量,和基本面数据的key一致
+var variables = map[string]bool{
+	"open": true, "high": true, "low": true, "close": true, "volume": true, "amount": true,
+}
+
+func init() {
+	for _, k := range fundamental.Keys {
+		variables[k] = true
+	}
+}
+
+// function 函数的参数个数,periods为需要是正整数常量的参数位置
+type function struct {
+	args    []int
+	periods []int
+}
+
+var functions = map[string]function{
+	"ma":    {args: []int{2}, periods: []int{1}},
+	"ema":   {args: []int{2}, periods: []int{1}},
+	"ref":   {args: []int{2}, periods: []int{1}},
+	"hhv":   {args: []int{2}, periods: []int{1}},
+	"llv":   {args: []int{2}, periods: []int{1}},
+	"sum":   {args: []int{2}, periods: []int{1}},
+	"std":   {args: []int{2}, periods: []int{1}},
+	"roc":   {args: []int{2}, periods: []int{1}},
+	"count": {args: []int{2}, periods: []int{1}},
+	"rsi":   {args: []int{1, 2}, periods: []int{-1}}, //rsi(n)或rsi(x,n),最后一个参数是周期
+	"cross": {args: []int{2}},
+	"abs":   {args: []int{1}},
+	"max":   {args: []int{2}},
+	"min":   {args: []int{2}},
+}
+
+// ParseExpr 解析表达式
+func ParseExpr(src string) (*Expr, error) {
+	p := &parser{src: src}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return nil, &ParseError{Pos: 0, Msg: "表达式为空"}
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("多余的'%s'", t.text)}
+	}
+	e := &Expr{src: src, root: root}
+	e.conditions = splitAnd(root)
+	return e, nil
+}
+
+func (this *Expr) String() string {
+	return this.src
+}
+
+// Uses 表达式是否用到了这些变量
+func (this *Expr) Uses(names ...string) bool {
+	for _, name := range names {
+		if uses(this.root, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Window 计算最后一根需要的K线数量
+func (this *Expr) Window() int {
+	return window(this.root) + 1
+}
+
+// Eval 计算最后一根K线是否满足表达式和每个条件的结果,f为基本面序列,可以为nil
+func (this *Expr) Eval(ks protocol.Klines, f map[string][]float64) (bool, []Condition) {
+	env := newEnv(ks, f)
+	if env.n == 0 {
+		return false, nil
+	}
+	last := env.n - 1
+	out := make([]Condition, len(this.conditions))
+	for i, c := range this.conditions {
+		out[i] = Condition{Expr: c.text(), Pass: truth(c.eval(env)[last])}
+		if b, ok := c.(*binary); ok && isCompare(b.op) {
+			if v := b.left.eval(env)[last]; !math.IsNaN(v) && !math.IsInf(v, 0) {
+				out[i].Value = v
+			}
+		}
+	}
+	return truth(this.root.eval(env)[last]), out
+}
+
+// Value 最后一根K线的计算结果,比较运算的结果为1或0,数据不足时为NaN
+func (this *Expr) Value(ks protocol.Klines, f map[string][]float64) float64 {
+	env := newEnv(ks, f)
+	if env.n == 0 {
+		return math.NaN()
+	}
+	return this.root.eval(env)[env.n-1]
+}
+
+type env struct {
+	n      int
+	series map[string][]float64
+	cache  map[string][]float64
+}
+
+func newEnv(ks protocol.Klines, f map[string][]float64) *env {
+	n := len(ks)
+	e := &env{n: n, series: map[string][]float64{}, cache: map[string][]float64{}}
+	open, high, low, close := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+	volume, amount := make([]float64, n), make([]float64, n)
+	for i, k := range ks {
+		open[i], high[i], low[i], close[i] = k.Open.Float64(), k.High.Float64(), k.Low.Float64(), k.Close.Float64()
+		volume[i], amount[i] = float64(k.Volume), k.Amount.Float64()
+	}
+	e.series["open"], e.series["high"], e.series["low"], e.series["close"] = open, high, low, close
+	e.series["volume"], e.series["amount"] = volume, amount
+	for _, k := range fundamental.Keys {
+		if v, ok := f[k]; ok && len(v) == n {
+			//没有基本面数据的值为0,按没有数据处理
+			s := make([]float64, n)
+			for i := range v {
+				s[i] = v[i]
+				if v[i] == 0 {
+					s[i] = math.NaN()
+				}
+			}
+			e.series[k] = s
+		} else {
+			e.series[k] = constant(n, math.NaN())
+		}
+	}
+	return e
+}
+
+func constant(n int, v float64) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = v
+	}
+	return out
+}
+
+func truth(v float64) bool {
+	return !math.IsNaN(v) && v != 0
+}
+
+func boolean(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type node interface {
+	eval(e *env) []float64
+	text() string
+}
+
+type number struct {
+	value float64
+	src   string
+}
+
+func (this *number) eval(e *env) []float64 { return constant(e.n, this.value) }
+func (this *number) text() string          { return this.src }
+
+type variable struct {
+	name string
+}
+
+func (this *variable) eval(e *env) []float64 { return e.series[this.name] }
+func (this *variable) text() string          { return this.name }
+
+type unary struct {
+	op  string
+	arg node
+	src string
+}
+
+func (this *unary) text() string { return this.src }
+
+func (this *unary) eval(e *env) []float64 {
+	x := this.arg.eval(e)
+	out := make([]float64, e.n)
+	for i, v := range x {
+		if this.op == "-" {
+			out[i] = -v
+		} else {
+			out[i] = boolean(!truth(v))
+		}
+	}
+	return out
+}
+
+type binary struct {
+	op          string
+	left, right node
+	src         string
+}
+
+func (this *binary) text() string { return this.src }
+
+func isCompare(op string) bool {
+	switch op {
+	case ">", ">=", "<", "<=", "==", "!=":
+		return true
+	}
+	return false
+}
+
+func (this *binary) eval(e *env) []float64 {
+	a, b := this.left.eval(e), this.right.eval(e)
+	out := make([]float64, e.n)
+	for i := range out {
+		x, y := a[i], b[i]
+		switch this.op {
+		case "and":
+			out[i] = boolean(truth(x) && truth(y))
+		case "or":
+			out[i] = boolean(truth(x) || truth(y))
+		case "+":
+			out[i] = x + y
+		case "-":
+			out[i] = x - y
+		case "*":
+			out[i] = x * y
+		case "/":
+			if y == 0 {
+				out[i] = math.NaN()
+			} else {
+				out[i] = x / y
+			}
+		default:
+			//没有数据时比较结果为假
+			if math.IsNaN(x) || math.IsNaN(y) {
+				continue
+			}
+			switch this.op {
+			case ">":
+				out[i] = boolean(x > y)
+			case ">=":
+				out[i] = boolean(x >= y)
+			case "<":
+				out[i] = boolean(x < y)
+			case "<=":
+				out[i] = boolean(x <= y)
+			case "==":
+				out[i] = boolean(x == y)
+			case "!=":
+				out[i] = boolean(x != y)
+			}
+		}
+	}
+	return out
+}
+
+type call struct {
+	name   string
+	args   []node
+	period int
+	src    string
+}
+
+func (this *call) text() string { return this.src }
+
+func (this *call) eval(e *env) []float64 {
+	if v, ok := e.cache[this.src]; ok {
+		return v
+	}
+	var out []float64
+	n := this.period
+	switch this.name {
+	case "ma":
+		out = rolling(this.args[0].eval(e), n, func(w []float64) float64 { return sum(w) / float64(n) })
+	case "sum":
+		out = rolling(this.args[0].eval(e), n, sum)
+	case "hhv":
+		out = rolling(this.args[0].eval(e), n, func(w []float64) float64 { return extreme(w, math.Max) })
+	case "llv":
+		out = rolling(this.args[0].eval(e), n, func(w []float64) float64 { return extreme(w, math.Min) })
+	case "std":
+		out = rolling(this.args[0].eval(e), n, stddev)
+	case "count":
+		out = rolling(this.args[0].eval(e), n, func(w []float64) float64 {
+			c := 0.
+			for _, v := range w {
+				c += boolean(truth(v))
+			}
+			return c
+		})
+	case "ref":
+		x := this.args[0].eval(e)
+		out = constant(e.n, math.NaN())
+		for i := n; i < e.n; i++ {
+			out[i] = x[i-n]
+		}
+	case "roc":
+		x := this.args[0].eval(e)
+		out = constant(e.n, math.NaN())
+		for i := n; i < e.n; i++ {
+			if x[i-n] != 0 {
+				out[i] = x[i]/x[i-n] - 1
+			}
+		}
+	case "ema":
+		x := this.args[0].eval(e)
+		out = constant(e.n, math.NaN())
+		alpha, prev := 2/float64(n+1), math.NaN()
+		for i, v := range x {
+			switch {
+			case math.IsNaN(v):
+				continue
+			case math.IsNaN(prev):
+				prev = v
+			default:
+				prev = alpha*v + (1-alpha)*prev
+			}
+			out[i] = prev
+		}
+	case "rsi":
+		//周期在解析时已经去掉,只剩序列参数
+		x := e.series["close"]
+		if len(this.args) == 1 {
+			x = this.args[0].eval(e)
+		}
+		out = rsi(x, n)
+	case "cross":
+		a, b := this.args[0].eval(e), this.args[1].eval(e)
+		out = make([]float64, e.n)
+		for i := 1; i < e.n; i++ {
+			out[i] = boolean(a[i-1] <= b[i-1] && a[i] > b[i])
+		}
+	case "abs":
+		x := this.args[0].eval(e)
+		out = make([]float64, e.n)
+		for i, v := range x {
+			out[i] = math.Abs(v)
+		}
+	case "max", "min":
+		a, b := this.args[0].eval(e), this.args[1].eval(e)
+		f := map[string]func(x, y float64) float64{"max": math.Max, "min": math.Min}[this.name]
+		out = make([]float64, e.n)
+		for i := range out {
+			out[i] = f(a[i], b[i])
+		}
+	}
+	e.cache[this.src] = out
+	return out
+}
+
+// rolling 滑动窗口计算,不足n根时为NaN
+func rolling(x []float64, n int, f func(w []float64) float64) []float64 {
+	out := constant(len(x), math.NaN())
+	for i := n - 1; i < len(x); i++ {
+		out[i] = f(x[i-n+1 : i+1])
+	}
+	return out
+}
+
+func sum(w []float64) float64 {
+	s := 0.
+	for _, v := range w {
+		s += v
+	}
+	return s
+}
+
+func extreme(w []float64, f func(x, y float64) float64) float64 {
+	out := w[0]
+	for _, v := range w[1:] {
+		out = f(out, v)
+	}
+	return out
+}
+
+func stddev(w []float64) float64 {
+	mean := sum(w) / float64(len(w))
+	s := 0.
+	for _, v := range w {
+		s += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(s / float64(len(w)))
+}
+
+// rsi 和strategy.RSI一样使用Wilder平滑
+func rsi(x []float64, n int) []float64 {
+	out := constant(len(x), math.NaN())
+	if len(x) <= n {
+		return out
+	}
+	var gain, loss float64
+	for i := 1; i <= n; i++ {
+		if d := x[i] - x[i-1]; d > 0 {
+			gain += d
+		} else {
+			loss -= d
+		}
+	}
+	gain, loss = gain/float64(n), loss/float64(n)
+	for i := n; i < len(x); i++ {
+		if i > n {
+			d := x[i] - x[i-1]
+			gain = (gain*float64(n-1) + math.Max(d, 0)) / float64(n)
+			loss = (loss*float64(n-1) + math.Max(-d, 0)) / float64(n)
+		}
+		if loss == 0 {
+			out[i] = 100
+		} else {
+			out[i] = 100 - 100/(1+gain/loss)
+		}
+	}
+	return out
+}
+
+// splitAnd 最外层用and连接的每一项
+func splitAnd(n node) []node {
+	if b, ok := n.(*binary); ok && b.op == "and" {
+		return append(splitAnd(b.left), splitAnd(b.right)...)
+	}
+	return []node{n}
+}
+
+func uses(n node, name string) bool {
+	switch v := n.(type) {
+	case *variable:
+		return v.name == name
+	case *unary:
+		return uses(v.arg, name)
+	case *binary:
+		return uses(v.left, name) || uses(v.right, name)
+	case *call:
+		if v.name == "rsi" && len(v.args) == 0 && name == "close" {
+			return true
+		}
+		for _, a := range v.args {
+			if uses(a, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func window(n node) int {
+	switch v := n.(type) {
+	case *unary:
+		return window(v.arg)
+	case *binary:
+		return max(window(v.left), window(v.right))
+	case *call:
+		w := 0
+		for _, a := range v.args {
+			w = max(w, window(a))
+		}
+		switch v.name {
+		case "ema":
+			//ema需要更长的数据才能收敛
+			return w + v.period*3
+		case "cross":
+			return w + 1
+		}
+		return w + v.period
+	}
+	return 0
+}
+
+const (
+	tokenEOF = iota
+	tokenNumber
+	tokenIdent
+	tokenOp
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	i      int
+}
+
+func (this *parser) tokenize() error {
+	rs := []rune(this.src)
+	//位置按字符计算,中文也算一个
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])):
+			j := i
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			//科学计数法,例1e8,1.5e-3
+			if j < len(rs) && (rs[j] == 'e' || rs[j] == 'E') {
+				k := j + 1
+				if k < len(rs) && (rs[k] == '+' || rs[k] == '-') {
+					k++
+				}
+				if k < len(rs) && unicode.IsDigit(rs[k]) {
+					for k < len(rs) && unicode.IsDigit(rs[k]) {
+						k++
+					}
+					j = k
+				}
+			}
+			this.tokens = append(this.tokens, token{kind: tokenNumber, text: string(rs[i:j]), pos: i})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			this.tokens = append(this.tokens, token{kind: tokenIdent, text: strings.ToLower(string(rs[i:j])), pos: i})
+			i = j
+		default:
+			op := ""
+			if i+1 < len(rs) {
+				switch two := string(rs[i : i+2]); two {
+				case ">=", "<=", "==", "!=", "&&", "||":
+					op = two
+				}
+			}
+			if op == "" {
+				switch r {
+				case '(', ')', ',', '+', '-', '*', '/', '>', '<', '!', '=':
+					op = string(r)
+				default:
+					return &ParseError{Pos: i, Msg: fmt.Sprintf("不支持的字符'%c'", r)}
+				}
+			}
+			this.tokens = append(this.tokens, token{kind: tokenOp, text: op, pos: i})
+			i += len([]rune(op))
+		}
+	}
+	return nil
+}
+
+func (this *parser) peek() token {
+	if this.i < len(this.tokens) {
+		return this.tokens[this.i]
+	}
+	return token{kind: tokenEOF, text: "结尾", pos: len([]rune(this.src))}
+}
+
+func (this *parser) next() token {
+	t := this.peek()
+	this.i++
+	return t
+}
+
+// source 从第start个token到当前位置的原文
+func (this *parser) source(start int) string {
+	rs := []rune(this.src)
+	from := this.tokens[start].pos
+	last := this.tokens[this.i-1]
+	return strings.TrimSpace(string(rs[from : last.pos+len([]rune(last.text))]))
+}
+
+// keyword 运算符的统一写法
+func keyword(t token) string {
+	switch t.text {
+	case "&&":
+		return "and"
+	case "||":
+		return "or"
+	case "!":
+		return "not"
+	case "=":
+		return "=="
+	}
+	return t.text
+}
+
+func (this *parser) parseOr() (node, error) {
+	start := this.i
+	left, err := this.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for keyword(this.peek()) == "or" {
+		this.next()
+		right, err := this.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: "or", left: left, right: right, src: this.source(start)}
+	}
+	return left, nil
+}
+
+func (this *parser) parseAnd() (node, error) {
+	start := this.i
+	left, err := this.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for keyword(this.peek()) == "and" {
+		this.next()
+		right, err := this.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: "and", left: left, right: right, src: this.source(start)}
+	}
+	return left, nil
+}
+
+func (this *parser) parseNot() (node, error) {
+	start := this.i
+	if keyword(this.peek()) == "not" {
+		this.next()
+		arg, err := this.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{op: "not", arg: arg, src: this.source(start)}, nil
+	}
+	return this.parseCompare()
+}
+
+func (this *parser) parseCompare() (node, error) {
+	start := this.i
+	left, err := this.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	if t := this.peek(); t.kind == tokenOp && isCompare(keyword(t)) {
+		this.next()
+		right, err := this.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: keyword(t), left: left, right: right, src: this.source(start)}
+		if t := this.peek(); t.kind == tokenOp && isCompare(keyword(t)) {
+			return nil, &ParseError{Pos: t.pos, Msg: "比较运算不能连续使用,请用and连接"}
+		}
+	}
+	return left, nil
+}
+
+func (this *parser) parseAdd() (node, error) {
+	start := this.i
+	left, err := this.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for t := this.peek(); t.kind == tokenOp && (t.text == "+" || t.text == "-"); t = this.peek() {
+		this.next()
+		right, err := this.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: t.text, left: left, right: right, src: this.source(start)}
+	}
+	return left, nil
+}
+
+func (this *parser) parseMul() (node, error) {
+	start := this.i
+	left, err := this.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := this.peek(); t.kind == tokenOp && (t.text == "*" || t.text == "/"); t = this.peek() {
+		this.next()
+		right, err := this.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: t.text, left: left, right: right, src: this.source(start)}
+	}
+	return left, nil
+}
+
+func (this *parser) parseUnary() (node, error) {
+	start := this.i
+	if t := this.peek(); t.kind == tokenOp && t.text == "-" {
+		this.next()
+		arg, err := this.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := arg.(*number); ok {
+			return &number{value: -v.value, src: this.source(start)}, nil
+		}
+		return &unary{op: "-", arg: arg, src: this.source(start)}, nil
+	}
+	return this.parsePrimary()
+}
+
+func (this *parser) parsePrimary() (node, error) {
+	start := this.i
+	t := this.next()
+	switch {
+	case t.kind == tokenNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("无效的数字'%s'", t.text)}
+		}
+		return &number{value: v, src: t.text}, nil
+
+	case t.kind == tokenOp && t.text == "(":
+		n, err := this.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := this.next(); c.text != ")" {
+			return nil, &ParseError{Pos: c.pos, Msg: fmt.Sprintf("缺少')',得到'%s'", c.text)}
+		}
+		return n, nil
+
+	case t.kind == tokenIdent:
+		if p := this.peek(); p.kind == tokenOp && p.text == "(" {
+			return this.parseCall(start, t)
+		}
+		switch t.text {
+		case "and", "or", "not":
+			return nil, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("'%s'前面缺少条件", t.text)}
+		}
+		if !variables[t.text] {
+			return nil, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("未知的变量'%s'", t.text)}
+		}
+		return &variable{name: t.text}, nil
+
+	case t.kind == tokenEOF:
+		return nil, &ParseError{Pos: t.pos, Msg: "表达式不完整"}
+
+	default:
+		return nil, &ParseError{Pos: t.pos, Msg: fmt.Sprintf("不应该出现'%s'", t.text)}
+	}
+}
+
+func (this *parser) parseCall(start int, name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, &ParseError{Pos: name.pos, Msg: fmt.Sprintf("未知的函数'%s'", name.text)}
+	}
+	this.next() //(
+	args := []node(nil)
+	if p := this.peek(); !(p.kind == tokenOp && p.text == ")") {
+		for {
+			arg, err := this.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p := this.peek(); p.kind == tokenOp && p.text == "," {
+				this.next()
+				continue
+			}
+			break
+		}
+	}
+	if c := this.next(); c.text != ")" {
+		return nil, &ParseError{Pos: c.pos, Msg: fmt.Sprintf("函数%s缺少')',得到'%s'", name.text, c.text)}
+	}
+
+	valid := false
+	for _, n := range fn.args {
+		valid = valid || n == len(args)
+	}
+	if !valid {
+		return nil, &ParseError{Pos: name.pos, Msg: fmt.Sprintf("函数%s的参数数量应该是%s,得到%d个", name.text, joinInts(fn.args), len(args))}
+	}
+	c := &call{name: name.text, args: args, src: this.source(start)}
+	for _, i := range fn.periods {
+		if i < 0 {
+			i += len(args)
+		}
+		v, ok := args[i].(*number)
+		if !ok || v.value < 1 || v.value != math.Trunc(v.value) {
+			return nil, &ParseError{Pos: name.pos, Msg: fmt.Sprintf("函数%s的周期需要是正整数", name.text)}
+		}
+		c.period = int(v.value)
+		//周期参数不参与计算
+		c.args = append(c.args[:i:i], c.args[i+1:]...)
+	}
+	return c, nil
+}
+
+func joinInts(ls []int) string {
+	s := make([]string, len(ls))
+	for i, v := range ls {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, "或")
+}
@@ -0,0 +1,206 @@
+package screener
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+// klines 按收盘价和成交量生成K线,开高低都等于收盘价
+func klines(closes []float64, volumes []int64) protocol.Klines {
+	out := make(protocol.Klines, len(closes))
+	t := time.Date(2024, 1, 1, 15, 0, 0, 0, time.Local)
+	for i, c := range closes {
+		out[i] = &protocol.Kline{
+			Time:   t.AddDate(0, 0, i),
+			Open:   protocol.Yuan(c),
+			High:   protocol.Yuan(c),
+			Low:    protocol.Yuan(c),
+			Close:  protocol.Yuan(c),
+			Volume: volumes[i],
+			Amount: protocol.Yuan(c * float64(volumes[i]) * 100),
+		}
+	}
+	return out
+}
+
+func TestParseExprError(t *testing.T) {
+	cases := []struct {
+		src string
+		pos int
+	}{
+		{"", 0},
+		{"foo > 1", 0},
+		{"close @ 1", 6},
+		{"close > 1 > 2", 10},
+		{"close 1", 6},
+		{"ma(close) > 1", 0},
+		{"ma(close,0) > 1", 0},
+		{"ma(close,n) > 1", 9},
+		{"bar(close) > 1", 0},
+	}
+	for _, c := range cases {
+		_, err := ParseExpr(c.src)
+		pe := (*ParseError)(nil)
+		if !errors.As(err, &pe) {
+			t.Errorf("%q: 期望解析错误,得到%v", c.src, err)
+			continue
+		}
+		if pe.Pos != c.pos {
+			t.Errorf("%q: 错误位置%d,期望%d: %v", c.src, pe.Pos, c.pos, err)
+		}
+	}
+}
+
+func TestParseExpr(t *testing.T) {
+	e, err := ParseExpr("close > ma(close,60) and rsi(14) < 30 && not amount < 1e8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"close > ma(close,60)", "rsi(14) < 30", "not amount < 1e8"}
+	if len(e.conditions) != len(want) {
+		t.Fatalf("条件数量%d,期望%d", len(e.conditions), len(want))
+	}
+	for i, c := range e.conditions {
+		if c.text() != want[i] {
+			t.Errorf("第%d个条件%q,期望%q", i, c.text(), want[i])
+		}
+	}
+	//or的优先级比and低,整体只有一个条件
+	if e, err = ParseExpr("close > 1 and close < 2 or volume > 0"); err != nil {
+		t.Fatal(err)
+	} else if len(e.conditions) != 1 {
+		t.Errorf("条件数量%d,期望1", len(e.conditions))
+	}
+}
+
+func TestExprValue(t *testing.T) {
+	closes, volumes := make([]float64, 30), make([]int64, 30)
+	for i := range closes {
+		closes[i], volumes[i] = float64(i+1), 100
+	}
+	ks := klines(closes, volumes)
+	cases := []struct {
+		src  string
+		want float64
+	}{
+		{"ma(close,5)", 28},
+		{"ref(close,1)", 29},
+		{"hhv(close,10) - llv(close,10)", 9},
+		{"sum(volume,3)", 300},
+		{"roc(close,10)", 30./20 - 1},
+		{"count(close > 25,10)", 5},
+		{"-close + 2 * 3", -24},
+		{"max(close,100) / min(close,10)", 10},
+		{"close / (volume - 100)", math.NaN()},
+		{"close > 29 and volume == 100", 1},
+		{"cross(close,ref(close,1))", 0},
+		{"ma(close,31)", math.NaN()},
+		{"pe", math.NaN()},
+	}
+	for _, c := range cases {
+		e, err := ParseExpr(c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := e.Value(ks, nil)
+		if math.IsNaN(c.want) {
+			if !math.IsNaN(got) {
+				t.Errorf("%s = %v,期望NaN", c.src, got)
+			}
+		} else if math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%s = %v,期望%v", c.src, got, c.want)
+		}
+	}
+}
+
+func TestExprEval(t *testing.T) {
+	ks := klines([]float64{10, 9, 8, 7, 12}, []int64{100, 100, 100, 100, 300})
+	e, err := ParseExpr("cross(close,ma(close,3)) and volume > 200 and close > 20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pass, cs := e.Eval(ks, nil)
+	if pass {
+		t.Error("期望不满足")
+	}
+	if len(cs) != 3 || !cs[0].Pass || !cs[1].Pass || cs[2].Pass {
+		t.Fatalf("条件结果有误: %+v", cs)
+	}
+	if cs[1].Value != 300 || cs[2].Value != 12 {
+		t.Errorf("条件左边的值有误: %+v", cs)
+	}
+	//基本面为0按没有数据处理,比较结果为假
+	e, _ = ParseExpr("pe < 20")
+	if pass, _ = e.Eval(ks, map[string][]float64{"pe": {0, 0, 0, 0, 15}}); !pass {
+		t.Error("pe=15时期望满足")
+	}
+	if pass, _ = e.Eval(ks, map[string][]float64{"pe": {15, 15, 15, 15, 0}}); pass {
+		t.Error("pe没有数据时期望不满足")
+	}
+}
+
+func TestExprRSI(t *testing.T) {
+	//收盘价一直上涨,成交量有涨有跌
+	ks := klines([]float64{1, 2, 3, 4, 5, 6}, []int64{100, 200, 100, 200, 100, 200})
+	value := func(src string) float64 {
+		e, err := ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e.Value(ks, nil)
+	}
+	if v := value("rsi(3)"); v != 100 {
+		t.Errorf("rsi(3) = %v,期望100", v)
+	}
+	if v := value("rsi(close,3)"); v != 100 {
+		t.Errorf("rsi(close,3) = %v,期望100", v)
+	}
+	if v := value("rsi(volume,3)"); v >= 100 || math.IsNaN(v) {
+		t.Errorf("rsi(volume,3) = %v,期望按成交量计算", v)
+	}
+}
+
+func TestExprUses(t *testing.T) {
+	cases := []struct {
+		src, name string
+		want      bool
+	}{
+		{"rsi(14) < 30", "close", true},
+		{"rsi(volume,14) < 30", "close", false},
+		{"rsi(volume,14) < 30", "volume", true},
+		{"pe < 10 and close > 1", "pe", true},
+		{"ma(amount,5) > 1e8", "close", false},
+	}
+	for _, c := range cases {
+		e, err := ParseExpr(c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Uses(c.name) != c.want {
+			t.Errorf("%s 使用%s: 期望%v", c.src, c.name, c.want)
+		}
+	}
+}
+
+func TestExprWindow(t *testing.T) {
+	cases := map[string]int{
+		"close > 1":                   1,
+		"ma(close,20) > ref(close,5)": 21,
+		"ma(ref(close,5),20) > 1":     26,
+		"cross(close,ma(close,10))":   12,
+		"ema(close,10) > 1":           31,
+	}
+	for src, want := range cases {
+		e, err := ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Window() != want {
+			t.Errorf("%s: 需要%d根K线,期望%d", src, e.Window(), want)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package screener
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/fundamental"
+)
+
+// 因子类型
+const (
+	FactorMomentum   = "momentum"   //动量,Period根K线的涨幅
+	FactorVolatility = "volatility" //波动率,Period根K线日收益率的标准差
+	FactorLiquidity  = "liquidity"  //流动性,Period根K线的平均成交额,元
+	FactorValue      = "value"      //基本面,Key见fundamental.Keys
+	FactorExpr       = "expr"       //自定义表达式,取最后一根K线的值,语法见Expr
+	FactorScript     = "script"     //自定义脚本,取最后一根K线的值,见FactorFunc
+)
+
+// FactorFunc 脚本因子的函数,脚本里声明为Value,返回和K线一一对应的值
+type FactorFunc = func(ks protocol.Klines) []float64
+
+// FundamentalFactorFunc 使用基本面数据的脚本因子函数,f和strategy.FundamentalSignalsFunc一样
+type FundamentalFactorFunc = func(ks protocol.Klines, f map[string][]float64) []float64
+
+// 标准化方式
+const (
+	StandardZScore = "zscore" //减去均值后除以标准差
+	StandardRank   = "rank"   //按排名线性映射到[-1,1],相同的值取平均排名
+)
+
+/*
+Factor 因子定义,保存后可以在选股时按名称引用
+
+每个因子先在选股范围(股票池和板块)内去极值和标准化,再乘以权重相加得到综合得分
+标准化不受策略信号、表达式和基本面过滤的影响,同一只股票的得分不会因为过滤条件变化
+权重为负数表示越小越好,例如波动率和市盈率
+脚本因子不含package声明,和策略脚本一样,例:
+
+	import "github.com/injoyai/tdx/protocol"
+
+	func Value(ks protocol.Klines) []float64 {...}
+*/
+type Factor struct {
+	Name      string    `xorm:"pk" json:"name"`
+	Type      string    `json:"type"`      //因子类型,见FactorMomentum等
+	Period    int       `json:"period"`    //计算周期,K线数量,默认20
+	Key       string    `json:"key"`       //基本面字段,类型为value时使用
+	Expr      string    `json:"expr"`      //表达式,类型为expr时使用
+	Script    string    `json:"script"`    //脚本,类型为script时使用,Period为脚本需要的K线数量
+	Standard  string    `json:"standard"`  //标准化方式,默认zscore
+	Winsorize float64   `json:"winsorize"` //去极值的分位数,例0.05把两端5%的值截断,0不处理
+	Weight    float64   `json:"weight"`    //权重
+	Memo      string    `json:"memo"`
+	Updated   time.Time `xorm:"updated" json:"updated"`
+
+	expr        *Expr
+	script      FundamentalFactorFunc
+	fundamental bool //脚本使用基本面数据
+}
+
+// FactorScore 一个因子对综合得分的贡献
+type FactorScore struct {
+	Name         string  `json:"name"`
+	Value        float64 `json:"value"`        //原始值
+	Missing      bool    `json:"missing"`      //没有数据,不参与标准化,贡献为0
+	Score        float64 `json:"score"`        //标准化后的值
+	Contribution float64 `json:"contribution"` //Score乘以权重
+}
+
+// Sync 同步选股相关的数据表
+func Sync() error {
+	return common.DB.Sync2(new(Factor), new(Screen), new(ScreenRun))
+}
+
+// Factors 保存的因子,按名称排序
+func Factors() ([]*Factor, error) {
+	out := []*Factor{}
+	err := common.DB.Asc("Name").Find(&out)
+	return out, err
+}
+
+// GetFactor 按名称获取保存的因子
+func GetFactor(name string) (*Factor, error) {
+	f := new(Factor)
+	has, err := common.DB.Where("Name=?", name).Get(f)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, fmt.Errorf("因子[%s]不存在", name)
+	}
+	return f, nil
+}
+
+// SaveFactor 校验并保存因子,已存在的覆盖
+func SaveFactor(f *Factor) error {
+	if err := f.Check(); err != nil {
+		return err
+	}
+	has, err := common.DB.Where("Name=?", f.Name).Exist(new(Factor))
+	if err != nil {
+		return err
+	}
+	if has {
+		_, err = common.DB.Where("Name=?", f.Name).AllCols().Update(f)
+	} else {
+		_, err = common.DB.Insert(f)
+	}
+	return err
+}
+
+// DelFactor 删除保存的因子
+func DelFactor(names ...string) error {
+	_, err := common.DB.In("Name", names).Delete(new(Factor))
+	return err
+}
+
+// Check 校验因子定义,表达式会在这里解析
+func (this *Factor) Check() error {
+	if this.Name == "" {
+		return errors.New("缺少因子名称")
+	}
+	if this.Period < 0 {
+		return fmt.Errorf("因子[%s]的周期不能为负数", this.Name)
+	}
+	switch this.Type {
+	case FactorMomentum, FactorVolatility, FactorLiquidity:
+	case FactorValue:
+		if !slices.Contains(fundamental.Keys, this.Key) {
+			return fmt.Errorf("因子[%s]的基本面字段[%s]无效,可选%v", this.Name, this.Key, fundamental.Keys)
+		}
+	case FactorExpr:
+		e, err := ParseExpr(this.Expr)
+		if err != nil {
+			return fmt.Errorf("因子[%s]: %w", this.Name, err)
+		}
+		this.expr = e
+	case FactorScript:
+		if err := this.compile(); err != nil {
+			return fmt.Errorf("因子[%s]: %w", this.Name, err)
+		}
+	default:
+		return fmt.Errorf("因子[%s]的类型[%s]无效", this.Name, this.Type)
+	}
+	switch this.Standard {
+	case "", StandardZScore, StandardRank:
+	default:
+		return fmt.Errorf("因子[%s]的标准化方式[%s]无效", this.Name, this.Standard)
+	}
+	if this.Winsorize < 0 || this.Winsorize >= 0.5 {
+		return fmt.Errorf("因子[%s]的去极值分位数需要在[0,0.5)之间", this.Name)
+	}
+	return nil
+}
+
+func (this *Factor) period() int {
+	if this.Period <= 0 {
+		return 20
+	}
+	return this.Period
+}
+
+// compile 在新的解释器中编译脚本,每次校验都重新编译,不占用共享的解释器
+func (this *Factor) compile() error {
+	script := common.NewScript()
+	if _, err := script.Eval("package factor\n" + this.Script); err != nil {
+		return err
+	}
+	res, err := script.Eval("factor.Value")
+	if err != nil {
+		return err
+	}
+	switch f := res.Interface().(type) {
+	case FactorFunc:
+		this.script = func(ks protocol.Klines, _ map[string][]float64) []float64 { return f(ks) }
+		this.fundamental = false
+	case FundamentalFactorFunc:
+		this.script, this.fundamental = f, true
+	default:
+		return errors.New("脚本函数有误,需要func Value(ks protocol.Klines) []float64")
+	}
+	return nil
+}
+
+// scriptValue 执行脚本,脚本异常或者返回的数量和K线不一致时为NaN
+func (this *Factor) scriptValue(ks protocol.Klines, f map[string][]float64) (v float64) {
+	defer func() {
+		if recover() != nil {
+			v = math.NaN()
+		}
+	}()
+	if f == nil {
+		f = fundamental.Empty(len(ks))
+	}
+	vs := this.script(ks, f)
+	if len(ks) == 0 || len(vs) != len(ks) {
+		return math.NaN()
+	}
+	return vs[len(vs)-1]
+}
+
+// window 计算需要的K线数量
+func (this *Factor) window() int {
+	switch this.Type {
+	case FactorMomentum, FactorVolatility:
+		return this.period() + 1
+	case FactorLiquidity, FactorScript:
+		return this.period()
+	case FactorExpr:
+		return this.expr.Window()
+	}
+	return 1
+}
+
+func (this *Factor) needFundamental() bool {
+	switch this.Type {
+	case FactorValue:
+		return true
+	case FactorExpr:
+		return this.expr.Uses(fundamental.Keys...)
+	case FactorScript:
+		return this.fundamental
+	}
+	return false
+}
+
+// value 最后一根K线的因子原始值,数据不足时为NaN
+func (this *Factor) value(ks protocol.Klines, f map[string][]float64) float64 {
+	last, n := len(ks)-1, this.period()
+	switch this.Type {
+	case FactorMomentum:
+		if last < n || ks[last-n].Close == 0 {
+			return math.NaN()
+		}
+		return ks[last].Close.Float64()/ks[last-n].Close.Float64() - 1
+	case FactorVolatility:
+		if last < n {
+			return math.NaN()
+		}
+		rets := make([]float64, 0, n)
+		for i := last - n + 1; i <= last; i++ {
+			if ks[i-1].Close == 0 {
+				return math.NaN()
+			}
+			rets = append(rets, ks[i].Close.Float64()/ks[i-1].Close.Float64()-1)
+		}
+		return stddev(rets)
+	case FactorLiquidity:
+		if last+1 < n {
+			return math.NaN()
+		}
+		total := 0.
+		for _, k := range ks[last-n+1:] {
+			total += k.Amount.Float64()
+		}
+		return total / float64(n)
+	case FactorValue:
+		//没有基本面数据的值为0
+		if ls := f[this.Key]; len(ls) > 0 && ls[len(ls)-1] != 0 {
+			return ls[len(ls)-1]
+		}
+		return math.NaN()
+	case FactorExpr:
+		return this.expr.Value(ks, f)
+	case FactorScript:
+		return this.scriptValue(ks, f)
+	}
+	return math.NaN()
+}
+
+// loadFactors 解析请求里的因子,只填了名称的使用保存的定义,请求里的权重不为0时覆盖保存的权重
+func loadFactors(ls []*Factor) ([]*Factor, error) {
+	out := make([]*Factor, 0, len(ls))
+	for _, v := range ls {
+		f := *v
+		if f.Type == "" {
+			saved, err := GetFactor(f.Name)
+			if err != nil {
+				return nil, err
+			}
+			if f.Weight != 0 {
+				saved.Weight = f.Weight
+			}
+			f = *saved
+		}
+		if err := f.Check(); err != nil {
+			return nil, err
+		}
+		out = append(out, &f)
+	}
+	return out, nil
+}
+
+// score 在整个选股范围内标准化每个因子,计算选股结果的综合得分
+// values[n][j]为选股范围内第n只股票第j个因子的原始值,index[i]为第i个结果在values里的位置
+func score(items []Item, factors []*Factor, values [][]float64, index []int) {
+	for i := range items {
+		items[i].Score = 0
+		items[i].Factors = make([]FactorScore, len(factors))
+	}
+	for j, f := range factors {
+		xs := make([]float64, len(values))
+		for n := range values {
+			xs[n] = values[n][j]
+		}
+		zs := standardize(xs, f.Standard, f.Winsorize)
+		for i := range items {
+			x, z := xs[index[i]], zs[index[i]]
+			fs := FactorScore{Name: f.Name, Value: x, Missing: math.IsNaN(x) || math.IsInf(x, 0)}
+			if fs.Missing {
+				fs.Value = 0
+			} else {
+				fs.Score = z
+				fs.Contribution = z * f.Weight
+			}
+			items[i].Factors[j] = fs
+			items[i].Score += fs.Contribution
+		}
+	}
+}
+
+// standardize 去极值后标准化,NaN不参与计算,结果仍为NaN
+func standardize(xs []float64, standard string, winsorize float64) []float64 {
+	valid := []float64(nil)
+	for _, v := range xs {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			valid = append(valid, v)
+		}
+	}
+	out := constant(len(xs), math.NaN())
+	if len(valid) == 0 {
+		return out
+	}
+	sort.Float64s(valid)
+	lo, hi := valid[0], valid[len(valid)-1]
+	if winsorize > 0 {
+		lo, hi = quantile(valid, winsorize), quantile(valid, 1-winsorize)
+	}
+	clip := func(v float64) float64 { return math.Min(math.Max(v, lo), hi) }
+
+	if standard == StandardRank {
+		//截断不改变顺序,截断后仍然有序
+		clipped := make([]float64, len(valid))
+		for i, v := range valid {
+			clipped[i] = clip(v)
+		}
+		for i, v := range xs {
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				out[i] = rank(clipped, clip(v))
+			}
+		}
+		return out
+	}
+
+	mean, sd := 0., 0.
+	for _, v := range valid {
+		mean += clip(v)
+	}
+	mean /= float64(len(valid))
+	for _, v := range valid {
+		sd += (clip(v) - mean) * (clip(v) - mean)
+	}
+	sd = math.Sqrt(sd / float64(len(valid)))
+	for i, v := range xs {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		out[i] = 0
+		if sd > 0 {
+			out[i] = (clip(v) - mean) / sd
+		}
+	}
+	return out
+}
+
+// quantile 已排序数据的分位数,线性插值
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (sorted[i+1]-sorted[i])*(pos-float64(i))
+}
+
+// rank v在已排序数据里的平均排名,映射到[-1,1]
+func rank(sorted []float64, v float64) float64 {
+	if len(sorted) == 1 {
+		return 0
+	}
+	less := sort.SearchFloat64s(sorted, v)
+	equal := sort.Search(len(sorted), func(i int) bool { return sorted[i] > v }) - less
+	r := float64(less) + float64(equal-1)/2
+	return r/float64(len(sorted)-1)*2 - 1
+}
@@ -0,0 +1,116 @@
+package screener
+
+import (
+	"math"
+	"testing"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+func TestStandardize(t *testing.T) {
+	nan := math.NaN()
+	cases := []struct {
+		name      string
+		xs        []float64
+		standard  string
+		winsorize float64
+		want      []float64
+	}{
+		{"zscore", []float64{1, 2, 3, nan}, StandardZScore, 0, []float64{-math.Sqrt(1.5), 0, math.Sqrt(1.5), nan}},
+		{"相同的值", []float64{2, 2}, StandardZScore, 0, []float64{0, 0}},
+		{"rank", []float64{30, 10, 20, 20}, StandardRank, 0, []float64{1, -1, 0, 0}},
+		{"去极值", []float64{1, 2, 3, 4, 100}, StandardRank, 0.25, []float64{-0.75, -0.75, 0, 0.75, 0.75}},
+	}
+	for _, c := range cases {
+		got := standardize(c.xs, c.standard, c.winsorize)
+		for i := range c.want {
+			if math.IsNaN(c.want[i]) != math.IsNaN(got[i]) || (!math.IsNaN(got[i]) && math.Abs(got[i]-c.want[i]) > 1e-9) {
+				t.Errorf("%s: 得到%v,期望%v", c.name, got, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	factors := []*Factor{{Name: "a", Weight: 1}, {Name: "b", Weight: -2}}
+	//选股范围内5只股票,只有最后一只通过过滤
+	values := [][]float64{{1, 5}, {2, 4}, {3, 3}, {4, 2}, {5, math.NaN()}}
+	items := []Item{{Symbol: "sz000005"}}
+	score(items, factors, values, []int{4})
+
+	fs := items[0].Factors
+	if len(fs) != 2 {
+		t.Fatalf("因子数量%d,期望2", len(fs))
+	}
+	//按全部5只标准化,不是只按通过过滤的1只
+	if want := 2 / math.Sqrt(2); math.Abs(fs[0].Score-want) > 1e-9 || fs[0].Value != 5 {
+		t.Fatalf("因子a有误: %+v,期望得分%v", fs[0], want)
+	}
+	if !fs[1].Missing || fs[1].Contribution != 0 {
+		t.Fatalf("没有数据的因子不参与打分: %+v", fs[1])
+	}
+	if items[0].Score != fs[0].Contribution {
+		t.Fatalf("综合得分%v,期望%v", items[0].Score, fs[0].Contribution)
+	}
+}
+
+func TestScriptFactor(t *testing.T) {
+	ks := protocol.Klines{{Close: protocol.Yuan(10)}, {Close: protocol.Yuan(12)}}
+	f := &Factor{Name: "s", Type: FactorScript, Script: `
+import "github.com/injoyai/tdx/protocol"
+
+func Value(ks protocol.Klines) []float64 {
+	out := make([]float64, len(ks))
+	for i, k := range ks {
+		out[i] = k.Close.Float64() * 2
+	}
+	return out
+}`}
+	if err := f.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if v := f.value(ks, nil); v != 24 || f.needFundamental() {
+		t.Fatalf("脚本因子的值%v,期望24", v)
+	}
+
+	//使用基本面数据
+	f = &Factor{Name: "pe", Type: FactorScript, Script: `
+import "github.com/injoyai/tdx/protocol"
+
+func Value(ks protocol.Klines, f map[string][]float64) []float64 {
+	return f["pe"]
+}`}
+	if err := f.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if v := f.value(ks, map[string][]float64{"pe": {5, 6}}); v != 6 || !f.needFundamental() {
+		t.Fatalf("基本面脚本因子的值%v,期望6", v)
+	}
+
+	//异常和数量不一致时没有值
+	for name, script := range map[string]string{
+		"异常":    "import \"github.com/injoyai/tdx/protocol\"\nfunc Value(ks protocol.Klines) []float64 { var m map[string]int; m[\"a\"] = 1; return nil }",
+		"数量不一致": "import \"github.com/injoyai/tdx/protocol\"\nfunc Value(ks protocol.Klines) []float64 { return []float64{1} }",
+	} {
+		f = &Factor{Name: name, Type: FactorScript, Script: script}
+		if err := f.Check(); err != nil {
+			t.Fatal(err)
+		}
+		if v := f.value(ks, nil); !math.IsNaN(v) {
+			t.Errorf("%s: 得到%v,期望NaN", name, v)
+		}
+	}
+
+	//编译失败和函数签名错误
+	for _, script := range []string{
+		"func Value( {",
+		"func Value(n int) int { return n }",
+		"func Other() {}",
+	} {
+		f = &Factor{Name: "bad", Type: FactorScript, Script: script}
+		if err := f.Check(); err == nil {
+			t.Errorf("脚本%q期望返回错误", script)
+		}
+	}
+}
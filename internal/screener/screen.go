@@ -0,0 +1,260 @@
+package screener
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/injoyai/logs"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/universe"
+	"github.com/robfig/cron/v3"
+	"xorm.io/xorm"
+)
+
+// scheduleParser 和定时更新一样使用带秒的cron表达式
+var scheduleParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+/*
+Screen 保存的选股条件
+
+Schedule决定哪些天执行,到期后在日线更新完成后执行,每次收盘后最多执行一次
+例 "0 0 0 * * 5" 每周五,"0 0 0 1 * *" 每月第一个交易日,空为每个交易日
+*/
+type Screen struct {
+	Name     string    `xorm:"pk" json:"name"`
+	Request  Request   `xorm:"json" json:"request"`
+	Schedule string    `json:"schedule"` //cron表达式,6位含秒
+	Enable   bool      `json:"enable"`   //是否定时执行,手动执行不受影响
+	Limit    int       `json:"limit"`    //只保存前N个结果,0全部
+	Memo     string    `json:"memo"`
+	LastRun  time.Time `json:"last_run"`
+	Updated  time.Time `xorm:"updated" json:"updated"`
+}
+
+// ScreenRun 一次执行的结果,Entered和Left是和上一次成功执行的结果比较
+type ScreenRun struct {
+	ID      int64     `xorm:"pk autoincr" json:"id"`
+	Screen  string    `xorm:"index" json:"screen"`
+	Time    time.Time `xorm:"index" json:"time"`
+	Count   int       `json:"count"`
+	Items   []Item    `xorm:"json" json:"items,omitempty"`
+	Entered []string  `xorm:"json" json:"entered"` //新进入的代码
+	Left    []string  `xorm:"json" json:"left"`    //离开的代码
+	Error   string    `json:"error,omitempty"`
+}
+
+// Screens 保存的选股条件,按名称排序
+func Screens() ([]*Screen, error) {
+	out := []*Screen{}
+	err := common.DB.Asc("Name").Find(&out)
+	return out, err
+}
+
+// GetScreen 按名称获取保存的选股条件
+func GetScreen(name string) (*Screen, error) {
+	s := new(Screen)
+	has, err := common.DB.Where("Name=?", name).Get(s)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, fmt.Errorf("选股[%s]不存在", name)
+	}
+	return s, nil
+}
+
+// SaveScreen 校验并保存选股条件,已存在的覆盖,保留上次执行的时间
+func SaveScreen(s *Screen) error {
+	if err := s.Check(); err != nil {
+		return err
+	}
+	old := new(Screen)
+	has, err := common.DB.Where("Name=?", s.Name).Get(old)
+	if err != nil {
+		return err
+	}
+	if has {
+		s.LastRun = old.LastRun
+		_, err = common.DB.Where("Name=?", s.Name).AllCols().Update(s)
+	} else {
+		_, err = common.DB.Insert(s)
+	}
+	return err
+}
+
+// DelScreen 删除选股条件和执行记录
+func DelScreen(names ...string) error {
+	return common.DB.SessionFunc(func(session *xorm.Session) error {
+		if _, err := session.In("Name", names).Delete(new(Screen)); err != nil {
+			return err
+		}
+		_, err := session.In("Screen", names).Delete(new(ScreenRun))
+		return err
+	})
+}
+
+// Check 校验选股条件,表达式、因子和股票池需要有效
+func (this *Screen) Check() error {
+	if this.Name == "" {
+		return errors.New("缺少选股名称")
+	}
+	if this.Schedule != "" {
+		if _, err := scheduleParser.Parse(this.Schedule); err != nil {
+			return fmt.Errorf("选股[%s]的定时无效: %v", this.Name, err)
+		}
+	}
+	if this.Request.Expr != "" {
+		if _, err := ParseExpr(this.Request.Expr); err != nil {
+			return err
+		}
+	}
+	if _, err := loadFactors(this.Request.Factors); err != nil {
+		return err
+	}
+	if this.Request.Universe != "" {
+		if _, err := universe.Get(this.Request.Universe); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Due 在now时是否需要执行,上次执行之后有新的收盘数据才执行
+例如启动时在收盘前用上一交易日的数据执行过,当天收盘后还会执行
+*/
+func (this *Screen) Due(now time.Time) bool {
+	if !this.LastRun.Before(common.Calendar.LastClose(now)) {
+		return false
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if this.Schedule == "" {
+		return true
+	}
+	sched, err := scheduleParser.Parse(this.Schedule)
+	if err != nil {
+		return false
+	}
+	from := this.LastRun
+	if from.IsZero() || !from.Before(today) {
+		//没有执行过或今天已经执行过时,只看今天是否到期
+		from = today.Add(-time.Nanosecond)
+	}
+	return !sched.Next(from).After(now)
+}
+
+// Runs 执行记录,按时间倒序,不包含结果列表,limit大于0时只返回最近的limit条
+func Runs(name string, limit int) ([]*ScreenRun, error) {
+	session := common.DB.Where("Screen=?", name).Omit("Items").Desc("Time", "ID")
+	if limit > 0 {
+		session.Limit(limit)
+	}
+	out := []*ScreenRun{}
+	err := session.Find(&out)
+	return out, err
+}
+
+// GetRun 执行记录,包含结果列表
+func GetRun(id int64) (*ScreenRun, error) {
+	r := new(ScreenRun)
+	has, err := common.DB.ID(id).Get(r)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, fmt.Errorf("执行记录[%d]不存在", id)
+	}
+	return r, nil
+}
+
+// RunScreen 执行保存的选股条件并保存结果,失败也会保存记录
+func RunScreen(name string) (*ScreenRun, error) {
+	s, err := GetScreen(name)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	r := &ScreenRun{Screen: s.Name, Time: now, Items: []Item{}, Entered: []string{}, Left: []string{}}
+	items, err := Run(s.Request)
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		if s.Limit > 0 && len(items) > s.Limit {
+			items = items[:s.Limit]
+		}
+		r.Items, r.Count = items, len(items)
+		prev := new(ScreenRun)
+		has, err := common.DB.Where("Screen=? AND Error=?", s.Name, "").Desc("Time", "ID").Get(prev)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			r.Entered, r.Left = diff(prev.Items, items)
+		} else {
+			for _, v := range items {
+				r.Entered = append(r.Entered, v.Symbol)
+			}
+		}
+	}
+	err = common.DB.SessionFunc(func(session *xorm.Session) error {
+		if _, err := session.Insert(r); err != nil {
+			return err
+		}
+		_, err := session.Where("Name=?", s.Name).Cols("LastRun").NoAutoTime().Update(&Screen{LastRun: now})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.Error != "" {
+		return r, errors.New(r.Error)
+	}
+	return r, nil
+}
+
+// diff 新进入和离开的代码,按结果的顺序
+func diff(prev, cur []Item) (entered, left []string) {
+	entered, left = []string{}, []string{}
+	old := make(map[string]bool, len(prev))
+	for _, v := range prev {
+		old[v.Symbol] = true
+	}
+	now := make(map[string]bool, len(cur))
+	for _, v := range cur {
+		now[v.Symbol] = true
+		if !old[v.Symbol] {
+			entered = append(entered, v.Symbol)
+		}
+	}
+	for _, v := range prev {
+		if !now[v.Symbol] {
+			left = append(left, v.Symbol)
+		}
+	}
+	return
+}
+
+// RunDue 执行全部到期的选股条件,单个失败记录日志后继续
+func RunDue() {
+	ls := []*Screen(nil)
+	if err := common.DB.Where("Enable=?", true).Find(&ls); err != nil {
+		logs.Err(err)
+		return
+	}
+	now := time.Now()
+	for _, s := range ls {
+		if !s.Due(now) {
+			continue
+		}
+		if _, err := RunScreen(s.Name); err != nil {
+			logs.Errf("执行选股[%s]失败: %v\n", s.Name, err)
+		}
+	}
+}
+
+// Start 每个交易日的日线更新完成后执行到期的选股条件
+func Start() {
+	data.OnUpdated(RunDue)
+}
@@ -0,0 +1,39 @@
+package screener
+
+import (
+	"testing"
+	"time"
+
+	"github.com/injoyai/trategy/internal/calendar"
+	"github.com/injoyai/trategy/internal/common"
+)
+
+func TestDue(t *testing.T) {
+	common.Calendar = new(calendar.Calendar)
+	at := func(day, hour int) time.Time {
+		return time.Date(2024, 1, day, hour, 0, 0, 0, time.Local) //2024-01-01是周一
+	}
+	cases := []struct {
+		name     string
+		schedule string
+		lastRun  time.Time
+		now      time.Time
+		want     bool
+	}{
+		{"没有执行过", "", time.Time{}, at(2, 16), true},
+		{"收盘后已经执行过", "", at(2, 15).Add(20 * time.Minute), at(2, 18), false},
+		{"收盘前执行过", "", at(2, 10), at(2, 16), true},
+		{"收盘前没有新数据", "", at(1, 16), at(2, 10), false},
+		{"周末没有新数据", "", at(5, 16), at(6, 16), false},
+		{"每周五,周四", "0 0 0 * * 5", at(3, 16), at(4, 16), false},
+		{"每周五,周五", "0 0 0 * * 5", at(4, 16), at(5, 16), true},
+		{"每周五,周五收盘前执行过", "0 0 0 * * 5", at(5, 10), at(5, 16), true},
+		{"错过的周五", "0 0 0 * * 5", at(4, 16), at(8, 16), true},
+	}
+	for _, c := range cases {
+		s := &Screen{Schedule: c.schedule, LastRun: c.lastRun}
+		if got := s.Due(c.now); got != c.want {
+			t.Errorf("%s: 得到%v,期望%v", c.name, got, c.want)
+		}
+	}
+}
@@ -1,44 +1,143 @@
 package screener
 
 import (
+	"slices"
 	"sort"
 	"time"
 
 	"github.com/injoyai/tdx/protocol"
 	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/fundamental"
+	"github.com/injoyai/trategy/internal/sector"
 	"github.com/injoyai/trategy/internal/strategy"
+	"github.com/injoyai/trategy/internal/universe"
 )
 
 type Item struct {
-	Symbol string         `json:"symbol"`
-	Score  float64        `json:"score"`
-	Price  protocol.Price `json:"price"`
-	Signal int            `json:"signal"`
+	Symbol     string         `json:"symbol"`
+	Score      float64        `json:"score"`
+	Price      protocol.Price `json:"price"`
+	Signal     int            `json:"signal"`
+	Passed     int            `json:"passed,omitempty"`     //满足的条件数量
+	Conditions []Condition    `json:"conditions,omitempty"` //表达式每个条件的结果
+	Factors    []FactorScore  `json:"factors,omitempty"`    //每个因子的贡献,设置了因子时Score为综合得分
 }
 
 type Request struct {
-	Strategy string  `json:"strategy"`
-	Lookback int     `json:"lookback"`
-	MinScore float64 `json:"min_score"`
-	Signal   int     `json:"signal"`
+	Strategy        string    `json:"strategy"`
+	Lookback        int       `json:"lookback"`
+	MinScore        float64   `json:"min_score"`
+	Signal          int       `json:"signal"`
+	Sectors         []string  `json:"sectors"`           //只选这些板块的成分股
+	SectorMinReturn float64   `json:"sector_min_return"` //板块等权指数在Lookback内的涨幅低于这个值时跳过这个板块,0不限制
+	Fundamental     *Filter   `json:"fundamental"`       //按最新的市值和估值过滤
+	Expr            string    `json:"expr"`              //条件表达式,例 close > ma(close,60) and rsi(14) < 30
+	Partial         bool      `json:"partial"`           //同时返回只满足部分条件的股票,按满足的数量排序
+	Factors         []*Factor `json:"factors"`           //多因子打分,只填名称时使用保存的因子
+	Universe        string    `json:"universe"`          //股票池名称,空为全部股票
+}
+
+// Filter 基本面过滤条件,按最后一个交易日的数据,0不限制,设置了PE或PB条件时没有数据的股票会被过滤
+type Filter struct {
+	MinCap float64 `json:"min_cap"` //最小总市值,亿
+	MaxCap float64 `json:"max_cap"` //最大总市值,亿
+	MinPE  float64 `json:"min_pe"`
+	MaxPE  float64 `json:"max_pe"`
+	MaxPB  float64 `json:"max_pb"`
+	MinROE float64 `json:"min_roe"` //最小净资产收益率,%
+}
+
+// Match 最后一个交易日的数据是否满足条件
+func (this *Filter) Match(f map[string][]float64) bool {
+	last := func(key string) float64 {
+		ls := f[key]
+		if len(ls) == 0 {
+			return 0
+		}
+		return ls[len(ls)-1]
+	}
+	capital, pe, pb, roe := last(fundamental.KeyCap)/1e8, last(fundamental.KeyPE), last(fundamental.KeyPB), last(fundamental.KeyROE)
+	switch {
+	case this.MinCap > 0 && capital < this.MinCap,
+		this.MaxCap > 0 && (capital <= 0 || capital > this.MaxCap),
+		this.MinPE > 0 && pe < this.MinPE,
+		this.MaxPE > 0 && (pe <= 0 || pe > this.MaxPE),
+		this.MaxPB > 0 && (pb <= 0 || pb > this.MaxPB),
+		this.MinROE != 0 && roe < this.MinROE:
+		return false
+	}
+	return true
 }
 
 func Run(req Request) ([]Item, error) {
-	codes := common.Data.GetStockCodes()
+	codes, err := stockCodes(req)
+	if err != nil {
+		return nil, err
+	}
+	var expr *Expr
+	if req.Expr != "" {
+		if expr, err = ParseExpr(req.Expr); err != nil {
+			return nil, err
+		}
+	}
 	out := make([]Item, 0, len(codes))
 	strat := strategy.Get(req.Strategy)
-	if strat == nil {
+	if strat == nil && (expr == nil || req.Strategy != "") {
 		strat = strategy.SMA{Fast: 5, Slow: 20}
 	}
+	factors, err := loadFactors(req.Factors)
+	if err != nil {
+		return nil, err
+	}
+	window, needFundamental := 0, req.Fundamental != nil
+	if expr != nil {
+		window, needFundamental = expr.Window(), needFundamental || expr.Uses(fundamental.Keys...)
+	}
+	for _, f := range factors {
+		window, needFundamental = max(window, f.window()), needFundamental || f.needFundamental()
+	}
+	since := time.Now().AddDate(-1, 0, 0)
+	//按交易日估算,需要的K线较多时多取一些
+	if days := window * 2; days > 365 {
+		since = time.Now().AddDate(0, 0, -days)
+	}
+	fs, _ := strat.(strategy.Fundamentaler)
+	isFundamental := strategy.NeedFundamental(strat)
+	//values是选股范围内全部股票的因子原始值,index是结果对应的位置
+	values, index := [][]float64(nil), []int(nil)
 	for _, code := range codes {
-		ks, err := common.Data.GetDayKlines(code, time.Now().AddDate(-1, 0, 0), time.Now())
+		ks, err := common.Data.GetDayKlines(code, since, time.Now())
 		if err != nil {
 			return nil, err
 		}
 		if len(ks) == 0 {
 			continue
 		}
-		sigs := strat.Signals(ks)
+		var sigs []int
+		var f map[string][]float64
+		if isFundamental || needFundamental {
+			f, err = fundamental.Series(common.Data, code, ks)
+			if err != nil {
+				return nil, err
+			}
+		}
+		//因子在过滤之前计算,按整个选股范围标准化
+		if len(factors) > 0 {
+			vs := make([]float64, len(factors))
+			for j, v := range factors {
+				vs[j] = v.value(ks, f)
+			}
+			values = append(values, vs)
+		}
+		if req.Fundamental != nil && !req.Fundamental.Match(f) {
+			continue
+		}
+		if isFundamental {
+			sigs = fs.SignalsFundamental(ks, f)
+		}
+		if sigs == nil && strat != nil {
+			sigs = strat.Signals(ks)
+		}
 		last := len(ks) - 1
 		lb := req.Lookback
 		if lb <= 0 || lb > last {
@@ -58,16 +157,97 @@ func Run(req Request) ([]Item, error) {
 			Symbol: code,
 			Score:  ret,
 			Price:  ks[last].Close,
-			Signal: sigs[last],
 		}
-		if req.MinScore != 0 && item.Score < req.MinScore {
+		if sigs != nil {
+			item.Signal = sigs[last]
+		}
+		//设置了因子时按综合得分过滤
+		if req.MinScore != 0 && len(factors) == 0 && item.Score < req.MinScore {
 			continue
 		}
 		if req.Signal != 0 && item.Signal != req.Signal {
 			continue
 		}
+		if expr != nil {
+			pass, cs := expr.Eval(ks, f)
+			for _, c := range cs {
+				if c.Pass {
+					item.Passed++
+				}
+			}
+			item.Conditions = cs
+			if !pass && (!req.Partial || item.Passed == 0) {
+				continue
+			}
+		}
+		if len(factors) > 0 {
+			index = append(index, len(values)-1)
+		}
 		out = append(out, item)
 	}
-	sort.Slice(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	if len(factors) > 0 {
+		score(out, factors, values, index)
+		if req.MinScore != 0 {
+			out = slices.DeleteFunc(out, func(v Item) bool { return v.Score < req.MinScore })
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Passed != out[j].Passed {
+			return out[i].Passed > out[j].Passed
+		}
+		return out[i].Score > out[j].Score
+	})
+	return out, nil
+}
+
+// stockCodes 选股范围,设置了股票池时只选股票池里的,设置了板块时再按板块的成分股过滤
+func stockCodes(req Request) ([]string, error) {
+	var pool map[string]bool
+	if req.Universe != "" {
+		ls, err := universe.Codes(common.Data, req.Universe, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if len(req.Sectors) == 0 {
+			return ls, nil
+		}
+		pool = make(map[string]bool, len(ls))
+		for _, code := range ls {
+			pool[code] = true
+		}
+	}
+	if len(req.Sectors) == 0 {
+		return common.Data.GetStockCodes(), nil
+	}
+	lb := req.Lookback
+	if lb <= 0 {
+		lb = 10
+	}
+	has := map[string]bool{}
+	out := []string(nil)
+	for _, name := range req.Sectors {
+		if req.SectorMinReturn != 0 {
+			ks, err := sector.Index(common.Data, name, sector.WeightEqual, time.Now().AddDate(-1, 0, 0), time.Now())
+			if err != nil {
+				return nil, err
+			}
+			last := len(ks) - 1
+			start := max(last-lb, 0)
+			if ret := ks[last].Close.Float64()/ks[start].Close.Float64() - 1; ret < req.SectorMinReturn {
+				continue
+			}
+		}
+		ls, err := sector.Members(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range ls {
+			if !has[code] && (pool == nil || pool[code]) {
+				has[code] = true
+				out = append(out, code)
+			}
+		}
+	}
+	sort.Strings(out)
 	return out, nil
 }
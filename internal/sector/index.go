@@ -0,0 +1,155 @@
+package sector
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/data"
+)
+
+// 板块指数的加权方式
+const (
+	WeightEqual = "equal" //等权
+	WeightCap   = "cap"   //流通市值加权
+)
+
+// IndexBase 板块指数的基点
+const IndexBase = 1000
+
+// bar 成分股一天相对前一根K线的涨跌幅
+type bar struct {
+	time                   time.Time
+	open, high, low, close float64
+	weight                 float64
+	volume                 int64
+	amount                 protocol.Price
+}
+
+/*
+Index 用成分股的日线计算板块指数,从IndexBase开始
+涨跌幅按前复权价格计算,市值加权时权重为前一天的不复权收盘价乘以流通股本
+成分股停牌的日子不参与计算,没有数据的成分股跳过
+*/
+func Index(s data.Source, name, weight string, start, end time.Time) (protocol.Klines, error) {
+	codes, err := Members(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("板块[%s]不存在", name)
+	}
+	if weight == "" {
+		weight = WeightEqual
+	}
+	if weight != WeightEqual && weight != WeightCap {
+		return nil, fmt.Errorf("不支持的加权方式: %s", weight)
+	}
+
+	days := map[string][]bar{}
+	for _, code := range codes {
+		ks, err := s.GetDayKlines(code, start, end)
+		if err != nil || len(ks) < 2 {
+			continue
+		}
+		xs, err := s.GetXRXDs(code)
+		if err != nil {
+			return nil, err
+		}
+		adj := data.Adjust(ks, xs, data.AdjustQFQ)
+		var eqs []*protocol.Equity
+		if weight == WeightCap {
+			if eqs, err = s.GetEquities(code); err != nil {
+				return nil, err
+			}
+		}
+		for i := 1; i < len(ks); i++ {
+			prev := adj[i-1].Close.Float64()
+			if prev <= 0 {
+				continue
+			}
+			w := 1.
+			if weight == WeightCap {
+				w = ks[i-1].Close.Float64() * shares(eqs, ks[i-1].Time)
+			}
+			if w <= 0 {
+				continue
+			}
+			k := adj[i]
+			day := k.Time.Format(time.DateOnly)
+			days[day] = append(days[day], bar{
+				time:   k.Time,
+				open:   k.Open.Float64()/prev - 1,
+				high:   k.High.Float64()/prev - 1,
+				low:    k.Low.Float64()/prev - 1,
+				close:  k.Close.Float64()/prev - 1,
+				weight: w,
+				volume: k.Volume,
+				amount: k.Amount,
+			})
+		}
+	}
+	if len(days) == 0 {
+		return nil, fmt.Errorf("板块[%s]在区间内没有数据", name)
+	}
+
+	keys := make([]string, 0, len(days))
+	for k := range days {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make(protocol.Klines, 0, len(keys))
+	last := float64(IndexBase)
+	for _, key := range keys {
+		k := &protocol.Kline{Last: protocol.Yuan(last)}
+		var sum, o, h, l, c float64
+		for _, v := range days[key] {
+			sum += v.weight
+			o += v.open * v.weight
+			h += v.high * v.weight
+			l += v.low * v.weight
+			c += v.close * v.weight
+			k.Volume += v.volume
+			k.Amount += v.amount
+			k.Time = v.time
+		}
+		open, close := last*(1+o/sum), last*(1+c/sum)
+		high := math.Max(last*(1+h/sum), math.Max(open, close))
+		low := math.Min(last*(1+l/sum), math.Min(open, close))
+		k.Open, k.High, k.Low, k.Close = protocol.Yuan(open), protocol.Yuan(high), protocol.Yuan(low), protocol.Yuan(close)
+		out = append(out, k)
+		last = close
+	}
+	return out, nil
+}
+
+// shares t时的流通股本,没有流通股本时用总股本
+func shares(eqs []*protocol.Equity, t time.Time) float64 {
+	var out float64
+	for _, v := range eqs {
+		if v.Time.After(t) {
+			break
+		}
+		out = v.Float
+		if out <= 0 {
+			out = v.Total
+		}
+	}
+	return out
+}
+
+// SectorPrefix 基准里板块指数的前缀,例sector:银行,sector:银行:cap
+const SectorPrefix = "sector:"
+
+// Benchmark 读取基准的日线,code为指数、ETF或股票代码,sector:名称[:加权方式]表示板块指数
+func Benchmark(s data.Source, code string, start, end time.Time) (protocol.Klines, error) {
+	if !strings.HasPrefix(code, SectorPrefix) {
+		return s.GetDayKlines(code, start, end)
+	}
+	name, weight, _ := strings.Cut(strings.TrimPrefix(code, SectorPrefix), ":")
+	return Index(s, name, weight, start, end)
+}
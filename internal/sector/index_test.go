@@ -0,0 +1,184 @@
+package sector
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/injoyai/goutil/database/sqlite"
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+)
+
+func testDB(t *testing.T) {
+	t.Helper()
+	db, err := sqlite.NewXorm(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	common.DB = db
+	if err = Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testDay(day int) time.Time {
+	return time.Date(2024, 1, day, 15, 0, 0, 0, time.Local)
+}
+
+// indexSource 每只股票按天给出收盘价,开高低收相同
+type indexSource struct {
+	data.Source
+	closes   map[string]map[int]float64
+	equities map[string][]*protocol.Equity
+}
+
+func (this *indexSource) GetDayKlines(code string, start, end time.Time) (protocol.Klines, error) {
+	ks := protocol.Klines{}
+	for day := 1; day <= 31; day++ {
+		c, ok := this.closes[code][day]
+		if t := testDay(day); !ok || !t.After(start) || !t.Before(end) {
+			continue
+		}
+		p := protocol.Yuan(c)
+		ks = append(ks, &protocol.Kline{Time: testDay(day), Open: p, High: p, Low: p, Close: p, Volume: 100, Amount: protocol.Yuan(1000)})
+	}
+	return ks, nil
+}
+
+func (this *indexSource) GetXRXDs(code string) (protocol.XRXDs, error) { return nil, nil }
+
+func (this *indexSource) GetEquities(code string) ([]*protocol.Equity, error) {
+	return this.equities[code], nil
+}
+
+func testIndexSource(t *testing.T) *indexSource {
+	testDB(t)
+	err := Replace([]*Member{
+		{Sector: "银行", Type: TypeIndustry, Code: "sz000001"},
+		{Sector: "银行", Type: TypeIndustry, Code: "sh600000"},
+		{Sector: "银行", Type: TypeIndustry, Code: "sh600001"}, //没有数据
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &indexSource{
+		closes: map[string]map[int]float64{
+			"sz000001": {2: 10, 3: 11, 4: 11},
+			"sh600000": {2: 20, 3: 18, 4: 18.9},
+		},
+		equities: map[string][]*protocol.Equity{
+			"sz000001": {{Time: testDay(1), Float: 100}},
+			//流通股本为0时按总股本
+			"sh600000": {{Time: testDay(1), Total: 900}},
+		},
+	}
+}
+
+func TestIndex(t *testing.T) {
+	s := testIndexSource(t)
+	start, end := testDay(1), testDay(10)
+
+	//3日 +10%和-10%, 4日 0%和+5%
+	capDay3 := (0.1*10*100 - 0.1*20*900) / (10*100 + 20*900)
+	capDay4 := 0.05 * 18 * 900 / (11*100 + 18*900)
+	cases := []struct {
+		weight string
+		want   []float64
+	}{
+		{"", []float64{1000, 1025}},
+		{WeightEqual, []float64{1000, 1025}},
+		{WeightCap, []float64{1000 * (1 + capDay3), 1000 * (1 + capDay3) * (1 + capDay4)}},
+	}
+	for _, v := range cases {
+		ks, err := Index(s, "银行", v.weight, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ks) != len(v.want) {
+			t.Fatalf("%q: K线数量%d,期望%d", v.weight, len(ks), len(v.want))
+		}
+		last := float64(IndexBase)
+		for i, k := range ks {
+			if !k.Time.Equal(testDay(i + 3)) {
+				t.Errorf("%q: 第%d根的时间%v", v.weight, i, k.Time)
+			}
+			if math.Abs(k.Close.Float64()-v.want[i]) > 0.01 {
+				t.Errorf("%q: 第%d根的收盘%v,期望%v", v.weight, i, k.Close.Float64(), v.want[i])
+			}
+			if math.Abs(k.Last.Float64()-last) > 0.01 {
+				t.Errorf("%q: 第%d根的昨收%v,期望%v", v.weight, i, k.Last.Float64(), last)
+			}
+			if k.Volume != 200 || k.Amount != protocol.Yuan(2000) {
+				t.Errorf("%q: 成交量%d,成交额%v", v.weight, k.Volume, k.Amount)
+			}
+			last = k.Close.Float64()
+		}
+	}
+
+	//流通市值加权时跌幅更接近大市值的股票
+	eq, _ := Index(s, "银行", WeightEqual, start, end)
+	cp, _ := Index(s, "银行", WeightCap, start, end)
+	if cp[0].Close >= eq[0].Close {
+		t.Fatalf("市值加权%v,等权%v", cp[0].Close, eq[0].Close)
+	}
+}
+
+func TestIndexSuspended(t *testing.T) {
+	s := testIndexSource(t)
+	//停牌的3日不参与计算,4日相对2日计算
+	s.closes["sh600000"] = map[int]float64{2: 20, 4: 22}
+	ks, err := Index(s, "银行", WeightEqual, testDay(1), testDay(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{1100, 1100 * 1.05}
+	if len(ks) != 2 || math.Abs(ks[0].Close.Float64()-want[0]) > 0.01 || math.Abs(ks[1].Close.Float64()-want[1]) > 0.01 {
+		t.Fatalf("指数%v,期望%v", ks, want)
+	}
+}
+
+func TestIndexErr(t *testing.T) {
+	s := testIndexSource(t)
+	if _, err := Index(s, "不存在", "", testDay(1), testDay(10)); err == nil {
+		t.Fatal("不存在的板块应该返回错误")
+	}
+	if _, err := Index(s, "银行", "float", testDay(1), testDay(10)); err == nil {
+		t.Fatal("不支持的加权方式应该返回错误")
+	}
+	if _, err := Index(s, "银行", "", testDay(20), testDay(30)); err == nil {
+		t.Fatal("区间内没有数据应该返回错误")
+	}
+}
+
+func TestShares(t *testing.T) {
+	eqs := []*protocol.Equity{
+		{Time: testDay(2), Float: 100, Total: 300},
+		{Time: testDay(5), Total: 400},
+		{Time: testDay(8), Float: 200, Total: 400},
+	}
+	for day, want := range map[int]float64{1: 0, 2: 100, 4: 100, 5: 400, 8: 200, 9: 200} {
+		if got := shares(eqs, testDay(day)); got != want {
+			t.Errorf("%d日的股本%v,期望%v", day, got, want)
+		}
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	s := testIndexSource(t)
+	ks, err := Benchmark(s, "sz000001", testDay(1), testDay(10))
+	if err != nil || len(ks) != 3 || ks[0].Close != protocol.Yuan(10) {
+		t.Fatalf("股票基准%v, %v", ks, err)
+	}
+	ks, err = Benchmark(s, SectorPrefix+"银行", testDay(1), testDay(10))
+	if err != nil || len(ks) != 2 || math.Abs(ks[1].Close.Float64()-1025) > 0.01 {
+		t.Fatalf("等权板块基准%v, %v", ks, err)
+	}
+	cp, err := Benchmark(s, SectorPrefix+"银行:"+WeightCap, testDay(1), testDay(10))
+	if err != nil || len(cp) != 2 || cp[0].Close == ks[0].Close {
+		t.Fatalf("市值加权板块基准%v, %v", cp, err)
+	}
+}
@@ -0,0 +1,294 @@
+package sector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"xorm.io/xorm"
+)
+
+// 板块类型
+const (
+	TypeIndustry = "industry" //行业
+	TypeConcept  = "concept"  //概念
+	TypeStyle    = "style"    //风格
+	TypeIndex    = "index"    //指数成分
+)
+
+// Member 板块成分股
+type Member struct {
+	ID      int64     `xorm:"pk autoincr" json:"id"`
+	Sector  string    `xorm:"index" json:"sector"`
+	Type    string    `xorm:"index" json:"type"`
+	Code    string    `xorm:"index" json:"code"`
+	Created time.Time `xorm:"created" json:"created"`
+}
+
+// Sector 板块和成分股数量
+type Sector struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	File    string `json:"file"`
+	Sectors int    `json:"sectors"`
+	Members int    `json:"members"`
+}
+
+// Sync 同步板块相关的数据表
+func Sync() error {
+	return common.DB.Sync2(new(Member))
+}
+
+// List 板块列表,typ为空时返回全部类型
+func List(typ string) ([]*Sector, error) {
+	session := common.DB.Table(new(Member)).Select("Sector AS Name, Type, COUNT(*) AS Count")
+	if typ != "" {
+		session.Where("Type=?", typ)
+	}
+	out := []*Sector{}
+	err := session.GroupBy("Sector, Type").Asc("Type", "Sector").Find(&out)
+	return out, err
+}
+
+// Members 板块的成分股代码
+func Members(name string) ([]string, error) {
+	out := []string{}
+	err := common.DB.Table(new(Member)).Where("Sector=?", name).Asc("Code").Cols("Code").Find(&out)
+	return out, err
+}
+
+// Of 代码所属的板块
+func Of(code string) ([]*Member, error) {
+	out := []*Member{}
+	err := common.DB.Where("Code=?", protocol.AddPrefix(code)).Asc("Type", "Sector").Find(&out)
+	return out, err
+}
+
+// Del 删除板块
+func Del(name string) error {
+	_, err := common.DB.Where("Sector=?", name).Delete(new(Member))
+	return err
+}
+
+// Replace 按板块替换成分股,ls里出现的板块会先删除原来的成分股
+func Replace(ls []*Member) error {
+	return common.DB.SessionFunc(func(session *xorm.Session) error {
+		deleted := map[[2]string]bool{}
+		for _, v := range ls {
+			key := [2]string{v.Type, v.Sector}
+			if deleted[key] {
+				continue
+			}
+			deleted[key] = true
+			if _, err := session.Where("Type=? AND Sector=?", v.Type, v.Sector).Delete(new(Member)); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < len(ls); i += 500 {
+			if _, err := session.Insert(ls[i:min(i+500, len(ls))]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+/*
+Import 按文件名导入板块,files为文件名对应的内容
+
+block_gn.dat/block_fg.dat/block_zs.dat: 通达信的概念、风格、指数板块
+tdxhy.cfg: 通达信的行业,需要同时上传incon.dat提供行业名称
+.csv: 列为板块,类型,代码,类型为空时按概念处理
+*/
+func Import(files map[string]io.Reader) ([]*ImportResult, error) {
+	var incon io.Reader
+	for name, r := range files {
+		if strings.EqualFold(filepath.Base(name), "incon.dat") {
+			incon = r
+		}
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := []*ImportResult(nil)
+	for _, name := range names {
+		base := strings.ToLower(filepath.Base(name))
+		var ls []*Member
+		var err error
+		switch {
+		case base == "incon.dat":
+			continue
+		case base == "tdxhy.cfg":
+			if incon == nil {
+				return nil, errors.New("导入tdxhy.cfg需要同时导入incon.dat")
+			}
+			ls, err = DecodeIndustry(files[name], incon)
+		case strings.HasSuffix(base, ".dat"):
+			ls, err = DecodeBlock(files[name], blockType(base))
+		case strings.HasSuffix(base, ".csv"):
+			ls, err = DecodeCsv(files[name])
+		default:
+			return nil, fmt.Errorf("不支持的板块文件: %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if err = Replace(ls); err != nil {
+			return nil, err
+		}
+		res := &ImportResult{File: name, Members: len(ls)}
+		sectors := map[string]bool{}
+		for _, v := range ls {
+			sectors[v.Sector] = true
+		}
+		res.Sectors = len(sectors)
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+// blockType 通达信板块文件对应的类型,block_gn概念,block_fg风格,block_zs指数
+func blockType(name string) string {
+	switch {
+	case strings.Contains(name, "_fg"):
+		return TypeStyle
+	case strings.Contains(name, "_zs"):
+		return TypeIndex
+	default:
+		return TypeConcept
+	}
+}
+
+const (
+	blockHeader = 384 //文件头
+	blockName   = 9   //板块名称,GBK
+	blockCodes  = 400 //每个板块固定400个代码的位置
+	blockCode   = 7   //6位代码加结尾的0
+)
+
+// DecodeBlock 解析通达信的block_*.dat
+func DecodeBlock(r io.Reader, typ string) ([]*Member, error) {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) < blockHeader+2 {
+		return nil, errors.New("板块文件长度错误")
+	}
+	n := int(binary.LittleEndian.Uint16(bs[blockHeader:]))
+	size := blockName + 4 + blockCodes*blockCode
+	bs = bs[blockHeader+2:]
+	if len(bs) < n*size {
+		return nil, errors.New("板块文件长度错误")
+	}
+	out := []*Member(nil)
+	for i := 0; i < n; i++ {
+		b := bs[i*size : (i+1)*size]
+		name := strings.TrimSpace(string(protocol.UTF8ToGBK(trimZero(b[:blockName]))))
+		count := int(binary.LittleEndian.Uint16(b[blockName:]))
+		codes := b[blockName+4:]
+		for j := 0; j < count && j < blockCodes; j++ {
+			code := protocol.AddPrefix(string(trimZero(codes[j*blockCode : (j+1)*blockCode])))
+			if name != "" && len(code) == 8 {
+				out = append(out, &Member{Sector: name, Type: typ, Code: code})
+			}
+		}
+	}
+	return out, nil
+}
+
+func trimZero(bs []byte) []byte {
+	for i, b := range bs {
+		if b == 0 {
+			return bs[:i]
+		}
+	}
+	return bs
+}
+
+// DecodeIndustry 解析通达信的tdxhy.cfg,行业名称来自incon.dat的#TDXNHY部分,按一级行业归类
+func DecodeIndustry(hy, incon io.Reader) ([]*Member, error) {
+	names := map[string]string{}
+	{
+		scanner := bufio.NewScanner(incon)
+		section := ""
+		for scanner.Scan() {
+			line := strings.TrimSpace(string(protocol.UTF8ToGBK(scanner.Bytes())))
+			switch {
+			case strings.HasPrefix(line, "######"):
+				section = ""
+			case strings.HasPrefix(line, "#"):
+				section = line
+			case section == "#TDXNHY":
+				if ls := strings.SplitN(line, "|", 2); len(ls) == 2 {
+					names[ls[0]] = ls[1]
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("incon.dat里没有通达信行业")
+	}
+
+	out := []*Member(nil)
+	scanner := bufio.NewScanner(hy)
+	for scanner.Scan() {
+		//市场|代码|行业代码|...,市场0深圳1上海2北京
+		ls := strings.Split(strings.TrimSpace(scanner.Text()), "|")
+		if len(ls) < 3 || len(ls[1]) != 6 || len(ls[2]) < 3 {
+			continue
+		}
+		ex := map[string]string{"0": "sz", "1": "sh", "2": "bj"}[ls[0]]
+		name := names[ls[2][:3]]
+		if ex == "" || name == "" {
+			continue
+		}
+		out = append(out, &Member{Sector: name, Type: TypeIndustry, Code: ex + ls[1]})
+	}
+	return out, scanner.Err()
+}
+
+// DecodeCsv 解析csv,第一行是表头,列为板块,类型,代码
+func DecodeCsv(r io.Reader) ([]*Member, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	out := []*Member(nil)
+	for i, row := range rows {
+		if i == 0 || len(row) < 3 {
+			continue
+		}
+		name, typ, code := strings.TrimSpace(row[0]), strings.TrimSpace(row[1]), strings.ToLower(strings.TrimSpace(row[2]))
+		if name == "" || code == "" {
+			continue
+		}
+		if typ == "" {
+			typ = TypeConcept
+		}
+		out = append(out, &Member{Sector: name, Type: typ, Code: protocol.AddPrefix(code)})
+	}
+	return out, nil
+}
@@ -0,0 +1,248 @@
+package strategy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/injoyai/conv"
+	"github.com/injoyai/trategy/internal/common"
+	"xorm.io/xorm"
+)
+
+const BundleFormat = 1
+
+// Export 导出策略,names为空时导出全部,名称可以是脚本策略或组合策略
+func Export(names ...string) (*Bundle, error) {
+	b := &Bundle{
+		Format:   BundleFormat,
+		Exported: time.Now(),
+	}
+
+	ss := []*Strategy(nil)
+	cs := []*Composite(nil)
+	if len(names) == 0 {
+		if err := common.DB.Find(&ss); err != nil {
+			return nil, err
+		}
+		if err := common.DB.Find(&cs); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := common.DB.In("Name", names).Find(&ss); err != nil {
+			return nil, err
+		}
+		if err := common.DB.In("Name", names).Find(&cs); err != nil {
+			return nil, err
+		}
+		if len(ss)+len(cs) < len(names) {
+			found := map[string]bool{}
+			for _, v := range ss {
+				found[v.Name] = true
+			}
+			for _, v := range cs {
+				found[v.Name] = true
+			}
+			for _, name := range names {
+				if !found[name] {
+					return nil, fmt.Errorf("策略[%s]不存在", name)
+				}
+			}
+		}
+	}
+
+	for _, s := range ss {
+		versions, err := GetVersions(s.Name)
+		if err != nil {
+			return nil, err
+		}
+		cases, err := GetCases(s.Name)
+		if err != nil {
+			return nil, err
+		}
+		b.Strategies = append(b.Strategies, &BundleItem{
+			Strategy: s,
+			Versions: versions,
+			Cases:    cases,
+		})
+	}
+	b.Composites = cs
+	return b, nil
+}
+
+// existKind 名称已经被使用的类型,script脚本策略,composite组合策略,builtin内置策略,未使用为空
+func existKind(name string) (string, error) {
+	has, err := common.DB.Where("Name=?", name).Exist(&Strategy{})
+	if err != nil || has {
+		return "script", err
+	}
+	has, err = common.DB.Where("Name=?", name).Exist(&Composite{})
+	if err != nil || has {
+		return "composite", err
+	}
+	if IsFile(name) {
+		return "file", nil
+	}
+	switch i := Get(name).(type) {
+	case nil:
+		return "", nil
+	case *Combine:
+		return "composite", nil
+	default:
+		if IsScript(i) {
+			return "file", nil
+		}
+		return "builtin", nil
+	}
+}
+
+// Import 导入策略,脚本会重新编译,启用的脚本需要通过测试用例
+// 名称冲突时,overwrite为false则返回全部冲突的名称,overwrite为true时只能覆盖同类型的策略
+func Import(b *Bundle, overwrite bool) error {
+	if b == nil {
+		return fmt.Errorf("导入内容为空")
+	}
+	if b.Format != BundleFormat {
+		return fmt.Errorf("不支持的格式版本: %d", b.Format)
+	}
+
+	names := make([]string, 0, len(b.Strategies)+len(b.Composites))
+	for _, v := range b.Strategies {
+		if v.Strategy == nil || v.Strategy.Name == "" {
+			return fmt.Errorf("策略名称不能为空")
+		}
+		names = append(names, v.Strategy.Name)
+	}
+	for _, v := range b.Composites {
+		names = append(names, v.Name)
+	}
+
+	//脚本和组合策略不能同名,内置策略不能覆盖,覆盖导入时也要检查
+	kinds := map[string]string{}
+	for _, v := range b.Strategies {
+		kinds[v.Strategy.Name] = "script"
+	}
+	for _, v := range b.Composites {
+		if kinds[v.Name] != "" {
+			return fmt.Errorf("策略名称[%s]重复", v.Name)
+		}
+		kinds[v.Name] = "composite"
+	}
+	conflicts := []string(nil)
+	for _, name := range names {
+		kind, err := existKind(name)
+		if err != nil {
+			return err
+		}
+		if kind != "" && (!overwrite || kind != kinds[name]) {
+			conflicts = append(conflicts, name)
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("策略名称冲突: %s", strings.Join(conflicts, ","))
+	}
+
+	//先编译,有错误则不导入
+	compiled := map[string]Interface{}
+	for _, v := range b.Strategies {
+		s := v.Strategy
+		s.Package = s.Name + conv.String(time.Now().UnixNano())
+		i, err := Compile(s)
+		if err != nil {
+			return fmt.Errorf("策略[%s]编译失败: %v", s.Name, err)
+		}
+		compiled[s.Name] = i
+	}
+	//校验组合策略,成员可以是导入的脚本和组合策略
+	for _, v := range b.Composites {
+		compiled[v.Name] = NewCombine(v)
+	}
+	get := func(name string) Interface {
+		if i, ok := compiled[name]; ok {
+			return i
+		}
+		return Get(name)
+	}
+	for _, v := range b.Composites {
+		if err := NewCombine(v).checkWith(get); err != nil {
+			return err
+		}
+	}
+
+	err := common.DB.SessionFunc(func(session *xorm.Session) error {
+		for _, v := range b.Strategies {
+			name := v.Strategy.Name
+			if _, err := session.Where("Name=?", name).Delete(&Strategy{}); err != nil {
+				return err
+			}
+			if _, err := session.Where("Name=?", name).Delete(&Version{}); err != nil {
+				return err
+			}
+			if _, err := session.Where("Strategy=?", name).Delete(&Case{}); err != nil {
+				return err
+			}
+			if _, err := session.Insert(v.Strategy); err != nil {
+				return err
+			}
+			for _, ver := range v.Versions {
+				ver.ID = 0
+				ver.Name = name
+				if _, err := session.Insert(ver); err != nil {
+					return err
+				}
+			}
+			//包名重新生成了,记录当前脚本的版本,注册时按包名查找
+			if _, err := session.Insert(&Version{Name: name, Package: v.Strategy.Package, Script: v.Strategy.Script}); err != nil {
+				return err
+			}
+			for _, c := range v.Cases {
+				c.ID = 0
+				c.Strategy = name
+				if _, err := session.Insert(c); err != nil {
+					return err
+				}
+			}
+		}
+		for _, v := range b.Composites {
+			if _, err := session.Where("Name=?", v.Name).Delete(&Composite{}); err != nil {
+				return err
+			}
+			if _, err := session.Insert(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	//注册启用的脚本,测试不通过的脚本改为不启用
+	errs := []string(nil)
+	for _, v := range b.Strategies {
+		s := v.Strategy
+		if !s.Enable {
+			Del(s.Name)
+			continue
+		}
+		err := CheckCases(s)
+		if err == nil {
+			err = RegisterScript(s)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			Del(s.Name)
+			_, err = common.DB.Where("Name=?", s.Name).Cols("Enable").Update(&Strategy{Enable: false})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, v := range b.Composites {
+		Register(NewCombine(v))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("导入成功,以下策略未启用: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
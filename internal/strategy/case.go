@@ -0,0 +1,134 @@
+package strategy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+)
+
+// GetCases 获取策略的全部测试用例
+func GetCases(name string) ([]*Case, error) {
+	data := []*Case(nil)
+	err := common.DB.Where("Strategy=?", name).Asc("ID").Find(&data)
+	return data, err
+}
+
+// TestCases 编译脚本并执行该策略的全部测试用例,编译失败返回错误
+func TestCases(s *Strategy) ([]*CaseResult, error) {
+	cases, err := GetCases(s.Name)
+	if err != nil {
+		return nil, err
+	}
+	//使用新的解释器编译,避免和已注册的脚本冲突,测试完即释放
+	tmp := *s
+	tmp.Package = packageName(s.Name)
+	i, err := compile(common.NewScript(), &tmp)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*CaseResult, len(cases))
+	for n, c := range cases {
+		out[n] = RunCase(i, c)
+	}
+	return out, nil
+}
+
+// CheckCases 执行测试用例,有失败的用例则返回错误,用于启用前的校验
+func CheckCases(s *Strategy) error {
+	results, err := TestCases(s)
+	if err != nil {
+		return err
+	}
+	failed := []string(nil)
+	for _, v := range results {
+		if !v.Pass {
+			failed = append(failed, v.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("策略[%s]测试未通过: %s", s.Name, strings.Join(failed, ","))
+	}
+	return nil
+}
+
+// RunCase 执行单个测试用例
+func RunCase(i Interface, c *Case) *CaseResult {
+	result := &CaseResult{ID: c.ID, Name: c.Name}
+	fail := func(format string, a ...any) {
+		result.Errors = append(result.Errors, fmt.Sprintf(format, a...))
+	}
+
+	ks, err := c.klines()
+	if err != nil {
+		fail("%v", err)
+		return result
+	}
+
+	sigs, err := signals(i, ks)
+	if err != nil {
+		fail("%v", err)
+		return result
+	}
+	if len(sigs) != len(ks) {
+		fail("信号数量(%d)和K线数量(%d)不一致", len(sigs), len(ks))
+		return result
+	}
+
+	for _, e := range c.Expects {
+		if e.Index < 0 || e.Index >= len(sigs) {
+			fail("期望的索引(%d)超出范围[0,%d)", e.Index, len(sigs))
+			continue
+		}
+		if sigs[e.Index] != e.Signal {
+			fail("第%d根K线期望信号%d,实际%d", e.Index, e.Signal, sigs[e.Index])
+		}
+	}
+
+	for n := 0; n < c.NoSignalBefore && n < len(sigs); n++ {
+		if sigs[n] != 0 {
+			fail("第%d根K线之前不应有信号,第%d根K线信号为%d", c.NoSignalBefore, n, sigs[n])
+			break
+		}
+	}
+
+	result.Pass = len(result.Errors) == 0
+	return result
+}
+
+func (this *Case) klines() (protocol.Klines, error) {
+	if len(this.Klines) > 0 {
+		return this.Klines, nil
+	}
+	if this.Code == "" {
+		return nil, fmt.Errorf("用例[%s]未设置K线或股票代码", this.Name)
+	}
+	start := time.Date(1990, 1, 1, 0, 0, 0, 0, time.Local)
+	end := time.Now()
+	var err error
+	if this.Start != "" {
+		start, err = time.Parse(time.DateOnly, this.Start)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if this.End != "" {
+		end, err = time.Parse(time.DateOnly, this.End)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return common.Data.GetDayKlines(this.Code, start, end)
+}
+
+// signals 执行策略,脚本中的panic转成错误
+func signals(i Interface, ks protocol.Klines) (sigs []int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("策略执行异常: %v", e)
+		}
+	}()
+	return i.Signals(ks), nil
+}
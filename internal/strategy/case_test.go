@@ -0,0 +1,79 @@
+package strategy
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/injoyai/goutil/database/sqlite"
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+)
+
+func testDB(t *testing.T) {
+	t.Helper()
+	db, err := sqlite.NewXorm(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err = db.Sync2(new(Strategy), new(Case), new(Version), new(Composite)); err != nil {
+		t.Fatal(err)
+	}
+	common.DB = db
+}
+
+func TestTestCases(t *testing.T) {
+	testDB(t)
+	common.Script = nil //测试用例不使用共享的解释器
+	ks := protocol.Klines{{Close: protocol.Yuan(10)}, {Close: protocol.Yuan(11)}}
+	if _, err := common.DB.Insert(&Case{Strategy: "涨", Name: "上涨", Klines: ks, Expects: []Expect{{Index: 1, Signal: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	s := &Strategy{Name: "涨", Script: `
+import "github.com/injoyai/tdx/protocol"
+
+func Signals(ks protocol.Klines) []int {
+	out := make([]int, len(ks))
+	for i := 1; i < len(ks); i++ {
+		if ks[i].Close > ks[i-1].Close {
+			out[i] = 1
+		}
+	}
+	return out
+}`}
+	//相同的包名多次编译不冲突
+	for n := 0; n < 2; n++ {
+		results, err := TestCases(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || !results[0].Pass {
+			t.Fatalf("测试结果有误: %+v", results[0])
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	testDB(t)
+	for _, v := range []any{&Strategy{Name: "a"}, &Case{Strategy: "a"}, &Version{Name: "a"}, &Case{Strategy: "b"}} {
+		if _, err := common.DB.Insert(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Register(NewScript("a", func(ks protocol.Klines) []int { return nil }))
+	if err := Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if Get("a") != nil {
+		t.Fatal("删除后没有取消注册")
+	}
+	for _, v := range []any{new(Strategy), new(Case), new(Version)} {
+		n, err := common.DB.Count(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := v.(*Case); (ok && n != 1) || (!ok && n != 0) {
+			t.Fatalf("%T剩余%d条", v, n)
+		}
+	}
+}
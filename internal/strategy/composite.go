@@ -0,0 +1,210 @@
+package strategy
+
+import (
+	"fmt"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+var (
+	_ Interface     = (*Combine)(nil)
+	_ Fundamentaler = (*Combine)(nil)
+)
+
+const (
+	CompositeAll    = "all"    //全部持有才持有
+	CompositeAny    = "any"    //任一持有就持有
+	CompositeVote   = "vote"   //多数持有才持有
+	CompositeEntry  = "entry"  //第一个策略的买入信号入场,第二个策略的卖出信号离场
+	CompositeFilter = "filter" //第一个策略的信号,仅在第二个策略持有期间入场
+)
+
+func NewCombine(c *Composite) *Combine {
+	return &Combine{name: c.Name, mode: c.Mode, members: c.Members}
+}
+
+// Combine 组合策略,按名称引用已注册的策略,在执行时解析
+type Combine struct {
+	name    string
+	mode    string
+	members []string
+}
+
+func (this *Combine) Name() string {
+	return this.name
+}
+
+// Check 校验组合方式和成员策略,成员不存在或者循环引用则返回错误
+func (this *Combine) Check() error {
+	return this.checkWith(Get)
+}
+
+// checkWith 按get查找成员策略校验,导入时成员可能还没有注册
+func (this *Combine) checkWith(get func(name string) Interface) error {
+	switch this.mode {
+	case CompositeAll, CompositeAny, CompositeVote:
+		if len(this.members) == 0 {
+			return fmt.Errorf("组合策略[%s]没有成员", this.name)
+		}
+	case CompositeEntry, CompositeFilter:
+		if len(this.members) != 2 {
+			return fmt.Errorf("组合方式[%s]需要2个成员", this.mode)
+		}
+	default:
+		return fmt.Errorf("未知的组合方式: %s", this.mode)
+	}
+	return this.check(map[string]bool{}, get)
+}
+
+func (this *Combine) check(visited map[string]bool, get func(name string) Interface) error {
+	if visited[this.name] {
+		return fmt.Errorf("组合策略[%s]存在循环引用", this.name)
+	}
+	visited[this.name] = true
+	defer delete(visited, this.name)
+	for _, name := range this.members {
+		if name == this.name {
+			return fmt.Errorf("组合策略[%s]存在循环引用", this.name)
+		}
+		i := get(name)
+		if i == nil {
+			return fmt.Errorf("策略[%s]不存在", name)
+		}
+		if c, ok := i.(*Combine); ok {
+			if err := c.check(visited, get); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (this *Combine) Signals(ks protocol.Klines) []int {
+	return this.signals(ks, nil)
+}
+
+// SignalsFundamental 需要基本面数据的成员使用f,其他成员按Signals执行
+func (this *Combine) SignalsFundamental(ks protocol.Klines, f map[string][]float64) []int {
+	return this.signals(ks, f)
+}
+
+// needFundamental 是否有成员需要基本面数据
+func (this *Combine) needFundamental(visited map[string]bool) bool {
+	if visited[this.name] {
+		return false
+	}
+	visited[this.name] = true
+	for _, name := range this.members {
+		switch i := Get(name).(type) {
+		case *Combine:
+			if i.needFundamental(visited) {
+				return true
+			}
+		case Fundamentaler:
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Combine) signals(ks protocol.Klines, f map[string][]float64) []int {
+	out := make([]int, len(ks))
+	sigs := make([][]int, 0, len(this.members))
+	for _, name := range this.members {
+		i := Get(name)
+		if i == nil {
+			//成员被删除了,不产生信号
+			return out
+		}
+		var sig []int
+		if fs, ok := i.(Fundamentaler); ok && f != nil {
+			sig = fs.SignalsFundamental(ks, f)
+		} else {
+			sig = i.Signals(ks)
+		}
+		if len(sig) != len(ks) {
+			//成员返回的信号数量不对,不产生信号
+			return out
+		}
+		sigs = append(sigs, sig)
+	}
+
+	switch this.mode {
+	case CompositeAll, CompositeAny, CompositeVote:
+		states := make([][]int, len(sigs))
+		for n := range sigs {
+			states[n] = toState(sigs[n])
+		}
+		state := make([]int, len(ks))
+		for i := range ks {
+			var long int
+			for n := range states {
+				if states[n][i] == 1 {
+					long++
+				}
+			}
+			switch {
+			case this.mode == CompositeAll && long == len(states),
+				this.mode == CompositeAny && long > 0,
+				this.mode == CompositeVote && long*2 > len(states):
+				state[i] = 1
+			default:
+				state[i] = -1
+			}
+		}
+		return toSignal(state)
+
+	case CompositeEntry:
+		var hold bool
+		for i := range ks {
+			if !hold && sigs[0][i] == 1 {
+				out[i] = 1
+				hold = true
+			} else if hold && sigs[1][i] == -1 {
+				out[i] = -1
+				hold = false
+			}
+		}
+
+	case CompositeFilter:
+		regime := toState(sigs[1])
+		var hold bool
+		for i := range ks {
+			if !hold && sigs[0][i] == 1 && regime[i] == 1 {
+				out[i] = 1
+				hold = true
+			} else if hold && (sigs[0][i] == -1 || regime[i] != 1) {
+				out[i] = -1
+				hold = false
+			}
+		}
+
+	}
+	return out
+}
+
+// toState 把信号转成每根K线的持有状态,1持有,-1空仓,0尚未出现信号
+func toState(sigs []int) []int {
+	out := make([]int, len(sigs))
+	var last int
+	for i, v := range sigs {
+		if v != 0 {
+			last = v
+		}
+		out[i] = last
+	}
+	return out
+}
+
+// toSignal 把持有状态转成信号,仅在状态变化时产生信号
+func toSignal(state []int) []int {
+	out := make([]int, len(state))
+	prev := -1
+	for i, v := range state {
+		if v != prev {
+			out[i] = v
+			prev = v
+		}
+	}
+	return out
+}
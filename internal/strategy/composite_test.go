@@ -0,0 +1,159 @@
+package strategy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+)
+
+func testKlines(n int) protocol.Klines {
+	out := make(protocol.Klines, n)
+	t := time.Date(2024, 1, 1, 15, 0, 0, 0, time.Local)
+	for i := range out {
+		out[i] = &protocol.Kline{Time: t.AddDate(0, 0, i), Close: protocol.Yuan(10)}
+	}
+	return out
+}
+
+// fixed 每根K线返回固定的信号
+func fixed(name string, sigs ...int) *Script {
+	return NewScript(name, func(ks protocol.Klines) []int { return sigs })
+}
+
+func TestCombineFundamental(t *testing.T) {
+	//pe低于10时买入,没有基本面数据时pe全为0,不产生信号
+	Register(NewFundamentalScript("_test_pe", func(ks protocol.Klines, f map[string][]float64) []int {
+		out := make([]int, len(ks))
+		for i, v := range f["pe"] {
+			if v > 0 && v < 10 {
+				out[i] = 1
+			}
+		}
+		return out
+	}))
+	Register(fixed("_test_long", 1, 0, 0))
+	c := NewCombine(&Composite{Name: "_test_combine", Mode: CompositeAll, Members: []string{"_test_long", "_test_pe"}})
+	Register(c)
+	outer := NewCombine(&Composite{Name: "_test_outer", Mode: CompositeAny, Members: []string{"_test_combine"}})
+	defer func() {
+		for _, name := range []string{"_test_pe", "_test_long", "_test_combine", "_test_outer"} {
+			Del(name)
+		}
+	}()
+
+	if !NeedFundamental(outer) {
+		t.Fatal("成员需要基本面数据,期望NeedFundamental为true")
+	}
+	if NeedFundamental(NewCombine(&Composite{Name: "_test_plain", Members: []string{"_test_long"}})) {
+		t.Fatal("成员不需要基本面数据,期望NeedFundamental为false")
+	}
+
+	ks := testKlines(3)
+	if got := outer.Signals(ks); got[0] != 0 {
+		t.Fatalf("没有基本面数据时期望不买入,得到%v", got)
+	}
+	got := outer.SignalsFundamental(ks, map[string][]float64{"pe": {8, 8, 8}})
+	if got[0] != 1 {
+		t.Fatalf("基本面数据需要传给成员,得到%v", got)
+	}
+}
+
+func TestCombineShortSignals(t *testing.T) {
+	Register(fixed("_test_long", 1, 0, 0))
+	Register(fixed("_test_short", 1))
+	defer Del("_test_long")
+	defer Del("_test_short")
+
+	ks := testKlines(3)
+	for _, mode := range []string{CompositeAll, CompositeAny, CompositeVote, CompositeEntry, CompositeFilter} {
+		c := NewCombine(&Composite{Name: "_test_combine", Mode: mode, Members: []string{"_test_long", "_test_short"}})
+		got := c.Signals(ks)
+		if len(got) != len(ks) {
+			t.Fatalf("%s: 信号数量%d,期望%d", mode, len(got), len(ks))
+		}
+		for _, v := range got {
+			if v != 0 {
+				t.Fatalf("%s: 成员信号数量不对时期望不产生信号,得到%v", mode, got)
+			}
+		}
+	}
+}
+
+func TestCombineModes(t *testing.T) {
+	members := map[string][]int{
+		"_test_a": {1, 0, 0, -1, 0, 0}, //持有[0,3)
+		"_test_b": {0, 1, 0, 0, -1, 0}, //持有[1,4)
+		"_test_c": {0, 0, 1, 0, 0, -1}, //持有[2,5)
+		"_test_d": {1, 0, 0, 0, 0, 0},  //一直持有
+		"_test_e": {0, 1, 0, -1, 0, 0}, //持有[1,3)
+		"_test_f": {-1, 0, 0, 0, -1, 0},
+	}
+	for name, sigs := range members {
+		Register(fixed(name, sigs...))
+		defer Del(name)
+	}
+
+	cases := []struct {
+		name    string
+		mode    string
+		members []string
+		want    []int
+	}{
+		{"all", CompositeAll, []string{"_test_a", "_test_b"}, []int{0, 1, 0, -1, 0, 0}},
+		{"all一个成员", CompositeAll, []string{"_test_a"}, []int{1, 0, 0, -1, 0, 0}},
+		{"any", CompositeAny, []string{"_test_a", "_test_b"}, []int{1, 0, 0, 0, -1, 0}},
+		{"vote三个成员,两个持有即可", CompositeVote, []string{"_test_a", "_test_b", "_test_c"}, []int{0, 1, 0, 0, -1, 0}},
+		{"vote平票不持有", CompositeVote, []string{"_test_a", "_test_b", "_test_c", "_test_d"}, []int{0, 1, 0, 0, -1, 0}},
+		{"vote两个成员需要都持有", CompositeVote, []string{"_test_a", "_test_d"}, []int{1, 0, 0, -1, 0, 0}},
+		{"entry", CompositeEntry, []string{"_test_a", "_test_b"}, []int{1, 0, 0, 0, -1, 0}},
+		{"entry忽略入场前的离场信号", CompositeEntry, []string{"_test_c", "_test_f"}, []int{0, 0, 1, 0, -1, 0}},
+		{"entry忽略第一个成员的卖出", CompositeEntry, []string{"_test_e", "_test_c"}, []int{0, 1, 0, 0, 0, -1}},
+		{"filter", CompositeFilter, []string{"_test_c", "_test_b"}, []int{0, 0, 1, 0, -1, 0}},
+		{"filter不在持有期间不入场", CompositeFilter, []string{"_test_a", "_test_b"}, []int{0, 0, 0, 0, 0, 0}},
+		{"filter按自身信号离场", CompositeFilter, []string{"_test_e", "_test_d"}, []int{0, 1, 0, -1, 0, 0}},
+	}
+	ks := testKlines(6)
+	for _, c := range cases {
+		comp := NewCombine(&Composite{Name: "_test_combine", Mode: c.mode, Members: c.members})
+		if err := comp.Check(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		got := comp.Signals(ks)
+		for i := range c.want {
+			if got[i] != c.want[i] {
+				t.Errorf("%s: 得到%v,期望%v", c.name, got, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestCombineMissingMember(t *testing.T) {
+	Register(fixed("_test_a", 1, 0, 0))
+	Register(fixed("_test_b", 1, 0, 0))
+	defer Del("_test_a")
+	c := NewCombine(&Composite{Name: "_test_combine", Mode: CompositeAny, Members: []string{"_test_a", "_test_b"}})
+	Register(c)
+	defer Del("_test_combine")
+
+	ks := testKlines(3)
+	if got := Get("_test_combine").Signals(ks); got[0] != 1 {
+		t.Fatalf("期望买入,得到%v", got)
+	}
+	//执行时成员已经被删除,不产生信号
+	Del("_test_b")
+	if err := c.Check(); err == nil {
+		t.Fatal("成员不存在时期望校验失败")
+	}
+	got := Get("_test_combine").Signals(ks)
+	if len(got) != len(ks) || got[0] != 0 {
+		t.Fatalf("成员不存在时期望不产生信号,得到%v", got)
+	}
+	//重新注册后恢复
+	Register(fixed("_test_b", 1, 0, 0))
+	defer Del("_test_b")
+	if got = c.Signals(ks); got[0] != 1 {
+		t.Fatalf("成员重新注册后期望买入,得到%v", got)
+	}
+}
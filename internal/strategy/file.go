@@ -0,0 +1,258 @@
+package strategy
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/injoyai/logs"
+	"github.com/injoyai/trategy/internal/common"
+)
+
+var (
+	files   = map[string]*File{}
+	filesMu sync.RWMutex
+)
+
+// File 策略目录下的脚本文件,文件名即策略名称
+type File struct {
+	Name     string    //策略名称
+	Filename string    //文件路径
+	ModTime  time.Time //文件修改时间
+	Loaded   time.Time //最后加载时间
+	Err      string    //编译或测试错误,为空表示已注册
+	//是否注册过,重新加载失败时保留之前注册的版本
+	registered bool
+}
+
+// Files 获取策略目录下的脚本文件状态
+func Files() []*File {
+	filesMu.RLock()
+	defer filesMu.RUnlock()
+	out := make([]*File, 0, len(files))
+	for _, v := range files {
+		f := *v
+		out = append(out, &f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// IsFile 策略目录下是否有这个名称的文件,包括加载失败的
+func IsFile(name string) bool {
+	filesMu.RLock()
+	defer filesMu.RUnlock()
+	return files[name] != nil
+}
+
+/*
+WatchDir 加载目录下定义了Signals的.go文件,监听文件变化重新加载
+监听失败时(例如部分网络文件系统)改为每interval按修改时间轮询
+*/
+func WatchDir(dir string, interval time.Duration) {
+	watchDir(dir, interval, nil)
+}
+
+// watchDir stop关闭时退出,为nil时一直运行
+func watchDir(dir string, interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		interval = time.Second * 2
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		logs.Err(err)
+		return
+	}
+	scanDir(dir)
+
+	w, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = w.Add(dir); err != nil {
+			w.Close()
+		}
+	}
+	if err != nil {
+		logs.Errf("监听策略目录[%s]失败,改为轮询: %v\n", dir, err)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+				scanDir(dir)
+			}
+		}
+	}
+	defer w.Close()
+
+	//保存一个文件可能触发多个事件,合并后再扫描
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case e, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if strings.HasSuffix(e.Name, ".go") {
+				reload = time.After(watchDelay)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			logs.Err(err)
+		case <-reload:
+			reload = nil
+			scanDir(dir)
+		}
+	}
+}
+
+// watchDelay 文件变化后等待合并事件的时间
+const watchDelay = 200 * time.Millisecond
+
+func scanDir(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logs.Err(err)
+		return
+	}
+
+	exist := map[string]bool{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") || strings.HasSuffix(e.Name(), "_test.go") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ".go")
+		exist[name] = true
+
+		filesMu.RLock()
+		old := files[name]
+		filesMu.RUnlock()
+		if old != nil && old.ModTime.Equal(info.ModTime()) {
+			continue
+		}
+
+		f := &File{
+			Name:     name,
+			Filename: filepath.Join(dir, e.Name()),
+			ModTime:  info.ModTime(),
+			Loaded:   time.Now(),
+		}
+		if err := loadFile(f); err != nil {
+			f.Err = err.Error()
+			f.registered = old != nil && old.registered
+			logs.Errf("加载策略文件[%s]失败: %v\n", f.Filename, err)
+		} else {
+			f.registered = true
+			logs.Infof("加载策略文件[%s]成功\n", f.Filename)
+		}
+		filesMu.Lock()
+		files[name] = f
+		filesMu.Unlock()
+	}
+
+	//文件被删除,注销对应的策略
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	for name, f := range files {
+		if !exist[name] {
+			if f.registered {
+				Del(name)
+			}
+			delete(files, name)
+		}
+	}
+}
+
+// loadFile 编译文件并注册,每次加载使用新的解释器,替换后旧的解释器可以被回收
+func loadFile(f *File) error {
+	s, err := ParseFile(f.Name, f.Filename)
+	if err != nil {
+		return err
+	}
+
+	has, err := common.DB.Where("Name=?", f.Name).Exist(&Strategy{})
+	if err != nil {
+		return err
+	}
+	if has {
+		return fmt.Errorf("策略名称[%s]和已保存的策略冲突", f.Name)
+	}
+	has, err = common.DB.Where("Name=?", f.Name).Exist(&Composite{})
+	if err != nil {
+		return err
+	}
+	if has {
+		return fmt.Errorf("策略名称[%s]和组合策略冲突", f.Name)
+	}
+	//同名的文件重新加载时覆盖,内置策略不能覆盖
+	if i := Get(f.Name); i != nil && !IsScript(i) {
+		return fmt.Errorf("策略名称[%s]和内置策略冲突", f.Name)
+	}
+
+	if err = CheckCases(s); err != nil {
+		return err
+	}
+	return registerScript(common.NewScript(), s)
+}
+
+// ParseFile 读取策略文件,不编译
+func ParseFile(name, filename string) (*Strategy, error) {
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, filename, bs, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	if !hasSignals(node) {
+		return nil, fmt.Errorf("未定义函数Signals")
+	}
+
+	//去掉原有的package声明,使用策略名称作为包名
+	return &Strategy{
+		Name:    name,
+		Script:  string(bs[fset.Position(node.Name.End()).Offset:]),
+		Enable:  true,
+		Package: packageName(name),
+	}, nil
+}
+
+func hasSignals(node *ast.File) bool {
+	for _, decl := range node.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "Signals" {
+			return true
+		}
+	}
+	return false
+}
+
+// packageName 把策略名称转成合法的包名
+func packageName(name string) string {
+	out := []rune(nil)
+	for i, r := range name {
+		if unicode.IsLetter(r) || r == '_' || (i > 0 && unicode.IsDigit(r)) {
+			out = append(out, r)
+		} else {
+			out = append(out, '_')
+		}
+	}
+	return string(out)
+}
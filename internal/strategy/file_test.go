@@ -0,0 +1,117 @@
+package strategy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+)
+
+// fileScript 每根K线都返回signal的策略文件
+func fileScript(signal string) string {
+	return `package a
+
+import "github.com/injoyai/tdx/protocol"
+
+func Signals(ks protocol.Klines) []int {
+	out := make([]int, len(ks))
+	for i := range out {
+		out[i] = ` + signal + `
+	}
+	return out
+}
+`
+}
+
+// waitFor 等待cond成立,超时失败
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchDir(t *testing.T) {
+	testDB(t)
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "watch_a.go")
+	if err := os.WriteFile(filename, []byte(fileScript("1")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchDir(dir, time.Hour, stop)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	ks := protocol.Klines{{}, {}}
+	signal := func() int {
+		if i := Get("watch_a"); i != nil {
+			return i.Signals(ks)[1]
+		}
+		return 0
+	}
+	waitFor(t, "启动时没有加载策略文件", func() bool { return signal() == 1 })
+	if !IsFile("watch_a") {
+		t.Fatal("加载后应该是文件策略")
+	}
+
+	//修改后通过文件事件重新加载,不等待轮询
+	if err := os.WriteFile(filename, []byte(fileScript("-1")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	os.Chtimes(filename, later, later)
+	waitFor(t, "修改后没有重新加载", func() bool { return signal() == -1 })
+
+	//编译失败时保留之前的版本
+	os.WriteFile(filename, []byte("package a\nfunc Signals( {"), 0o644)
+	later = later.Add(time.Second)
+	os.Chtimes(filename, later, later)
+	waitFor(t, "编译失败没有记录错误", func() bool {
+		fs := Files()
+		return len(fs) == 1 && fs[0].Err != ""
+	})
+	if signal() != -1 {
+		t.Fatal("编译失败后应该保留之前的版本")
+	}
+
+	//删除后注销
+	os.Remove(filename)
+	waitFor(t, "删除后没有注销", func() bool { return Get("watch_a") == nil && !IsFile("watch_a") })
+}
+
+func TestLoadFileConflict(t *testing.T) {
+	testDB(t)
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "conflict_a.go")
+	os.WriteFile(filename, []byte(fileScript("1")), 0o644)
+	if _, err := common.DB.Insert(&Strategy{Name: "conflict_a"}); err != nil {
+		t.Fatal(err)
+	}
+	scanDir(dir)
+	defer func() {
+		os.Remove(filename)
+		scanDir(dir)
+	}()
+	fs := Files()
+	if len(fs) != 1 || fs[0].Err == "" || Get("conflict_a") != nil {
+		t.Fatalf("和已保存的策略同名时不应该加载: %+v", fs)
+	}
+	//目录下有同名文件时,创建数据库策略需要拒绝
+	if !IsFile("conflict_a") {
+		t.Fatal("加载失败的文件也应该占用名称")
+	}
+}
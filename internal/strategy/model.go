@@ -1,6 +1,11 @@
 package strategy
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+)
 
 type Strategy struct {
 	Name    string `xorm:"pk"`
@@ -13,6 +18,15 @@ func (this *Strategy) Content() string {
 	return fmt.Sprintf("package %s\n%s", this.Package, this.Script)
 }
 
+// Version 策略脚本的历史版本,每次保存脚本时记录
+type Version struct {
+	ID      int64     `xorm:"pk autoincr"`
+	Name    string    `xorm:"index"` //策略名称
+	Package string    //包名
+	Script  string    //脚本
+	Created time.Time `xorm:"created"`
+}
+
 type CreateReq struct {
 	Name   string
 	Script string
@@ -23,3 +37,56 @@ type EnableReq struct {
 	Name   string
 	Enable bool
 }
+
+// Composite 组合策略的定义,Mode见CompositeAll等
+type Composite struct {
+	Name    string   `xorm:"pk"`
+	Mode    string   //组合方式
+	Members []string `xorm:"json"` //成员策略名称
+}
+
+// Case 策略测试用例,K线可以内联,也可以引用已存储的股票数据
+type Case struct {
+	ID             int64           `xorm:"pk autoincr"`
+	Strategy       string          `xorm:"index"` //策略名称
+	Name           string          //用例名称
+	Klines         protocol.Klines `xorm:"json"` //内联K线,优先使用
+	Code           string          //股票代码,未内联K线时使用
+	Start          string          //开始日期,例2024-01-02
+	End            string          //结束日期
+	Expects        []Expect        `xorm:"json"` //期望信号
+	NoSignalBefore int             //第N根K线之前不能有信号
+}
+
+// Expect 期望在第Index根K线上出现的信号
+type Expect struct {
+	Index  int
+	Signal int
+}
+
+// CaseResult 测试用例的执行结果
+type CaseResult struct {
+	ID     int64
+	Name   string
+	Pass   bool
+	Errors []string
+}
+
+type CaseTestReq struct {
+	Name   string //策略名称
+	Script string //脚本,为空时使用已保存的脚本
+}
+
+// Bundle 策略导出包,用于在不同实例之间迁移策略
+type Bundle struct {
+	Format     int           //格式版本
+	Exported   time.Time     //导出时间
+	Strategies []*BundleItem //脚本策略
+	Composites []*Composite  //组合策略
+}
+
+type BundleItem struct {
+	Strategy *Strategy
+	Versions []*Version
+	Cases    []*Case
+}
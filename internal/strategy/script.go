@@ -2,25 +2,65 @@ package strategy
 
 import (
 	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/debug"
+	"github.com/injoyai/trategy/internal/fundamental"
 )
 
 var (
-	_ Interface = (*Script)(nil)
+	_ Interface     = (*Script)(nil)
+	_ Debugger      = (*Script)(nil)
+	_ Fundamentaler = (*FundamentalScript)(nil)
 )
 
 func NewScript(name string, handler SignalsFunc) *Script {
+	return &Script{name: name, handler: func(ks protocol.Klines, d *debug.Debug) []int {
+		return handler(ks)
+	}}
+}
+
+func NewDebugScript(name string, handler DebugSignalsFunc) *Script {
 	return &Script{name: name, handler: handler}
 }
 
 type Script struct {
 	name    string
-	handler SignalsFunc
+	version int64 //注册时的版本ID,策略文件没有版本为0
+	handler DebugSignalsFunc
 }
 
 func (this *Script) Name() string {
 	return this.name
 }
 
+// Version 注册时的版本ID
+func (this *Script) Version() int64 {
+	return this.version
+}
+
 func (this *Script) Signals(ks protocol.Klines) []int {
-	return this.handler(ks)
+	//调试输出为nil时,脚本的调用会被忽略
+	return this.handler(ks, nil)
+}
+
+func (this *Script) SignalsDebug(ks protocol.Klines, d *debug.Debug) []int {
+	return this.handler(ks, d)
+}
+
+// NewFundamentalScript 使用基本面数据的脚本策略,没有基本面数据时传入全为0的序列
+func NewFundamentalScript(name string, handler FundamentalSignalsFunc) *FundamentalScript {
+	return &FundamentalScript{
+		Script: NewScript(name, func(ks protocol.Klines) []int {
+			return handler(ks, fundamental.Empty(len(ks)))
+		}),
+		handler: handler,
+	}
+}
+
+type FundamentalScript struct {
+	*Script
+	handler FundamentalSignalsFunc
+}
+
+func (this *FundamentalScript) SignalsFundamental(ks protocol.Klines, f map[string][]float64) []int {
+	return this.handler(ks, f)
 }
@@ -2,9 +2,14 @@ package strategy
 
 import (
 	"errors"
+	"sync"
 
+	"github.com/injoyai/logs"
 	"github.com/injoyai/tdx/protocol"
 	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/debug"
+	"github.com/traefik/yaegi/interp"
+	"xorm.io/xorm"
 )
 
 type Interface interface {
@@ -12,34 +17,144 @@ type Interface interface {
 	Signals(ks protocol.Klines) []int
 }
 
-var strategies = map[string]Interface{}
+var (
+	strategies   = map[string]Interface{}
+	strategiesMu sync.RWMutex
+)
+
+// Sync 同步策略相关的数据表
+func Sync() error {
+	return common.DB.Sync2(new(Strategy), new(Case), new(Composite), new(Version))
+}
+
+// Load 注册已启用的脚本策略和保存的组合策略,编译失败的脚本只记录日志
+func Load() error {
+	scripts := []*Strategy(nil)
+	if err := common.DB.Where("Enable=?", true).Find(&scripts); err != nil {
+		return err
+	}
+	for _, v := range scripts {
+		if err := RegisterScript(v); err != nil {
+			logs.Errf("加载策略[%s]失败: %v\n", v.Name, err)
+		}
+	}
+	//组合策略在执行时才解析成员,这里直接注册
+	composites := []*Composite(nil)
+	if err := common.DB.Find(&composites); err != nil {
+		return err
+	}
+	for _, v := range composites {
+		Register(NewCombine(v))
+	}
+	return nil
+}
 
 func Register(s Interface) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
 	strategies[s.Name()] = s
 }
 
+// RegisterScript 编译并注册脚本策略,记录对应的版本ID
 func RegisterScript(s *Strategy) error {
-	res, err := common.Script.Eval(s.Content())
+	return registerScript(common.Script, s)
+}
+
+// registerScript 在指定的解释器中编译并注册
+func registerScript(script *interp.Interpreter, s *Strategy) error {
+	i, err := compile(script, s)
 	if err != nil {
 		return err
 	}
-	f, ok := res.Interface().(SignalsFunc)
-	if !ok {
-		return errors.New("脚本函数有误")
+	v := new(Version)
+	has, err := common.DB.Where("Name=? AND Package=?", s.Name, s.Package).Desc("ID").Get(v)
+	if err != nil {
+		return err
 	}
-	Register(NewScript(s.Name, f))
+	if has {
+		switch x := i.(type) {
+		case *Script:
+			x.version = v.ID
+		case *FundamentalScript:
+			x.version = v.ID
+		}
+	}
+	Register(i)
 	return nil
 }
 
+// RegisterComposite 校验并注册组合策略
+func RegisterComposite(c *Composite) error {
+	i := NewCombine(c)
+	if err := i.Check(); err != nil {
+		return err
+	}
+	Register(i)
+	return nil
+}
+
+// Compile 编译脚本策略,不注册
+func Compile(s *Strategy) (Interface, error) {
+	return compile(common.Script, s)
+}
+
+// compile 在指定的解释器中编译脚本
+func compile(script *interp.Interpreter, s *Strategy) (Interface, error) {
+	_, err := script.Eval(s.Content())
+	if err != nil {
+		return nil, err
+	}
+	//按包名获取函数,脚本里Signals不一定是最后声明的
+	res, err := script.Eval(s.Package + ".Signals")
+	if err != nil {
+		return nil, err
+	}
+	switch f := res.Interface().(type) {
+	case SignalsFunc:
+		return NewScript(s.Name, f), nil
+	case DebugSignalsFunc:
+		return NewDebugScript(s.Name, f), nil
+	case FundamentalSignalsFunc:
+		return NewFundamentalScript(s.Name, f), nil
+	default:
+		return nil, errors.New("脚本函数有误")
+	}
+}
+
 func Get(name string) Interface {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
 	return strategies[name]
 }
 
 func Del(name string) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
 	delete(strategies, name)
 }
 
+// Delete 删除脚本策略和它的测试用例、历史版本,并取消注册
+func Delete(name string) error {
+	err := common.DB.SessionFunc(func(session *xorm.Session) error {
+		if _, err := session.Where("Name=?", name).Delete(new(Strategy)); err != nil {
+			return err
+		}
+		if _, err := session.Where("Strategy=?", name).Delete(new(Case)); err != nil {
+			return err
+		}
+		_, err := session.Where("Name=?", name).Delete(new(Version))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	Del(name)
+	return nil
+}
+
 func Registry() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
 	out := make([]string, 0, len(strategies))
 	for k := range strategies {
 		out = append(out, k)
@@ -47,8 +162,54 @@ func Registry() []string {
 	return out
 }
 
+// IsScript 是否是脚本策略,内置策略和组合策略返回false
+func IsScript(i Interface) bool {
+	switch i.(type) {
+	case *Script, *FundamentalScript:
+		return true
+	}
+	return false
+}
+
 type SignalsFunc = func(ks protocol.Klines) []int
 
+// DebugSignalsFunc 带调试输出的脚本函数,可以记录日志和调试序列
+type DebugSignalsFunc = func(ks protocol.Klines, d *debug.Debug) []int
+
+// Debugger 支持调试输出的策略
+type Debugger interface {
+	Interface
+	SignalsDebug(ks protocol.Klines, d *debug.Debug) []int
+}
+
+// FundamentalSignalsFunc 使用基本面数据的脚本函数,f的key为pe,pb,ps,roe,eps,cap,float_cap,和K线一一对应
+type FundamentalSignalsFunc = func(ks protocol.Klines, f map[string][]float64) []int
+
+// Fundamentaler 需要基本面数据的策略
+type Fundamentaler interface {
+	Interface
+	SignalsFundamental(ks protocol.Klines, f map[string][]float64) []int
+}
+
+// VersionOf 策略的版本ID,内置策略、组合策略和策略文件为0
+func VersionOf(i Interface) int64 {
+	if v, ok := i.(interface{ Version() int64 }); ok {
+		return v.Version()
+	}
+	return 0
+}
+
+// NeedFundamental 策略执行时是否需要基本面数据,组合策略按成员判断
+func NeedFundamental(i Interface) bool {
+	switch v := i.(type) {
+	case *Combine:
+		return v.needFundamental(map[string]bool{})
+	case Fundamentaler:
+		return true
+	}
+	return false
+}
+
 const (
 	DefaultScript = `
 import (
@@ -0,0 +1,22 @@
+package strategy
+
+import (
+	"github.com/injoyai/trategy/internal/common"
+)
+
+// AddVersion 记录脚本的历史版本
+func AddVersion(s *Strategy) error {
+	_, err := common.DB.Insert(&Version{
+		Name:    s.Name,
+		Package: s.Package,
+		Script:  s.Script,
+	})
+	return err
+}
+
+// GetVersions 获取策略的历史版本,按时间顺序
+func GetVersions(name string) ([]*Version, error) {
+	data := []*Version(nil)
+	err := common.DB.Where("Name=?", name).Asc("ID").Find(&data)
+	return data, err
+}
@@ -0,0 +1,192 @@
+package tick
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/injoyai/conv/cfg"
+	"github.com/injoyai/goutil/g"
+	"github.com/injoyai/logs"
+	"github.com/injoyai/tdx"
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/robfig/cron/v3"
+)
+
+// quoteBatch 每次请求行情的最大代码数量
+const quoteBatch = 80
+
+// FetchResult 补采结果
+type FetchResult struct {
+	Days   int      `json:"days"`
+	Ticks  int      `json:"ticks"`
+	Errors []string `json:"errors"`
+}
+
+// client 采集需要连接通达信服务器,离线数据源不支持
+func client(s data.Source) (*data.Data, error) {
+	if c, ok := s.(*data.Cache); ok {
+		s = c.Unwrap()
+	}
+	d, ok := s.(*data.Data)
+	if !ok {
+		return nil, errors.New("当前数据源不支持采集")
+	}
+	return d, nil
+}
+
+// FetchTicks 获取一天的分笔成交并保存,当天的从实时接口获取,之前的从历史接口获取
+func FetchTicks(s data.Source, code string, date time.Time) (int, error) {
+	d, err := client(s)
+	if err != nil {
+		return 0, err
+	}
+	code = protocol.AddPrefix(code)
+	today := date.Format("20060102") == time.Now().Format("20060102")
+	var resp *protocol.TradeResp
+	err = g.Retry(func() error {
+		return d.Do(func(c *tdx.Client) (err error) {
+			if today {
+				resp, err = c.GetMinuteTradeAll(code)
+			} else {
+				resp, err = c.GetHistoryMinuteTradeDay(date.Format("20060102"), code)
+			}
+			return
+		})
+	}, d.Retry)
+	if err != nil {
+		return 0, err
+	}
+	return SaveTicks(code, date, resp.List)
+}
+
+// FetchRange 按交易日采集区间内的分笔成交,已有的数据会被替换,单天失败记录错误后继续
+func FetchRange(ctx context.Context, s data.Source, codes []string, start, end time.Time, progress func(done, total int)) (*FetchResult, error) {
+	days := common.Calendar.Days(start, end)
+	total := len(days) * len(codes)
+	res := &FetchResult{Errors: []string{}}
+	done := 0
+	for _, code := range codes {
+		for _, day := range days {
+			if err := ctx.Err(); err != nil {
+				return res, err
+			}
+			n, err := FetchTicks(s, code, day)
+			if err != nil {
+				res.Errors = append(res.Errors, fmt.Sprintf("%s %s: %v", code, day.Format(time.DateOnly), err))
+			} else {
+				res.Days++
+				res.Ticks += n
+			}
+			done++
+			if progress != nil {
+				progress(done, total)
+			}
+		}
+	}
+	return res, nil
+}
+
+// CaptureQuotes 采集一次五档行情快照并保存
+func CaptureQuotes(s data.Source, codes []string) (int, error) {
+	d, err := client(s)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().Truncate(time.Second)
+	ls := []*Snapshot(nil)
+	for i := 0; i < len(codes); i += quoteBatch {
+		batch := append([]string(nil), codes[i:min(i+quoteBatch, len(codes))]...)
+		var quotes protocol.QuotesResp
+		err = d.Do(func(c *tdx.Client) (err error) {
+			quotes, err = c.GetQuote(batch...)
+			return
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, q := range quotes {
+			ls = append(ls, snapshot(q, now))
+		}
+	}
+	return len(ls), SaveSnapshots(ls)
+}
+
+func snapshot(q *protocol.Quote, t time.Time) *Snapshot {
+	s := &Snapshot{
+		Code:    q.Exchange.String() + q.Code,
+		Time:    t,
+		Last:    q.K.Last,
+		Open:    q.K.Open,
+		High:    q.K.High,
+		Low:     q.K.Low,
+		Close:   q.K.Close,
+		Volume:  q.TotalHand,
+		Amount:  q.Amount,
+		Inside:  q.InsideDish,
+		Outside: q.OuterDisc,
+		Bid:     make([]Level, len(q.BuyLevel)),
+		Ask:     make([]Level, len(q.SellLevel)),
+	}
+	for i, v := range q.BuyLevel {
+		s.Bid[i] = Level{Price: v.Price, Volume: v.Number}
+	}
+	for i, v := range q.SellLevel {
+		s.Ask[i] = Level{Price: v.Price, Volume: v.Number}
+	}
+	return s
+}
+
+/*
+Start 配置了tick.enable时开始采集采集列表里的代码
+交易时段内每隔tick.interval(默认3秒)采集一次五档快照,每个交易日收盘后采集当天的分笔成交
+*/
+func Start() error {
+	if !cfg.GetBool("tick.enable") {
+		return nil
+	}
+	if _, err := client(common.Data); err != nil {
+		return err
+	}
+	go func() {
+		t := time.NewTicker(cfg.GetSecond("tick.interval", 3))
+		defer t.Stop()
+		for now := range t.C {
+			if !common.Calendar.IsOpen(now) {
+				continue
+			}
+			codes, err := Watches()
+			if err != nil || len(codes) == 0 {
+				logs.PrintErr(err)
+				continue
+			}
+			_, err = CaptureQuotes(common.Data, codes)
+			logs.PrintErr(err)
+		}
+	}()
+	cr := cron.New(cron.WithSeconds())
+	_, err := cr.AddFunc("0 5 15 * * *", func() {
+		now := time.Now()
+		if !common.Calendar.IsTradingDay(now) {
+			return
+		}
+		codes, err := Watches()
+		if err != nil {
+			logs.Err(err)
+			return
+		}
+		for _, code := range codes {
+			if _, err := FetchTicks(common.Data, code, now); err != nil {
+				logs.Errf("采集[%s]分笔成交失败: %v\n", code, err)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	cr.Start()
+	return nil
+}
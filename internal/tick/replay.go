@@ -0,0 +1,33 @@
+package tick
+
+import (
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/data"
+)
+
+/*
+Replay 把采集的分笔成交合成1分钟K线,每个有成交的交易日241根(含9:30集合竞价)
+没有成交的分钟按上一根的收盘价补齐,成交量为0
+*/
+func Replay(code string, start, end time.Time) (protocol.Klines, error) {
+	ls, err := Ticks(code, start, end)
+	if err != nil {
+		return nil, err
+	}
+	ts := make(protocol.Trades, len(ls))
+	for i, v := range ls {
+		ts[i] = &protocol.Trade{Time: v.Time, Price: v.Price, Volume: v.Volume, Status: v.Status, Number: v.Number}
+	}
+	return ts.Klines(), nil
+}
+
+// ReplayImport 合成1分钟K线并写入数据源的分钟线,已存在的分钟跳过,回测和分钟线导出可以直接使用
+func ReplayImport(s data.Source, code string, start, end time.Time) (*data.ImportResult, error) {
+	ks, err := Replay(code, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return data.ImportKlines(s, data.MinKline, code, ks)
+}
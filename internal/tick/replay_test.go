@@ -0,0 +1,142 @@
+package tick
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/injoyai/goutil/database/sqlite"
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+)
+
+func testTickDB(t *testing.T) {
+	t.Helper()
+	db, err := sqlite.NewXorm(filepath.Join(t.TempDir(), "tick.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	common.Tick = db
+	if err = Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func at(day, hour, minute int) time.Time {
+	return time.Date(2024, 1, day, hour, minute, 0, 0, time.Local)
+}
+
+func trade(t time.Time, price float64, volume int) *protocol.Trade {
+	return &protocol.Trade{Time: t, Price: protocol.Yuan(price), Volume: volume}
+}
+
+// saveTestTicks 2日全天有成交,3日只有10:00有成交,4日没有成交
+func saveTestTicks(t *testing.T) {
+	t.Helper()
+	days := map[int]protocol.Trades{
+		2: {
+			trade(at(2, 9, 25), 10, 5), //集合竞价
+			trade(at(2, 9, 31), 10.1, 3),
+			trade(at(2, 9, 31), 10.2, 2),
+			trade(at(2, 9, 33), 9.9, 1),
+			trade(at(2, 11, 29), 10, 1),
+			trade(at(2, 13, 0), 10.3, 1),
+			trade(at(2, 14, 59), 10.4, 1),
+			trade(at(2, 15, 0), 10.5, 1),
+		},
+		3: {trade(at(3, 10, 0), 11, 1)},
+	}
+	for day, ts := range days {
+		if _, err := SaveTicks("000001", at(day, 0, 0), ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	testTickDB(t)
+	saveTestTicks(t)
+
+	ks, err := Replay("sz000001", at(1, 0, 0), at(5, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//没有成交的4日没有K线
+	if len(ks) != 241*2 {
+		t.Fatalf("K线数量%d,期望%d", len(ks), 241*2)
+	}
+	bars := map[time.Time]*protocol.Kline{}
+	for _, k := range ks {
+		bars[k.Time] = k
+	}
+	cases := []struct {
+		name                   string
+		time                   time.Time
+		open, high, low, close float64
+		volume                 int64
+	}{
+		{"集合竞价", at(2, 9, 30), 10, 10, 10, 10, 5},
+		{"没有成交补齐", at(2, 9, 31), 10, 10, 10, 10, 0},
+		{"同一分钟多笔", at(2, 9, 32), 10.1, 10.2, 10.1, 10.2, 5},
+		{"补齐上一根收盘", at(2, 9, 33), 10.2, 10.2, 10.2, 10.2, 0},
+		{"下跌", at(2, 9, 34), 9.9, 9.9, 9.9, 9.9, 1},
+		{"上午最后一根", at(2, 11, 30), 10, 10, 10, 10, 1},
+		{"下午第一根", at(2, 13, 1), 10.3, 10.3, 10.3, 10.3, 1},
+		{"收盘", at(2, 15, 0), 10.4, 10.5, 10.4, 10.5, 2},
+		{"开盘前按当天第一笔补齐", at(3, 9, 30), 11, 11, 11, 11, 0},
+		{"当天唯一一笔", at(3, 10, 1), 11, 11, 11, 11, 1},
+		{"之后补齐", at(3, 15, 0), 11, 11, 11, 11, 0},
+	}
+	for _, v := range cases {
+		k, ok := bars[v.time]
+		if !ok {
+			t.Errorf("%s: 没有%s的K线", v.name, v.time.Format(time.DateTime))
+			continue
+		}
+		if k.Open != protocol.Yuan(v.open) || k.High != protocol.Yuan(v.high) || k.Low != protocol.Yuan(v.low) ||
+			k.Close != protocol.Yuan(v.close) || k.Volume != v.volume {
+			t.Errorf("%s: 得到%v", v.name, k)
+		}
+	}
+	//午休没有K线
+	for _, tm := range []time.Time{at(2, 11, 31), at(2, 12, 0), at(2, 13, 0)} {
+		if _, ok := bars[tm]; ok {
+			t.Errorf("午休不应该有%s的K线", tm.Format(time.TimeOnly))
+		}
+	}
+
+	//只回放区间内的分笔
+	if ks, err = Replay("sz000001", at(3, 0, 0), at(3, 23, 0)); err != nil || len(ks) != 241 {
+		t.Fatalf("3日的K线数量%d, %v", len(ks), err)
+	}
+	if ks, err = Replay("sz000001", at(4, 0, 0), at(4, 23, 0)); err != nil || len(ks) != 0 {
+		t.Fatalf("没有分笔时K线数量%d, %v", len(ks), err)
+	}
+}
+
+func TestReplayImport(t *testing.T) {
+	testTickDB(t)
+	saveTestTicks(t)
+	s, err := data.NewOffline(t.TempDir(), data.OfflineSqlite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ReplayImport(s, "sz000001", at(1, 0, 0), at(5, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Type != data.MinKline || res.Inserted != 241*2 {
+		t.Fatalf("导入结果%+v", res)
+	}
+	ks, err := s.GetMinKlines("sz000001", at(1, 0, 0), at(5, 0, 0))
+	if err != nil || len(ks) != 241*2 || ks[0].Close != protocol.Yuan(10) {
+		t.Fatalf("分钟线%d, %v", len(ks), err)
+	}
+
+	//重复回放时已存在的分钟跳过
+	if res, err = ReplayImport(s, "sz000001", at(1, 0, 0), at(5, 0, 0)); err != nil || res.Inserted != 0 || res.Duplicate != 241*2 {
+		t.Fatalf("重复导入结果%+v, %v", res, err)
+	}
+}
@@ -0,0 +1,155 @@
+package tick
+
+import (
+	"sort"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/common"
+	"xorm.io/xorm"
+)
+
+// Tick 分笔成交,通达信的时间只到分钟,同一分钟内按Seq排序
+type Tick struct {
+	ID     int64          `xorm:"pk autoincr" json:"id"`
+	Code   string         `xorm:"index(code_time)" json:"code"`
+	Time   time.Time      `xorm:"index(code_time)" json:"time"`
+	Seq    int            `json:"seq"`    //当天的序号,从0开始
+	Price  protocol.Price `json:"price"`  //成交价
+	Volume int            `json:"volume"` //成交量,手
+	Status int            `json:"status"` //0买入,1卖出,2中性
+	Number int            `json:"number"` //单数,历史数据没有
+}
+
+// Level 一档盘口
+type Level struct {
+	Price  protocol.Price `json:"price"`
+	Volume int            `json:"volume"` //挂单量,手
+}
+
+// Snapshot 五档行情快照
+type Snapshot struct {
+	ID      int64          `xorm:"pk autoincr" json:"id"`
+	Code    string         `xorm:"index(code_time)" json:"code"`
+	Time    time.Time      `xorm:"index(code_time)" json:"time"` //采集时间
+	Last    protocol.Price `json:"last"`                         //昨收
+	Open    protocol.Price `json:"open"`
+	High    protocol.Price `json:"high"`
+	Low     protocol.Price `json:"low"`
+	Close   protocol.Price `json:"close"`           //最新价
+	Volume  int            `json:"volume"`          //总手
+	Amount  float64        `json:"amount"`          //成交额,元
+	Inside  int            `json:"inside"`          //内盘
+	Outside int            `json:"outside"`         //外盘
+	Bid     []Level        `xorm:"json" json:"bid"` //买1-5
+	Ask     []Level        `xorm:"json" json:"ask"` //卖1-5
+}
+
+// Watch 需要采集的代码
+type Watch struct {
+	Code    string    `xorm:"pk" json:"code"`
+	Created time.Time `xorm:"created" json:"created"`
+}
+
+// Sync 同步分笔和快照的数据表
+func Sync() error {
+	return common.Tick.Sync2(new(Tick), new(Snapshot), new(Watch))
+}
+
+// Watches 采集列表
+func Watches() ([]string, error) {
+	out := []string{}
+	err := common.Tick.Table(new(Watch)).Asc("Code").Cols("Code").Find(&out)
+	return out, err
+}
+
+// AddWatch 添加到采集列表,已存在的跳过
+func AddWatch(codes ...string) error {
+	return common.Tick.SessionFunc(func(session *xorm.Session) error {
+		for _, code := range codes {
+			code = protocol.AddPrefix(code)
+			has, err := session.Where("Code=?", code).Exist(new(Watch))
+			if err != nil {
+				return err
+			}
+			if has {
+				continue
+			}
+			if _, err = session.Insert(&Watch{Code: code}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DelWatch 从采集列表删除,已采集的数据保留
+func DelWatch(codes ...string) error {
+	for i := range codes {
+		codes[i] = protocol.AddPrefix(codes[i])
+	}
+	_, err := common.Tick.In("Code", codes).Delete(new(Watch))
+	return err
+}
+
+// Ticks 区间内的分笔成交,按时间和序号升序,闭区间
+func Ticks(code string, start, end time.Time) ([]*Tick, error) {
+	out := []*Tick{}
+	err := common.Tick.Where("Code=? AND Time>=? AND Time<=?", protocol.AddPrefix(code), start, end).Asc("Time", "Seq").Find(&out)
+	return out, err
+}
+
+// Snapshots 区间内的快照,按时间升序,闭区间,limit大于0时只返回最后limit条
+func Snapshots(code string, start, end time.Time, limit int) ([]*Snapshot, error) {
+	session := common.Tick.Where("Code=? AND Time>=? AND Time<=?", protocol.AddPrefix(code), start, end)
+	out := []*Snapshot{}
+	if limit <= 0 {
+		err := session.Asc("Time").Find(&out)
+		return out, err
+	}
+	if err := session.Desc("Time").Limit(limit).Find(&out); err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, nil
+}
+
+// SaveTicks 保存一天的分笔成交,替换当天已有的数据
+func SaveTicks(code string, date time.Time, ts protocol.Trades) (int, error) {
+	code = protocol.AddPrefix(code)
+	start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	end := start.AddDate(0, 0, 1)
+	ls := make([]*Tick, 0, len(ts))
+	for i, v := range ts {
+		ls = append(ls, &Tick{
+			Code:   code,
+			Time:   v.Time,
+			Seq:    i,
+			Price:  v.Price,
+			Volume: v.Volume,
+			Status: v.Status,
+			Number: v.Number,
+		})
+	}
+	err := common.Tick.SessionFunc(func(session *xorm.Session) error {
+		if _, err := session.Where("Code=? AND Time>=? AND Time<?", code, start, end).Delete(new(Tick)); err != nil {
+			return err
+		}
+		for i := 0; i < len(ls); i += 500 {
+			if _, err := session.Insert(ls[i:min(i+500, len(ls))]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return len(ls), err
+}
+
+// SaveSnapshots 保存快照
+func SaveSnapshots(ls []*Snapshot) error {
+	if len(ls) == 0 {
+		return nil
+	}
+	_, err := common.Tick.Insert(ls)
+	return err
+}
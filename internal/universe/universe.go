@@ -0,0 +1,215 @@
+package universe
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+	"github.com/injoyai/trategy/internal/sector"
+)
+
+/*
+Universe 股票池,选股和全市场回测可以按名称引用
+
+按某一天的数据过滤,回测时是开始日期前最后一个交易日,不会用到之后的数据
+ST按当前的股票名称判断,没有历史名称
+*/
+type Universe struct {
+	Name             string    `xorm:"pk" json:"name"`
+	Types            []string  `xorm:"json" json:"types"`           //品种,默认stock
+	Boards           []string  `xorm:"json" json:"boards"`          //只选这些交易板块,可选main,gem,star,bj,空不限制
+	Sectors          []string  `xorm:"json" json:"sectors"`         //只选这些板块或指数的成分股,需要先导入板块
+	ExcludeSectors   []string  `xorm:"json" json:"exclude_sectors"` //排除这些板块的成分股
+	ExcludeST        bool      `json:"exclude_st"`                  //排除ST,*ST和退市整理
+	ExcludeSuspended bool      `json:"exclude_suspended"`           //排除当天停牌
+	MinListDays      int       `json:"min_list_days"`               //最少上市交易日数量,0不限制
+	MinAmount        float64   `json:"min_amount"`                  //最低日均成交额,元,0不限制
+	AmountDays       int       `json:"amount_days"`                 //计算日均成交额的交易日数量,默认20
+	Memo             string    `json:"memo"`
+	Updated          time.Time `xorm:"updated" json:"updated"`
+}
+
+// Sync 同步股票池的数据表
+func Sync() error {
+	return common.DB.Sync2(new(Universe))
+}
+
+// List 保存的股票池,按名称排序
+func List() ([]*Universe, error) {
+	out := []*Universe{}
+	err := common.DB.Asc("Name").Find(&out)
+	return out, err
+}
+
+// Get 按名称获取股票池
+func Get(name string) (*Universe, error) {
+	u := new(Universe)
+	has, err := common.DB.Where("Name=?", name).Get(u)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, fmt.Errorf("股票池[%s]不存在", name)
+	}
+	return u, nil
+}
+
+// Save 校验并保存股票池,已存在的覆盖
+func Save(u *Universe) error {
+	if err := u.Check(); err != nil {
+		return err
+	}
+	has, err := common.DB.Where("Name=?", u.Name).Exist(new(Universe))
+	if err != nil {
+		return err
+	}
+	if has {
+		_, err = common.DB.Where("Name=?", u.Name).AllCols().Update(u)
+	} else {
+		_, err = common.DB.Insert(u)
+	}
+	return err
+}
+
+// Del 删除股票池
+func Del(names ...string) error {
+	_, err := common.DB.In("Name", names).Delete(new(Universe))
+	return err
+}
+
+// Codes 按名称获取股票池在t时的代码
+func Codes(s data.Source, name string, t time.Time) ([]string, error) {
+	u, err := Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return u.Codes(s, t)
+}
+
+// Check 校验股票池的定义
+func (this *Universe) Check() error {
+	if this.Name == "" {
+		return errors.New("缺少股票池名称")
+	}
+	for _, v := range this.Types {
+		if !slices.Contains(data.Types, v) {
+			return fmt.Errorf("股票池[%s]的品种[%s]无效,可选%v", this.Name, v, data.Types)
+		}
+	}
+	for _, v := range this.Boards {
+		if !slices.Contains(data.Boards, v) {
+			return fmt.Errorf("股票池[%s]的交易板块[%s]无效,可选%v", this.Name, v, data.Boards)
+		}
+	}
+	if this.MinListDays < 0 || this.MinAmount < 0 || this.AmountDays < 0 {
+		return fmt.Errorf("股票池[%s]的过滤条件不能为负数", this.Name)
+	}
+	return nil
+}
+
+func (this *Universe) amountDays() int {
+	if this.AmountDays <= 0 {
+		return 20
+	}
+	return this.AmountDays
+}
+
+// Codes 按t之前最后一个收盘日的数据过滤,返回排序后的代码
+func (this *Universe) Codes(s data.Source, t time.Time) ([]string, error) {
+	types := this.Types
+	if len(types) == 0 {
+		types = []string{data.TypeStock}
+	}
+	codes := []string(nil)
+	if len(this.Sectors) == 0 {
+		codes = s.GetCodes(types...)
+	} else {
+		has := map[string]bool{}
+		for _, name := range this.Sectors {
+			ls, err := sector.Members(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, code := range ls {
+				if !has[code] && data.IsType(code, types...) {
+					has[code] = true
+					codes = append(codes, code)
+				}
+			}
+		}
+	}
+	exclude := map[string]bool{}
+	for _, name := range this.ExcludeSectors {
+		ls, err := sector.Members(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range ls {
+			exclude[code] = true
+		}
+	}
+
+	//数据截止的交易日
+	last := common.Calendar.LastClose(t)
+	day := time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.Local)
+	//按交易日估算需要的K线,多取一些覆盖节假日
+	need := max(this.MinListDays, this.amountDays())
+	start := day.AddDate(0, 0, -need*3/2-30)
+	//日线的时间是当天15:00,查询区间不包含结束时间,取到第二天零点
+	end := day.AddDate(0, 0, 1)
+	needKlines := this.ExcludeSuspended || this.MinListDays > 0 || this.MinAmount > 0
+
+	out := []string(nil)
+	for _, code := range codes {
+		if exclude[code] {
+			continue
+		}
+		if len(this.Boards) > 0 && !slices.Contains(this.Boards, data.BoardOf(code)) {
+			continue
+		}
+		if this.ExcludeST && IsST(s.GetName(code)) {
+			continue
+		}
+		if !needKlines {
+			out = append(out, code)
+			continue
+		}
+		ks, err := s.GetDayKlines(code, start, end)
+		if err != nil {
+			return nil, err
+		}
+		if len(ks) == 0 {
+			//区间内没有数据,未上市或者长期停牌
+			continue
+		}
+		k := ks[len(ks)-1]
+		if this.ExcludeSuspended && (k.Time.Before(day) || k.Volume == 0) {
+			continue
+		}
+		if this.MinListDays > 0 && common.Calendar.Count(ks[0].Time, day) < this.MinListDays {
+			continue
+		}
+		if this.MinAmount > 0 {
+			n := min(this.amountDays(), len(ks))
+			total := 0.
+			for _, v := range ks[len(ks)-n:] {
+				total += v.Amount.Float64()
+			}
+			if total/float64(n) < this.MinAmount {
+				continue
+			}
+		}
+		out = append(out, code)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// IsST 按名称判断是否是ST,*ST或者退市整理的股票
+func IsST(name string) bool {
+	return data.IsST(name)
+}
@@ -0,0 +1,100 @@
+package universe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/injoyai/tdx/protocol"
+	"github.com/injoyai/trategy/internal/calendar"
+	"github.com/injoyai/trategy/internal/common"
+	"github.com/injoyai/trategy/internal/data"
+)
+
+// source 日线按TDX的格式打在15:00,查询区间和数据源一样不包含结束时间
+type source struct {
+	data.Source
+	klines map[string]protocol.Klines
+}
+
+func (this *source) GetCodes(types ...string) []string {
+	out := []string(nil)
+	for code := range this.klines {
+		out = append(out, code)
+	}
+	return out
+}
+
+func (this *source) GetName(code string) string { return "" }
+
+func (this *source) GetDayKlines(code string, start, end time.Time) (protocol.Klines, error) {
+	out := protocol.Klines(nil)
+	for _, k := range this.klines[code] {
+		if k.Time.After(start) && k.Time.Before(end) {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+// bars 从start开始每个工作日一根,成交额为amount元
+func bars(start, end time.Time, amount float64) protocol.Klines {
+	out := protocol.Klines(nil)
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+			continue
+		}
+		out = append(out, &protocol.Kline{
+			Time:   time.Date(d.Year(), d.Month(), d.Day(), 15, 0, 0, 0, time.Local),
+			Close:  protocol.Yuan(10),
+			Volume: 100,
+			Amount: protocol.Yuan(amount),
+		})
+	}
+	return out
+}
+
+func TestCodes(t *testing.T) {
+	common.Calendar = new(calendar.Calendar) //没有交易日时按工作日计算
+	//2024-06-14是周五,按周五收盘后的数据过滤
+	day := time.Date(2024, 6, 14, 0, 0, 0, 0, time.Local)
+	now := day.Add(16 * time.Hour)
+	s := &source{klines: map[string]protocol.Klines{
+		"sh600000": bars(day.AddDate(-1, 0, 0), day, 2e8),                   //正常
+		"sh600001": bars(day.AddDate(-1, 0, 0), day.AddDate(0, 0, -1), 2e8), //周五停牌
+		"sh600002": bars(day.AddDate(0, 0, -10), day, 2e8),                  //新股
+		"sh600003": append(bars(day.AddDate(-1, 0, 0), day.AddDate(0, 0, -1), 1e6), bars(day, day, 1e10)...),
+	}}
+
+	cases := []struct {
+		name string
+		u    *Universe
+		want []string
+	}{
+		{"停牌", &Universe{ExcludeSuspended: true}, []string{"sh600000", "sh600002", "sh600003"}},
+		{"上市天数", &Universe{MinListDays: 60}, []string{"sh600000", "sh600001", "sh600003"}},
+		//最后一根的成交额需要计入,否则sh600003的日均成交额达不到
+		{"成交额", &Universe{MinAmount: 1e8, AmountDays: 20}, []string{"sh600000", "sh600001", "sh600002", "sh600003"}},
+	}
+	for _, c := range cases {
+		got, err := c.u.Codes(s, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(c.want) {
+			t.Fatalf("%s: 得到%v,期望%v", c.name, got, c.want)
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Fatalf("%s: 得到%v,期望%v", c.name, got, c.want)
+			}
+		}
+	}
+}
+
+func TestIsST(t *testing.T) {
+	for name, want := range map[string]bool{"*ST海润": true, "ST大集": true, "平安银行": false, "退市海润": true, "海润退": true} {
+		if IsST(name) != want {
+			t.Errorf("%s: 期望%v", name, want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+import React, { useEffect, useState } from 'react'
+import ReactECharts from 'echarts-for-react'
+import { Button, Card, Input, Popconfirm, Select, Space, Table, Tag, message } from 'antd'
+import dayjs from 'dayjs'
+import { BacktestHistory, backtestReportURL, compareBacktests, deleteBacktestHistory, getBacktestHistory, setBacktestHistoryTags } from '../lib/api'
+
+const metricNames: Record<string, string> = {
+  return: '收益',
+  max_drawdown: '最大回撤',
+  sharpe: 'Sharpe',
+  trades: '交易次数',
+  bars: 'K线数量',
+}
+
+export default function HistoryPanel({ refresh }: { refresh?: number }) {
+  const [list, setList] = useState<BacktestHistory[]>([])
+  const [loading, setLoading] = useState(false)
+  const [selected, setSelected] = useState<number[]>([])
+  const [strategy, setStrategy] = useState<string>()
+  const [tag, setTag] = useState<string>()
+  const [compare, setCompare] = useState<Awaited<ReturnType<typeof compareBacktests>>>()
+
+  async function load() {
+    setLoading(true)
+    try {
+      setList(await getBacktestHistory({ strategy, tag, limit: 200 }))
+    } catch (e: any) {
+      message.error(e?.message || '获取回测记录失败')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  useEffect(() => { load() }, [refresh, strategy, tag])
+
+  async function onCompare() {
+    try {
+      setCompare(await compareBacktests(selected))
+    } catch (e: any) {
+      message.error(e?.message || '对比失败')
+    }
+  }
+
+  async function onTags(id: number, tags: string[]) {
+    try {
+      await setBacktestHistoryTags(id, tags)
+      setList(prev => prev.map(it => (it.id === id ? { ...it, tags } : it)))
+    } catch (e: any) {
+      message.error(e?.message || '设置标签失败')
+    }
+  }
+
+  async function onDelete(id: number) {
+    try {
+      await deleteBacktestHistory(id)
+      setSelected(prev => prev.filter(v => v !== id))
+      await load()
+    } catch (e: any) {
+      message.error(e?.message || '删除失败')
+    }
+  }
+
+  const label = (r: BacktestHistory) => `#${r.id} ${r.strategy} ${r.code || '全市场'}`
+
+  return (
+    <Card title="回测记录">
+      <Space style={{ marginBottom: 12 }} wrap>
+        <Input.Search size="small" placeholder="策略" allowClear onSearch={v => setStrategy(v || undefined)} style={{ width: 160 }} />
+        <Input.Search size="small" placeholder="标签" allowClear onSearch={v => setTag(v || undefined)} style={{ width: 160 }} />
+        <Button size="small" onClick={load}>刷新</Button>
+        <Button size="small" type="primary" disabled={selected.length < 2} onClick={onCompare}>对比({selected.length})</Button>
+      </Space>
+      <Table
+        size="small"
+        rowKey="id"
+        loading={loading}
+        dataSource={list}
+        pagination={{ pageSize: 8 }}
+        rowSelection={{
+          selectedRowKeys: selected,
+          onChange: keys => setSelected(keys.map(Number)),
+          getCheckboxProps: r => ({ disabled: r.kind !== 'single' }),
+        }}
+        columns={[
+          { title: 'ID', dataIndex: 'id' },
+          { title: '策略', dataIndex: 'strategy' },
+          { title: '标的', dataIndex: 'code', render: (v: string) => v || <Tag>全市场</Tag> },
+          { title: '数据区间', render: (_: any, r: BacktestHistory) => `${dayjs(r.data_start).format('YYYY-MM-DD')} ~ ${dayjs(r.data_end).format('YYYY-MM-DD')}` },
+          { title: '收益', dataIndex: 'return', render: (v: number) => `${(v * 100).toFixed(2)}%` },
+          { title: '回撤', dataIndex: 'max_drawdown', render: (v: number) => `${(v * 100).toFixed(2)}%` },
+          { title: 'Sharpe', dataIndex: 'sharpe', render: (v: number) => v.toFixed(2) },
+          { title: '标签', dataIndex: 'tags', render: (v: string[], r: BacktestHistory) => (
+            <Select size="small" mode="tags" value={v} style={{ minWidth: 120 }} onChange={tags => onTags(r.id, tags)} />
+          ) },
+          { title: '时间', dataIndex: 'created', render: (v: string) => dayjs(v).format('MM-DD HH:mm') },
+          { title: '操作', render: (_: any, r: BacktestHistory) => (
+            <Space size={0}>
+              {r.kind === 'single' && <Button size="small" type="link" href={backtestReportURL(r.id)} target="_blank">报告</Button>}
+              {r.kind === 'single' && <Button size="small" type="link" href={backtestReportURL(r.id, 'trades')}>交易</Button>}
+              {r.kind === 'single' && <Button size="small" type="link" href={backtestReportURL(r.id, 'equity')}>权益</Button>}
+              <Button size="small" type="link" href={backtestReportURL(r.id, 'json')}>JSON</Button>
+              <Popconfirm title="删除该回测记录?" onConfirm={() => onDelete(r.id)}>
+                <Button size="small" type="link" danger>删除</Button>
+              </Popconfirm>
+            </Space>
+          ) },
+        ]}
+      />
+      {compare && (
+        <>
+          <ReactECharts style={{ height: 360 }} option={{
+            tooltip: { trigger: 'axis' },
+            legend: {},
+            xAxis: { type: 'category', data: compare.dates },
+            yAxis: { type: 'value', scale: true, name: '净值' },
+            dataZoom: [{ type: 'inside' }, { type: 'slider' }],
+            series: compare.runs.map((r, i) => ({ type: 'line', name: label(r), data: compare.equity[i], showSymbol: false })),
+          }} />
+          <Table
+            size="small"
+            rowKey="name"
+            pagination={false}
+            dataSource={compare.metrics}
+            columns={[
+              { title: '指标', dataIndex: 'name', render: (v: string) => metricNames[v] || v },
+              ...compare.runs.map((r, i) => ({
+                title: label(r),
+                render: (_: any, m: { name: string, values: number[] }) =>
+                  ['return', 'max_drawdown'].includes(m.name) ? `${(m.values[i] * 100).toFixed(2)}%` :
+                  m.name === 'sharpe' ? m.values[i].toFixed(2) : m.values[i],
+              })),
+            ]}
+          />
+        </>
+      )}
+    </Card>
+  )
+}
@@ -2,7 +2,7 @@ import React from 'react'
 import ReactECharts from 'echarts-for-react'
 import dayjs from 'dayjs'
 
-export default function PriceChart({ candles, trades, equity, showBuy = true, showSell = true, showReturns = true, enableZoom = false, defaultWindowCount, showBollinger = false, showVolume = false }: { candles: { Time: string, Open: number, High: number, Low: number, Close: number, Volume?: number, Amount?: number }[], trades?: { index: number, side: string }[], equity?: number[], showBuy?: boolean, showSell?: boolean, showReturns?: boolean, enableZoom?: boolean, defaultWindowCount?: number, showBollinger?: boolean, showVolume?: boolean }) {
+export default function PriceChart({ candles, trades, equity, showBuy = true, showSell = true, showReturns = true, enableZoom = false, defaultWindowCount, showBollinger = false, showVolume = false, overlays }: { candles: { Time: string, Open: number, High: number, Low: number, Close: number, Volume?: number, Amount?: number }[], trades?: { index: number, side: string }[], equity?: number[], showBuy?: boolean, showSell?: boolean, showReturns?: boolean, enableZoom?: boolean, defaultWindowCount?: number, showBollinger?: boolean, showVolume?: boolean, overlays?: Record<string, number[]> }) {
   if (!candles || candles.length === 0) return null
   const x = candles.map(c => dayjs(c.Time).format('YY-MM-DD'))
   const ohlc = candles.map(c => [c.Open, c.Close, c.Low, c.High])
@@ -88,6 +88,8 @@ export default function PriceChart({ candles, trades, equity, showBuy = true, sh
     buyPts.length && showBuy ? { type: 'scatter', name: '买入', data: buyPts, symbol: 'triangle' } as any : undefined,
     sellPts.length && showSell ? { type: 'scatter', name: '卖出', data: sellPts, symbol: 'triangle', symbolRotate: 180 } as any : undefined,
     showVolume ? { type: 'bar', name: '成交量', data: volumeSeriesData, xAxisIndex: 1, yAxisIndex: 2 } as any : undefined,
+    // 脚本策略的调试序列，0 表示未设置
+    ...Object.entries(overlays || {}).map(([name, vs]) => ({ type: 'line', name, data: vs.map(v => (v === 0 ? null : v)), smooth: true, showSymbol: false, connectNulls: false }) as any),
   ].filter(Boolean) as any[]
   const startIdx = defaultWindowCount ? Math.max(0, x.length - defaultWindowCount) : 0
   const option = {
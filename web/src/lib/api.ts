@@ -88,6 +88,7 @@ export async function backtest(req: {
   slippage?: number
   stop_loss?: number
   take_profit?: number
+  debug?: boolean
 }) {
   const payload: any = {
     strategy: req.strategy,
@@ -105,6 +106,7 @@ export async function backtest(req: {
     minFee: req.min_fee,
     stopLoss: req.stop_loss,
     takeProfit: req.take_profit,
+    debug: req.debug,
   }
   const { data } = await api.post('/backtest', payload)
   const resp = unwrap(data)
@@ -121,6 +123,7 @@ export async function backtest(req: {
   const ret = resp.return ?? resp.ret ?? resp.total_return ?? 0
   const max_drawdown = resp.max_drawdown ?? resp.maxDD ?? resp.MaxDD ?? resp.drawdown ?? 0
   const sharpe = resp.sharpe ?? resp.Sharpe ?? 0
+  const debug = resp.debug as { logs: string[], series: Record<string, number[]> } | undefined
   return resp as {
     equity: typeof eq
     cash: typeof cash
@@ -129,6 +132,7 @@ export async function backtest(req: {
     return: typeof ret
     max_drawdown: typeof max_drawdown
     sharpe: typeof sharpe
+    debug: typeof debug
   }
 }
 
@@ -289,3 +293,56 @@ export async function getKlines(params: { code: string, start?: string, end?: st
     }
   }) as { Time: string, Open: number, High: number, Low: number, Close: number, Volume: number, Amount?: number, Symbol: string }[]
 }
+
+export type BacktestHistory = {
+  id: number
+  kind: string
+  strategy: string
+  version: number
+  code: string
+  return: number
+  max_drawdown: number
+  sharpe: number
+  trades: number
+  tags: string[]
+  data_start: string
+  data_end: string
+  created: string
+}
+
+export async function getBacktestHistory(params: { kind?: string, strategy?: string, code?: string, tag?: string, limit?: number, offset?: number } = {}) {
+  const { data } = await api.get('/backtest/history', { params })
+  const body = unwrap(data)
+  const arr = Array.isArray(body) ? body : []
+  return arr.map((it: any) => ({ ...it, tags: it.tags || [] })) as BacktestHistory[]
+}
+
+export async function getBacktestHistoryDetail(id: number) {
+  const { data } = await api.get('/backtest/history/detail', { params: { id } })
+  return unwrap(data)
+}
+
+export async function setBacktestHistoryTags(id: number, tags: string[]) {
+  const { data } = await api.put('/backtest/history/tags', { id, tags })
+  unwrap(data)
+}
+
+export async function deleteBacktestHistory(id: number) {
+  const { data } = await api.delete('/backtest/history', { params: { id } })
+  unwrap(data)
+}
+
+export async function compareBacktests(ids: number[]) {
+  const { data } = await api.post('/backtest/compare', { ids })
+  const body = unwrap(data)
+  return {
+    dates: body.dates || [],
+    runs: (body.runs || []) as BacktestHistory[],
+    equity: (body.equity || []) as (number | null)[][],
+    metrics: (body.metrics || []) as { name: string, values: number[] }[],
+  }
+}
+
+export function backtestReportURL(id: number, format: 'html' | 'json' | 'trades' | 'equity' = 'html') {
+  return `${api.defaults.baseURL}/backtest/${id}/report?format=${format}`
+}
@@ -2,6 +2,7 @@ import React, { useEffect, useState } from 'react'
 import { Card, Form, Select, DatePicker, InputNumber, Button, Space, Statistic, Row, Col, message, Table, Checkbox, Tabs } from 'antd'
 import dayjs from 'dayjs'
 import PriceChart from '../components/PriceChart'
+import HistoryPanel from '../components/HistoryPanel'
 import { getStrategies, getCodes, backtest, grid, getKlines, backtestAll, backtestAllWS } from '../lib/api'
 import { useRef } from 'react'
 
@@ -15,6 +16,9 @@ export default function BacktestPage() {
   const [candles, setCandles] = useState<any[]>([])
   const [metrics, setMetrics] = useState<{ret?: number, dd?: number, sharpe?: number}>({})
   const [trades, setTrades] = useState<{ index: number, side: string, price: number }[]>([])
+  const [debugSeries, setDebugSeries] = useState<Record<string, number[]>>({})
+  const [debugLogs, setDebugLogs] = useState<string[]>([])
+  const [historyRefresh, setHistoryRefresh] = useState(0)
   const [gridData, setGridData] = useState<{ fast: number, slow: number, return: number, sharpe: number, max_drawdown: number }[]>([])
   const [form] = Form.useForm()
   const [screenList, setScreenList] = useState<{ code: string, name: string, return: number, max_drawdown: number, sharpe: number }[]>([])
@@ -81,6 +85,7 @@ export default function BacktestPage() {
             })
           } else if (msg.type === 'summary') {
             setMetrics({ ret: msg.avg_return, dd: msg.avg_max_drawdown, sharpe: msg.avg_sharpe })
+            setHistoryRefresh(n => n + 1)
             setLoading(false)
             try { ws.close() } catch {}
             wsRef.current = null
@@ -116,8 +121,12 @@ export default function BacktestPage() {
         slippage: v.slippage,
         stop_loss: v.stop_loss,
         take_profit: v.take_profit,
+        debug: true,
       })
       setEquity(res.equity)
+      setDebugSeries(res.debug?.series || {})
+      setDebugLogs(res.debug?.logs || [])
+      setHistoryRefresh(n => n + 1)
       setCash(res.cash)
       setMetrics({ ret: res.return, dd: res.max_drawdown, sharpe: res.sharpe })
       setTrades(res.trades.map((t: any) => ({ index: t.index, side: t.side, price: t.price })))
@@ -393,15 +402,21 @@ export default function BacktestPage() {
               <Checkbox checked={showSell} onChange={e => setShowSell(e.target.checked)}>卖点</Checkbox>
               <Checkbox checked={showReturns} onChange={e => setShowReturns(e.target.checked)}>收益</Checkbox>
             </Space>
-            <PriceChart candles={candles} trades={trades} equity={equity} showBuy={showBuy} showSell={showSell} showReturns={showReturns} />
+            <PriceChart candles={candles} trades={trades} equity={equity} showBuy={showBuy} showSell={showSell} showReturns={showReturns} overlays={debugSeries} />
             <Row gutter={24} style={{ marginTop: 12 }}>
               <Col span={8}><Statistic title="累计收益" value={metrics.ret ? metrics.ret * 100 : 0} suffix="%" precision={2} /></Col>
               <Col span={8}><Statistic title="最大回撤" value={metrics.dd ? metrics.dd * 100 : 0} suffix="%" precision={2} /></Col>
               <Col span={8}><Statistic title="Sharpe" value={metrics.sharpe || 0} precision={2} /></Col>
             </Row>
+            {debugLogs.length > 0 && (
+              <Card size="small" title="脚本日志" style={{ marginTop: 12 }}>
+                <pre style={{ maxHeight: 200, overflow: 'auto', margin: 0 }}>{debugLogs.join('\n')}</pre>
+              </Card>
+            )}
           </Card>
         </Col>
       </Row>
+      <HistoryPanel refresh={historyRefresh} />
       <Card title="SMA 网格结果">
         <Row gutter={[12,12]}>
           {gridData.map((g, i) => (